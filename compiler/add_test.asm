@@ -0,0 +1,4 @@
+# tests for add.asm, run with `bcc test`
+
+#: out    42 ...
+#: expect A=42 X=14
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/project"
+
+	"github.com/bdlm/log/v2"
+)
+
+// buildCmd assembles a program into a ROM image. The image is written to
+// src.asm.img unless -o is given; "-" reads the source from stdin and, without
+// -o, writes the image to stdout. Without a source file it builds the targets
+// of the bcc.toml project manifest.
+//
+//	bcc build [flags] [src.asm]
+func buildCmd(flags *flag.FlagSet) func(args []string) {
+	manifest := flags.String("project", project.File, "project manifest, used when no source file is given")
+	targets := flags.String("target", "", "comma separated project targets to build (default all)")
+	destFile := flags.String("o", "", "output file, '-' for stdout (default src.img or src.hex, stdout for stdin)")
+	stackSize := flags.Int("stack", bcc.StackDepth, "hardware stack depth")
+	optimize := flags.Bool("O", false, "remove unused subroutines, inline and apply peephole optimizations")
+	inlineSize := flags.Int("inline-size", 0, "with -O, inline subroutines of at most this many bytes at every call site")
+	inlineBudget := flags.Int("inline-budget", 0, "with -O, bytes the program may grow by inlining")
+	inlineRuns := flags.Int("inline-runs", 0, "with -O, only inline at every call site when the sites run at least this many times")
+	format := flags.String("format", string(bcc.FORMAT_BIN), "image format, bin or ihex")
+	includes := listFlag{}
+	flags.Var(&includes, "I", "directory searched for included files, may be repeated")
+	debugInfo := flags.Bool("dbg", true, "write debug info next to the image, dest.dbg")
+	meta := metaFlag(flags)
+	defines := defineFlag{}
+	flags.Var(&defines, "D", "set a constant, $name=value, may be repeated")
+
+	return func(args []string) {
+		if 0 == len(args) {
+			buildProject(*manifest, *targets)
+			return
+		}
+		sourceFile := args[0]
+		dest := *destFile
+		if "" == dest {
+			dest = defaultImage(sourceFile, bcc.OutputFormat(*format))
+		}
+
+		logger := log.WithFields(log.Fields{"src": sourceFile, "dest": dest})
+		target := bcc.DefaultTarget()
+		target.StackDepth = *stackSize
+		opts := []bcc.Option{
+			bcc.WithTarget(target),
+			bcc.WithFormat(bcc.OutputFormat(*format)),
+			bcc.WithIncludePaths(includes...),
+			bcc.WithMetadata(bcc.META_EMBED == *meta),
+		}
+		switch *meta {
+		case bcc.META_EMBED, bcc.META_SIDECAR, bcc.META_NONE:
+		default:
+			fmt.Fprintf(os.Stderr, "bcc build: invalid -meta '%s', expected embed, sidecar or none\n", *meta)
+			os.Exit(EXIT_USAGE)
+		}
+		for name, value := range defines {
+			opts = append(opts, bcc.WithDefine(name, value))
+		}
+		if *optimize {
+			opts = append(opts,
+				bcc.WithOptimization(bcc.OPT_INLINE),
+				bcc.WithInline(bcc.InlineConfig{MaxSize: *inlineSize, Budget: *inlineBudget, MinRuns: *inlineRuns}),
+			)
+		}
+
+		// "-" reads the source from stdin
+		src := os.Stdin
+		if "-" != sourceFile {
+			opts = append(opts, bcc.WithSourceName(sourceFile))
+			f, err := os.Open(sourceFile)
+			if nil != err {
+				fatal(EXIT_IO, logger, err, "failed to read source file")
+			}
+			defer f.Close()
+			src = f
+		}
+
+		logger.Debug("assembling program")
+		prog, err := bcc.NewAssembler(opts...).Assemble(context.Background(), src)
+		if nil != prog {
+			for _, diag := range prog.Diagnostics {
+				logger.WithField("rule", diag.Rule).Warn(diag.String())
+			}
+		}
+		if nil != err {
+			fatal(EXIT_SOURCE, logger, err, "failed to assemble program")
+		}
+		if 0 < len(prog.Rewrites) {
+			saved := 0
+			for _, rw := range prog.Rewrites {
+				saved += rw.Bytes
+				logger.WithField("rule", rw.Rule).Info(rw.String())
+			}
+			logger.Infof("optimizations saved %d bytes", saved)
+		}
+
+		// "-" writes the image to stdout
+		logger.Debug("writing dest image")
+		if "-" == dest {
+			_, err = os.Stdout.Write(prog.Output)
+		} else {
+			err = ioutil.WriteFile(dest, prog.Output, 0644)
+		}
+		if nil != err {
+			fatal(EXIT_IO, logger, err, "failed to write ROM image")
+		}
+
+		if bcc.META_SIDECAR == *meta && "-" != dest {
+			err = prog.Meta.WriteSidecar(dest)
+			if nil != err {
+				fatal(EXIT_IO, logger, err, "failed to write image metadata")
+			}
+		}
+
+		if *debugInfo && "-" != dest {
+			dbgFile, err := os.Create(dest + bcc.DebugExt)
+			if nil == err {
+				_, err = prog.DebugInfo(sourceFile).WriteTo(dbgFile)
+				dbgFile.Close()
+			}
+			if nil != err {
+				fatal(EXIT_IO, logger, err, "failed to write debug info")
+			}
+		}
+
+		logger.WithField("bytes", prog.Size).Info("success")
+	}
+}
+
+// buildProject builds the targets of a project manifest.
+func buildProject(manifest, targets string) {
+	logger := log.WithFields(log.Fields{"project": manifest})
+	proj, err := project.Load(manifest)
+	if nil != err {
+		if os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "bcc build: no source file given and no %s found\n", manifest)
+			os.Exit(EXIT_USAGE)
+		}
+		fatal(EXIT_IO, logger, err, "failed to read project manifest")
+	}
+
+	names := []string{}
+	for _, name := range strings.Split(targets, ",") {
+		if "" != strings.TrimSpace(name) {
+			names = append(names, strings.TrimSpace(name))
+		}
+	}
+	for _, name := range names {
+		if _, ok := proj.Target(name); !ok {
+			fmt.Fprintf(os.Stderr, "bcc build: %s has no target '%s'\n", manifest, name)
+			os.Exit(EXIT_USAGE)
+		}
+	}
+	results, err := proj.Build(context.Background(), names...)
+	if nil != err {
+		fatal(EXIT_IO, logger, err, "failed to build project")
+	}
+
+	failed := false
+	for _, res := range results {
+		logger := logger.WithFields(log.Fields{"target": res.Target.Name, "src": res.Source})
+		if nil != res.Program {
+			for _, diag := range res.Program.Diagnostics {
+				logger.WithField("rule", diag.Rule).Warn(diag.String())
+			}
+		}
+		if nil != res.Err {
+			failed = true
+			logger.WithError(res.Err).Error("failed to build")
+			continue
+		}
+		for _, file := range res.Files {
+			logger.WithField("bytes", res.Program.Size).Info("wrote " + file)
+		}
+	}
+	if failed {
+		os.Exit(EXIT_SOURCE)
+	}
+}
+
+// defaultImage names the image built from a source file: the source name with
+// .img, or .hex for Intel HEX, appended. Stdin builds go to stdout.
+func defaultImage(sourceFile string, format bcc.OutputFormat) string {
+	if "-" == sourceFile {
+		return "-"
+	}
+	if bcc.FORMAT_IHEX == format {
+		return sourceFile + ".hex"
+	}
+	return sourceFile + ".img"
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// completionCmd prints a shell completion script for the command and flag
+// tables. Load it with e.g.
+//
+//	source <(bcc completion bash)
+//	bcc completion fish > ~/.config/fish/completions/bcc.fish
+func completionCmd(flags *flag.FlagSet) func(args []string) {
+	return func(args []string) {
+		switch args[0] {
+		case "bash":
+			fmt.Print(bashCompletion())
+		case "zsh":
+			// zsh loads bash completion functions through bashcompinit
+			fmt.Print("autoload -U +X bashcompinit && bashcompinit\n" + bashCompletion())
+		case "fish":
+			fmt.Print(fishCompletion())
+		default:
+			fmt.Fprintf(os.Stderr, "bcc: unsupported shell '%s', expected bash, zsh or fish\n", args[0])
+			os.Exit(EXIT_USAGE)
+		}
+	}
+}
+
+// commandFlags returns the flags of a command.
+func commandFlags(cmd *command) []*flag.Flag {
+	flags, _ := cmd.newFlags()
+	list := []*flag.Flag{}
+	flags.VisitAll(func(f *flag.Flag) {
+		list = append(list, f)
+	})
+	return list
+}
+
+// bashCompletion completes command names, then the flags of the command
+// when the word starts with '-', and file names otherwise.
+func bashCompletion() string {
+	names := []string{}
+	cases := ""
+	for _, cmd := range commands {
+		names = append(names, cmd.name)
+		opts := []string{}
+		for _, f := range commandFlags(cmd) {
+			opts = append(opts, "-"+f.Name)
+		}
+		cases = cases + fmt.Sprintf("        %s) opts=%q ;;\n", cmd.name, strings.Join(opts, " "))
+	}
+
+	return fmt.Sprintf(`_bcc() {
+    local cur cmd opts k
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    cmd=""
+    for ((k = 1; k < COMP_CWORD; k++)); do
+        case "${COMP_WORDS[k]}" in
+            -*) ;;
+            *) cmd="${COMP_WORDS[k]}"; break ;;
+        esac
+    done
+    if [ -z "$cmd" ]; then
+        COMPREPLY=($(compgen -W "%s -v -q -log" -- "$cur"))
+        return
+    fi
+    case "$cmd" in
+%s        *) opts="" ;;
+    esac
+    if [[ "$cur" == -* ]]; then
+        COMPREPLY=($(compgen -W "$opts" -- "$cur"))
+    else
+        COMPREPLY=($(compgen -f -- "$cur"))
+    fi
+}
+complete -o filenames -F _bcc bcc
+`, strings.Join(names, " "), cases)
+}
+
+// fishCompletion completes command names with their summaries, and the flags
+// of each command with their usage.
+func fishCompletion() string {
+	s := "complete -c bcc -f -n __fish_use_subcommand -o v -d 'log progress'\n"
+	s = s + "complete -c bcc -f -n __fish_use_subcommand -o q -d 'only log errors'\n"
+	s = s + "complete -c bcc -x -n __fish_use_subcommand -o log -a 'debug info warn error' -d 'log level'\n"
+	for _, cmd := range commands {
+		s = s + fmt.Sprintf("complete -c bcc -f -n __fish_use_subcommand -a %s -d %s\n", cmd.name, fishQuote(cmd.summary))
+	}
+	for _, cmd := range commands {
+		for _, f := range commandFlags(cmd) {
+			s = s + fmt.Sprintf("complete -c bcc -n '__fish_seen_subcommand_from %s' -o %s -d %s\n",
+				cmd.name, f.Name, fishQuote(f.Usage))
+		}
+	}
+	return s
+}
+
+// fishQuote quotes a string for fish.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/emu"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/ucode"
+
+	"github.com/bdlm/errors/v2"
+	"github.com/bdlm/log/v2"
+)
+
+// debugHelp lists the debugger commands.
+const debugHelp = `commands:
+  s, step [n]       execute n instructions (default 1)
+  t, tick [n]       execute n clock pulses (default 1)
+  c, continue       run to a breakpoint, HLT or the cycle limit
+  b, break [where]  set a breakpoint at an address (0x06), label, line or
+                    file:line; list breakpoints without an argument
+  d, delete where   remove a breakpoint
+  r, regs           print every register
+  l, list           disassemble around the program counter
+  reset             reset the machine
+  q, quit           exit
+An empty line repeats the last command.
+`
+
+// debugCmd steps through a ROM image interactively, reading commands from
+// stdin.
+//
+//	bcc debug [flags] prog.img
+func debugCmd(flags *flag.FlagSet) func(args []string) {
+	cfg := emu.DefaultConfig()
+	flags.IntVar(&cfg.StackDepth, "stack", cfg.StackDepth, "hardware stack depth")
+	cycles := flags.Uint64("cycles", 100000, "clock cycles continue may run before stopping")
+	dbgFile := flags.String("dbg", "", "debug info file (default prog.img.dbg if it exists)")
+	force := flags.Bool("force", false, "debug images built for another ISA or failing their CRC")
+	isa := isaFlag(flags)
+	breaks := listFlag{}
+	flags.Var(&breaks, "b", "set a breakpoint before starting, may be repeated")
+
+	return func(args []string) {
+		imgFile := args[0]
+		logger := log.WithFields(log.Fields{"img": imgFile})
+
+		img, err := ioutil.ReadFile(imgFile)
+		if nil != err {
+			fatal(EXIT_IO, logger, err, "failed to read program image")
+		}
+		checkImage(logger, imgFile, img, loadTarget(logger, *isa), true, *force)
+		dbg, err := loadDebugInfo(imgFile, *dbgFile, false)
+		if nil != err {
+			fatal(EXIT_IO, logger, err, "failed to read debug info")
+		}
+		if nil == dbg {
+			logger.Warn("no debug info, labels and source lines are unavailable")
+		}
+		cpu, err := emu.New(img, cfg)
+		if nil != err {
+			fatal(EXIT_EMU, logger, err, "failed to initialize emulator")
+		}
+
+		dbgr := &debugger{
+			cpu:    cpu,
+			img:    img,
+			dbg:    dbg,
+			limit:  *cycles,
+			breaks: map[int]bool{},
+			out:    os.Stdout,
+		}
+		for _, where := range breaks {
+			err = dbgr.exec("break " + where)
+			if nil != err {
+				fatal(EXIT_USAGE, logger, err, "invalid breakpoint")
+			}
+		}
+		dbgr.repl(os.Stdin)
+	}
+}
+
+// debugger is an interactive front end for the emulator.
+type debugger struct {
+	cpu    emu.CPU
+	img    []byte
+	dbg    *bcc.DebugInfo
+	limit  uint64
+	breaks map[int]bool
+	out    io.Writer
+}
+
+// errQuit ends the read loop.
+var errQuit = errors.Errorf("quit")
+
+// repl reads and executes commands until quit or end of input.
+func (dbgr *debugger) repl(in io.Reader) {
+	fmt.Fprint(dbgr.out, debugHelp)
+	dbgr.where()
+	last := ""
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(dbgr.out, "(bcc) ")
+		if !scanner.Scan() {
+			fmt.Fprintln(dbgr.out)
+			return
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if "" == line {
+			line = last
+		}
+		last = line
+		if "" == line {
+			continue
+		}
+		err := dbgr.exec(line)
+		if errQuit == err {
+			return
+		}
+		if nil != err {
+			fmt.Fprintf(dbgr.out, "error: %s\n", err)
+		}
+	}
+}
+
+// exec runs one debugger command.
+func (dbgr *debugger) exec(line string) error {
+	fields := strings.Fields(line)
+	arg := ""
+	if 1 < len(fields) {
+		arg = fields[1]
+	}
+
+	switch fields[0] {
+	case "s", "step":
+		n, err := count(arg)
+		if nil != err {
+			return err
+		}
+		for k := 0; k < n; k++ {
+			halted, err := dbgr.instruction()
+			fmt.Fprintln(dbgr.out, emu.Trace(dbgr.img, dbgr.cpu.State(), dbgr.dbg))
+			if nil != err || halted {
+				return err
+			}
+		}
+
+	case "t", "tick":
+		n, err := count(arg)
+		if nil != err {
+			return err
+		}
+		for k := 0; k < n; k++ {
+			before := dbgr.cpu.State()
+			err := dbgr.tick()
+			state := dbgr.cpu.State()
+			fmt.Fprintf(dbgr.out, "step %-2d  BUS=0x%02X  %s\n", before.Step, state.Bus, state.Signals)
+			if nil != err || state.Halted {
+				return err
+			}
+		}
+
+	case "c", "continue":
+		start := dbgr.cpu.State().Cycle
+		for {
+			halted, err := dbgr.instruction()
+			if nil != err {
+				return err
+			}
+			state := dbgr.cpu.State()
+			switch true {
+			case halted:
+				fmt.Fprintln(dbgr.out, "halted")
+			case dbgr.breaks[int(state.PC)]:
+				fmt.Fprintf(dbgr.out, "breakpoint at 0x%02X\n", state.PC)
+			case 0 != dbgr.limit && state.Cycle-start >= dbgr.limit:
+				fmt.Fprintf(dbgr.out, "stopped after %d cycles\n", state.Cycle-start)
+			default:
+				continue
+			}
+			dbgr.where()
+			return nil
+		}
+
+	case "b", "break":
+		if "" == arg {
+			addrs := []int{}
+			for addr := range dbgr.breaks {
+				addrs = append(addrs, addr)
+			}
+			sort.Ints(addrs)
+			for _, addr := range addrs {
+				fmt.Fprintf(dbgr.out, "0x%02X  %s\n", addr, dbgr.describe(addr))
+			}
+			return nil
+		}
+		addr, err := dbgr.resolve(arg)
+		if nil != err {
+			return err
+		}
+		dbgr.breaks[addr] = true
+		fmt.Fprintf(dbgr.out, "breakpoint at 0x%02X  %s\n", addr, dbgr.describe(addr))
+
+	case "d", "delete":
+		addr, err := dbgr.resolve(arg)
+		if nil != err {
+			return err
+		}
+		if !dbgr.breaks[addr] {
+			return errors.Errorf("no breakpoint at 0x%02X", addr)
+		}
+		delete(dbgr.breaks, addr)
+
+	case "r", "regs":
+		state := dbgr.cpu.State()
+		fmt.Fprintf(dbgr.out, "A=0x%02X X=0x%02X Y=0x%02X OUT=0x%02X  carry=%t zero=%t\n",
+			state.A, state.X, state.Y, state.Out, state.Carry, state.Zero)
+		fmt.Fprintf(dbgr.out, "PC=0x%02X MAR=0x%02X RAR=0x%02X IR=0x%02X step=%d  cycle=%d halted=%t\n",
+			state.PC, state.MAR, state.RAR, state.IR, state.Step, state.Cycle, state.Halted)
+		fmt.Fprintf(dbgr.out, "stack=% X\nRAM=% X\n", state.Stack, state.RAM[:])
+
+	case "l", "list":
+		pc := int(dbgr.cpu.State().PC)
+		size := bcc.ImageSize(dbgr.img)
+		if nil != dbgr.dbg {
+			size = dbgr.dbg.Size
+		}
+		insts := bcc.Disassemble(dbgr.img, size)
+		for k, inst := range insts {
+			if inst.Addr+inst.Size() <= pc-8 || inst.Addr > pc+8 {
+				continue
+			}
+			mark := "  "
+			if inst.Addr == pc {
+				mark = "=>"
+			}
+			if dbgr.breaks[inst.Addr] {
+				mark = mark[:1] + "*"
+			}
+			fmt.Fprintf(dbgr.out, "%s 0x%02X  %-12s %s\n", mark, inst.Addr, insts[k], dbgr.describe(inst.Addr))
+		}
+
+	case "reset":
+		dbgr.cpu.Reset()
+		dbgr.where()
+
+	case "q", "quit":
+		return errQuit
+
+	case "h", "help":
+		fmt.Fprint(dbgr.out, debugHelp)
+
+	default:
+		return errors.Errorf("unknown command '%s', try help", fields[0])
+	}
+	return nil
+}
+
+// tick executes one clock pulse and prints any value latched into the output
+// register.
+func (dbgr *debugger) tick() error {
+	err := dbgr.cpu.Tick()
+	if nil != err {
+		return err
+	}
+	state := dbgr.cpu.State()
+	if !state.Halted && 0 != state.Signals&ucode.OUT {
+		fmt.Fprintf(dbgr.out, "out: %d\n", state.Out)
+	}
+	return nil
+}
+
+// instruction executes clock pulses until the current instruction completes.
+// It returns whether the machine halted.
+func (dbgr *debugger) instruction() (bool, error) {
+	for {
+		err := dbgr.tick()
+		if nil != err {
+			return false, err
+		}
+		state := dbgr.cpu.State()
+		if state.Halted {
+			return true, nil
+		}
+		if 0 == state.Step {
+			return false, nil
+		}
+	}
+}
+
+// where prints the next instruction to execute.
+func (dbgr *debugger) where() {
+	pc := int(dbgr.cpu.State().PC)
+	fmt.Fprintf(dbgr.out, "=> 0x%02X  %-12s %s\n", pc, bcc.Decode(dbgr.img, pc), dbgr.describe(pc))
+}
+
+// describe returns the label and source location of an address.
+func (dbgr *debugger) describe(addr int) string {
+	if nil == dbgr.dbg {
+		return ""
+	}
+	s := ""
+	if loc, ok := dbgr.dbg.At(addr); ok {
+		s = fmt.Sprintf("%s:%d", dbgr.dbg.File(loc), loc.Line)
+	}
+	if label, ok := dbgr.dbg.Label(addr); ok {
+		s = s + " " + label
+	}
+	return strings.TrimSpace(s)
+}
+
+// resolve returns the address of a breakpoint location: an address, a label,
+// a line of the main source or file:line.
+func (dbgr *debugger) resolve(where string) (int, error) {
+	if strings.HasPrefix(where, "0x") {
+		addr, err := strconv.ParseUint(where[2:], 16, 8)
+		if nil != err {
+			return 0, errors.Errorf("invalid address '%s'", where)
+		}
+		return int(addr), nil
+	}
+	if nil == dbgr.dbg {
+		return 0, errors.Errorf("no debug info, use an address such as 0x06")
+	}
+
+	file, line := "", where
+	if k := strings.LastIndex(where, ":"); k >= 0 {
+		file, line = where[:k], where[k+1:]
+	}
+	if ln, err := strconv.Atoi(line); nil == err {
+		for _, loc := range dbgr.dbg.Lines {
+			if ln == loc.Line && ("" == file || file == dbgr.dbg.File(loc)) {
+				return loc.Addr, nil
+			}
+		}
+		return 0, errors.Errorf("no code at line %s", where)
+	}
+	for _, sym := range dbgr.dbg.Symbols {
+		if where == sym.Name && bcc.SYM_CONST != sym.Kind {
+			return sym.Value, nil
+		}
+	}
+	return 0, errors.Errorf("unknown label '%s'", where)
+}
+
+// count parses an optional repeat count.
+func count(arg string) (int, error) {
+	if "" == arg {
+		return 1, nil
+	}
+	n, err := strconv.Atoi(arg)
+	if nil != err || n < 1 {
+		return 0, errors.Errorf("invalid count '%s'", arg)
+	}
+	return n, nil
+}
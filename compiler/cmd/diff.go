@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/flash"
+
+	"github.com/bdlm/log/v2"
+)
+
+// diffCmd compares two ROM images: the program's instructions aligned so
+// inserted code does not show as everything after it changing, the byte
+// ranges that differ, and the blocks to burn to turn an EEPROM holding the
+// old image into one holding the new. It exits 1 if the images differ, as
+// diff(1).
+//
+//	bcc diff [flags] old.img new.img
+func diffCmd(flags *flag.FlagSet) func(args []string) {
+	context := flags.Int("context", 2, "unchanged instructions shown around each change")
+	noDbg := flags.Bool("no-dbg", false, "ignore debug info")
+	patchFile := flags.String("patch", "", "write the patch list for bcc flash apply to this file")
+
+	return func(args []string) {
+		oldFile, newFile := args[0], args[1]
+		logger := log.WithFields(log.Fields{"old": oldFile, "new": newFile})
+
+		imgs := [2][]byte{}
+		dbgs := [2]*bcc.DebugInfo{}
+		for k, file := range args {
+			var err error
+			imgs[k], err = ioutil.ReadFile(file)
+			if nil != err {
+				fatal(EXIT_IO, logger, err, "failed to read image")
+			}
+			dbgs[k], err = loadDebugInfo(file, "", *noDbg)
+			if nil != err {
+				fatal(EXIT_IO, logger, err, "failed to read debug info")
+			}
+		}
+		old, new := imgs[0], imgs[1]
+
+		diff := bcc.DiffImages(old, new, dbgs[0], dbgs[1])
+		ranges := flash.Ranges(old, new)
+		patches := flash.Patches(old, new)
+		if 0 == len(ranges) {
+			return
+		}
+
+		fmt.Printf("--- %s\n+++ %s\n", oldFile, newFile)
+		for _, hunk := range diff.Hunks(*context) {
+			fmt.Printf("@@ %s @@\n", hunkHeader(hunk))
+			for _, line := range hunk {
+				switch line.Op {
+				case ' ':
+					fmt.Printf("  0x%02X 0x%02X  %s\n", line.Old.Addr, line.New.Addr, line.Code)
+				case '-':
+					fmt.Printf("- 0x%02X       %s\n", line.Old.Addr, line.Code)
+				case '+':
+					fmt.Printf("+      0x%02X  %s\n", line.New.Addr, line.Code)
+				}
+			}
+		}
+		for _, move := range diff.Moves {
+			fmt.Printf("moved %s 0x%02X -> 0x%02X\n", move.Name, move.Old, move.New)
+		}
+
+		fmt.Println("changed:")
+		for _, r := range ranges {
+			unit := "bytes"
+			if 1 == r.End-r.Start {
+				unit = "byte"
+			}
+			fmt.Printf("  %-13s  %d %s\n", rangeString(r), r.End-r.Start, unit)
+		}
+		size := 0
+		for _, patch := range patches {
+			size += len(patch.Data)
+		}
+		fmt.Printf("patch: %d bytes in %d blocks, the whole image is %d blocks\n",
+			size, len(patches), len(flash.Blocks(new)))
+
+		if "" != *patchFile {
+			comment := fmt.Sprintf("bcc diff %s %s\n%d bytes in %d blocks", oldFile, newFile, size, len(patches))
+			err := ioutil.WriteFile(*patchFile, []byte(flash.FormatPatches(patches, comment)), 0644)
+			if nil != err {
+				fatal(EXIT_IO, logger, err, "failed to write patch list")
+			}
+		}
+		os.Exit(EXIT_FAIL)
+	}
+}
+
+// hunkHeader returns the old and new address a hunk starts at.
+func hunkHeader(hunk []bcc.DiffLine) string {
+	old, new := "", ""
+	for _, line := range hunk {
+		if "" == old && '+' != line.Op {
+			old = fmt.Sprintf("-0x%02X", line.Old.Addr)
+		}
+		if "" == new && '-' != line.Op {
+			new = fmt.Sprintf("+0x%02X", line.New.Addr)
+		}
+	}
+	switch true {
+	case "" == old:
+		return new
+	case "" == new:
+		return old
+	}
+	return old + " " + new
+}
+
+// rangeString formats an address range.
+func rangeString(r flash.Range) string {
+	if 1 == r.End-r.Start {
+		return fmt.Sprintf("0x%04X", r.Start)
+	}
+	return fmt.Sprintf("0x%04X-0x%04X", r.Start, r.End-1)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+
+	"github.com/bdlm/log/v2"
+)
+
+// disasmCmd disassembles a ROM image. Labels and source lines come from the
+// image's debug info when it exists; "-" reads the image from stdin.
+//
+//	bcc disasm [flags] prog.img
+func disasmCmd(flags *flag.FlagSet) func(args []string) {
+	dbgFile := flags.String("dbg", "", "debug info file (default prog.img.dbg if it exists)")
+	noDbg := flags.Bool("no-dbg", false, "ignore debug info")
+	out := flags.String("o", "", "write to a file instead of stdout")
+	isa := isaFlag(flags)
+
+	return func(args []string) {
+		imgFile := args[0]
+		logger := log.WithFields(log.Fields{"img": imgFile})
+
+		var img []byte
+		var err error
+		if "-" == imgFile {
+			img, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			img, err = ioutil.ReadFile(imgFile)
+		}
+		if nil != err {
+			fatal(EXIT_IO, logger, err, "failed to read program image")
+		}
+		// the listing is still useful for a mismatched image
+		checkImage(logger, imgFile, img, loadTarget(logger, *isa), false, false)
+
+		dbg, err := loadDebugInfo(imgFile, *dbgFile, *noDbg)
+		if nil != err {
+			fatal(EXIT_IO, logger, err, "failed to read debug info")
+		}
+
+		listing := bcc.DisasmListing(img, dbg)
+		if "" == *out {
+			fmt.Print(listing)
+			return
+		}
+		err = ioutil.WriteFile(*out, []byte(listing), 0644)
+		if nil != err {
+			fatal(EXIT_IO, logger, err, "failed to write listing")
+		}
+	}
+}
+
+// loadDebugInfo reads the debug info of an image: the named file, or the
+// image's sidecar if it exists. It returns nil without an error if there is
+// none.
+func loadDebugInfo(imgFile, dbgFile string, skip bool) (*bcc.DebugInfo, error) {
+	switch true {
+	case skip:
+		return nil, nil
+	case "" != dbgFile:
+		f, err := os.Open(dbgFile)
+		if nil != err {
+			return nil, err
+		}
+		defer f.Close()
+		return bcc.ReadDebugInfo(f)
+	case "-" == imgFile:
+		return nil, nil
+	}
+	if _, err := os.Stat(imgFile + bcc.DebugExt); nil != err {
+		return nil, nil
+	}
+	return bcc.LoadDebugInfo(imgFile)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+
+	"github.com/bdlm/log/v2"
+)
+
+// Exit codes, one per class of failure, so scripts can tell a broken
+// program from a broken environment.
+const (
+	EXIT_OK = 0
+	// a check found problems: vet diagnostics, failing tests, unformatted
+	// files
+	EXIT_FAIL = 1
+	// bad command line
+	EXIT_USAGE = 2
+	// the source does not assemble
+	EXIT_SOURCE = 3
+	// a file could not be read or written
+	EXIT_IO = 4
+	// the emulated machine faulted
+	EXIT_EMU = 5
+)
+
+// checkDiagnostics logs the diagnostics of an assembled program and exits
+// if any of them is an error, as a failed build does.
+func checkDiagnostics(logger *log.Entry, prg bcc.Bcc) {
+	for _, diag := range prg.Diagnostics() {
+		logger.WithField("rule", diag.Rule).Warn(diag.String())
+	}
+	err := prg.CheckDiagnostics()
+	if nil != err {
+		fatal(EXIT_SOURCE, logger, err, "failed to assemble program")
+	}
+}
+
+// fatal logs an error and exits with the code of its failure class.
+func fatal(code int, logger *log.Entry, err error, msg string) {
+	if nil == logger {
+		logger = log.WithFields(log.Fields{})
+	}
+	logger.WithError(err).Error(msg)
+	os.Exit(code)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+
+	"github.com/bdlm/log/v2"
+)
+
+// explainCmd prints every instruction of a program expanded into the
+// micro-steps of its fetch and execute cycles.
+//
+//	bcc explain [flags] src.asm
+func explainCmd(flags *flag.FlagSet) func(args []string) {
+	stackSize := flags.Int("stack", bcc.StackDepth, "hardware stack depth")
+	optimize := flags.Bool("O", false, "remove unused subroutines, inline and apply peephole optimizations")
+	includes := listFlag{}
+	flags.Var(&includes, "I", "directory searched for included files, may be repeated")
+
+	return func(args []string) {
+		sourceFile := args[0]
+
+		logger := log.WithFields(log.Fields{"src": sourceFile})
+		prg, err := bcc.New(sourceFile, "")
+		if nil != err {
+			fatal(EXIT_IO, logger, err, "failed to initialize bit code compiler")
+		}
+
+		prg.SetStackSize(*stackSize)
+		prg.SetIncludePaths(includes)
+
+		err = prg.Parse()
+		if nil != err {
+			fatal(EXIT_SOURCE, logger, err, "failed to parse source file")
+		}
+
+		if *optimize {
+			_, err = prg.Inline(bcc.InlineConfig{})
+			if nil != err {
+				fatal(EXIT_SOURCE, logger, err, "failed to inline subroutines")
+			}
+			_, err = prg.Optimize()
+			if nil != err {
+				fatal(EXIT_SOURCE, logger, err, "failed to optimize program")
+			}
+		}
+
+		explanation, err := prg.Explain()
+		if nil != err {
+			fatal(EXIT_SOURCE, logger, err, "failed to assemble program")
+		}
+		checkDiagnostics(logger, prg)
+		fmt.Print(explanation)
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/eeprom"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/flash"
+
+	"github.com/bdlm/errors/v2"
+	"github.com/bdlm/log/v2"
+	"golang.org/x/term"
+)
+
+// flashCmd burns images and bcc diff patch lists with a serial EEPROM
+// programmer, reads them back and runs a programmer simulator on a
+// pseudo-terminal.
+//
+//	bcc flash [flags] write|apply|verify|read|erase|sim [file]
+func flashCmd(flags *flag.FlagSet) func(args []string) {
+	port := flags.String("port", os.Getenv("BCC_PORT"), "programmer serial port (default $BCC_PORT)")
+	baud := flags.Int("baud", flash.BAUD, "line rate")
+	timeout := flags.Duration("timeout", flash.TIMEOUT, "how long to wait for each reply")
+	boot := flags.Duration("boot", 2*time.Second, "how long the programmer may take to answer after the port opens")
+	partName := flags.String("part", "", "EEPROM part, checked against the programmer's; the simulated part for sim (default 28C256)")
+	resume := flags.Bool("resume", false, "skip blocks that already hold the image, to finish an interrupted write")
+	erase := flags.Bool("erase", false, "erase the EEPROM before writing")
+	noVerify := flags.Bool("no-verify", false, "do not verify blocks as they are written")
+	force := flags.Bool("force", false, "write images built for another ISA or failing their CRC")
+	isa := isaFlag(flags)
+	failAfter := flags.Int("fail-after", 0, "sim: go silent after this many writes, to test -resume")
+
+	return func(args []string) {
+		action, file := args[0], ""
+		if 2 == len(args) {
+			file = args[1]
+		}
+		logger := log.WithFields(log.Fields{"action": action})
+		switch action {
+		case "write", "apply", "verify", "read":
+			if "" == file {
+				fatal(EXIT_USAGE, logger, errors.Errorf("bcc flash %s needs a file", action), "invalid arguments")
+			}
+		case "erase":
+			if "" != file {
+				fatal(EXIT_USAGE, logger, errors.Errorf("bcc flash erase takes no file"), "invalid arguments")
+			}
+		case "sim":
+			flashSim(logger, *partName, *failAfter, file)
+			return
+		default:
+			fatal(EXIT_USAGE, logger, errors.Errorf("unknown action '%s', expected write, apply, verify, read, erase or sim", action), "invalid arguments")
+		}
+		logger = logger.WithField("file", file)
+
+		var img []byte
+		var patches []flash.Patch
+		switch action {
+		case "write", "verify":
+			var err error
+			img, err = ioutil.ReadFile(file)
+			if nil != err {
+				fatal(EXIT_IO, logger, err, "failed to read image")
+			}
+			checkImage(logger, file, img, loadTarget(logger, *isa), "write" == action, *force)
+		case "apply":
+			f, err := os.Open(file)
+			if nil == err {
+				patches, err = flash.ParsePatches(f)
+				f.Close()
+			}
+			if nil != err {
+				fatal(EXIT_IO, logger, err, "failed to read patch list")
+			}
+		}
+
+		if "" == *port {
+			fatal(EXIT_USAGE, logger, errors.Errorf("no programmer port, set -port or $BCC_PORT"), "invalid arguments")
+		}
+		logger = logger.WithField("port", *port)
+		conn, err := flash.OpenPort(*port, *baud)
+		if nil != err {
+			fatal(EXIT_IO, logger, err, "failed to open programmer port")
+		}
+		defer conn.Close()
+		prog, err := flash.Connect(conn, *timeout, *boot)
+		if nil != err {
+			fatal(EXIT_IO, logger, err, "programmer did not answer")
+		}
+		logger = logger.WithField("part", prog.Part.Name)
+		logger.Info("connected to programmer")
+		if "" != *partName {
+			part, err := eeprom.Lookup(*partName)
+			if nil != err {
+				fatal(EXIT_USAGE, logger, err, "invalid arguments")
+			}
+			if part.Name != prog.Part.Name || part.Size != prog.Part.Size {
+				fatal(EXIT_FAIL, logger, errors.Errorf("expected a %s, the programmer has a %s", part.Name, prog.Part.Name), "wrong EEPROM")
+			}
+		}
+		if nil != img {
+			img, err = fitImage(img, prog.Part)
+			if nil != err {
+				fatal(EXIT_FAIL, logger, err, "image does not fit")
+			}
+		}
+
+		switch action {
+		case "write":
+			if *erase {
+				err = prog.Erase()
+				if nil != err {
+					fatal(EXIT_IO, logger, err, "erase failed")
+				}
+			}
+			stats, err := prog.Write(img, flash.WriteOptions{
+				Resume:   *resume,
+				Verify:   !*noVerify,
+				Progress: progress("writing"),
+			})
+			if nil != err {
+				fatal(EXIT_IO, logger, errors.Wrap(err, "%s, -resume to continue", err), "write failed")
+			}
+			fmt.Printf("wrote %d bytes to the %s: %d blocks written, %d already written\n", len(img), prog.Part.Name, stats.Written, stats.Skipped)
+
+		case "apply":
+			stats, err := prog.Apply(patches, flash.WriteOptions{
+				Resume:   *resume,
+				Verify:   !*noVerify,
+				Progress: progress("patching"),
+			})
+			if nil != err {
+				fatal(EXIT_IO, logger, errors.Wrap(err, "%s, -resume to continue", err), "patch failed")
+			}
+			fmt.Printf("patched the %s: %d blocks written, %d already written\n", prog.Part.Name, stats.Written, stats.Skipped)
+
+		case "verify":
+			have, err := prog.Read(0, len(img))
+			if nil != err {
+				fatal(EXIT_IO, logger, err, "read failed")
+			}
+			ranges := flash.Ranges(img, have)
+			for _, r := range ranges {
+				fmt.Printf("%-13s  image %s  eeprom %s\n", rangeString(r), hexBytes(img[r.Start:r.End]), hexBytes(have[r.Start:r.End]))
+			}
+			if 0 < len(ranges) {
+				fatal(EXIT_FAIL, logger, errors.Errorf("%d ranges differ", len(ranges)), "verify failed")
+			}
+			fmt.Printf("verified %d bytes\n", len(img))
+
+		case "read":
+			data, err := prog.Read(0, prog.Part.Size)
+			if nil != err {
+				fatal(EXIT_IO, logger, err, "read failed")
+			}
+			err = ioutil.WriteFile(file, data, 0644)
+			if nil != err {
+				fatal(EXIT_IO, logger, err, "failed to write image")
+			}
+
+		case "erase":
+			err = prog.Erase()
+			if nil != err {
+				fatal(EXIT_IO, logger, err, "erase failed")
+			}
+		}
+	}
+}
+
+// flashSim serves a simulated programmer on a pseudo-terminal until killed.
+// The EEPROM contents persist in file, if given.
+func flashSim(logger *log.Entry, partName string, failAfter int, file string) {
+	if "" == partName {
+		partName = eeprom.Default
+	}
+	part, err := eeprom.Lookup(partName)
+	if nil != err {
+		fatal(EXIT_USAGE, logger, err, "invalid arguments")
+	}
+	sim := flash.NewSimulator(part)
+	sim.FailAfter = failAfter
+	if "" != file {
+		logger = logger.WithField("file", file)
+		mem, err := ioutil.ReadFile(file)
+		switch true {
+		case os.IsNotExist(err):
+		case nil != err:
+			fatal(EXIT_IO, logger, err, "failed to read EEPROM contents")
+		case len(mem) != part.Size:
+			fatal(EXIT_USAGE, logger, errors.Errorf("%d bytes, expected %d", len(mem), part.Size), "EEPROM contents do not fit the part")
+		default:
+			copy(sim.Mem, mem)
+		}
+		sim.Changed = func(mem []byte) error {
+			return ioutil.WriteFile(file, mem, 0644)
+		}
+	}
+
+	master, slave, err := flash.OpenPTY()
+	if nil != err {
+		fatal(EXIT_IO, logger, err, "failed to start simulator")
+	}
+	defer slave.Close()
+	fmt.Printf("%s programmer simulator on %s\n", part.Name, slave.Name())
+	err = sim.Serve(master)
+	if nil != err {
+		fatal(EXIT_IO, logger, err, "simulator failed")
+	}
+}
+
+// fitImage trims an image's erased tail to fit a part. Images smaller than
+// the part are written as they are.
+func fitImage(img []byte, part eeprom.Part) ([]byte, error) {
+	if len(img) <= part.Size {
+		return img, nil
+	}
+	return part.Fit(img, len(bytes.TrimRight(img, "\xff")))
+}
+
+// progress returns a callback that shows how many blocks have been written
+// when stderr is a terminal.
+func progress(what string) func(done, total int) {
+	if !term.IsTerminal(int(os.Stderr.Fd())) {
+		return nil
+	}
+	return func(done, total int) {
+		fmt.Fprintf(os.Stderr, "\r%s block %d/%d", what, done, total)
+		if done >= total {
+			fmt.Fprintln(os.Stderr)
+		}
+	}
+}
+
+// hexBytes formats a range of bytes, eliding long ones.
+func hexBytes(byts []byte) string {
+	if len(byts) > 8 {
+		return strings.TrimSpace(fmt.Sprintf("% X", byts[:8])) + " ..."
+	}
+	return fmt.Sprintf("% X", byts)
+}
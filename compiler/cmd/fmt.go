@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+
+	"github.com/bdlm/log/v2"
+)
+
+// fmtCmd reprints source files in canonical form. With no files it formats
+// stdin to stdout.
+//
+//	bcc fmt [flags] [src.asm ...]
+func fmtCmd(flags *flag.FlagSet) func(args []string) {
+	cfg := bcc.DefaultFormatConfig()
+
+	flags.IntVar(&cfg.Indent, "indent", cfg.Indent, "spaces before instructions")
+	literals := flags.String("literals", string(cfg.Literals), "rewrite literals as hex, dec or bin")
+	write := flags.Bool("w", false, "write the result to the source file instead of stdout")
+	check := flags.Bool("check", false, "list files that are not formatted and exit 1 if there are any")
+
+	return func(args []string) {
+		cfg.Literals = bcc.LiteralFormat(*literals)
+
+		if 0 == len(args) {
+			src, err := ioutil.ReadAll(os.Stdin)
+			if nil != err {
+				fatal(EXIT_IO, nil, err, "failed to read stdin")
+			}
+			out, err := bcc.Format(src, cfg)
+			if nil != err {
+				fatal(EXIT_SOURCE, nil, err, "failed to format stdin")
+			}
+			if *check && !bytes.Equal(src, out) {
+				fmt.Println("<stdin>")
+				os.Exit(EXIT_FAIL)
+			}
+			if !*check {
+				os.Stdout.Write(out)
+			}
+			return
+		}
+
+		unformatted := false
+		for _, sourceFile := range args {
+			logger := log.WithFields(log.Fields{"src": sourceFile})
+			src, err := ioutil.ReadFile(sourceFile)
+			if nil != err {
+				fatal(EXIT_IO, logger, err, "failed to read source file")
+			}
+			out, err := bcc.Format(src, cfg)
+			if nil != err {
+				fatal(EXIT_SOURCE, logger, err, "failed to format source file")
+			}
+
+			switch true {
+			case *check:
+				if !bytes.Equal(src, out) {
+					fmt.Println(sourceFile)
+					unformatted = true
+				}
+			case *write:
+				if bytes.Equal(src, out) {
+					continue
+				}
+				err = ioutil.WriteFile(sourceFile, out, 0644)
+				if nil != err {
+					fatal(EXIT_IO, logger, err, "failed to write source file")
+				}
+			default:
+				os.Stdout.Write(out)
+			}
+		}
+		if unformatted {
+			os.Exit(EXIT_FAIL)
+		}
+	}
+}
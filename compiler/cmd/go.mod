@@ -1,10 +1,18 @@
 module github.com/mkenney/8bit-cpu/compiler/cmd
 
-go 1.14
+go 1.17
 
 require (
+	github.com/bdlm/errors/v2 v2.1.2
 	github.com/bdlm/log/v2 v2.0.3
 	github.com/mkenney/8bit-cpu/cmp2/pkg v0.0.0-00010101000000-000000000000
+	golang.org/x/term v0.6.0
+)
+
+require (
+	github.com/bdlm/std/v2 v2.1.0 // indirect
+	golang.org/x/crypto v0.7.0 // indirect
+	golang.org/x/sys v0.6.0 // indirect
 )
 
 replace github.com/mkenney/8bit-cpu/cmp2/pkg => ../pkg
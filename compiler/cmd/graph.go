@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+
+	"github.com/bdlm/log/v2"
+)
+
+// graphCmd prints the control flow graph or call graph in Graphviz DOT
+// format.
+//
+//	bcc graph [flags] src.asm | dot -Tsvg > src.svg
+func graphCmd(flags *flag.FlagSet) func(args []string) {
+	cfg := bcc.GraphConfig{}
+
+	flags.BoolVar(&cfg.Calls, "calls", false, "draw the subroutine call graph instead of the basic blocks")
+	flags.BoolVar(&cfg.Cycles, "cycles", false, "annotate with cycle counts")
+	flags.BoolVar(&cfg.Lines, "lines", false, "annotate with source line numbers")
+	out := flags.String("o", "", "write to a file instead of stdout")
+	includes := listFlag{}
+	flags.Var(&includes, "I", "directory searched for included files, may be repeated")
+
+	return func(args []string) {
+		sourceFile := args[0]
+
+		logger := log.WithFields(log.Fields{"src": sourceFile})
+		prg, err := bcc.New(sourceFile, "")
+		if nil != err {
+			fatal(EXIT_IO, logger, err, "failed to initialize bit code compiler")
+		}
+		prg.SetIncludePaths(includes)
+
+		err = prg.Parse()
+		if nil != err {
+			fatal(EXIT_SOURCE, logger, err, "failed to parse source file")
+		}
+
+		dot, err := prg.Graph(cfg)
+		if nil != err {
+			fatal(EXIT_SOURCE, logger, err, "failed to assemble program")
+		}
+		checkDiagnostics(logger, prg)
+
+		if "" == *out {
+			fmt.Print(dot)
+			return
+		}
+		err = ioutil.WriteFile(*out, []byte(dot), 0644)
+		if nil != err {
+			fatal(EXIT_IO, logger, err, "failed to write graph")
+		}
+	}
+}
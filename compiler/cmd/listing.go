@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+
+	"github.com/bdlm/log/v2"
+)
+
+// listingCmd prints the assembler listing with cycle counts and timing.
+//
+//	bcc listing [flags] src.asm
+func listingCmd(flags *flag.FlagSet) func(args []string) {
+	hz := flags.Float64("hz", 10, "clock frequency for wall-clock estimates, 0 to omit")
+	stackSize := flags.Int("stack", bcc.StackDepth, "hardware stack depth")
+	optimize := flags.Bool("O", false, "remove unused subroutines, inline and apply peephole optimizations")
+	inlineSize := flags.Int("inline-size", 0, "with -O, inline subroutines of at most this many bytes at every call site")
+	inlineBudget := flags.Int("inline-budget", 0, "with -O, bytes the program may grow by inlining")
+	inlineRuns := flags.Int("inline-runs", 0, "with -O, only inline at every call site when the sites run at least this many times")
+	includes := listFlag{}
+	flags.Var(&includes, "I", "directory searched for included files, may be repeated")
+
+	return func(args []string) {
+		sourceFile := args[0]
+
+		logger := log.WithFields(log.Fields{"src": sourceFile})
+		prg, err := bcc.New(sourceFile, "")
+		if nil != err {
+			fatal(EXIT_IO, logger, err, "failed to initialize bit code compiler")
+		}
+
+		prg.SetStackSize(*stackSize)
+		prg.SetIncludePaths(includes)
+
+		err = prg.Parse()
+		if nil != err {
+			fatal(EXIT_SOURCE, logger, err, "failed to parse source file")
+		}
+
+		if *optimize {
+			_, err = prg.Inline(bcc.InlineConfig{MaxSize: *inlineSize, Budget: *inlineBudget, MinRuns: *inlineRuns})
+			if nil != err {
+				fatal(EXIT_SOURCE, logger, err, "failed to inline subroutines")
+			}
+			_, err = prg.Optimize()
+			if nil != err {
+				fatal(EXIT_SOURCE, logger, err, "failed to optimize program")
+			}
+		}
+
+		listing, err := prg.Listing(*hz)
+		if nil != err {
+			fatal(EXIT_SOURCE, logger, err, "failed to assemble program")
+		}
+		fmt.Print(listing)
+
+		// the listing shows the source errors before the exit
+		checkDiagnostics(logger, prg)
+	}
+}
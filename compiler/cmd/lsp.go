@@ -0,0 +1,25 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/lsp"
+)
+
+// lspCmd runs the language server on stdin and stdout. Logs go to stderr,
+// which editors show in their server output panel. It exits 1 if the client
+// exits without shutting the server down.
+//
+//	bcc lsp
+func lspCmd(flags *flag.FlagSet) func(args []string) {
+	return func(args []string) {
+		err := lsp.New(os.Stdin, os.Stdout).Serve()
+		if lsp.ErrNoShutdown == err {
+			os.Exit(EXIT_FAIL)
+		}
+		if nil != err {
+			fatal(EXIT_IO, nil, err, "language server failed")
+		}
+	}
+}
@@ -2,49 +2,240 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 
-	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
-
+	"github.com/bdlm/errors/v2"
 	"github.com/bdlm/log/v2"
 )
 
+// command is a bcc subcommand.
+type command struct {
+	name string
+	// positional arguments, for the usage line
+	args    string
+	summary string
+	// accepted number of positional arguments, max -1 for no limit
+	min, max int
+	// setup defines the command's flags and returns its entry point, which
+	// is called with the positional arguments once the flags are parsed.
+	setup func(flags *flag.FlagSet) func(args []string)
+}
+
+// commands lists every subcommand in help order. It is populated in init
+// because help and completion refer back to it.
+var commands []*command
+
 func init() {
-	//log.SetFormatter(&log.TextFormatter{DisableTTY: true})
-	log.SetLevel(log.DebugLevel)
+	commands = []*command{
+		{"build", "[flags] [src.asm]", "assemble a program, or the targets of bcc.toml", 0, 1, buildCmd},
+		{"run", "[flags] prog.img", "execute a ROM image in the emulator", 1, 1, runCmd},
+		{"sim", "[flags] [prog.img]", "execute a ROM image on a chip-level simulation of the breadboard", 0, 1, simCmd},
+		{"debug", "[flags] prog.img", "step through a ROM image interactively", 1, 1, debugCmd},
+		{"disasm", "[flags] prog.img", "disassemble a ROM image", 1, 1, disasmCmd},
+		{"diff", "[flags] old.img new.img", "compare ROM images and list the blocks to reburn", 2, 2, diffCmd},
+		{"listing", "[flags] src.asm", "print the assembler listing with cycle counts", 1, 1, listingCmd},
+		{"explain", "[flags] src.asm", "expand each instruction into its micro-steps", 1, 1, explainCmd},
+		{"graph", "[flags] src.asm", "print the control flow or call graph as DOT", 1, 1, graphCmd},
+		{"fmt", "[flags] [src.asm ...]", "reformat source files", 0, -1, fmtCmd},
+		{"vet", "[flags] src.asm", "report suspicious code", 0, 1, vetCmd},
+		{"test", "[flags] [./...]", "run assembly unit tests", 0, -1, testCmd},
+		{"microcode", "[flags]", "generate the instruction decoder ROM images", 0, 0, microcodeCmd},
+		{"flash", "[flags] write|apply|verify|read|erase|sim [file]", "burn, read back or erase an EEPROM with a serial programmer", 1, 2, flashCmd},
+		{"seg7", "[flags] dest.img", "generate the output module decoder ROM image", 1, 1, seg7Cmd},
+		{"lsp", "", "run the language server on stdin and stdout", 0, 0, lspCmd},
+		{"completion", "bash|zsh|fish", "print a shell completion script", 1, 1, completionCmd},
+		{"help", "[command]", "show help for a command", 0, 1, helpCmd},
+	}
 }
 
-func main() {
-	var err error
-	sourceFile := os.Args[1]
-	destFile := os.Args[2]
+// lookup returns the named command.
+func lookup(name string) (*command, bool) {
+	for _, cmd := range commands {
+		if name == cmd.name {
+			return cmd, true
+		}
+	}
+	return nil, false
+}
 
-	logger := log.WithFields(log.Fields{"src": os.Args[1], "dest": os.Args[2]})
-	logger.Debug("initializing compiler")
-	prg, err := bcc.New(sourceFile, destFile)
-	if nil != err {
-		logger.WithError(err).Fatal("failed to initialize bit code compiler")
+// newFlags returns the flag set of a command with its flags defined, and the
+// command's entry point.
+func (cmd *command) newFlags() (*flag.FlagSet, func(args []string)) {
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	run := cmd.setup(flags)
+	flags.Usage = func() {
+		out := flags.Output()
+		fmt.Fprintf(out, "usage: bcc %s %s\n\n%s.\n", cmd.name, cmd.args, capitalize(cmd.summary))
+		if hasFlags(flags) {
+			fmt.Fprintln(out, "\nflags:")
+			flags.PrintDefaults()
+		}
 	}
+	return flags, run
+}
 
-	logger.Debug("parsing src file")
-	err = prg.Parse()
+// main runs the command named by the first argument:
+//
+//	bcc [-v|-q|-log level] command [flags] [args]
+func main() {
+	flag.CommandLine.Init("bcc", flag.ContinueOnError)
+	flag.Usage = usage
+	verbose := flag.Bool("v", false, "log progress")
+	quiet := flag.Bool("q", false, "only log errors")
+	level := flag.String("log", "", "log level: debug, info, warn or error (default $BCC_LOG or warn)")
+	err := flag.CommandLine.Parse(os.Args[1:])
+	if flag.ErrHelp == err {
+		os.Exit(EXIT_OK)
+	}
 	if nil != err {
-		logger.WithError(err).Fatal("failed to parse source file")
+		os.Exit(EXIT_USAGE)
+	}
+
+	log.SetOutput(os.Stderr)
+	log.SetLevel(log.WarnLevel)
+	if env := os.Getenv("BCC_LOG"); "" != env && "" == *level {
+		*level = env
+	}
+	switch true {
+	case "" != *level:
+		lvl, err := log.ParseLevel(*level)
+		if nil != err {
+			fmt.Fprintf(os.Stderr, "invalid log level '%s'\n", *level)
+			os.Exit(EXIT_USAGE)
+		}
+		log.SetLevel(lvl)
+	case *verbose:
+		log.SetLevel(log.InfoLevel)
+	case *quiet:
+		log.SetLevel(log.ErrorLevel)
+	}
+
+	if 0 == flag.NArg() {
+		usage()
+		os.Exit(EXIT_USAGE)
+	}
+	name, args := flag.Arg(0), flag.Args()[1:]
+
+	cmd, ok := lookup(name)
+	if !ok {
+		// bcc src.asm dest.img predates the subcommands
+		if _, err := os.Stat(name); nil == err && 1 == len(args) {
+			log.Warnf("bcc src dest is deprecated, use bcc build -o %s %s", args[0], name)
+			cmd, args = commands[0], []string{"-o", args[0], name}
+		} else {
+			fmt.Fprintf(os.Stderr, "bcc: unknown command '%s'\nRun 'bcc help' for usage.\n", name)
+			os.Exit(EXIT_USAGE)
+		}
 	}
 
-	logger.Debug("writing dest image")
-	err = prg.Compile()
+	flags, run := cmd.newFlags()
+	err = flags.Parse(args)
+	if flag.ErrHelp == err {
+		os.Exit(EXIT_OK)
+	}
 	if nil != err {
-		logger.WithError(err).Fatal("failed to compile ROM images")
+		os.Exit(EXIT_USAGE)
+	}
+	if flags.NArg() < cmd.min || (cmd.max >= 0 && flags.NArg() > cmd.max) {
+		flags.Usage()
+		os.Exit(EXIT_USAGE)
 	}
+	run(flags.Args())
+}
+
+// usage prints the top level help.
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprint(out, "bcc is the bit code compiler and toolchain for the 8 bit CPU.\n\n")
+	fmt.Fprint(out, "usage: bcc [-v|-q|-log level] command [flags] [args]\n\ncommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-11s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprint(out, "\nflags:\n")
+	flag.PrintDefaults()
+	fmt.Fprint(out, "\nRun 'bcc help command' for the flags of a command.\n")
+}
 
-	logger.Info("success")
+// helpCmd prints the usage of a command, or the command list.
+//
+//	bcc help [command]
+func helpCmd(flags *flag.FlagSet) func(args []string) {
+	return func(args []string) {
+		if 0 == len(args) {
+			flag.CommandLine.SetOutput(os.Stdout)
+			usage()
+			return
+		}
+		cmd, ok := lookup(args[0])
+		if !ok {
+			fmt.Fprintf(os.Stderr, "bcc: unknown command '%s'\n", args[0])
+			os.Exit(EXIT_USAGE)
+		}
+		cmdFlags, _ := cmd.newFlags()
+		cmdFlags.SetOutput(os.Stdout)
+		cmdFlags.Usage()
+	}
+}
+
+// hasFlags reports whether any flags are defined.
+func hasFlags(flags *flag.FlagSet) bool {
+	found := false
+	flags.VisitAll(func(*flag.Flag) {
+		found = true
+	})
+	return found
+}
+
+// capitalize upper-cases the first letter of a summary.
+func capitalize(s string) string {
+	if "" == s {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
 
-	// DEBUG
-	code := ""
-	for _, inst := range prg.Instructions() {
-		code = code + "\n" + inst.Line()
+// listFlag collects the values of a repeated flag.
+type listFlag []string
+
+// String implements flag.Value.
+func (list *listFlag) String() string {
+	return strings.Join(*list, ",")
+}
+
+// Set implements flag.Value.
+func (list *listFlag) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+// defineFlag collects repeated $name=value constant definitions.
+type defineFlag map[string]byte
+
+// String implements flag.Value.
+func (defines defineFlag) String() string {
+	s := []string{}
+	for name, value := range defines {
+		s = append(s, fmt.Sprintf("%s=%d", name, value))
+	}
+	sort.Strings(s)
+	return strings.Join(s, ",")
+}
+
+// Set implements flag.Value.
+func (defines defineFlag) Set(value string) error {
+	p := strings.SplitN(value, "=", 2)
+	if 2 != len(p) || "" == strings.TrimPrefix(p[0], "$") {
+		return errors.Errorf("expected $name=value, found '%s'", value)
+	}
+	v, err := strconv.ParseInt(p[1], 0, 16)
+	if nil != err || v < -128 || v > 255 {
+		return errors.Errorf("invalid byte value '%s'", p[1])
 	}
-	fmt.Printf("\n%s\n\n", code)
+	defines[p[0]] = byte(v)
+	return nil
 }
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/project"
+
+	"github.com/bdlm/errors/v2"
+	"github.com/bdlm/log/v2"
+)
+
+// metaFlag defines the -meta flag of the commands that build images.
+func metaFlag(flags *flag.FlagSet) *string {
+	return flags.String("meta", bcc.META_EMBED, "image metadata: embed it at 0x0100, write a .meta sidecar or none")
+}
+
+// isaFlag defines the -isa flag of the commands that check images.
+func isaFlag(flags *flag.FlagSet) *string {
+	return flags.String("isa", "", "ISA file of the target images are checked against, the reference build if empty")
+}
+
+// loadTarget reads an ISA file, the reference build if file is empty.
+func loadTarget(logger *log.Entry, file string) bcc.Target {
+	if "" == file {
+		return bcc.DefaultTarget()
+	}
+	target, err := project.LoadISA(file)
+	if nil != err {
+		fatal(EXIT_SOURCE, logger.WithField("isa", file), err, "invalid ISA file")
+	}
+	return target
+}
+
+// checkImage verifies an image against its metadata: that it is intact and
+// was built for the target's ISA. A strict check exits unless forced;
+// otherwise problems are warnings. Images without metadata are not checked.
+func checkImage(logger *log.Entry, imgFile string, img []byte, target bcc.Target, strict, force bool) {
+	meta, ok, err := bcc.LoadMetadata(imgFile, img)
+	if !ok {
+		logger.Info("image has no metadata, ISA not checked")
+		return
+	}
+	if nil == err {
+		err = meta.Verify(img)
+	}
+	if nil == err {
+		err = meta.CheckISA(target)
+	}
+	if nil == err {
+		logger.WithFields(log.Fields{"isa": meta.ISA, "build": meta.BuildID}).Debug("image metadata verified")
+		return
+	}
+	if strict && !force {
+		fatal(EXIT_FAIL, logger, errors.Wrap(err, "%s, -force to use it anyway", err), "image check failed")
+	}
+	logger.WithError(err).Warn("image check failed")
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/ucode"
+
+	"github.com/bdlm/errors/v2"
+	"github.com/bdlm/log/v2"
+)
+
+// microcodeCmd generates the instruction decoder EEPROM images, one per 8
+// control signals, from the microcode in package ucode and the assembler's
+// opcode assignment. The micro-steps are verified first, and nothing is
+// written if any breaks a rule. -isa generates them for a target's
+// operations only. Each image gets a metadata sidecar naming the ISA, and
+// -check refuses to write them if a program image was built for another. -read audits burned decoder ROMs instead: it prints their dumps as
+// a signal grid, diffed against the current microcode.
+//
+//	bcc microcode [flags]
+func microcodeCmd(flags *flag.FlagSet) func(args []string) {
+	prefix := flags.String("o", "ucode", "output file prefix, ROM k is written to prefixk.img")
+	show := flags.Bool("print", false, "print the micro-steps of every opcode instead of writing images")
+	verifyOnly := flags.Bool("verify", false, "only verify the micro-steps")
+	read := flags.String("read", "", "print the decoder ROM dumps prefixk.img as a grid, diffed against the microcode")
+	all := flags.Bool("all", false, "-read: show unused opcodes that match")
+	checks := listFlag{}
+	flags.Var(&checks, "check", "program image that must match the ISA, may be repeated")
+	isa := isaFlag(flags)
+
+	return func(args []string) {
+		target := loadTarget(log.WithFields(log.Fields{}), *isa)
+		ops := microcodeOps(target)
+		if *show {
+			for opcode, name := range ops {
+				if "" == name {
+					continue
+				}
+				steps, _ := ucode.Lookup(name)
+				for step, sig := range steps {
+					fmt.Printf("0x%02X  %-4s  %2d  %s\n", opcode, name, step, sig)
+				}
+			}
+			return
+		}
+		if "" != *read {
+			readDecoder(*read, target, ops, *all)
+			return
+		}
+
+		logger := log.WithFields(log.Fields{"prefix": *prefix, "isa": bcc.ISAHash(target)})
+		for _, imgFile := range checks {
+			img, err := ioutil.ReadFile(imgFile)
+			if nil != err {
+				fatal(EXIT_IO, logger, err, "failed to read program image")
+			}
+			meta, ok, err := bcc.LoadMetadata(imgFile, img)
+			if nil == err && !ok {
+				err = errors.Errorf("%s has no metadata", imgFile)
+			}
+			if nil == err {
+				err = meta.CheckISA(target)
+			}
+			if nil != err {
+				fatal(EXIT_FAIL, logger.WithField("img", imgFile), err, "program does not match the microcode")
+			}
+		}
+
+		violations, err := ucode.Verify(ops)
+		if nil != err {
+			fatal(EXIT_SOURCE, logger, err, "failed to generate microcode")
+		}
+		for _, v := range violations {
+			fmt.Println(v)
+		}
+		if 0 < len(violations) {
+			fatal(EXIT_FAIL, logger, errors.Errorf("%d violations", len(violations)), "microcode verification failed")
+		}
+		if *verifyOnly {
+			return
+		}
+
+		roms, err := ucode.ROMs(ops)
+		if nil != err {
+			fatal(EXIT_SOURCE, logger, err, "failed to generate microcode")
+		}
+		for k, rom := range roms {
+			file := fmt.Sprintf("%s%d.img", *prefix, k)
+			err = ioutil.WriteFile(file, rom, 0644)
+			if nil != err {
+				fatal(EXIT_IO, logger, err, "failed to write microcode image")
+			}
+			err = bcc.NewMetadata(target, rom, len(rom)).WriteSidecar(file)
+			if nil != err {
+				fatal(EXIT_IO, logger, err, "failed to write microcode metadata")
+			}
+			logger.WithField("file", file).Info("wrote decoder ROM")
+		}
+	}
+}
+
+// readDecoder prints decoder ROM dumps as a grid diffed against the
+// microcode, then the rule violations in the dumps. It exits 1 if they differ
+// or break a rule.
+func readDecoder(prefix string, target bcc.Target, ops []string, all bool) {
+	logger := log.WithFields(log.Fields{"prefix": prefix, "isa": bcc.ISAHash(target)})
+	want, err := ucode.ROMs(ops)
+	if nil != err {
+		fatal(EXIT_SOURCE, logger, err, "failed to generate microcode")
+	}
+	roms := make([][]byte, len(want))
+	for k := range roms {
+		file := fmt.Sprintf("%s%d.img", prefix, k)
+		roms[k], err = ioutil.ReadFile(file)
+		if nil != err {
+			fatal(EXIT_IO, logger, err, "failed to read decoder ROM")
+		}
+	}
+	have, err := ucode.ReadPrograms(roms)
+	if nil != err {
+		fatal(EXIT_USAGE, logger, err, "invalid decoder ROMs")
+	}
+	progs, _ := ucode.Programs(ops)
+
+	ucode.Grid(os.Stdout, have, progs, ops, all)
+	fmt.Println()
+	diffs := ucode.DiffPrograms(have, progs)
+	for k := range roms {
+		n := 0
+		for addr, b := range want[k] {
+			if b != roms[k][addr] {
+				n++
+			}
+		}
+		if 0 < n {
+			fmt.Printf("%s%d.img: %d of %d bytes differ\n", prefix, k, n, len(want[k]))
+		}
+	}
+	violations := ucode.Check(have, ops)
+	for _, v := range violations {
+		fmt.Println(v)
+	}
+	if 0 < len(diffs) || 0 < len(violations) {
+		fatal(EXIT_FAIL, logger, errors.Errorf("%d micro-steps differ, %d violations", len(diffs), len(violations)), "decoder ROMs do not match the microcode")
+	}
+	fmt.Println("decoder ROMs match the microcode")
+}
+
+// microcodeOps returns the names of the operations a target implements,
+// indexed by opcode.
+func microcodeOps(target bcc.Target) []string {
+	implemented := map[string]bool{}
+	for _, name := range target.Ops {
+		implemented[name] = true
+	}
+	ops := []string{}
+	for _, name := range bcc.OpNames() {
+		if nil != target.Ops && !implemented[name] {
+			continue
+		}
+		opcode, _ := bcc.Opcode(name)
+		for len(ops) <= int(opcode) {
+			ops = append(ops, "")
+		}
+		ops[opcode] = name
+	}
+	return ops
+}
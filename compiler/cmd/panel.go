@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/emu"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/seg7"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/ucode"
+
+	"github.com/bdlm/errors/v2"
+	"golang.org/x/term"
+)
+
+// ANSI colors matching the LEDs on the breadboards.
+const (
+	ledRed    = "\x1b[31m"
+	ledGreen  = "\x1b[32m"
+	ledYellow = "\x1b[33m"
+	ledBlue   = "\x1b[34m"
+	ledOff    = "\x1b[90m"
+	ledReset  = "\x1b[0m"
+)
+
+// frameRate is the number of front panel redraws per second.
+const frameRate = 30
+
+// panel draws the machine state like the breadboard front panel.
+type panel struct {
+	cpu     emu.CPU
+	clk     emu.Clock
+	display seg7.Decoder
+	status  string
+}
+
+// runPanel drives the emulator from the keyboard until the user quits.
+//
+//	space  toggle the clock mode switch, astable (run) or manual (step)
+//	s      manual clock pulse
+//	i      manual pulses until the current instruction completes
+//	+ -    double/halve the clock rate
+//	r      reset
+//	q      quit
+func runPanel(cpu emu.CPU, clk emu.Clock) error {
+	display, err := seg7.New("", seg7.DefaultConfig())
+	if nil != err {
+		return errors.Wrap(err, "could not initialize output display")
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return errors.Errorf("the front panel requires a terminal")
+	}
+	oldState, err := term.MakeRaw(fd)
+	if nil != err {
+		return errors.Wrap(err, "could not configure terminal")
+	}
+	defer term.Restore(fd, oldState)
+	fmt.Print("\x1b[?25l\x1b[2J")
+	defer fmt.Print("\x1b[?25h\r\n")
+
+	keys := make(chan byte)
+	go func() {
+		buf := make([]byte, 1)
+		for {
+			if _, err := os.Stdin.Read(buf); nil != err {
+				close(keys)
+				return
+			}
+			keys <- buf[0]
+		}
+	}()
+
+	pnl := &panel{
+		cpu:     cpu,
+		clk:     clk,
+		display: display,
+	}
+
+	frame := time.NewTicker(time.Second / frameRate)
+	defer frame.Stop()
+	for {
+		select {
+		case key, ok := <-keys:
+			if !ok || 'q' == key || 3 == key {
+				return nil
+			}
+			pnl.key(key)
+
+		case now := <-frame.C:
+			if _, err := pnl.clk.Advance(now); nil != err {
+				pnl.fail(err)
+			}
+		}
+		fmt.Print("\x1b[H" + strings.ReplaceAll(pnl.String(), "\n", "\x1b[K\r\n"))
+	}
+}
+
+// key handles a keypress.
+func (pnl *panel) key(key byte) {
+	switch key {
+	case ' ':
+		if emu.CLOCK_ASTABLE == pnl.clk.Mode() {
+			pnl.clk.SetMode(emu.CLOCK_MANUAL)
+		} else {
+			pnl.clk.SetMode(emu.CLOCK_ASTABLE)
+		}
+	case 's', '\r':
+		if err := pnl.clk.Pulse(); nil != err {
+			pnl.fail(err)
+		}
+	case 'i':
+		for emu.CLOCK_MANUAL == pnl.clk.Mode() {
+			if err := pnl.clk.Pulse(); nil != err {
+				pnl.fail(err)
+				break
+			}
+			if state := pnl.cpu.State(); 0 == state.Step || state.Halted {
+				break
+			}
+		}
+	case '+', '=':
+		if hz := pnl.clk.Frequency(); 0 != hz {
+			pnl.clk.SetFrequency(hz * 2)
+		}
+	case '-':
+		switch hz := pnl.clk.Frequency(); true {
+		case 0 == hz:
+			pnl.clk.SetFrequency(1024)
+		case hz > 0.25:
+			pnl.clk.SetFrequency(hz / 2)
+		}
+	case 'r':
+		pnl.cpu.Reset()
+		pnl.status = ""
+	}
+}
+
+// fail reports an emulation failure and switches to manual mode.
+func (pnl *panel) fail(err error) {
+	pnl.status = err.Error()
+	pnl.clk.SetMode(emu.CLOCK_MANUAL)
+}
+
+// leds draws the low `width` bits of a value as LEDs, MSB first.
+func leds(color string, val byte, width uint) string {
+	s := ""
+	for bit := int(width) - 1; bit >= 0; bit-- {
+		if 0 != val&(1<<uint(bit)) {
+			s = s + color + "●"
+		} else {
+			s = s + ledOff + "○"
+		}
+	}
+	return s + ledReset
+}
+
+// String renders the front panel.
+func (pnl *panel) String() string {
+	state := pnl.cpu.State()
+	lines := []string{}
+	add := func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+
+	clock := ledBlue + "RUN " + ledReset
+	switch true {
+	case state.Halted:
+		clock = ledRed + "HLT " + ledReset
+	case emu.CLOCK_MANUAL == pnl.clk.Mode():
+		clock = ledYellow + "STEP" + ledReset
+	}
+	rate := fmt.Sprintf("%8.2f Hz", pnl.clk.Frequency())
+	if 0 == pnl.clk.Frequency() {
+		rate = "     max   "
+	}
+	op, _ := bcc.OpName(state.IR)
+
+	add(" CLK   %s %s   cycle %d", clock, rate, state.Cycle)
+	add("")
+	add(" BUS   %s  0x%02X", leds(ledYellow, state.Bus, 8), state.Bus)
+	add("")
+	add(" PC    %s  0x%02X      A    %s  0x%02X", leds(ledGreen, state.PC, 8), state.PC, leds(ledRed, state.A, 8), state.A)
+	add(" MAR   %s  0x%02X      X    %s  0x%02X", leds(ledYellow, state.MAR, 8), state.MAR, leds(ledRed, state.X, 8), state.X)
+	add(" IR    %s  %-4s      Y    %s  0x%02X", leds(ledBlue, state.IR, 8), op, leds(ledRed, state.Y, 8), state.Y)
+	add(" STEP  %s  T%-2d           OUT  %s  0x%02X", leds(ledGreen, state.Step, 4), state.Step, leds(ledRed, state.Out, 8), state.Out)
+	add(" FLAGS C%s Z%s", leds(ledGreen, boolByte(state.Carry), 1), leds(ledGreen, boolByte(state.Zero), 1))
+	stack := []string{}
+	for _, byt := range state.Stack {
+		stack = append(stack, fmt.Sprintf("%02X", byt))
+	}
+	add(" STACK [%s]", strings.Join(stack, " "))
+	add("")
+
+	// control unit bus LEDs
+	row := ""
+	for k, sig := range ucode.Signals {
+		if 0 != state.Signals&sig {
+			row = row + fmt.Sprintf(" %s%-5s%s", ledBlue, sig.Name(), ledReset)
+		} else {
+			row = row + fmt.Sprintf(" %s%-5s%s", ledOff, sig.Name(), ledReset)
+		}
+		if 0 == (k+1)%12 {
+			add("%s", row)
+			row = ""
+		}
+	}
+	add("%s", row)
+	add("")
+
+	art, _ := pnl.display.Render(seg7.MODE_UNSIGNED, state.Out)
+	for _, line := range strings.Split(art, "\n") {
+		add("   %s%s%s", ledRed, line, ledReset)
+	}
+	add("")
+	add(" %s", pnl.status)
+	add(" [space] run/halt  [s] pulse  [i] instruction  [+/-] rate  [r] reset  [q] quit")
+
+	return strings.Join(lines, "\n")
+}
+
+// boolByte returns 1 for true.
+func boolByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/emu"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/ucode"
+
+	"github.com/bdlm/log/v2"
+)
+
+// runCmd executes a program image in the emulator.
+//
+//	bcc run [flags] prog.img
+func runCmd(flags *flag.FlagSet) func(args []string) {
+	cfg := emu.DefaultConfig()
+
+	flags.IntVar(&cfg.StackDepth, "stack", cfg.StackDepth, "hardware stack depth")
+	panel := flags.Bool("panel", false, "draw the front panel in the terminal")
+	hz := flags.Float64("hz", 0, "clock rate in Hz, 0 runs unthrottled")
+	manual := flags.Bool("manual", false, "start the front panel clock in manual step mode")
+	cycles := flags.Uint64("cycles", 100000, "stop after this many clock cycles, 0 for no limit")
+	force := flags.Bool("force", false, "run images built for another ISA or failing their CRC")
+	isa := isaFlag(flags)
+	trace := flags.Bool("trace", false, "print every instruction executed, with its source line if prog.img.dbg exists")
+	record := vcdFlags(flags)
+
+	return func(args []string) {
+		imgFile := args[0]
+
+		logger := log.WithFields(log.Fields{"img": imgFile})
+		img, err := ioutil.ReadFile(imgFile)
+		if nil != err {
+			fatal(EXIT_IO, logger, err, "failed to read program image")
+		}
+		checkImage(logger, imgFile, img, loadTarget(logger, *isa), true, *force)
+
+		cpu, err := emu.New(img, cfg)
+		if nil != err {
+			fatal(EXIT_EMU, logger, err, "failed to initialize emulator")
+		}
+
+		machine, closeVCD := record(logger, cpu, *hz)
+		clk, err := emu.NewClock(machine, *hz)
+		if nil != err {
+			fatal(EXIT_EMU, logger, err, "failed to initialize clock module")
+		}
+
+		if *panel {
+			if *manual {
+				clk.SetMode(emu.CLOCK_MANUAL)
+			}
+			err = runPanel(machine, clk)
+			closeVCD()
+			if nil != err {
+				fatal(EXIT_EMU, logger, err, "front panel failure")
+			}
+			return
+		}
+
+		var dbg *bcc.DebugInfo
+		if *trace {
+			dbg, err = bcc.LoadDebugInfo(imgFile)
+			if nil != err {
+				logger.WithError(err).Warn("no debug info, tracing addresses only")
+			}
+		}
+
+		// Print each value latched into the output register.
+		err = clk.Run(context.Background(), func(state emu.State) bool {
+			if *trace && (0 == state.Step || state.Halted) {
+				fmt.Println(emu.Trace(img, state, dbg))
+			}
+			if 0 != state.Signals&ucode.OUT {
+				fmt.Println(state.Out)
+			}
+			return 0 == *cycles || state.Cycle < *cycles
+		})
+		closeVCD()
+		if nil != err {
+			fatal(EXIT_EMU, logger, err, "emulation failure")
+		}
+	}
+}
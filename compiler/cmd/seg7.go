@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/seg7"
+
+	"github.com/bdlm/log/v2"
+)
+
+// seg7Cmd generates the output module decoder ROM.
+//
+//	bcc seg7 [flags] dest.img
+func seg7Cmd(flags *flag.FlagSet) func(args []string) {
+	cfg := seg7.DefaultConfig()
+
+	flags.BoolVar(&cfg.Anode, "anode", cfg.Anode, "common-anode displays")
+	flags.StringVar(&cfg.Wiring, "wiring", cfg.Wiring, "segment-to-bit wiring, D7 first ('p' is the decimal point)")
+	flags.IntVar(&cfg.Digits, "digits", cfg.Digits, "number of digits")
+	flags.IntVar(&cfg.Size, "size", cfg.Size, "ROM image size in bytes")
+	modes := flags.String("modes", "unsigned,signed", "comma separated display modes in address order (unsigned, signed, hex)")
+	render := flags.Bool("render", false, "print every value in every mode as ASCII art")
+
+	return func(args []string) {
+		destFile := args[0]
+
+		cfg.Modes = []seg7.Mode{}
+		for _, mode := range strings.Split(*modes, ",") {
+			cfg.Modes = append(cfg.Modes, seg7.Mode(strings.TrimSpace(mode)))
+		}
+
+		logger := log.WithFields(log.Fields{"dest": destFile, "modes": *modes})
+		dec, err := seg7.New(destFile, cfg)
+		if nil != err {
+			fatal(EXIT_USAGE, logger, err, "failed to initialize decoder ROM generator")
+		}
+
+		logger.Debug("writing decoder image")
+		err = dec.Compile()
+		if nil != err {
+			fatal(EXIT_IO, logger, err, "failed to compile decoder ROM image")
+		}
+
+		err = dec.Verify()
+		if nil != err {
+			fatal(EXIT_FAIL, logger, err, "decoder ROM verification failed")
+		}
+
+		if *render {
+			for _, mode := range cfg.Modes {
+				for v := 0; v < 256; v++ {
+					art, _ := dec.Render(mode, byte(v))
+					fmt.Printf("%s 0x%02X\n%s\n\n", mode, v, art)
+				}
+			}
+		}
+
+		logger.Info("success")
+	}
+}
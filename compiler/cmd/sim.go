@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/chip"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/emu"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/ucode"
+
+	"github.com/bdlm/errors/v2"
+	"github.com/bdlm/log/v2"
+)
+
+// simCmd executes a program image on a chip-level simulation of the
+// breadboard: every 74LS part and EEPROM wired by a netlist, the reference
+// build unless -netlist names another. The decoder EEPROMs hold the current
+// microcode of the -isa target, or the images given with -ucode. Floating bus lines and
+// contention are reported once the program stops, and -compare runs the
+// emulator in lockstep to catch wiring that computes the wrong result.
+//
+//	bcc sim [flags] prog.img
+func simCmd(flags *flag.FlagSet) func(args []string) {
+	netlistFile := flags.String("netlist", "", "netlist file, the reference build if empty")
+	prefix := flags.String("ucode", "", "decoder ROM images prefixk.img, the current microcode if empty")
+	dump := flags.Bool("dump", false, "print the reference netlist and exit")
+	listParts := flags.Bool("parts", false, "list the part types and their pins and exit")
+	panel := flags.Bool("panel", false, "draw the front panel in the terminal")
+	hz := flags.Float64("hz", 0, "clock rate in Hz, 0 runs unthrottled")
+	manual := flags.Bool("manual", false, "start the front panel clock in manual step mode")
+	cycles := flags.Uint64("cycles", 100000, "stop after this many clock cycles, 0 for no limit")
+	force := flags.Bool("force", false, "run images built for another ISA or failing their CRC")
+	isa := isaFlag(flags)
+	trace := flags.Bool("trace", false, "print every instruction executed, with its source line if prog.img.dbg exists")
+	record := vcdFlags(flags)
+	compare := flags.Bool("compare", false, "run the emulator in lockstep and stop at the first instruction where they disagree")
+
+	return func(args []string) {
+		switch true {
+		case *dump:
+			fmt.Print(chip.Reference)
+			return
+		case *listParts:
+			printParts()
+			return
+		case 0 == len(args):
+			fatal(EXIT_USAGE, nil, errors.Errorf("bcc sim needs a program image"), "invalid arguments")
+		}
+		imgFile := args[0]
+
+		logger := log.WithFields(log.Fields{"img": imgFile})
+		img, err := ioutil.ReadFile(imgFile)
+		if nil != err {
+			fatal(EXIT_IO, logger, err, "failed to read program image")
+		}
+		target := loadTarget(logger, *isa)
+		checkImage(logger, imgFile, img, target, true, *force)
+
+		nl := chip.ReferenceNetlist()
+		if "" != *netlistFile {
+			logger = logger.WithFields(log.Fields{"netlist": *netlistFile})
+			src, err := ioutil.ReadFile(*netlistFile)
+			if nil != err {
+				fatal(EXIT_IO, logger, err, "failed to read netlist")
+			}
+			nl, err = chip.ParseNetlist(bytes.NewReader(src))
+			if nil != err {
+				fatal(EXIT_SOURCE, logger, err, "invalid netlist")
+			}
+		}
+
+		roms, err := ucode.ROMs(microcodeOps(target))
+		if nil != err {
+			fatal(EXIT_SOURCE, logger, err, "failed to generate microcode")
+		}
+		if "" != *prefix {
+			for k := range roms {
+				file := fmt.Sprintf("%s%d.img", *prefix, k)
+				roms[k], err = ioutil.ReadFile(file)
+				if nil != err {
+					fatal(EXIT_IO, logger, err, "failed to read decoder ROM")
+				}
+			}
+		}
+
+		sim, err := chip.New(nl, img, roms)
+		if nil != err {
+			fatal(EXIT_EMU, logger, err, "failed to initialize simulation")
+		}
+
+		machine, closeVCD := record(logger, sim, *hz)
+		clk, err := emu.NewClock(machine, *hz)
+		if nil != err {
+			fatal(EXIT_EMU, logger, err, "failed to initialize clock module")
+		}
+
+		if *panel {
+			if *manual {
+				clk.SetMode(emu.CLOCK_MANUAL)
+			}
+			err = runPanel(machine, clk)
+			closeVCD()
+			printIssues(sim)
+			if nil != err {
+				fatal(EXIT_EMU, logger, err, "front panel failure")
+			}
+			checkIssues(logger, sim)
+			return
+		}
+
+		var dbg *bcc.DebugInfo
+		if *trace {
+			dbg, err = bcc.LoadDebugInfo(imgFile)
+			if nil != err {
+				logger.WithError(err).Warn("no debug info, tracing addresses only")
+			}
+		}
+
+		var ref emu.CPU
+		if *compare {
+			ref, err = emu.New(img, emu.DefaultConfig())
+			if nil != err {
+				fatal(EXIT_EMU, logger, err, "failed to initialize emulator")
+			}
+		}
+
+		// Print each value latched into the output register, as bcc run does.
+		var mismatch error
+		err = clk.Run(context.Background(), func(state emu.State) bool {
+			if *trace && (0 == state.Step || state.Halted) {
+				fmt.Println(emu.Trace(img, state, dbg))
+			}
+			if 0 != state.Signals&ucode.OUT {
+				fmt.Println(state.Out)
+			}
+			if nil != ref {
+				if err := ref.Tick(); nil != err {
+					mismatch = errors.Wrap(err, "emulator: %s", err)
+					return false
+				}
+				if 0 == state.Step || state.Halted {
+					mismatch = compareState(ref.State(), state)
+					if nil != mismatch {
+						return false
+					}
+				}
+			}
+			return 0 == *cycles || state.Cycle < *cycles
+		})
+		closeVCD()
+		printIssues(sim)
+		if nil != err {
+			fatal(EXIT_EMU, logger, err, "simulation failure")
+		}
+		if nil != mismatch {
+			fatal(EXIT_FAIL, logger, mismatch, "simulation does not match the emulator")
+		}
+		checkIssues(logger, sim)
+	}
+}
+
+// compareState returns an error describing where a simulated machine state
+// differs from the emulator's at an instruction boundary. Only what a program
+// can observe is compared: the instruction register and the address
+// registers may legitimately hold other values between instructions, and the
+// emulator's reset clears the RAM where the hardware's does not.
+func compareState(want, have emu.State) error {
+	diffs := []string{}
+	diff := func(name string, want, have interface{}) {
+		if fmt.Sprint(want) != fmt.Sprint(have) {
+			diffs = append(diffs, fmt.Sprintf("%s=%v, emulator %v", name, have, want))
+		}
+	}
+	diff("A", want.A, have.A)
+	diff("X", want.X, have.X)
+	diff("Y", want.Y, have.Y)
+	diff("OUT", want.Out, have.Out)
+	diff("PC", want.PC, have.PC)
+	diff("carry", want.Carry, have.Carry)
+	diff("zero", want.Zero, have.Zero)
+	diff("halted", want.Halted, have.Halted)
+	diff("stack", want.Stack, have.Stack)
+	if 0 == len(diffs) {
+		return nil
+	}
+	return errors.Errorf("cycle %d, 0x%02X: %s", have.Cycle, want.Addr, strings.Join(diffs, "; "))
+}
+
+// printIssues prints the wiring faults the simulation found.
+func printIssues(sim *chip.Sim) {
+	for _, issue := range sim.Issues() {
+		fmt.Fprintln(os.Stderr, issue)
+	}
+}
+
+// checkIssues exits 1 if the simulation found wiring faults.
+func checkIssues(logger *log.Entry, sim *chip.Sim) {
+	if n := len(sim.Issues()); 0 < n {
+		fatal(EXIT_FAIL, logger, errors.Errorf("%d wiring faults", n), "simulation found wiring faults")
+	}
+}
+
+// printParts lists the part types a netlist can place.
+func printParts() {
+	names := []string{}
+	for name := range chip.Parts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		spec := chip.Parts[name]
+		fmt.Printf("%-8s %s\n", name, spec.Doc)
+		fmt.Printf("         %s\n", strings.Join(spec.Pins(), " "))
+	}
+}
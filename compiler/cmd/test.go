@@ -0,0 +1,147 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/asmtest"
+)
+
+// testCmd runs assembly unit tests. Arguments are test files, directories,
+// or directories ending in /... to search recursively, like go test.
+//
+//	bcc test [flags] [./...]
+func testCmd(flags *flag.FlagSet) func(args []string) {
+	verbose := flags.Bool("v", false, "list every case, not only failures")
+	run := flags.String("run", "", "only run cases whose name contains this string")
+
+	return func(args []string) {
+		patterns := args
+		if 0 == len(patterns) {
+			patterns = []string{"."}
+		}
+		files, err := findTests(patterns)
+		if nil != err {
+			fatal(EXIT_IO, nil, err, "failed to find test files")
+		}
+		if 0 == len(files) {
+			fmt.Fprintln(os.Stderr, "no test files found")
+			os.Exit(EXIT_FAIL)
+		}
+
+		failed := false
+		for _, file := range files {
+			if !runTests(file, *run, *verbose) {
+				failed = true
+			}
+		}
+		if failed {
+			fmt.Println("FAIL")
+			os.Exit(EXIT_FAIL)
+		}
+	}
+}
+
+// runTests runs the cases of a test file and prints the results. It returns
+// false if any case failed.
+func runTests(file, run string, verbose bool) bool {
+	suite, err := asmtest.ParseFile(file)
+	if nil == err {
+		cases := []*asmtest.Case{}
+		for _, tc := range suite.Cases {
+			if strings.Contains(tc.Name, run) {
+				cases = append(cases, tc)
+			}
+		}
+		suite.Cases = cases
+	}
+	var results []*asmtest.Result
+	if nil == err {
+		results, err = suite.Run()
+	}
+	if nil != err {
+		fmt.Printf("FAIL\t%s\n\t%s\n", file, err)
+		return false
+	}
+
+	passed := 0
+	for _, res := range results {
+		if res.Passed() {
+			passed++
+			if verbose {
+				fmt.Printf("--- PASS: %s (%d cycles)\n", res.Case.Name, res.Cycles)
+			}
+			continue
+		}
+		fmt.Printf("--- FAIL: %s (%d cycles)\n", res.Case.Name, res.Cycles)
+		for _, failure := range res.Failures {
+			fmt.Printf("    %s\n", failure)
+		}
+		fmt.Println("    trace:")
+		for _, line := range res.Trace {
+			fmt.Printf("        %s\n", line)
+		}
+	}
+
+	if passed < len(results) {
+		fmt.Printf("FAIL\t%s\t%d of %d cases failed\n", file, len(results)-passed, len(results))
+		return false
+	}
+	fmt.Printf("ok  \t%s\t%d cases\n", file, len(results))
+	return true
+}
+
+// findTests expands the command line patterns into a sorted list of test
+// files.
+func findTests(patterns []string) ([]string, error) {
+	found := map[string]bool{}
+	for _, pattern := range patterns {
+		recursive := false
+		if strings.HasSuffix(pattern, "/...") || "..." == pattern {
+			recursive = true
+			pattern = strings.TrimSuffix(strings.TrimSuffix(pattern, "..."), "/")
+			if "" == pattern {
+				pattern = "."
+			}
+		}
+
+		info, err := os.Stat(pattern)
+		if nil != err {
+			return nil, err
+		}
+		if !info.IsDir() {
+			found[pattern] = true
+			continue
+		}
+
+		err = filepath.Walk(pattern, func(path string, info os.FileInfo, err error) error {
+			if nil != err {
+				return err
+			}
+			if info.IsDir() {
+				if path != pattern && (!recursive || "vendor" == info.Name() || strings.HasPrefix(info.Name(), ".")) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasSuffix(path, "_test.asm") {
+				found[path] = true
+			}
+			return nil
+		})
+		if nil != err {
+			return nil, err
+		}
+	}
+
+	files := []string{}
+	for file := range found {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/emu"
+
+	"github.com/bdlm/log/v2"
+)
+
+// vcdFlags defines the waveform recording flags of the commands that run
+// images. The function it returns wraps a CPU in a recorder when -vcd is
+// given, and returns the function that completes the dump.
+func vcdFlags(flags *flag.FlagSet) func(logger *log.Entry, cpu emu.CPU, hz float64) (emu.CPU, func()) {
+	file := flags.String("vcd", "", "record a waveform of every clock edge to this VCD file")
+	signals := flags.String("vcd-signals", "", "comma separated signals to record, glob patterns such as 'cpu.*' or 'RO*', all if empty")
+	from := flags.Uint64("vcd-from", 0, "first clock cycle to record")
+	to := flags.Uint64("vcd-to", 0, "last clock cycle to record, 0 for no limit")
+
+	return func(logger *log.Entry, cpu emu.CPU, hz float64) (emu.CPU, func()) {
+		if "" == *file {
+			return cpu, func() {}
+		}
+		logger = logger.WithFields(log.Fields{"vcd": *file})
+		cfg := emu.VCDConfig{From: *from, To: *to, Hz: hz}
+		for _, pattern := range strings.Split(*signals, ",") {
+			if pattern = strings.TrimSpace(pattern); "" != pattern {
+				cfg.Signals = append(cfg.Signals, pattern)
+			}
+		}
+
+		out, err := os.Create(*file)
+		if nil != err {
+			fatal(EXIT_IO, logger, err, "failed to create waveform file")
+		}
+		rec, err := emu.NewRecorder(cpu, out, cfg)
+		if nil != err {
+			out.Close()
+			os.Remove(*file)
+			fatal(EXIT_USAGE, logger, err, "invalid waveform recording")
+		}
+		return rec, func() {
+			err := rec.Close()
+			if nil == err {
+				err = out.Close()
+			}
+			if nil != err {
+				fatal(EXIT_IO, logger, err, "failed to write waveform file")
+			}
+		}
+	}
+}
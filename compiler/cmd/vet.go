@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+
+	"github.com/bdlm/log/v2"
+)
+
+// vetCmd reports semantic mistakes in a source file. It exits 1 if any
+// diagnostics are reported.
+//
+//	bcc vet [flags] src.asm
+func vetCmd(flags *flag.FlagSet) func(args []string) {
+	asJSON := flags.Bool("json", false, "print diagnostics as JSON")
+	disable := flags.String("disable", "", "comma separated rules to skip")
+	only := flags.String("only", "", "comma separated rules to report, all others are skipped")
+	list := flags.Bool("rules", false, "list the available rules and exit")
+	stackSize := flags.Int("stack", bcc.StackDepth, "hardware stack depth")
+	includes := listFlag{}
+	flags.Var(&includes, "I", "directory searched for included files, may be repeated")
+
+	return func(args []string) {
+		rules := []string{}
+		for rule := range bcc.VetRules {
+			rules = append(rules, rule)
+		}
+		sort.Strings(rules)
+
+		if *list {
+			for _, rule := range rules {
+				fmt.Printf("%-16s  %s\n", rule, bcc.VetRules[rule])
+			}
+			return
+		}
+
+		if 1 != len(args) {
+			flags.Usage()
+			os.Exit(EXIT_USAGE)
+		}
+		sourceFile := args[0]
+
+		cfg := bcc.VetConfig{Disabled: map[string]bool{}}
+		if "" != *only {
+			for _, rule := range rules {
+				cfg.Disabled[rule] = true
+			}
+			for _, rule := range strings.Split(*only, ",") {
+				if _, ok := bcc.VetRules[strings.TrimSpace(rule)]; !ok {
+					fmt.Fprintf(os.Stderr, "unknown vet rule '%s'\n", rule)
+					os.Exit(EXIT_USAGE)
+				}
+				delete(cfg.Disabled, strings.TrimSpace(rule))
+			}
+		}
+		if "" != *disable {
+			for _, rule := range strings.Split(*disable, ",") {
+				cfg.Disabled[strings.TrimSpace(rule)] = true
+			}
+		}
+
+		logger := log.WithFields(log.Fields{"src": sourceFile})
+		prg, err := bcc.New(sourceFile, "")
+		if nil != err {
+			fatal(EXIT_IO, logger, err, "failed to initialize bit code compiler")
+		}
+		prg.SetStackSize(*stackSize)
+		prg.SetIncludePaths(includes)
+
+		err = prg.Parse()
+		if nil != err {
+			fatal(EXIT_SOURCE, logger, err, "failed to parse source file")
+		}
+
+		diags, err := prg.Vet(cfg)
+		if nil != err {
+			fatal(EXIT_SOURCE, logger, err, "failed to vet program")
+		}
+
+		if *asJSON {
+			byts, err := json.MarshalIndent(diags, "", "  ")
+			if nil != err {
+				fatal(EXIT_IO, logger, err, "failed to encode diagnostics")
+			}
+			fmt.Println(string(byts))
+		} else {
+			for _, diag := range diags {
+				file := sourceFile
+				if "" != diag.File {
+					file = diag.File
+				}
+				fmt.Printf("%s:%d: %s: %s (%s)\n", file, diag.Line, diag.Severity, diag.Message, diag.Rule)
+			}
+		}
+
+		if 0 < len(diags) {
+			os.Exit(EXIT_FAIL)
+		}
+	}
+}
@@ -12,23 +12,23 @@ $d2 0b1110 # 14 - hex: 0e; bin: 1110  : 00 0e
 
 # initialize registers
 reset {
-    LDAV    0   # set register A to 0x00
-    LDXV    0   # set register X to 0x00
-    LDYV    0   # set register Y to 0x00
+    LDAV 0 # set register A to 0x00
+    LDXV 0 # set register X to 0x00
+    LDYV 0 # set register Y to 0x00
 }
 
 # calculate the next fibonacci number
 nextfib {
-    LDYA    # copy register A to register y
-    ADDX    # add register A (always) + register X, store result in A (always)
-    LDXY    # copy register Y to register X
+    LDYA # copy register A to register y
+    ADDX # add register A (always) + register X, store result in A (always)
+    LDXY # copy register Y to register X
 }
 
 # initialize. no label required.
-    RUN     reset   # reset all data registers
-    LDAV    1       # set register A to 0x01
-    LDXV    0       # set register X to 0x01
-    LDYV    1       # set register y to 0x01
+    RUN  reset # reset all data registers
+    LDAV 1     # set register A to 0x01
+    LDXV 0     # set register X to 0x01
+    LDYV 1     # set register y to 0x01
 
 # simple addition statement. the label is optional because it's never referenced
 add
@@ -38,6 +38,6 @@ add
 
 # this label is required, it is referenced in code below to create a loop
 loop
-    OUTA        # copy register A (rid 0) to the output register
-    RUN nextfib # call Fibonacci subroutine
-    JMP loop    # loop forever
+    OUTA         # copy register A (rid 0) to the output register
+    RUN  nextfib # call Fibonacci subroutine
+    JMP  loop    # loop forever
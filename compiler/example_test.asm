@@ -0,0 +1,5 @@
+# tests for example.asm, run with `bcc test`
+
+#: cycles 2000
+#: out    42 42 42 84 126 210 80 34 ...
+#: stack  empty
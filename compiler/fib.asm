@@ -5,8 +5,8 @@
 
 # loop
 loop
-    OUTA     # copy register A to the output register
-    LDYA     # copy register A to register Y
-    ADDX     # add register A (always) + register X, store result in register A (always)
-    LDXY     # copy register Y to register X
-    JMP loop # loop forever
+    OUTA      # copy register A to the output register
+    LDYA      # copy register A to register Y
+    ADDX      # add register A (always) + register X, store result in register A (always)
+    LDXY      # copy register Y to register X
+    JMP  loop # loop forever
@@ -0,0 +1,12 @@
+# tests for fib.asm, run with `bcc test`
+
+#: cycles 2000
+#: out    1 1 2 3 5 8 13 21 34 55 89 144 233 121 ...
+#: stack  empty
+
+#: case   wraps at 8 bits
+#: expect A=121 X=233
+
+#: case   enter the loop with registers set
+#: set    PC=6 A=2 X=1
+#: out    2 3 5 8 ...
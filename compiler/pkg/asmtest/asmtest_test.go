@@ -0,0 +1,190 @@
+package asmtest_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/asmtest"
+
+	"github.com/bdlm/errors/v2"
+)
+
+// rootText returns the message of the innermost error an error wraps.
+func rootText(err error) string {
+	for nil != errors.Unwrap(err) {
+		err = errors.Unwrap(err)
+	}
+	return err.Error()
+}
+
+func TestParse(t *testing.T) {
+	src := `
+#: program fib.asm
+#: depth   4
+#: cycles  0x100
+#: set     A=2 RAM[3]=-1
+#: out     1 2 ...
+
+#: case    first
+#: expect  X=3 CARRY=1
+#: halt
+
+#: case    second case
+#: out     4 0b101
+#: stack   empty
+`
+	suite, err := asmtest.Parse("fib_test.asm", []byte(src))
+	if nil != err {
+		t.Fatalf("parse: %s", err)
+	}
+	if "fib.asm" != suite.Program || 4 != suite.StackDepth || 2 != len(suite.Cases) {
+		t.Fatalf("suite: got %+v", suite)
+	}
+
+	first, second := suite.Cases[0], suite.Cases[1]
+	got := fmt.Sprintf("%s %d %v %v %v %v %v %v", first.Name, first.Cycles, first.Set, first.Out, first.OutPrefix, first.Expect, first.Halt, first.Stack)
+	if want := "first 256 [A=0x02 RAM[3]=0xFF] [1 2] true [X=0x03 CARRY=0x01] true []"; got != want {
+		t.Errorf("first case:\n got  %s\n want %s", got, want)
+	}
+	got = fmt.Sprintf("%s %d %v %v %v %v %v %v", second.Name, second.Cycles, second.Set, second.Out, second.OutPrefix, second.Expect, second.Halt, second.Stack)
+	if want := "second case 256 [A=0x02 RAM[3]=0xFF] [4 5] false [] false []"; got != want {
+		t.Errorf("second case:\n got  %s\n want %s", got, want)
+	}
+	if nil != first.Stack || nil == second.Stack {
+		t.Errorf("stack: only the second case expects an empty stack")
+	}
+
+	// a file without cases is a single case named after it
+	suite, err = asmtest.Parse("add_test.asm", []byte("#: out 42\n"))
+	if nil != err || 1 != len(suite.Cases) || "add" != suite.Cases[0].Name || asmtest.DefaultCycles != suite.Cases[0].Cycles {
+		t.Errorf("single case: got %+v, %v", suite.Cases, err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"#: bogus 1", "unknown directive 'bogus'"},
+		{"#: case a\n#: program x.asm", "program must be set before the first case"},
+		{"#: case", "case requires a name"},
+		{"#: cycles 0", "invalid cycle count '0'"},
+		{"#: depth 0", "invalid stack depth '0'"},
+		{"#: set B=1", "unknown register 'B'"},
+		{"#: set A", "expected NAME=value, found 'A'"},
+		{"#: set A=256", "invalid byte value '256'"},
+		{"#: set RAM[16]=1", "invalid RAM address in 'RAM[16]=1'"},
+		{"#: expect ZERO=2", "flag ZERO must be 0 or 1"},
+		{"#: out 1 x", "invalid byte value 'x'"},
+	}
+	for _, tt := range tests {
+		_, err := asmtest.Parse("x_test.asm", []byte(tt.src))
+		if nil == err || !strings.Contains(rootText(err), tt.want) {
+			t.Errorf("%q: got %v, want an error containing %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+// TestExamples runs the test files of the example programs.
+func TestExamples(t *testing.T) {
+	files, err := filepath.Glob("../../*_test.asm")
+	if nil != err || 0 == len(files) {
+		t.Fatalf("no example tests: %v", err)
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			suite, err := asmtest.ParseFile(file)
+			if nil != err {
+				t.Fatalf("parse: %s", err)
+			}
+			if want := strings.TrimSuffix(file, "_test.asm") + ".asm"; suite.Program != want {
+				t.Errorf("program: got %s, want %s", suite.Program, want)
+			}
+			results, err := suite.Run()
+			if nil != err {
+				t.Fatalf("run: %s", err)
+			}
+			for _, res := range results {
+				if !res.Passed() {
+					t.Errorf("%s: %v", res.Case.Name, res.Failures)
+				}
+			}
+		})
+	}
+}
+
+func TestFailures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "asmtest")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a file with code is its own program
+	file := filepath.Join(dir, "count_test.asm")
+	src := `#: cycles 200
+#: case    passes
+#: out     1 2 3 ...
+#: case    fails
+#: out     1 3 ...
+#: expect  A=9
+#: stack   1
+#: halt
+#: case    halts
+#: set     PC=7
+#: halt
+#: expect  A=0
+
+    LDAV 1
+loop
+    OUTA
+    ADDV 1
+    JMP  loop
+    HLT
+`
+	if err = ioutil.WriteFile(file, []byte(src), 0644); nil != err {
+		t.Fatal(err)
+	}
+	suite, err := asmtest.ParseFile(file)
+	if nil != err {
+		t.Fatalf("parse: %s", err)
+	}
+	if file != suite.Program {
+		t.Errorf("program: got %s, want the test file", suite.Program)
+	}
+	results, err := suite.Run()
+	if nil != err {
+		t.Fatalf("run: %s", err)
+	}
+
+	if !results[0].Passed() || "1 2 3" != strings.Trim(fmt.Sprint(results[0].Out), "[]") {
+		t.Errorf("passes: %v, output %v", results[0].Failures, results[0].Out)
+	}
+	// a prefix stops the run once enough bytes were written
+	want := []string{
+		"halt: not reached within 200 cycles",
+		"out: got 1 2, want 1 3 ...",
+		"A: got 0x02, want 0x09",
+		"stack: got [], want [1]",
+	}
+	if got := results[1].Failures; strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("fails:\n got  %q\n want %q", got, want)
+	}
+	if n := len(results[1].Trace); 0 == n || n > asmtest.TraceLen {
+		t.Errorf("trace: got %d instructions, want 1-%d", n, asmtest.TraceLen)
+	}
+	if !results[2].Passed() || !results[2].State.Halted {
+		t.Errorf("halts: %v", results[2].Failures)
+	}
+
+	// a program that doesn't assemble is an error
+	suite.Source = []byte("    JMP nowhere\n")
+	if _, err = suite.Run(); nil == err || !strings.Contains(err.Error(), "undefined label 'nowhere'") {
+		t.Errorf("run a broken program: got %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+package asmtest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/emu"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/ucode"
+
+	"github.com/bdlm/errors/v2"
+)
+
+const (
+	ramSize = emu.RAMSize
+
+	// TraceLen is the number of instructions shown before a failure.
+	TraceLen = 8
+)
+
+// Result is the outcome of a case.
+type Result struct {
+	Case *Case
+	// clock pulses executed
+	Cycles uint64
+	// values latched into the OUT register
+	Out []byte
+	// final machine state
+	State emu.State
+	// unmet expectations, empty if the case passed
+	Failures []string
+	// the last instructions executed, oldest first
+	Trace []string
+}
+
+// Passed returns whether every expectation was met.
+func (res *Result) Passed() bool {
+	return 0 == len(res.Failures)
+}
+
+// Run assembles the program and runs every case. An error is returned if the
+// program doesn't assemble; emulation errors fail the case they occur in.
+func (suite *Suite) Run() ([]*Result, error) {
+	cfg := emu.DefaultConfig()
+	if 0 < suite.StackDepth {
+		cfg.StackDepth = suite.StackDepth
+	}
+	target := bcc.DefaultTarget()
+	target.StackDepth = cfg.StackDepth
+	prog, err := bcc.NewAssembler(
+		bcc.WithTarget(target),
+		bcc.WithSourceName(suite.Program),
+	).Assemble(context.Background(), bytes.NewReader(suite.Source))
+	if nil != err {
+		if nil != prog {
+			for _, diag := range prog.Diagnostics {
+				if bcc.SEV_ERROR == diag.Severity {
+					err = errors.Errorf("%s", diag)
+					break
+				}
+			}
+		}
+		return nil, errors.Wrap(err, "could not assemble '%s': %s", suite.Program, err)
+	}
+	dbg := prog.DebugInfo(suite.Program)
+
+	results := []*Result{}
+	for _, tc := range suite.Cases {
+		res, err := RunCase(prog.Image, dbg, cfg, tc)
+		if nil != err {
+			return nil, err
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// RunCase runs a program image from the case's initial state until it halts,
+// fails, produces the expected output prefix or exhausts the cycle budget,
+// then checks the expectations. dbg adds source lines to the trace and may be
+// nil.
+func RunCase(img []byte, dbg *bcc.DebugInfo, cfg emu.Config, tc *Case) (*Result, error) {
+	cpu, err := emu.New(img, cfg)
+	if nil != err {
+		return nil, errors.Wrap(err, "failed to initialize emulator")
+	}
+	state := cpu.State()
+	for _, assign := range tc.Set {
+		assign.apply(&state)
+	}
+	cpu.SetState(state)
+
+	res := &Result{Case: tc, Out: []byte{}, Failures: []string{}, Trace: []string{}}
+	var runErr error
+	for {
+		state = cpu.State()
+		if state.Halted || state.Cycle >= tc.Cycles {
+			break
+		}
+		if tc.OutPrefix && len(res.Out) >= len(tc.Out) {
+			break
+		}
+
+		runErr = cpu.Tick()
+		if nil != runErr {
+			break
+		}
+		state = cpu.State()
+		if 0 != state.Signals&ucode.OUT {
+			res.Out = append(res.Out, state.Out)
+		}
+		if 0 == state.Step || state.Halted {
+			res.Trace = append(res.Trace, emu.Trace(img, state, dbg))
+			if len(res.Trace) > TraceLen {
+				res.Trace = res.Trace[1:]
+			}
+		}
+	}
+	res.State = cpu.State()
+	res.Cycles = res.State.Cycle
+
+	if nil != runErr {
+		res.fail("emulation failed after %d cycles: %s", res.Cycles, runErr)
+	}
+	res.check(tc)
+	return res, nil
+}
+
+// fail records an unmet expectation.
+func (res *Result) fail(format string, args ...interface{}) {
+	res.Failures = append(res.Failures, fmt.Sprintf(format, args...))
+}
+
+// check compares the final state with the expectations.
+func (res *Result) check(tc *Case) {
+	state := res.State
+
+	if tc.Halt && !state.Halted {
+		res.fail("halt: not reached within %d cycles", tc.Cycles)
+	}
+
+	if nil != tc.Out {
+		got := res.Out
+		if tc.OutPrefix && len(got) > len(tc.Out) {
+			got = got[:len(tc.Out)]
+		}
+		if string(got) != string(tc.Out) {
+			want := formatBytes(tc.Out)
+			if tc.OutPrefix {
+				want = want + " ..."
+			}
+			res.fail("out: got %s, want %s", formatBytes(res.Out), want)
+		}
+	}
+
+	for _, assign := range tc.Expect {
+		got := assign
+		got.Value = assign.read(state)
+		if got.Value != assign.Value {
+			res.fail("%s: got 0x%02X, want 0x%02X", strings.SplitN(assign.String(), "=", 2)[0], got.Value, assign.Value)
+		}
+	}
+
+	if nil != tc.Stack && string(state.Stack) != string(tc.Stack) {
+		res.fail("stack: got [%s], want [%s]", formatBytes(state.Stack), formatBytes(tc.Stack))
+	}
+}
+
+// apply sets a register or RAM cell.
+func (assign Assign) apply(state *emu.State) {
+	switch assign.Name {
+	case "A":
+		state.A = assign.Value
+	case "X":
+		state.X = assign.Value
+	case "Y":
+		state.Y = assign.Value
+	case "OUT":
+		state.Out = assign.Value
+	case "PC":
+		state.PC = assign.Value
+	case "CARRY":
+		state.Carry = 0 != assign.Value
+	case "ZERO":
+		state.Zero = 0 != assign.Value
+	case "RAM":
+		state.RAM[assign.Addr] = assign.Value
+	}
+}
+
+// read returns the value of a register or RAM cell.
+func (assign Assign) read(state emu.State) byte {
+	flag := func(b bool) byte {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	switch assign.Name {
+	case "A":
+		return state.A
+	case "X":
+		return state.X
+	case "Y":
+		return state.Y
+	case "OUT":
+		return state.Out
+	case "PC":
+		return state.PC
+	case "CARRY":
+		return flag(state.Carry)
+	case "ZERO":
+		return flag(state.Zero)
+	case "RAM":
+		return state.RAM[assign.Addr]
+	}
+	return 0
+}
+
+// formatBytes prints bytes as space separated decimal values.
+func formatBytes(byts []byte) string {
+	s := []string{}
+	for _, byt := range byts {
+		s = append(s, fmt.Sprintf("%d", byt))
+	}
+	return strings.Join(s, " ")
+}
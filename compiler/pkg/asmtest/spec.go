@@ -0,0 +1,311 @@
+// Package asmtest runs assembly unit tests: programs are assembled, executed
+// in the emulator from a declared initial state, and checked against the
+// expected output, registers, RAM and stack.
+//
+// Tests are declared in `#:` comment directives, so a test file is also
+// valid assembly source:
+//
+//	#: program fib.asm
+//	#: cycles  2000
+//	#: out     1 1 2 3 5 8 13 ...
+//
+//	#: case    seeded
+//	#: set     A=2
+//	#: expect  X=3
+//
+// Directives before the first `case` apply to every case. A file without
+// cases is a single case.
+package asmtest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bdlm/errors/v2"
+)
+
+const (
+	// DefaultCycles is the clock pulse budget of a case that doesn't set one.
+	DefaultCycles = 10000
+
+	// ext is the suffix of test files.
+	ext = "_test.asm"
+)
+
+// Register names accepted by the set and expect directives, besides
+// RAM[n].
+var registers = []string{"A", "X", "Y", "OUT", "PC", "CARRY", "ZERO"}
+
+// Assign is a register or RAM cell and its value.
+type Assign struct {
+	// register name or "RAM"
+	Name string
+	// RAM address
+	Addr  int
+	Value byte
+}
+
+// String implements Stringer.
+func (assign Assign) String() string {
+	if "RAM" == assign.Name {
+		return fmt.Sprintf("RAM[%d]=0x%02X", assign.Addr, assign.Value)
+	}
+	return fmt.Sprintf("%s=0x%02X", assign.Name, assign.Value)
+}
+
+// Case is one run of a program and its expectations.
+type Case struct {
+	Name string
+	// clock pulse budget
+	Cycles uint64
+	// initial state, applied after reset
+	Set []Assign
+
+	// expected OUT register values in order, nil for no expectation
+	Out []byte
+	// Out is a prefix of the output, the run stops once it is produced
+	OutPrefix bool
+	// expected final register and RAM values
+	Expect []Assign
+	// the program must halt within the budget
+	Halt bool
+	// expected final stack, bottom first, nil for no expectation
+	Stack []byte
+}
+
+// Suite is the cases of a test file.
+type Suite struct {
+	// test file
+	File string
+	// program source file
+	Program string
+	// program source
+	Source []byte
+	// hardware stack depth
+	StackDepth int
+	Cases      []*Case
+}
+
+// ParseFile reads a test file. The program under test is named by the
+// `program` directive, relative to the test file; otherwise the test file is
+// the program if it contains code, or else fib_test.asm tests fib.asm.
+func ParseFile(path string) (*Suite, error) {
+	src, err := ioutil.ReadFile(path)
+	if nil != err {
+		return nil, errors.Wrap(err, "could not read test file '%s'", path)
+	}
+	suite, err := Parse(path, src)
+	if nil != err {
+		return nil, err
+	}
+
+	switch true {
+	case "" != suite.Program:
+		suite.Program = filepath.Join(filepath.Dir(path), suite.Program)
+	case hasCode(src):
+		suite.Program = path
+	default:
+		suite.Program = strings.TrimSuffix(path, ext) + ".asm"
+	}
+	if path == suite.Program {
+		suite.Source = src
+		return suite, nil
+	}
+
+	suite.Source, err = ioutil.ReadFile(suite.Program)
+	if nil != err {
+		return nil, errors.Wrap(err, "could not read program '%s'", suite.Program)
+	}
+	return suite, nil
+}
+
+// hasCode returns whether assembly source has any code outside comments.
+func hasCode(src []byte) bool {
+	for _, line := range strings.Split(string(src), "\n") {
+		if "" != strings.TrimSpace(strings.SplitN(line, "#", 2)[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse reads the directives of a test file. The program is not loaded.
+func Parse(name string, src []byte) (*Suite, error) {
+	suite := &Suite{File: name}
+	defaults := &Case{Name: strings.TrimSuffix(filepath.Base(name), ext), Cycles: DefaultCycles}
+	current := defaults
+
+	for idx, line := range strings.Split(string(src), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "#:") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "#:"))
+		if 0 == len(fields) {
+			continue
+		}
+		err := suite.directive(&current, defaults, fields[0], fields[1:])
+		if nil != err {
+			return nil, errors.Wrap(err, "%s:%d: %s", name, idx+1, err)
+		}
+	}
+
+	if 0 == len(suite.Cases) {
+		suite.Cases = []*Case{defaults}
+	}
+	return suite, nil
+}
+
+// directive applies one directive to the current case.
+func (suite *Suite) directive(current **Case, defaults *Case, keyword string, args []string) error {
+	tc := *current
+	switch keyword {
+	case "program":
+		if 1 != len(args) {
+			return errors.Errorf("program requires a file name")
+		}
+		if tc != defaults {
+			return errors.Errorf("program must be set before the first case")
+		}
+		suite.Program = args[0]
+
+	case "depth":
+		if 1 != len(args) {
+			return errors.Errorf("depth requires a stack depth")
+		}
+		depth, err := strconv.Atoi(args[0])
+		if nil != err || depth < 1 {
+			return errors.Errorf("invalid stack depth '%s'", args[0])
+		}
+		suite.StackDepth = depth
+
+	case "case":
+		if 0 == len(args) {
+			return errors.Errorf("case requires a name")
+		}
+		tc := &Case{}
+		*tc = *defaults
+		tc.Name = strings.Join(args, " ")
+		tc.Set = append([]Assign{}, defaults.Set...)
+		tc.Expect = append([]Assign{}, defaults.Expect...)
+		suite.Cases = append(suite.Cases, tc)
+		*current = tc
+
+	case "cycles":
+		if 1 != len(args) {
+			return errors.Errorf("cycles requires a count")
+		}
+		cycles, err := strconv.ParseUint(args[0], 0, 64)
+		if nil != err || 0 == cycles {
+			return errors.Errorf("invalid cycle count '%s'", args[0])
+		}
+		tc.Cycles = cycles
+
+	case "set", "expect":
+		assigns, err := parseAssigns(args)
+		if nil != err {
+			return err
+		}
+		if "set" == keyword {
+			tc.Set = append(tc.Set, assigns...)
+		} else {
+			tc.Expect = append(tc.Expect, assigns...)
+		}
+
+	case "out":
+		tc.OutPrefix = 0 < len(args) && "..." == args[len(args)-1]
+		if tc.OutPrefix {
+			args = args[:len(args)-1]
+		}
+		out, err := parseBytes(args)
+		if nil != err {
+			return err
+		}
+		tc.Out = out
+
+	case "halt":
+		tc.Halt = true
+
+	case "stack":
+		if 1 == len(args) && "empty" == args[0] {
+			tc.Stack = []byte{}
+			break
+		}
+		stack, err := parseBytes(args)
+		if nil != err {
+			return err
+		}
+		tc.Stack = stack
+
+	default:
+		return errors.Errorf("unknown directive '%s'", keyword)
+	}
+	return nil
+}
+
+// parseByte parses a hex, binary or decimal byte value.
+func parseByte(s string) (byte, error) {
+	v, err := strconv.ParseInt(s, 0, 16)
+	if nil != err || v < -128 || v > 255 {
+		return 0, errors.Errorf("invalid byte value '%s'", s)
+	}
+	return byte(v), nil
+}
+
+// parseBytes parses a list of byte values.
+func parseBytes(args []string) ([]byte, error) {
+	byts := []byte{}
+	for _, arg := range args {
+		byt, err := parseByte(arg)
+		if nil != err {
+			return nil, err
+		}
+		byts = append(byts, byt)
+	}
+	return byts, nil
+}
+
+// parseAssigns parses NAME=value pairs. Flags take 0 or 1.
+func parseAssigns(args []string) ([]Assign, error) {
+	assigns := []Assign{}
+	for _, arg := range args {
+		p := strings.SplitN(arg, "=", 2)
+		if 2 != len(p) {
+			return nil, errors.Errorf("expected NAME=value, found '%s'", arg)
+		}
+		assign := Assign{Name: strings.ToUpper(p[0])}
+		if strings.HasPrefix(assign.Name, "RAM[") && strings.HasSuffix(assign.Name, "]") {
+			addr, err := strconv.ParseUint(assign.Name[4:len(assign.Name)-1], 0, 8)
+			if nil != err || addr >= ramSize {
+				return nil, errors.Errorf("invalid RAM address in '%s'", arg)
+			}
+			assign.Name, assign.Addr = "RAM", int(addr)
+		} else if !known(assign.Name) {
+			return nil, errors.Errorf("unknown register '%s'", p[0])
+		}
+
+		value, err := parseByte(p[1])
+		if nil != err {
+			return nil, err
+		}
+		if ("CARRY" == assign.Name || "ZERO" == assign.Name) && value > 1 {
+			return nil, errors.Errorf("flag %s must be 0 or 1", p[0])
+		}
+		assign.Value = value
+		assigns = append(assigns, assign)
+	}
+	return assigns, nil
+}
+
+// known returns whether a register can be set and checked.
+func known(name string) bool {
+	for _, reg := range registers {
+		if name == reg {
+			return true
+		}
+	}
+	return false
+}
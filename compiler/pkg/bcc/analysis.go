@@ -0,0 +1,223 @@
+package bcc
+
+import (
+	"sort"
+	"strings"
+)
+
+// SymbolKind is the kind of a named program location or value.
+type SymbolKind string
+
+const (
+	SYM_LABEL SymbolKind = "label"
+	SYM_SUB   SymbolKind = "subroutine"
+	SYM_CONST SymbolKind = "constant"
+)
+
+// Span is a range of a source line. Line is 1-based, Col is a 0-based byte
+// offset.
+type Span struct {
+	// included file, "" for the main source
+	File string `json:"file,omitempty"`
+	Line int    `json:"line"`
+	Col  int    `json:"col"`
+	Len  int    `json:"len"`
+}
+
+// Contains returns whether a position of the main source falls within the
+// span, including the position just after it.
+func (span Span) Contains(line, col int) bool {
+	return "" == span.File && line == span.Line && col >= span.Col && col <= span.Col+span.Len
+}
+
+// Symbol is a label, subroutine or constant, where it is defined and where
+// it is referenced.
+type Symbol struct {
+	Name string     `json:"name"`
+	Kind SymbolKind `json:"kind"`
+	Def  Span       `json:"def"`
+	Refs []Span     `json:"refs"`
+	// last line of a subroutine
+	End int `json:"end,omitempty"`
+	// ROM address of a label or subroutine, value of a constant, -1 if the
+	// program did not assemble
+	Value int `json:"value"`
+}
+
+// Field is a whitespace separated word of source code.
+type Field struct {
+	Text string
+	Span Span
+}
+
+// Analysis is everything known about a source file, for editors.
+type Analysis struct {
+	Lines       []string
+	Diagnostics []Diagnostic
+	Symbols     []*Symbol
+}
+
+// Analyze parses and assembles source held in memory, never touching the
+// filesystem. Every call uses its own assembler state, so it is safe to call
+// concurrently. Diagnostics cover syntax errors on every line; if there are
+// none the program is assembled and vetted. Included files are searched for
+// in the working directory, then the include paths.
+func Analyze(src []byte, includePaths ...string) *Analysis {
+	prg, _ := NewSource(src)
+	prg.SetIncludePaths(includePaths)
+	an := &Analysis{Lines: prg.lines} // before includes are expanded
+
+	assembled := false
+	if nil == prg.lex() {
+		_, err := prg.Vet(VetConfig{})
+		assembled = nil == err
+	}
+	an.Diagnostics = prg.Diagnostics()
+
+	an.Symbols = prg.symbols(assembled)
+	return an
+}
+
+// symbols returns the labels, subroutines and constants of the lexed source
+// and their references. Addresses are only known once the program is
+// assembled.
+func (bcc *bcc) symbols(assembled bool) []*Symbol {
+	syms := []*Symbol{}
+	byName := map[string]*Symbol{}
+	span := func(inst *instruction, field Field) Span {
+		field.Span.File, field.Span.Line = bcc.position(inst.ln)
+		return field.Span
+	}
+
+	for _, inst := range bcc.instructions {
+		fields := LineFields(bcc.lines[inst.ln-1])
+		if 0 == len(fields) {
+			continue
+		}
+
+		var sym *Symbol
+		switch inst.tokens[0].typ {
+		case TOK_CONST:
+			sym = &Symbol{Name: inst.tokens[0].tkn, Kind: SYM_CONST, Value: int(bcc.constMap[inst.tokens[0].tkn])}
+		case TOK_LABEL:
+			sym = &Symbol{Name: inst.tokens[0].tkn, Kind: SYM_LABEL, Value: -1}
+		case TOK_SUB:
+			sym = &Symbol{Name: strings.TrimSuffix(inst.tokens[0].tkn, "{"), Kind: SYM_SUB, Value: -1}
+			end := inst.ln
+			for _, body := range bcc.instructions {
+				if sym.Name == body.sub && body.ln > end {
+					end = body.ln
+				}
+			}
+			_, sym.End = bcc.position(end)
+		}
+		if nil != sym {
+			sym.Def = span(inst, fields[0])
+			sym.Def.Len = len(sym.Name)
+			sym.Refs = []Span{}
+			if assembled && SYM_CONST != sym.Kind {
+				sym.Value = inst.addr
+			}
+			byName[string(sym.Kind)+":"+sym.Name] = sym
+			syms = append(syms, sym)
+		}
+	}
+
+	for _, inst := range bcc.instructions {
+		param := inst.op.param
+		if nil == param {
+			continue
+		}
+		fields := LineFields(bcc.lines[inst.ln-1])
+
+		var sym *Symbol
+		switch param.typ {
+		case TOK_CREF:
+			sym = byName[string(SYM_CONST)+":"+param.tkn]
+		case TOK_LREF:
+			sym = byName[string(SYM_LABEL)+":"+param.tkn]
+			if "RUN" == inst.opName() || nil == sym {
+				sym = byName[string(SYM_SUB)+":"+param.tkn]
+			}
+		}
+		if nil != sym {
+			sym.Refs = append(sym.Refs, span(inst, fields[len(fields)-1]))
+		}
+	}
+
+	// main source first, then included files
+	sort.SliceStable(syms, func(i, j int) bool {
+		a, b := syms[i].Def, syms[j].Def
+		if a.File != b.File {
+			return "" == a.File
+		}
+		return a.Line < b.Line
+	})
+	return syms
+}
+
+// LineFields splits the code of a source line into fields with their
+// positions. A brace attached to a subroutine name is a separate field.
+func LineFields(line string) []Field {
+	code := strings.SplitN(line, "#", 2)[0]
+	fields := []Field{}
+	start := -1
+	for k := 0; k <= len(code); k++ {
+		space := k == len(code) || ' ' == code[k] || '\t' == code[k]
+		switch true {
+		case space && start >= 0:
+			text := code[start:k]
+			if 1 < len(text) && strings.HasSuffix(text, "{") {
+				fields = append(fields, Field{text[:len(text)-1], Span{Col: start, Len: len(text) - 1}})
+				fields = append(fields, Field{"{", Span{Col: k - 1, Len: 1}})
+			} else {
+				fields = append(fields, Field{text, Span{Col: start, Len: len(text)}})
+			}
+			start = -1
+		case !space && start < 0:
+			start = k
+		}
+	}
+	return fields
+}
+
+// FieldAt returns the field of a source line at a position, and its index
+// on the line.
+func (an *Analysis) FieldAt(line, col int) (Field, int, bool) {
+	if line < 1 || line > len(an.Lines) {
+		return Field{}, 0, false
+	}
+	for k, field := range LineFields(an.Lines[line-1]) {
+		field.Span.Line = line
+		if field.Span.Contains(line, col) {
+			return field, k, true
+		}
+	}
+	return Field{}, 0, false
+}
+
+// SymbolAt returns the symbol defined or referenced at a position.
+func (an *Analysis) SymbolAt(line, col int) (*Symbol, bool) {
+	for _, sym := range an.Symbols {
+		if sym.Def.Contains(line, col) {
+			return sym, true
+		}
+		for _, ref := range sym.Refs {
+			if ref.Contains(line, col) {
+				return sym, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Lookup returns the symbols with a name, of any kind.
+func (an *Analysis) Lookup(name string) []*Symbol {
+	syms := []*Symbol{}
+	for _, sym := range an.Symbols {
+		if name == sym.Name {
+			syms = append(syms, sym)
+		}
+	}
+	return syms
+}
@@ -0,0 +1,319 @@
+package bcc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/bdlm/errors/v2"
+)
+
+// OutputFormat is an encoding of the ROM image.
+type OutputFormat string
+
+const (
+	// raw image padded to 32 KiB
+	FORMAT_BIN OutputFormat = "bin"
+	// Intel HEX records of the program bytes, the padding is left erased
+	FORMAT_IHEX OutputFormat = "ihex"
+)
+
+// Target describes the hardware a program is assembled for.
+type Target struct {
+	Name string
+	// hardware stack capacity in bytes, 0 for machines without a stack
+	StackDepth int
+	// operations the hardware implements, nil for every operation
+	Ops []string
+}
+
+// DefaultTarget returns the reference build.
+func DefaultTarget() Target {
+	return Target{
+		Name:       "default",
+		StackDepth: StackDepth,
+	}
+}
+
+// Optimization levels.
+const (
+	// assemble the source as written
+	OPT_NONE = 0
+	// peephole rewrites
+	OPT_PEEPHOLE = 1
+	// remove dead subroutines and inline, then peephole rewrites
+	OPT_INLINE = 2
+)
+
+// Option configures an Assembler.
+type Option func(*Assembler)
+
+// WithTarget sets the hardware to assemble for.
+func WithTarget(target Target) Option {
+	return func(asm *Assembler) {
+		asm.target = target
+	}
+}
+
+// WithIncludePaths adds directories searched for included files.
+func WithIncludePaths(paths ...string) Option {
+	return func(asm *Assembler) {
+		asm.includePaths = append(asm.includePaths, paths...)
+	}
+}
+
+// WithDefine sets a constant, overriding any definition in the source. The
+// leading '$' is optional.
+func WithDefine(name string, value byte) Option {
+	return func(asm *Assembler) {
+		asm.defines["$"+strings.TrimPrefix(name, "$")] = value
+	}
+}
+
+// WithFormat sets the encoding of Program.Output.
+func WithFormat(format OutputFormat) Option {
+	return func(asm *Assembler) {
+		asm.format = format
+	}
+}
+
+// WithOptimization sets the optimization level, OPT_NONE by default.
+func WithOptimization(level int) Option {
+	return func(asm *Assembler) {
+		asm.level = level
+	}
+}
+
+// WithInline sets the inlining limits used at OPT_INLINE.
+func WithInline(cfg InlineConfig) Option {
+	return func(asm *Assembler) {
+		asm.inline = cfg
+	}
+}
+
+// WithMetadata embeds the metadata block in the image at MetaAddr.
+// Program.Meta is set either way.
+func WithMetadata(embed bool) Option {
+	return func(asm *Assembler) {
+		asm.meta = embed
+	}
+}
+
+// WithSourceName names the source for included file lookups, which start in
+// its directory.
+func WithSourceName(name string) Option {
+	return func(asm *Assembler) {
+		asm.name = name
+	}
+}
+
+// Assembler assembles programs in memory. It holds no state between calls,
+// so one Assembler may be used concurrently.
+type Assembler struct {
+	target       Target
+	includePaths []string
+	defines      map[string]byte
+	format       OutputFormat
+	level        int
+	inline       InlineConfig
+	meta         bool
+	name         string
+}
+
+// NewAssembler returns an assembler for the default target.
+func NewAssembler(opts ...Option) *Assembler {
+	asm := &Assembler{
+		target:  DefaultTarget(),
+		defines: map[string]byte{},
+		format:  FORMAT_BIN,
+	}
+	for _, opt := range opts {
+		opt(asm)
+	}
+	return asm
+}
+
+// SourceLoc is where the code at a ROM address came from.
+type SourceLoc struct {
+	Addr int `json:"addr"`
+	Size int `json:"size"`
+	// included file, "" for the main source
+	File string `json:"file,omitempty"`
+	Line int    `json:"line"`
+	// 0-based byte offset of the mnemonic
+	Col int `json:"col"`
+	// enclosing subroutine
+	Sub  string `json:"sub,omitempty"`
+	Code string `json:"code"`
+	// include directives leading to the line, outermost first, as file:line
+	Include []string `json:"include,omitempty"`
+}
+
+// Program is an assembled program.
+type Program struct {
+	// ROM image padded to 32 KiB
+	Image []byte
+	// Image in the configured format
+	Output []byte
+	Format OutputFormat
+	// program bytes, excluding padding
+	Size        int
+	Symbols     []*Symbol
+	SourceMap   []SourceLoc
+	Diagnostics []Diagnostic
+	Rewrites    []Rewrite
+	// identifies the ISA and checksums the program bytes
+	Meta Metadata
+}
+
+// Assemble reads and assembles a program. If the source has errors the
+// returned Program carries the diagnostics along with the error.
+func (asm *Assembler) Assemble(ctx context.Context, r io.Reader) (*Program, error) {
+	switch asm.format {
+	case FORMAT_BIN, FORMAT_IHEX:
+	default:
+		return nil, errors.Errorf("unknown output format '%s'", asm.format)
+	}
+	if asm.level < OPT_NONE || asm.level > OPT_INLINE {
+		return nil, errors.Errorf("invalid optimization level %d", asm.level)
+	}
+	if asm.target.StackDepth < 0 {
+		return nil, errors.Errorf("invalid stack depth %d for target '%s'", asm.target.StackDepth, asm.target.Name)
+	}
+
+	src, err := ioutil.ReadAll(r)
+	if nil != err {
+		return nil, errors.Wrap(err, "could not read source")
+	}
+	prg, _ := NewSource(src)
+	prg.sourceFile = asm.name
+	prg.SetStackSize(asm.target.StackDepth)
+	prg.SetIncludePaths(asm.includePaths)
+	for name, value := range asm.defines {
+		prg.defines[name] = value
+	}
+	prog := &Program{Format: asm.format}
+
+	steps := []func() error{
+		prg.lex,
+		func() error {
+			if asm.level < OPT_INLINE {
+				return nil
+			}
+			_, err := prg.Inline(asm.inline)
+			return err
+		},
+		func() error {
+			if asm.level < OPT_PEEPHOLE {
+				return nil
+			}
+			_, err := prg.Optimize()
+			return err
+		},
+		prg.assemble,
+		func() error {
+			prg.checkTarget(asm.target)
+			return nil
+		},
+		prg.checkDiagnostics,
+	}
+	for _, step := range steps {
+		err = ctx.Err()
+		if nil == err {
+			err = step()
+		}
+		if nil != err {
+			prog.Diagnostics = prg.Diagnostics()
+			return prog, err
+		}
+	}
+
+	prog.Image = append([]byte{}, prg.prg[:]...)
+	prog.Size = prg.size()
+	prog.Symbols = prg.symbols(true)
+	prog.Diagnostics = prg.Diagnostics()
+	prog.Rewrites = append([]Rewrite{}, prg.rewrites...)
+	for _, inst := range prg.byAddr() {
+		file, line := prg.position(inst.ln)
+		loc := SourceLoc{
+			Addr:    inst.addr,
+			Size:    inst.size(),
+			File:    file,
+			Line:    line,
+			Sub:     inst.sub,
+			Code:    inst.code(),
+			Include: prg.includedVia(inst.ln),
+		}
+		if fields := LineFields(prg.lines[inst.ln-1]); 0 < len(fields) {
+			loc.Col = fields[0].Span.Col
+		}
+		prog.SourceMap = append(prog.SourceMap, loc)
+	}
+
+	prog.Meta = NewMetadata(asm.target, prog.Image, prog.Size)
+	if asm.meta {
+		prog.Meta.Embed(prog.Image)
+	}
+
+	prog.Output = prog.Image
+	if FORMAT_IHEX == asm.format {
+		prog.Output = IntelHex(prog.Image[:prog.Size])
+		if asm.meta {
+			prog.Output = []byte(intelHex(prog.Image[:prog.Size], 0) + intelHex(prog.Meta.Encode(), MetaAddr) + ihexEOF)
+		}
+	}
+	return prog, nil
+}
+
+// checkTarget reports operations the target hardware does not implement.
+func (bcc *bcc) checkTarget(target Target) {
+	if nil == target.Ops {
+		return
+	}
+	ops := map[string]bool{}
+	for _, op := range target.Ops {
+		ops[op] = true
+	}
+	for _, inst := range bcc.instructions {
+		name := inst.opName()
+		if "" == name || ops[name] {
+			continue
+		}
+		if _, ok := Opcode(name); !ok {
+			continue
+		}
+		bcc.diagnose(inst.ln, "unsupported", SEV_ERROR, "%s is not implemented by target '%s'", name, target.Name)
+	}
+}
+
+// ihexEOF is the Intel HEX end of file record.
+const ihexEOF = ":00000001FF\n"
+
+// IntelHex encodes bytes as Intel HEX data records starting at address 0,
+// 16 bytes per record, followed by the end of file record.
+func IntelHex(byts []byte) []byte {
+	return []byte(intelHex(byts, 0) + ihexEOF)
+}
+
+// intelHex encodes bytes as Intel HEX data records starting at an address.
+func intelHex(byts []byte, base int) string {
+	s := ""
+	for off := 0; off < len(byts); off += 16 {
+		addr := base + off
+		end := off + 16
+		if end > len(byts) {
+			end = len(byts)
+		}
+		rec := append([]byte{byte(end - off), byte(addr >> 8), byte(addr), 0x00}, byts[off:end]...)
+		sum := byte(0)
+		s = s + ":"
+		for _, byt := range rec {
+			s = s + fmt.Sprintf("%02X", byt)
+			sum += byt
+		}
+		s = s + fmt.Sprintf("%02X\n", -sum)
+	}
+	return s
+}
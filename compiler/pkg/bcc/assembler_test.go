@@ -0,0 +1,103 @@
+package bcc_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcctest"
+)
+
+func TestAssemble(t *testing.T) {
+	prog := assemble(t, "$n 3\n    LDAV $n\n    OUTA\n    HLT\n")
+	ldav, _ := bcc.Opcode("LDAV")
+	outa, _ := bcc.Opcode("OUTA")
+	hlt, _ := bcc.Opcode("HLT")
+	bcctest.ExpectBytes(t, "$n 3\n    LDAV $n\n    OUTA\n    HLT\n", ldav, 3, outa, hlt)
+	if 4 != prog.Size || bcc.Kbit32 != len(prog.Image) {
+		t.Errorf("size: got %d bytes of %d, want 4 of %d", prog.Size, len(prog.Image), bcc.Kbit32)
+	}
+	if string(prog.Output) != string(prog.Image) {
+		t.Errorf("binary output differs from the image")
+	}
+	if 3 != len(prog.SourceMap) || 2 != prog.SourceMap[1].Addr || 3 != prog.SourceMap[1].Line {
+		t.Errorf("source map: got %+v", prog.SourceMap)
+	}
+}
+
+func TestAssembleOptions(t *testing.T) {
+	src := "$n 3\n    LDAV $n\n    OUTA\n    HLT\n"
+
+	t.Run("define", func(t *testing.T) {
+		prog := assemble(t, src, bcc.WithDefine("n", 9))
+		trace := bcctest.Run(t, prog.Image, bcctest.Options{MustHalt: true})
+		bcctest.ExpectOut(t, trace, 9)
+	})
+
+	t.Run("ihex", func(t *testing.T) {
+		prog := assemble(t, src, bcc.WithFormat(bcc.FORMAT_IHEX))
+		if want := string(bcc.IntelHex(prog.Image[:prog.Size])); string(prog.Output) != want {
+			t.Errorf("output:\n got  %s\n want %s", prog.Output, want)
+		}
+	})
+
+	t.Run("ihex metadata", func(t *testing.T) {
+		prog := assemble(t, src, bcc.WithFormat(bcc.FORMAT_IHEX), bcc.WithMetadata(true))
+		if !strings.Contains(string(prog.Output), ":10010000") {
+			t.Errorf("no metadata record at 0x%04X:\n%s", bcc.MetaAddr, prog.Output)
+		}
+	})
+
+	t.Run("target", func(t *testing.T) {
+		target := bcc.Target{Name: "no-out", StackDepth: bcc.StackDepth, Ops: []string{"LDAV", "HLT"}}
+		prog, err := bcc.NewAssembler(bcc.WithTarget(target)).Assemble(context.Background(), strings.NewReader(src))
+		if nil == err {
+			t.Fatalf("assembled OUTA for a target without it")
+		}
+		if 1 != len(prog.Diagnostics) || "unsupported" != prog.Diagnostics[0].Rule || 3 != prog.Diagnostics[0].Line {
+			t.Errorf("diagnostics: got %v", prog.Diagnostics)
+		}
+	})
+
+	t.Run("stackless target", func(t *testing.T) {
+		target := bcc.Target{Name: "stackless"}
+		_, err := bcc.NewAssembler(bcc.WithTarget(target)).Assemble(context.Background(), strings.NewReader("    PSHA\n    POPA\n    HLT\n"))
+		if nil == err {
+			t.Errorf("assembled a push for a machine without a stack")
+		}
+	})
+
+	t.Run("optimization", func(t *testing.T) {
+		prog := assemble(t, "    PSHA\n    POPA\n"+src, bcc.WithOptimization(bcc.OPT_PEEPHOLE))
+		if want := bcctest.Code(t, src); string(prog.Image[:prog.Size]) != string(want) {
+			t.Errorf("optimized bytes:\n got  % X\n want % X", prog.Image[:prog.Size], want)
+		}
+	})
+
+	errs := []struct {
+		name string
+		opt  bcc.Option
+	}{
+		{"format", bcc.WithFormat("srec")},
+		{"level", bcc.WithOptimization(3)},
+		{"stack", bcc.WithTarget(bcc.Target{Name: "broken", StackDepth: -1})},
+	}
+	for _, tt := range errs {
+		t.Run("invalid "+tt.name, func(t *testing.T) {
+			_, err := bcc.NewAssembler(tt.opt).Assemble(context.Background(), strings.NewReader(src))
+			if nil == err {
+				t.Errorf("assembled with an invalid %s", tt.name)
+			}
+		})
+	}
+}
+
+func TestAssembleCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := bcc.NewAssembler().Assemble(ctx, strings.NewReader("    HLT\n"))
+	if nil == err {
+		t.Errorf("assembled with a canceled context")
+	}
+}
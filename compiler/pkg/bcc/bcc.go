@@ -1,7 +1,10 @@
 package bcc
 
 import (
+	"bytes"
+	"context"
 	"encoding/binary"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"strings"
@@ -17,6 +20,14 @@ const (
 type Bcc interface {
 	Parse() error
 	Compile() error
+	Listing(float64) (string, error)
+	Explain() (string, error)
+	Optimize() ([]Rewrite, error)
+	Inline(InlineConfig) ([]Rewrite, error)
+	Graph(GraphConfig) (string, error)
+	Vet(VetConfig) ([]Diagnostic, error)
+	Diagnostics() []Diagnostic
+	CheckDiagnostics() error
 	String() string
 }
 
@@ -24,12 +35,24 @@ func New(sourceFile, destFile string) (*bcc, error) {
 	return &bcc{
 		sourceFile: sourceFile,
 		destFile:   destFile,
+		constMap:   map[string]byte{},
+		defines:    map[string]byte{},
+		jmpMap:     map[string]int{},
+		subMap:     map[string]int{},
+		stackSize:  StackDepth,
 	}, nil
 }
 
-var constMap map[string]byte = map[string]byte{} // data map of $const => byte
-var jmpMap map[string]int = map[string]int{}     // location map of label => program index
-var subMap map[string]int = map[string]int{}     // subroutine map of subroutine{ => program index
+// NewSource returns a compiler for source held in memory. Parse lexes the
+// source instead of reading a file.
+func NewSource(src []byte) (*bcc, error) {
+	prg, err := New("", "")
+	if nil != err {
+		return nil, err
+	}
+	prg.lines = strings.Split(strings.ReplaceAll(string(src), "\r\n", "\n"), "\n")
+	return prg, nil
+}
 
 // bcc is a compiler that manages an input source file, output binary file, and
 // binary instruction table image.
@@ -45,39 +68,74 @@ type bcc struct {
 	instructionModuleImage []byte
 
 	// maps and indexes
-	lines        []string       // [idx]line from source
-	instructions []*instruction //
+	lines        []string        // [idx]line from source, includes expanded
+	origins      []origin        // [idx]file and line each line came from
+	includePaths []string        // directories searched for included files
+	instructions []*instruction  //
+	constMap     map[string]byte // data map of $const => byte
+	defines      map[string]byte // $const => byte overriding the source
+	jmpMap       map[string]int  // location map of label => program index
+	subMap       map[string]int  // subroutine map of subroutine => program index
+
+	// analysis
+	stackSize   int            // hardware stack capacity
+	cfg         *cfg           // control flow graph
+	stack       *stackAnalysis // stack depth analysis
+	diagnostics []Diagnostic   // problems found while assembling
+	rewrites    []Rewrite      // changes made by the optimizer
+	fixed       *instruction   // fixed address that stopped the optimizer
 }
 
 func (bcc *bcc) Lines() []string {
 	return bcc.lines
 }
 
-func (bcc *bcc) Instructions() []*instruction {
-	return bcc.instructions
-}
-
-func (bcc *bcc) compile() error {
+// assemble lays out the program and builds the ROM image in memory.
+func (bcc *bcc) assemble() error {
 	var err error
+	bcc.diagnostics = []Diagnostic{}
+	if nil != bcc.fixed {
+		bcc.diagnose(bcc.fixed.ln, "fixed-address", SEV_WARNING, "%s uses a fixed address, the program is not optimized", bcc.fixed.opName())
+	}
+
+	err = bcc.layout()
+	if nil != err {
+		return errors.Wrap(err, "program layout failure")
+	}
 
-	bitIndex := 0
 	for _, inst := range bcc.instructions {
-		byts, err := inst.compile()
+		byts, err := inst.compile(bcc)
 		if nil != err {
 			return errors.Wrap(err, "instruction compilation failure on line %d: '%s'", inst.ln, inst.line)
 		}
 
-		for _, byt := range byts {
-			bcc.prg[bitIndex] = byt
-			bitIndex++
+		for k, byt := range byts {
+			bcc.prg[inst.addr+k] = byt
 		}
 	}
 
 	// Pad the image to 32Kib
-	for a := bitIndex; a < Kbit32; a++ {
+	for a := bcc.size(); a < Kbit32; a++ {
 		bcc.prg[a] = byte(255)
 	}
 
+	bcc.cfg = bcc.graph()
+	bcc.stack = bcc.analyzeStack(bcc.cfg)
+
+	return nil
+}
+
+func (bcc *bcc) compile() error {
+	err := bcc.assemble()
+	if nil != err {
+		return err
+	}
+
+	err = bcc.checkDiagnostics()
+	if nil != err {
+		return errors.Wrap(err, "program analysis failure")
+	}
+
 	outf, err := os.Create(bcc.destFile)
 	if nil != err {
 		return errors.Wrap(err, "could not create data file '%s'", bcc.destFile)
@@ -92,6 +150,26 @@ func (bcc *bcc) compile() error {
 	return nil
 }
 
+// Build assembles source held in memory into a ROM image, never touching the
+// filesystem. It fails if the program has any error diagnostics.
+func Build(src []byte, stackSize int) ([]byte, error) {
+	target := DefaultTarget()
+	target.StackDepth = stackSize
+	prog, err := NewAssembler(WithTarget(target)).Assemble(context.Background(), bytes.NewReader(src))
+	if nil != err && nil != prog {
+		// report the first error diagnostic rather than the failure it caused
+		for _, diag := range prog.Diagnostics {
+			if SEV_ERROR == diag.Severity {
+				return nil, errors.Errorf("%s", diag)
+			}
+		}
+	}
+	if nil != err {
+		return nil, err
+	}
+	return prog.Image, nil
+}
+
 func (bcc *bcc) readSource() error {
 	// Read source file and split into lines.
 	bytes, err := ioutil.ReadFile(bcc.sourceFile)
@@ -103,18 +181,41 @@ func (bcc *bcc) readSource() error {
 }
 
 func (bcc *bcc) lex() error {
+	var lexErr error
+	sub, subLn := "", 0 // enclosing subroutine
+
+	if nil == bcc.origins {
+		bcc.expand()
+		for _, diag := range bcc.diagnostics {
+			if SEV_ERROR == diag.Severity && nil == lexErr {
+				lexErr = errors.Errorf("%s", diag)
+			}
+		}
+	}
+
+	// fail records a syntax error and moves on to the next line so every
+	// error in the file is reported. The first error is returned.
+	fail := func(ln int, err error, format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		bcc.diagnose(ln, "syntax", SEV_ERROR, "%s", msg)
+		if nil != lexErr {
+			return
+		}
+		if nil != err {
+			lexErr = errors.Wrap(err, "%s on %s", msg, bcc.where(ln))
+			return
+		}
+		lexErr = errors.Errorf("%s on %s", msg, bcc.where(ln))
+	}
+
+	defined := map[string]bool{}
+	for name, value := range bcc.defines {
+		bcc.constMap[name] = value
+	}
+
 	// Inspect each line, tokenizing all elements.
 	for idx, line := range bcc.lines {
-		// Strip comments.
-		p := strings.Split(line, "#")
-		code := strings.TrimRight(p[0], " \t")
-
-		// All whitespace must be a single space.
-		code = strings.ReplaceAll(code, "\t", " ")
-		for strings.Contains(code, "  ") {
-			code = strings.ReplaceAll(code, "  ", " ")
-		}
-		code = strings.ReplaceAll(code, " {", "{")
+		code, _ := splitLine(line)
 
 		// Remaining non-blank lines are code instructions. Tokenize instructions,
 		// populate maps.
@@ -122,32 +223,94 @@ func (bcc *bcc) lex() error {
 
 			inst, err := newInst(idx+1, code)
 			if nil != err {
-				return errors.Wrap(err, "instruction tokenization failure on line %d: '%s'", idx+1, line)
+				fail(idx+1, err, "%s", rootText(err))
+				continue
 			}
 
 			// populate instruction maps
+			name := inst.tokens[0].tkn
 			switch inst.tokens[0].typ {
 			case TOK_CONST:
-				constMap[inst.tokens[0].tkn] = inst.tokens[0].dat
+				if defined[name] {
+					fail(idx+1, nil, "constant '%s' redefined", name)
+					continue
+				}
+				if len(inst.tokens) < 2 || TOK_LIT != inst.tokens[1].typ {
+					fail(idx+1, nil, "constant '%s' requires a literal value", name)
+					continue
+				}
+				defined[name] = true
+				if _, ok := bcc.defines[name]; !ok {
+					bcc.constMap[name] = inst.tokens[1].dat
+				}
 			case TOK_LABEL:
-				jmpMap[inst.tokens[0].tkn] = len(bcc.instructions)
+				if _, ok := bcc.jmpMap[name]; ok {
+					fail(idx+1, nil, "label '%s' redefined", name)
+					continue
+				}
+				bcc.jmpMap[name] = len(bcc.instructions)
 			case TOK_SUB:
-				subMap[inst.tokens[0].tkn] = len(bcc.instructions)
+				name = strings.TrimSuffix(name, "{")
+				if "" != sub {
+					fail(idx+1, nil, "subroutine '%s' defined inside subroutine '%s'", name, sub)
+				}
+				if _, ok := bcc.subMap[name]; ok {
+					fail(idx+1, nil, "subroutine '%s' redefined", name)
+					continue
+				}
+				bcc.subMap[name] = len(bcc.instructions)
+				sub, subLn = name, idx+1
+			case TOK_SUBEND:
+				if "" == sub {
+					fail(idx+1, nil, "unexpected '}'")
+					continue
+				}
+			}
+			inst.sub = sub
+			if TOK_SUBEND == inst.tokens[0].typ {
+				sub = ""
 			}
 
 			bcc.instructions = append(bcc.instructions, inst)
 		}
 	}
+	if "" != sub {
+		fail(subLn, nil, "subroutine '%s' is missing a closing '}'", sub)
+	}
 
-	return nil
+	return lexErr
+}
+
+// splitLine separates the code in a source line from its comment and
+// normalizes the code's whitespace for tokenizing.
+func splitLine(line string) (string, string) {
+	// Strip comments.
+	p := strings.SplitN(line, "#", 2)
+	code := strings.TrimRight(p[0], " \t")
+	comment := ""
+	if 2 == len(p) {
+		comment = p[1]
+	}
+
+	// All whitespace must be a single space.
+	code = strings.ReplaceAll(code, "\t", " ")
+	for strings.Contains(code, "  ") {
+		code = strings.ReplaceAll(code, "  ", " ")
+	}
+	code = strings.ReplaceAll(code, " {", "{")
+
+	return code, comment
 }
 
 // parse parses the source file, performing "lexical analysis"... just a bunch
 // of strings.Split and if statements :)
 func (bcc *bcc) parse() error {
-	err := bcc.readSource()
-	if nil != err {
-		return errors.Wrap(err, "error reading source file")
+	var err error
+	if nil == bcc.lines {
+		err = bcc.readSource()
+		if nil != err {
+			return errors.Wrap(err, "error reading source file")
+		}
 	}
 
 	err = bcc.lex()
@@ -163,6 +326,11 @@ func (bcc *bcc) Parse() error {
 	return bcc.parse()
 }
 
+// Interface implementation
+func (bcc *bcc) CheckDiagnostics() error {
+	return bcc.checkDiagnostics()
+}
+
 // Interface implementation
 func (bcc *bcc) Compile() error {
 	return bcc.compile()
@@ -0,0 +1,191 @@
+package bcc
+
+import (
+	"sort"
+)
+
+// edgeType describes how control passes between basic blocks.
+type edgeType string
+
+const (
+	// sequential execution into the next block
+	EDGE_FALL edgeType = "fall"
+	// JMP or JMPV to a known address
+	EDGE_JUMP edgeType = "jump"
+	// computed jump (JMPA, JMPX, JMPY, JMPS), target unknown
+	EDGE_UNKNOWN edgeType = "unknown"
+	// RUN to a subroutine, execution resumes after the RUN
+	EDGE_CALL edgeType = "call"
+)
+
+// edge is a control flow edge. `to` is nil for unknown targets and for
+// execution that runs past the end of the program.
+type edge struct {
+	typ  edgeType
+	from *instruction
+	to   *block
+	addr int
+}
+
+// block is a basic block: a run of instructions, in address order, entered
+// only at the first and left only after the last.
+type block struct {
+	id    int
+	insts []*instruction
+	succs []*edge
+	calls []*edge
+	preds []*block
+}
+
+// addr returns the ROM address of the block.
+func (blk *block) addr() int {
+	return blk.insts[0].addr
+}
+
+// last returns the final instruction of the block.
+func (blk *block) last() *instruction {
+	return blk.insts[len(blk.insts)-1]
+}
+
+// cfg is the control flow graph of the assembled program.
+type cfg struct {
+	blocks []*block
+	byAddr map[int]*block // block start address => block
+	subs   map[string]*block
+}
+
+// isReturn returns whether an instruction is a subroutine end.
+func (inst *instruction) isReturn() bool {
+	return TOK_SUBEND == inst.tokens[0].typ
+}
+
+// terminates returns whether control never falls through to the next
+// instruction.
+func (inst *instruction) terminates() bool {
+	switch inst.opName() {
+	case "HLT", "RST", "JMP", "JMPV", "JMPA", "JMPX", "JMPY", "JMPS", "POPP":
+		return true
+	}
+	return false
+}
+
+// graph builds the control flow graph. The program must be laid out.
+func (bcc *bcc) graph() *cfg {
+	code := bcc.byAddr()
+	graph := &cfg{
+		byAddr: map[int]*block{},
+		subs:   map[string]*block{},
+	}
+	if 0 == len(code) {
+		return graph
+	}
+
+	// block leaders
+	leaders := map[int]bool{code[0].addr: true}
+	for name := range bcc.subMap {
+		if addr, ok := bcc.addrOf(bcc.subMap, name); ok {
+			leaders[addr] = true
+		}
+	}
+	for k, inst := range code {
+		if addr, ok := inst.target(bcc); ok {
+			leaders[addr] = true
+		}
+		if inst.terminates() && k+1 < len(code) {
+			leaders[code[k+1].addr] = true
+		}
+	}
+
+	var blk *block
+	for _, inst := range code {
+		if leaders[inst.addr] || nil == blk {
+			blk = &block{id: len(graph.blocks)}
+			graph.blocks = append(graph.blocks, blk)
+			graph.byAddr[inst.addr] = blk
+		}
+		blk.insts = append(blk.insts, inst)
+	}
+	for name := range bcc.subMap {
+		if addr, ok := bcc.addrOf(bcc.subMap, name); ok && nil != graph.byAddr[addr] {
+			graph.subs[name] = graph.byAddr[addr]
+		}
+	}
+
+	// edges
+	for k, blk := range graph.blocks {
+		for _, inst := range blk.insts {
+			if addr, ok := inst.target(bcc); ok && "RUN" == inst.opName() {
+				blk.calls = append(blk.calls, &edge{typ: EDGE_CALL, from: inst, to: graph.byAddr[addr], addr: addr})
+			}
+		}
+
+		last := blk.last()
+		switch last.opName() {
+		case "HLT", "POPP":
+			continue
+		case "RST":
+			blk.succs = append(blk.succs, &edge{typ: EDGE_JUMP, from: last, to: graph.byAddr[0], addr: 0})
+			continue
+		case "JMP", "JMPV":
+			addr, ok := last.target(bcc)
+			if !ok {
+				blk.succs = append(blk.succs, &edge{typ: EDGE_UNKNOWN, from: last})
+				continue
+			}
+			blk.succs = append(blk.succs, &edge{typ: EDGE_JUMP, from: last, to: graph.byAddr[addr], addr: addr})
+			continue
+		case "JMPA", "JMPX", "JMPY", "JMPS":
+			blk.succs = append(blk.succs, &edge{typ: EDGE_UNKNOWN, from: last})
+			continue
+		}
+
+		next := &edge{typ: EDGE_FALL, from: last, addr: last.addr + last.size()}
+		if k+1 < len(graph.blocks) {
+			next.to = graph.blocks[k+1]
+		}
+		blk.succs = append(blk.succs, next)
+	}
+
+	for _, blk := range graph.blocks {
+		for _, e := range blk.succs {
+			if nil != e.to {
+				e.to.preds = append(e.to.preds, blk)
+			}
+		}
+	}
+
+	return graph
+}
+
+// reachable returns the blocks reachable from the program entry, following
+// jumps, fall-through and calls.
+func (graph *cfg) reachable() map[*block]bool {
+	seen := map[*block]bool{}
+	if 0 == len(graph.blocks) {
+		return seen
+	}
+	var visit func(*block)
+	visit = func(blk *block) {
+		if nil == blk || seen[blk] {
+			return
+		}
+		seen[blk] = true
+		for _, e := range append(append([]*edge{}, blk.succs...), blk.calls...) {
+			visit(e.to)
+		}
+	}
+	visit(graph.byAddr[0])
+	return seen
+}
+
+// subNames returns the subroutine names in address order.
+func (graph *cfg) subNames() []string {
+	names := []string{}
+	for name := range graph.subs {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return graph.subs[names[i]].addr() < graph.subs[names[j]].addr()
+	})
+	return names
+}
@@ -0,0 +1,109 @@
+package bcc
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/bdlm/errors/v2"
+)
+
+const (
+	// DebugVersion is the debug info format version.
+	DebugVersion = 1
+
+	// DebugExt is appended to an image file name to name its debug info.
+	DebugExt = ".dbg"
+)
+
+// DebugInfo maps the ROM addresses of an image back to its source. It is
+// written next to the image as JSON.
+type DebugInfo struct {
+	Version int `json:"version"`
+	// main source file, the file of locations and symbols without one
+	Source string `json:"source"`
+	// program bytes, excluding padding
+	Size int `json:"size"`
+	// code locations in address order
+	Lines   []SourceLoc `json:"lines"`
+	Symbols []*Symbol   `json:"symbols"`
+}
+
+// DebugInfo returns the debug info of a program assembled from a source
+// file.
+func (prog *Program) DebugInfo(source string) *DebugInfo {
+	return &DebugInfo{
+		Version: DebugVersion,
+		Source:  source,
+		Size:    prog.Size,
+		Lines:   prog.SourceMap,
+		Symbols: prog.Symbols,
+	}
+}
+
+// WriteTo writes the debug info as indented JSON.
+func (dbg *DebugInfo) WriteTo(w io.Writer) (int64, error) {
+	byts, err := json.MarshalIndent(dbg, "", "  ")
+	if nil != err {
+		return 0, errors.Wrap(err, "could not encode debug info")
+	}
+	n, err := w.Write(append(byts, '\n'))
+	return int64(n), err
+}
+
+// ReadDebugInfo decodes debug info.
+func ReadDebugInfo(r io.Reader) (*DebugInfo, error) {
+	dbg := &DebugInfo{}
+	err := json.NewDecoder(r).Decode(dbg)
+	if nil != err {
+		return nil, errors.Wrap(err, "could not decode debug info")
+	}
+	if DebugVersion != dbg.Version {
+		return nil, errors.Errorf("unsupported debug info version %d, expected %d", dbg.Version, DebugVersion)
+	}
+	sort.SliceStable(dbg.Lines, func(i, j int) bool {
+		return dbg.Lines[i].Addr < dbg.Lines[j].Addr
+	})
+	return dbg, nil
+}
+
+// LoadDebugInfo reads the debug info written next to an image file.
+func LoadDebugInfo(imgFile string) (*DebugInfo, error) {
+	f, err := os.Open(imgFile + DebugExt)
+	if nil != err {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadDebugInfo(f)
+}
+
+// At returns the source location of the code at a ROM address, which may be
+// an operand byte.
+func (dbg *DebugInfo) At(addr int) (SourceLoc, bool) {
+	k := sort.Search(len(dbg.Lines), func(k int) bool {
+		return dbg.Lines[k].Addr+dbg.Lines[k].Size > addr
+	})
+	if k < len(dbg.Lines) && dbg.Lines[k].Addr <= addr {
+		return dbg.Lines[k], true
+	}
+	return SourceLoc{}, false
+}
+
+// File returns the source file of a location.
+func (dbg *DebugInfo) File(loc SourceLoc) string {
+	if "" == loc.File {
+		return dbg.Source
+	}
+	return loc.File
+}
+
+// Label returns the label or subroutine at a ROM address.
+func (dbg *DebugInfo) Label(addr int) (string, bool) {
+	for _, sym := range dbg.Symbols {
+		if SYM_CONST != sym.Kind && addr == sym.Value {
+			return sym.Name, true
+		}
+	}
+	return "", false
+}
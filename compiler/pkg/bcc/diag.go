@@ -0,0 +1,67 @@
+package bcc
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/bdlm/errors/v2"
+)
+
+// Severity is the importance of a diagnostic.
+type Severity string
+
+const (
+	// the program is invalid and is not compiled
+	SEV_ERROR Severity = "error"
+	// the program compiles but is probably wrong
+	SEV_WARNING Severity = "warning"
+)
+
+// Diagnostic is a problem found in the source file.
+type Diagnostic struct {
+	// included file the line is in, "" for the main source
+	File     string   `json:"file,omitempty"`
+	Line     int      `json:"line"`
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+
+	ln int // line of the expanded source
+}
+
+// String implements Stringer.
+func (diag Diagnostic) String() string {
+	if "" != diag.File {
+		return fmt.Sprintf("%s:%d: %s: %s (%s)", diag.File, diag.Line, diag.Severity, diag.Message, diag.Rule)
+	}
+	return fmt.Sprintf("line %d: %s: %s (%s)", diag.Line, diag.Severity, diag.Message, diag.Rule)
+}
+
+// diagnose records a diagnostic.
+func (bcc *bcc) diagnose(ln int, rule string, sev Severity, format string, args ...interface{}) {
+	file, line := bcc.position(ln)
+	bcc.diagnostics = append(bcc.diagnostics, Diagnostic{
+		File:     file,
+		Line:     line,
+		ln:       ln,
+		Rule:     rule,
+		Severity: sev,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Diagnostics returns the problems found while compiling, in line order.
+func (bcc *bcc) Diagnostics() []Diagnostic {
+	sort.SliceStable(bcc.diagnostics, func(i, j int) bool {
+		return bcc.diagnostics[i].ln < bcc.diagnostics[j].ln
+	})
+	return bcc.diagnostics
+}
+
+// rootText returns the message of the innermost error an error wraps.
+func rootText(err error) string {
+	for nil != errors.Unwrap(err) {
+		err = errors.Unwrap(err)
+	}
+	return err.Error()
+}
@@ -0,0 +1,142 @@
+package bcc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Decoded is an instruction decoded from a ROM image.
+type Decoded struct {
+	Addr   int
+	Opcode byte
+	// operation name, "" if the byte is not an opcode
+	Name       string
+	Operand    byte
+	HasOperand bool
+}
+
+// Size returns the number of bytes the instruction occupies.
+func (inst Decoded) Size() int {
+	if inst.HasOperand {
+		return 2
+	}
+	return 1
+}
+
+// String returns the instruction as assembly source.
+func (inst Decoded) String() string {
+	switch true {
+	case "" == inst.Name:
+		return fmt.Sprintf("0x%02X ?", inst.Opcode)
+	case inst.HasOperand:
+		return fmt.Sprintf("%-4s 0x%02X", inst.Name, inst.Operand)
+	}
+	return inst.Name
+}
+
+// Decode decodes the instruction at a ROM address. Operands beyond the image
+// read as erased EEPROM cells.
+func Decode(img []byte, addr int) Decoded {
+	inst := Decoded{Addr: addr}
+	if addr >= len(img) {
+		inst.Opcode = 0xFF
+	} else {
+		inst.Opcode = img[addr]
+	}
+	name, ok := OpName(inst.Opcode)
+	if !ok {
+		return inst
+	}
+	inst.Name = name
+	if OpHasParam(name) {
+		inst.HasOperand = true
+		inst.Operand = 0xFF
+		if addr+1 < len(img) {
+			inst.Operand = img[addr+1]
+		}
+	}
+	return inst
+}
+
+// Disassemble decodes the first size bytes of a ROM image in address order.
+func Disassemble(img []byte, size int) []Decoded {
+	insts := []Decoded{}
+	for addr := 0; addr < size; {
+		inst := Decode(img, addr)
+		insts = append(insts, inst)
+		addr += inst.Size()
+	}
+	return insts
+}
+
+// ImageSize returns the number of program bytes in a ROM image, excluding
+// the erased (0xFF) padding after the last instruction.
+func ImageSize(img []byte) int {
+	size := len(img)
+	if size > Addressable {
+		size = Addressable
+	}
+	for size > 0 && 0xFF == img[size-1] {
+		size--
+	}
+	// a trailing 0xFF operand is part of the program
+	end := 0
+	for _, inst := range Disassemble(img, size) {
+		end = inst.Addr + inst.Size()
+	}
+	if end > len(img) {
+		end = len(img)
+	}
+	return end
+}
+
+// DisasmListing disassembles a ROM image into assembly source, with the
+// address and bytes of each instruction in a comment. With debug info the
+// program size, labels and source lines come from it; dbg may be nil, in
+// which case jump targets are given generated labels.
+func DisasmListing(img []byte, dbg *DebugInfo) string {
+	size := ImageSize(img)
+	if nil != dbg {
+		size = dbg.Size
+	}
+	insts := Disassemble(img, size)
+
+	labels := map[int]string{}
+	if nil != dbg {
+		for _, inst := range insts {
+			if label, ok := dbg.Label(inst.Addr); ok {
+				labels[inst.Addr] = label
+			}
+		}
+	} else {
+		for _, inst := range insts {
+			if "JMP" == inst.Name || "RUN" == inst.Name {
+				labels[int(inst.Operand)] = fmt.Sprintf("L%02X", inst.Operand)
+			}
+		}
+	}
+
+	var b strings.Builder
+	for _, inst := range insts {
+		if label, ok := labels[inst.Addr]; ok {
+			fmt.Fprintf(&b, "%s\n", label)
+		}
+
+		code := inst.String()
+		if label, ok := labels[int(inst.Operand)]; ok && ("JMP" == inst.Name || "RUN" == inst.Name) {
+			code = fmt.Sprintf("%-4s %s", inst.Name, label)
+		}
+		byts := fmt.Sprintf("%02X", inst.Opcode)
+		if inst.HasOperand {
+			byts = byts + fmt.Sprintf(" %02X", inst.Operand)
+		}
+		line := fmt.Sprintf("    %-16s # 0x%02X  %-5s", code, inst.Addr, byts)
+		if nil != dbg {
+			if loc, ok := dbg.At(inst.Addr); ok && loc.Addr == inst.Addr {
+				line = line + fmt.Sprintf("  %s:%d", dbg.File(loc), loc.Line)
+			}
+		}
+		fmt.Fprintln(&b, strings.TrimRight(line, " "))
+	}
+	return b.String()
+}
@@ -0,0 +1,183 @@
+package bcc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bdlm/errors/v2"
+)
+
+// GraphConfig selects what Graph draws.
+type GraphConfig struct {
+	// draw the subroutine call graph instead of the basic blocks
+	Calls bool
+	// annotate instructions with their cycle counts
+	Cycles bool
+	// annotate instructions with their source line numbers
+	Lines bool
+}
+
+// edgeStyle maps edge types to DOT attributes.
+var edgeStyle = map[edgeType]string{
+	EDGE_FALL:    `style=dashed`,
+	EDGE_JUMP:    `style=solid`,
+	EDGE_UNKNOWN: `style=dotted, color=red, label="unknown"`,
+	EDGE_CALL:    `style=bold, color=blue, label="RUN"`,
+}
+
+// dotQuote returns a DOT string literal.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// Graph assembles the program and returns its control flow graph, or its
+// call graph, in Graphviz DOT format.
+func (bcc *bcc) Graph(cfg GraphConfig) (string, error) {
+	err := bcc.assemble()
+	if nil != err {
+		return "", errors.Wrap(err, "could not assemble program")
+	}
+	if cfg.Calls {
+		return bcc.callDot(bcc.cfg, cfg), nil
+	}
+	return bcc.blockDot(bcc.cfg, cfg), nil
+}
+
+// blockDot draws the basic blocks, grouping each subroutine in a cluster.
+func (bcc *bcc) blockDot(graph *cfg, cfg GraphConfig) string {
+	s := "digraph program {\n"
+	s = s + "\tnode [shape=box, fontname=monospace];\n"
+
+	// blocks grouped by subroutine, top level first
+	groups := map[string][]*block{}
+	for _, blk := range graph.blocks {
+		sub := blk.insts[0].sub
+		groups[sub] = append(groups[sub], blk)
+	}
+	for _, sub := range append([]string{""}, graph.subNames()...) {
+		indent := "\t"
+		if "" != sub {
+			s = s + fmt.Sprintf("\tsubgraph %s {\n", dotQuote("cluster_"+sub))
+			s = s + fmt.Sprintf("\t\tlabel=%s;\n", dotQuote(sub))
+			indent = "\t\t"
+		}
+		for _, blk := range groups[sub] {
+			s = s + fmt.Sprintf("%sb%d [label=%s];\n", indent, blk.id, bcc.blockLabel(blk, cfg))
+		}
+		if "" != sub {
+			s = s + "\t}\n"
+		}
+	}
+
+	unknown := false
+	for _, blk := range graph.blocks {
+		for _, e := range append(append([]*edge{}, blk.succs...), blk.calls...) {
+			to := ""
+			switch true {
+			case nil != e.to:
+				to = fmt.Sprintf("b%d", e.to.id)
+			case EDGE_UNKNOWN == e.typ:
+				to, unknown = "unknown", true
+			default:
+				to = fmt.Sprintf("end%d", blk.id)
+				s = s + fmt.Sprintf("\t%s [label=%s, shape=plaintext];\n", to, dotQuote(fmt.Sprintf("0x%02X (erased)", e.addr)))
+			}
+			s = s + fmt.Sprintf("\tb%d -> %s [%s];\n", blk.id, to, edgeStyle[e.typ])
+		}
+	}
+	if unknown {
+		s = s + "\tunknown [label=\"?\", shape=circle, color=red];\n"
+	}
+
+	return s + "}\n"
+}
+
+// blockLabel returns the DOT label of a basic block, one instruction per
+// line.
+func (bcc *bcc) blockLabel(blk *block, cfg GraphConfig) string {
+	s := ""
+	labels := []string{}
+	for name, idx := range bcc.jmpMap {
+		if label := bcc.instructions[idx]; label.addr == blk.addr() && label.sub == blk.insts[0].sub {
+			labels = append(labels, name+":\n")
+		}
+	}
+	sort.Strings(labels)
+	s = s + strings.Join(labels, "")
+	for _, inst := range blk.insts {
+		line := fmt.Sprintf("0x%02X  %s", inst.addr, inst.code())
+		if cfg.Cycles {
+			line = line + fmt.Sprintf("  (%d)", inst.cycles())
+		}
+		if cfg.Lines {
+			line = line + fmt.Sprintf("  :%d", inst.ln)
+		}
+		s = s + line + "\n"
+	}
+	// left justify every line
+	return strings.ReplaceAll(dotQuote(s), "\n", `\l`)
+}
+
+// callDot draws the subroutine call graph.
+func (bcc *bcc) callDot(graph *cfg, cfg GraphConfig) string {
+	s := "digraph calls {\n"
+	s = s + "\tnode [shape=box, fontname=monospace];\n"
+
+	// top level code is drawn as "(program)", which is not a valid
+	// subroutine name
+	id := func(name string) string {
+		if "" == name {
+			return dotQuote("(program)")
+		}
+		return dotQuote(name)
+	}
+
+	names := append([]string{""}, graph.subNames()...)
+	for _, name := range names {
+		label := name
+		if "" == name {
+			label = "(program)"
+		}
+		if cfg.Cycles && "" != name {
+			if cyc, ok := bcc.subCycles(name, map[string]bool{}); ok {
+				label = label + fmt.Sprintf("\n%d cycles", cyc)
+			} else {
+				label = label + "\nunbounded"
+			}
+		}
+		if cfg.Lines && "" != name {
+			label = label + fmt.Sprintf("\nline %d", bcc.instructions[bcc.subMap[name]].ln)
+		}
+		s = s + fmt.Sprintf("\t%s [label=%s];\n", id(name), strings.ReplaceAll(dotQuote(label), "\n", `\n`))
+	}
+
+	// caller => callee => number of call sites
+	calls := map[string]map[string]int{}
+	for _, inst := range bcc.instructions {
+		callee, ok := bcc.callee(inst)
+		if !ok {
+			continue
+		}
+		if nil == calls[inst.sub] {
+			calls[inst.sub] = map[string]int{}
+		}
+		calls[inst.sub][callee]++
+	}
+	for _, caller := range names {
+		callees := []string{}
+		for callee := range calls[caller] {
+			callees = append(callees, callee)
+		}
+		sort.Strings(callees)
+		for _, callee := range callees {
+			attr := ""
+			if n := calls[caller][callee]; 1 < n {
+				attr = fmt.Sprintf(" [label=\"%dx\"]", n)
+			}
+			s = s + fmt.Sprintf("\t%s -> %s%s;\n", id(caller), id(callee), attr)
+		}
+	}
+
+	return s + "}\n"
+}
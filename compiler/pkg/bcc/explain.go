@@ -0,0 +1,85 @@
+package bcc
+
+import (
+	"fmt"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/ucode"
+
+	"github.com/bdlm/errors/v2"
+)
+
+// Explain assembles the program and expands every instruction into the
+// micro-steps of its fetch and execute cycles. Each T-state lists the control
+// signals that fire, the bus value where it is known without running the
+// program, and what drives the bus and which registers latch it.
+func (bcc *bcc) Explain() (string, error) {
+	err := bcc.assemble()
+	if nil != err {
+		return "", errors.Wrap(err, "could not assemble program")
+	}
+
+	byLine := map[int]*instruction{}
+	width := 0
+	for _, inst := range bcc.instructions {
+		byLine[inst.ln] = inst
+		steps, _ := ucode.Lookup(inst.opName())
+		for _, sig := range steps {
+			if len(sig.String()) > width {
+				width = len(sig.String())
+			}
+		}
+	}
+
+	s := "ADDR  LINE  SOURCE\n"
+	for idx, line := range bcc.lines {
+		inst, ok := byLine[idx+1]
+		_, ln := bcc.position(idx + 1)
+		if !ok || 0 == inst.size() {
+			s = s + fmt.Sprintf("%-4s  %4d  %s\n", "", ln, line)
+			continue
+		}
+		s = s + fmt.Sprintf("0x%02X  %4d  %s\n", inst.addr, ln, line)
+		s = s + bcc.explainSteps(inst, width)
+	}
+	return s, nil
+}
+
+// explainSteps lists the micro-steps of an instruction. The program counter
+// and ROM address register are followed from the instruction's address so the
+// bus value is shown when the program counter or ROM drives it; registers,
+// RAM and the stack hold run-time values shown as '?'.
+func (bcc *bcc) explainSteps(inst *instruction, width int) string {
+	steps, _ := ucode.Lookup(inst.opName())
+	pc, mar := inst.addr, -1
+	s := ""
+	for step, sig := range steps {
+		phase := "exec"
+		if step < len(ucode.Fetch) {
+			phase = "fetch"
+		}
+
+		bus := -1
+		switch true {
+		case 0 != sig&ucode.PCO:
+			bus = pc
+		case 0 != sig&ucode.ROMO && mar >= 0 && mar < len(bcc.prg):
+			bus = int(bcc.prg[mar])
+		}
+		value := "  "
+		switch true {
+		case bus >= 0:
+			value = fmt.Sprintf("%02X", bus)
+		case 0 != sig&ucode.Drivers:
+			value = " ?"
+		}
+
+		if 0 != sig&ucode.RORI {
+			mar = bus
+		}
+		if 0 != sig&ucode.PCE {
+			pc++
+		}
+		s = s + fmt.Sprintf("      T%-2d %-5s  %-*s  %s  %s\n", step, phase, width, sig, value, ucode.Describe(sig))
+	}
+	return s
+}
@@ -0,0 +1,20 @@
+package bcc
+
+// StackDepths assembles source for a stack of size bytes and returns the
+// deepest the program gets, the depth one call to each subroutine adds and
+// the diagnostics.
+func StackDepths(src string, size int) (int, map[string]int, []Diagnostic, error) {
+	prg, err := NewSource([]byte(src))
+	if nil != err {
+		return 0, nil, nil, err
+	}
+	prg.SetStackSize(size)
+	err = prg.Parse()
+	if nil == err {
+		err = prg.assemble()
+	}
+	if nil != err {
+		return 0, nil, prg.Diagnostics(), err
+	}
+	return prg.stack.max, prg.stack.subs, prg.Diagnostics(), nil
+}
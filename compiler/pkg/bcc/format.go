@@ -0,0 +1,226 @@
+package bcc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bdlm/errors/v2"
+)
+
+// LiteralFormat is the notation the formatter prints literals in.
+type LiteralFormat string
+
+const (
+	// literals are printed as written
+	LIT_KEEP LiteralFormat = ""
+	// 0x1C
+	LIT_HEX LiteralFormat = "hex"
+	// 28
+	LIT_DEC LiteralFormat = "dec"
+	// 0b00011100
+	LIT_BIN LiteralFormat = "bin"
+)
+
+// FormatConfig controls the canonical source layout.
+type FormatConfig struct {
+	// spaces before instructions and the comments inside subroutines
+	Indent int
+	// literal notation
+	Literals LiteralFormat
+}
+
+// DefaultFormatConfig returns the layout of the example programs.
+func DefaultFormatConfig() FormatConfig {
+	return FormatConfig{
+		Indent:   4,
+		Literals: LIT_KEEP,
+	}
+}
+
+// fmtLine is a source line split into aligned columns.
+type fmtLine struct {
+	kind    tokenType // TOK_OP for instructions, TOK_NIL for blank and comment lines
+	cols    []string  // code columns
+	comment string    // comment text after the '#', "" for none
+	hasCmt  bool
+	indent  string
+}
+
+// literal prints a literal token in the configured notation.
+func (cfg FormatConfig) literal(tkn *tok) string {
+	switch cfg.Literals {
+	case LIT_HEX:
+		return fmt.Sprintf("0x%02X", tkn.dat)
+	case LIT_DEC:
+		return fmt.Sprintf("%d", tkn.dat)
+	case LIT_BIN:
+		return fmt.Sprintf("0b%08b", tkn.dat)
+	}
+	return tkn.tkn
+}
+
+// Format reprints assembly source in canonical form: labels, constants and
+// subroutine braces at column 0, labels on their own line, instructions
+// indented with the operand in a fixed column, trailing comments aligned
+// across consecutive lines of the same kind, and runs of blank lines
+// collapsed. Comments are kept verbatim.
+func Format(src []byte, cfg FormatConfig) ([]byte, error) {
+	if cfg.Indent < 0 {
+		return nil, errors.Errorf("invalid indent %d", cfg.Indent)
+	}
+	switch cfg.Literals {
+	case LIT_KEEP, LIT_HEX, LIT_DEC, LIT_BIN:
+	default:
+		return nil, errors.Errorf("unknown literal format '%s'", cfg.Literals)
+	}
+	indent := strings.Repeat(" ", cfg.Indent)
+
+	lines := []*fmtLine{}
+	sub := false
+	for idx, line := range strings.Split(strings.ReplaceAll(string(src), "\r\n", "\n"), "\n") {
+		code, comment := splitLine(line)
+		fl := &fmtLine{
+			kind:    TOK_NIL,
+			comment: strings.TrimRight(comment, " \t"),
+			hasCmt:  strings.Contains(line, "#"),
+		}
+
+		if "" == strings.Trim(code, " ") {
+			if sub && fl.hasCmt {
+				fl.indent = indent
+			}
+			lines = append(lines, fl)
+			continue
+		}
+
+		if name, ok := includeFile(line); ok {
+			fl.cols = []string{`include "` + name + `"`}
+			if fl.hasCmt {
+				fl.cols[0] = fl.cols[0] + " "
+			}
+			lines = append(lines, fl)
+			continue
+		}
+
+		inst, err := newInst(idx+1, code)
+		if nil != err {
+			return nil, errors.Wrap(err, "line %d: '%s'", idx+1, line)
+		}
+		tokens := inst.tokens
+		// a label moves to its own line ahead of the instruction
+		if TOK_LABEL == tokens[0].typ && 1 < len(tokens) {
+			lines = append(lines, &fmtLine{kind: TOK_LABEL, cols: []string{tokens[0].tkn}})
+			tokens = tokens[1:]
+		}
+		fl.kind = tokens[0].typ
+		switch fl.kind {
+		case TOK_CONST:
+			fl.cols = []string{tokens[0].tkn}
+			for _, tkn := range tokens[1:] {
+				fl.cols = append(fl.cols, cfg.literal(tkn))
+			}
+		case TOK_SUB:
+			fl.cols = []string{strings.TrimSuffix(tokens[0].tkn, "{") + " {"}
+			sub = true
+		case TOK_SUBEND:
+			fl.cols = []string{"}"}
+			sub = false
+		case TOK_OP:
+			fl.indent = indent
+			fl.cols = []string{tokens[0].tkn}
+			for _, tkn := range tokens[1:] {
+				if TOK_LIT == tkn.typ {
+					fl.cols = append(fl.cols, cfg.literal(tkn))
+					continue
+				}
+				fl.cols = append(fl.cols, tkn.tkn)
+			}
+		default:
+			fl.cols = []string{}
+			for _, tkn := range tokens {
+				fl.cols = append(fl.cols, tkn.tkn)
+			}
+		}
+		lines = append(lines, fl)
+	}
+
+	// align the columns of each run of consecutive lines of the same kind
+	for start := 0; start < len(lines); {
+		end := start + 1
+		for end < len(lines) && TOK_NIL != lines[start].kind && lines[end].kind == lines[start].kind {
+			end++
+		}
+		alignRun(lines[start:end])
+		start = end
+	}
+
+	s := ""
+	blank := true
+	for _, fl := range lines {
+		text := fl.indent + strings.Join(fl.cols, "")
+		if fl.hasCmt {
+			text = text + "#" + fl.comment
+		}
+		text = strings.TrimRight(text, " ")
+		if "" == text {
+			if !blank {
+				s = s + "\n"
+			}
+			blank = true
+			continue
+		}
+		s = s + text + "\n"
+		blank = false
+	}
+	if blank {
+		s = strings.TrimRight(s, "\n") + "\n"
+	}
+	if "\n" == s {
+		s = ""
+	}
+
+	return []byte(s), nil
+}
+
+// alignRun pads the columns of consecutive lines. Instructions put the
+// operand after the mnemonic padded to 4 characters, constants pad the name
+// to the longest in the run. Trailing comments start one space after the
+// longest code that has one.
+func alignRun(run []*fmtLine) {
+	if TOK_NIL == run[0].kind {
+		return
+	}
+
+	width := 4
+	if TOK_OP != run[0].kind {
+		width = 0
+		for _, fl := range run {
+			if 1 < len(fl.cols) && len(fl.cols[0]) > width {
+				width = len(fl.cols[0])
+			}
+		}
+	}
+	for _, fl := range run {
+		for k := 0; k < len(fl.cols)-1; k++ {
+			pad := 1
+			if 0 == k {
+				pad = width - len(fl.cols[0]) + 1
+			}
+			fl.cols[k] = fl.cols[k] + strings.Repeat(" ", pad)
+		}
+	}
+
+	comment := 0
+	for _, fl := range run {
+		if n := len(strings.Join(fl.cols, "")); fl.hasCmt && n > comment {
+			comment = n
+		}
+	}
+	for _, fl := range run {
+		if !fl.hasCmt {
+			continue
+		}
+		code := strings.Join(fl.cols, "")
+		fl.cols = []string{code + strings.Repeat(" ", comment-len(code)+1)}
+	}
+}
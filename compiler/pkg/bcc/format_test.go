@@ -0,0 +1,41 @@
+package bcc_test
+
+import (
+	"testing"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcctest"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		literals bcc.LiteralFormat
+		want     string
+	}{
+		{"instruction", "  LDAV   28 # a\n  OUTA # b\n", bcc.LIT_KEEP, "    LDAV 28 # a\n    OUTA    # b\n"},
+		{"hex", "    LDAV 28\n", bcc.LIT_HEX, "    LDAV 0x1C\n"},
+		{"labeled instruction", "x   LDAV 28\n    JMP x\n", bcc.LIT_HEX, "x\n    LDAV 0x1C\n    JMP  x\n"},
+		{"labeled with comment", "x OUTA # out\n    JMP x\n", bcc.LIT_KEEP, "x\n    OUTA # out\n    JMP  x\n"},
+		{"constants", "$a 1\n$long 0x02\n    LDAV $a\n", bcc.LIT_DEC, "$a    1\n$long 2\n    LDAV $a\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := bcc.DefaultFormatConfig()
+			cfg.Literals = tt.literals
+			got, err := bcc.Format([]byte(tt.src), cfg)
+			if nil != err {
+				t.Fatalf("format: %s", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("formatted:\n got  %q\n want %q", got, tt.want)
+			}
+
+			// formatting never changes the program
+			if want := bcctest.Code(t, tt.src); string(bcctest.Code(t, string(got))) != string(want) {
+				t.Errorf("formatted source assembles differently")
+			}
+		})
+	}
+}
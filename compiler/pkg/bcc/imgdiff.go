@@ -0,0 +1,151 @@
+package bcc
+
+import "sort"
+
+// DiffLine is a line of an instruction level diff of two images.
+type DiffLine struct {
+	// ' ' in both images, '-' only in the old one, '+' only in the new one
+	Op byte
+	// the instruction in the old and new image, as applicable
+	Old, New Decoded
+	// the instruction as source, with jump targets named when there is debug
+	// info
+	Code string
+}
+
+// Move is a label or subroutine whose address changed.
+type Move struct {
+	Name     string
+	Old, New int
+}
+
+// ImageDiff aligns the programs of two images.
+type ImageDiff struct {
+	Lines []DiffLine
+	Moves []Move
+}
+
+// DiffImages aligns the instructions of two images, a longest common
+// subsequence so inserted code shows as an insertion rather than changing
+// everything after it. With debug info for both, jumps compare by target
+// label, so code that only moved matches; either may be nil.
+func DiffImages(old, new []byte, oldDbg, newDbg *DebugInfo) *ImageDiff {
+	a := disasmFor(old, oldDbg)
+	b := disasmFor(new, newDbg)
+	keyA := make([]string, len(a))
+	for k, inst := range a {
+		keyA[k] = diffCode(inst, oldDbg)
+	}
+	keyB := make([]string, len(b))
+	for k, inst := range b {
+		keyB[k] = diffCode(inst, newDbg)
+	}
+
+	// lcs[i][j] is the common length of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch true {
+			case keyA[i] == keyB[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	diff := &ImageDiff{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch true {
+		case i < len(a) && j < len(b) && keyA[i] == keyB[j]:
+			diff.Lines = append(diff.Lines, DiffLine{' ', a[i], b[j], keyB[j]})
+			i, j = i+1, j+1
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			diff.Lines = append(diff.Lines, DiffLine{Op: '-', Old: a[i], Code: keyA[i]})
+			i++
+		default:
+			diff.Lines = append(diff.Lines, DiffLine{Op: '+', New: b[j], Code: keyB[j]})
+			j++
+		}
+	}
+
+	if nil != oldDbg && nil != newDbg {
+		for _, sym := range newDbg.Symbols {
+			if SYM_CONST == sym.Kind {
+				continue
+			}
+			for _, was := range oldDbg.Symbols {
+				if sym.Name == was.Name && SYM_CONST != was.Kind && sym.Value != was.Value {
+					diff.Moves = append(diff.Moves, Move{sym.Name, was.Value, sym.Value})
+				}
+			}
+		}
+		sort.Slice(diff.Moves, func(i, j int) bool { return diff.Moves[i].New < diff.Moves[j].New })
+	}
+	return diff
+}
+
+// Changed reports whether the programs differ.
+func (diff *ImageDiff) Changed() bool {
+	for _, line := range diff.Lines {
+		if ' ' != line.Op {
+			return true
+		}
+	}
+	return false
+}
+
+// Hunks groups the changed lines with up to context unchanged lines around
+// them.
+func (diff *ImageDiff) Hunks(context int) [][]DiffLine {
+	hunks := [][]DiffLine{}
+	start, end := 0, -1
+	for k, line := range diff.Lines {
+		if ' ' == line.Op {
+			continue
+		}
+		if k-context > end {
+			if end >= 0 {
+				hunks = append(hunks, diff.Lines[start:end])
+			}
+			start = k - context
+			if start < 0 {
+				start = 0
+			}
+		}
+		end = k + 1 + context
+		if end > len(diff.Lines) {
+			end = len(diff.Lines)
+		}
+	}
+	if end >= 0 {
+		hunks = append(hunks, diff.Lines[start:end])
+	}
+	return hunks
+}
+
+// disasmFor disassembles the program of an image, sized by its debug info if
+// there is any.
+func disasmFor(img []byte, dbg *DebugInfo) []Decoded {
+	size := ImageSize(img)
+	if nil != dbg {
+		size = dbg.Size
+	}
+	return Disassemble(img, size)
+}
+
+// diffCode returns an instruction as source, naming jump targets.
+func diffCode(inst Decoded, dbg *DebugInfo) string {
+	if nil != dbg && ("JMP" == inst.Name || "RUN" == inst.Name) {
+		if label, ok := dbg.Label(int(inst.Operand)); ok {
+			return inst.Name + " " + label
+		}
+	}
+	return inst.String()
+}
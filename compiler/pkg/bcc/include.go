@@ -0,0 +1,136 @@
+package bcc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// origin is the file and line a source line came from. file is "" for the
+// main source.
+type origin struct {
+	file string
+	ln   int
+	via  []string // include directives leading to the line, outermost first
+}
+
+// SetIncludePaths sets the directories searched for included files after
+// the directory of the including file.
+func (bcc *bcc) SetIncludePaths(paths []string) {
+	bcc.includePaths = paths
+}
+
+// includeFile returns the file named by an include directive:
+//
+//	include "lib/math.asm"
+//
+// at column 0.
+func includeFile(line string) (string, bool) {
+	if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+		return "", false
+	}
+	code, _ := splitLine(line)
+	fields := strings.Fields(code)
+	if 2 != len(fields) || "include" != fields[0] {
+		return "", false
+	}
+	return strings.Trim(fields[1], `"`), true
+}
+
+// expand replaces include directives with the lines of the files they name,
+// recording where every line came from. Each file is included at most once,
+// so libraries can include their own dependencies.
+func (bcc *bcc) expand() {
+	bcc.origins = []origin{}
+	lines := []string{}
+	seen := map[string]bool{}
+	if "" != bcc.sourceFile {
+		if abs, err := filepath.Abs(bcc.sourceFile); nil == err {
+			seen[abs] = true
+		}
+	}
+
+	var walk func(file, dir string, src []string, via []string)
+	walk = func(file, dir string, src []string, via []string) {
+		for idx, line := range src {
+			name, ok := includeFile(line)
+			if !ok {
+				lines = append(lines, line)
+				bcc.origins = append(bcc.origins, origin{file, idx + 1, via})
+				continue
+			}
+
+			// the directive is kept as a blank line so errors can point at it
+			lines = append(lines, "")
+			bcc.origins = append(bcc.origins, origin{file, idx + 1, via})
+			path, ok := bcc.resolve(dir, name)
+			if !ok {
+				bcc.diagnose(len(lines), "syntax", SEV_ERROR, "included file '%s' not found", name)
+				continue
+			}
+			if abs, err := filepath.Abs(path); nil == err {
+				if seen[abs] {
+					continue
+				}
+				seen[abs] = true
+			}
+			byts, err := ioutil.ReadFile(path)
+			if nil != err {
+				bcc.diagnose(len(lines), "syntax", SEV_ERROR, "could not read included file '%s': %s", name, rootText(err))
+				continue
+			}
+			from := file
+			if "" == from {
+				from = bcc.sourceFile
+			}
+			walk(path, filepath.Dir(path), strings.Split(strings.ReplaceAll(string(byts), "\r\n", "\n"), "\n"),
+				append(append([]string{}, via...), fmt.Sprintf("%s:%d", from, idx+1)))
+		}
+	}
+	walk("", filepath.Dir(bcc.sourceFile), bcc.lines, nil)
+	bcc.lines = lines
+}
+
+// resolve finds an included file in the including file's directory, then
+// the include paths.
+func (bcc *bcc) resolve(dir, name string) (string, bool) {
+	if filepath.IsAbs(name) {
+		_, err := os.Stat(name)
+		return name, nil == err
+	}
+	for _, base := range append([]string{dir}, bcc.includePaths...) {
+		path := filepath.Join(base, name)
+		if info, err := os.Stat(path); nil == err && !info.IsDir() {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// position returns the file and line an expanded source line came from.
+func (bcc *bcc) position(ln int) (string, int) {
+	if ln < 1 || ln > len(bcc.origins) {
+		return "", ln
+	}
+	return bcc.origins[ln-1].file, bcc.origins[ln-1].ln
+}
+
+// where describes an expanded source line for error messages.
+func (bcc *bcc) where(ln int) string {
+	file, line := bcc.position(ln)
+	if "" == file {
+		return fmt.Sprintf("line %d", line)
+	}
+	return fmt.Sprintf("%s:%d", file, line)
+}
+
+// includedVia returns the include directives that led to an expanded source
+// line, outermost first.
+func (bcc *bcc) includedVia(ln int) []string {
+	if ln < 1 || ln > len(bcc.origins) {
+		return nil
+	}
+	return bcc.origins[ln-1].via
+}
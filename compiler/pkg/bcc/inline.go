@@ -0,0 +1,403 @@
+package bcc
+
+import (
+	"math"
+	"sort"
+
+	"github.com/bdlm/errors/v2"
+)
+
+// InlineConfig controls the whole-program size optimizations.
+type InlineConfig struct {
+	// Subroutines with a body of at most MaxSize bytes are inlined at every
+	// call site while the program grows by no more than Budget bytes. 0 only
+	// inlines subroutines called once.
+	MaxSize int
+	Budget  int
+	// Subroutines called more than once are only inlined when their call
+	// sites run at least MinRuns times in total. A call site in a loop runs
+	// without bound. 0 inlines regardless of how often they run.
+	MinRuns int
+}
+
+// callGraph is the subroutine call graph built from RUN sites and the
+// subroutine map.
+type callGraph struct {
+	// subroutine => indexes of the RUN instructions that call it
+	sites map[string][]int
+	// subroutine => referenced by something other than RUN (a tail call or
+	// an invalid JMP)
+	other map[string]bool
+	// subroutine => subroutines and labels it references
+	refs map[string]map[string]bool
+	// symbols referenced by top level code
+	roots map[string]bool
+	// label => enclosing subroutine
+	labels map[string]string
+}
+
+// callGraph builds the call graph of the parsed program.
+func (bcc *bcc) callGraph() *callGraph {
+	graph := &callGraph{
+		sites:  map[string][]int{},
+		other:  map[string]bool{},
+		refs:   map[string]map[string]bool{},
+		roots:  map[string]bool{},
+		labels: map[string]string{},
+	}
+	for idx, inst := range bcc.instructions {
+		if TOK_LABEL == inst.tokens[0].typ {
+			graph.labels[inst.tokens[0].tkn] = inst.sub
+		}
+		param := inst.op.param
+		if nil == param || TOK_LREF != param.typ {
+			continue
+		}
+		if _, ok := bcc.subMap[param.tkn]; ok {
+			if "RUN" == inst.opName() {
+				graph.sites[param.tkn] = append(graph.sites[param.tkn], idx)
+			} else {
+				graph.other[param.tkn] = true
+			}
+		}
+		if "" == inst.sub {
+			graph.roots[param.tkn] = true
+			continue
+		}
+		if nil == graph.refs[inst.sub] {
+			graph.refs[inst.sub] = map[string]bool{}
+		}
+		graph.refs[inst.sub][param.tkn] = true
+	}
+	return graph
+}
+
+// live returns the subroutines reachable from top level code, directly or
+// through a label inside them.
+func (graph *callGraph) live() map[string]bool {
+	live := map[string]bool{}
+	var visit func(name string)
+	visit = func(name string) {
+		if sub, ok := graph.labels[name]; ok {
+			name = sub
+		}
+		if "" == name || live[name] {
+			return
+		}
+		live[name] = true
+		for ref := range graph.refs[name] {
+			visit(ref)
+		}
+	}
+	for ref := range graph.roots {
+		visit(ref)
+	}
+	return live
+}
+
+// recursive returns whether a subroutine can call itself.
+func (graph *callGraph) recursive(name string) bool {
+	seen := map[string]bool{}
+	var visit func(sub string) bool
+	visit = func(sub string) bool {
+		for ref := range graph.refs[sub] {
+			if owner, ok := graph.labels[ref]; ok {
+				ref = owner
+			}
+			if ref == name {
+				return true
+			}
+			if "" == ref || seen[ref] {
+				continue
+			}
+			seen[ref] = true
+			if visit(ref) {
+				return true
+			}
+		}
+		return false
+	}
+	return visit(name)
+}
+
+// subRuns returns how many times the call sites of each subroutine run
+// according to the loop analysis: once for top level code, once per run of
+// the enclosing subroutine and without bound, math.MaxInt32, in a loop or a
+// subroutine reached other than by RUN.
+func (bcc *bcc) subRuns(graph *callGraph) map[string]int {
+	// the loop analysis needs addresses, a program that is too large is
+	// reported when it is assembled
+	diags := bcc.diagnostics
+	_ = bcc.layout()
+	bcc.diagnostics = diags
+
+	looped := map[*instruction]bool{}
+	for _, lp := range bcc.loops() {
+		for _, inst := range lp.body {
+			looped[inst] = true
+		}
+	}
+
+	runs := map[string]int{}
+	var visit func(name string) int
+	visit = func(name string) int {
+		if n, ok := runs[name]; ok {
+			return n
+		}
+		// a recursive call runs without bound
+		runs[name] = math.MaxInt32
+		if graph.other[name] {
+			return runs[name]
+		}
+		n := 0
+		for _, idx := range graph.sites[name] {
+			site := bcc.instructions[idx]
+			m := 1
+			switch true {
+			case looped[site]:
+				m = math.MaxInt32
+			case "" != site.sub:
+				m = visit(site.sub)
+			}
+			if n += m; n > math.MaxInt32 {
+				n = math.MaxInt32
+			}
+		}
+		runs[name] = n
+		return n
+	}
+	for name := range bcc.subMap {
+		visit(name)
+	}
+	return runs
+}
+
+// subRange returns the indexes of a subroutine's opening line and its last
+// instruction, the closing brace unless a tail call replaced it.
+func (bcc *bcc) subRange(name string) (int, int) {
+	start := bcc.subMap[name]
+	end := start
+	for end+1 < len(bcc.instructions) && name == bcc.instructions[end+1].sub {
+		end++
+	}
+	return start, end
+}
+
+// body returns the instructions of a subroutine, without its opening line
+// and closing brace.
+func (bcc *bcc) body(name string) []*instruction {
+	start, end := bcc.subRange(name)
+	if bcc.instructions[end].isReturn() {
+		return bcc.instructions[start+1 : end]
+	}
+	return bcc.instructions[start+1 : end+1]
+}
+
+// inlineable returns whether the body of a subroutine can replace its call
+// sites: it is only called by RUN, is not recursive, never pops its return
+// address and, when copied to more than one site, defines no labels.
+func (bcc *bcc) inlineable(graph *callGraph, name string) bool {
+	if graph.other[name] || graph.recursive(name) {
+		return false
+	}
+	depth := 0
+	for _, inst := range bcc.body(name) {
+		if TOK_LABEL == inst.tokens[0].typ && 1 < len(graph.sites[name]) {
+			return false
+		}
+		if depth += inst.stackEffect(); depth < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Inline removes subroutines that are never called, inlines subroutines
+// called exactly once and, within the configured budget, small subroutines
+// called more than once. It returns the rewrites made. Like Optimize it
+// leaves programs that use fixed addresses alone.
+func (bcc *bcc) Inline(cfg InlineConfig) ([]Rewrite, error) {
+	rewrites := []Rewrite{}
+	if !bcc.movable() {
+		return rewrites, nil
+	}
+
+	// without top level code the first subroutine runs at address 0
+	top := false
+	for _, inst := range bcc.instructions {
+		top = top || ("" == inst.sub && 0 < inst.size())
+	}
+	if !top {
+		return rewrites, nil
+	}
+
+	growth := 0
+	for {
+		bcc.index()
+		graph := bcc.callGraph()
+
+		names := []string{}
+		for name := range bcc.subMap {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		// dead subroutines
+		live := graph.live()
+		dead := ""
+		for _, name := range names {
+			if !live[name] {
+				dead = name
+				break
+			}
+		}
+		if "" != dead {
+			rewrites = append(rewrites, *bcc.removeSub(dead))
+			continue
+		}
+
+		// the candidate that grows the program least
+		runs := map[string]int{}
+		if 0 < cfg.MinRuns {
+			runs = bcc.subRuns(graph)
+		}
+		best, bestCost := "", 0
+		for _, name := range names {
+			sites := len(graph.sites[name])
+			if 0 == sites || !bcc.inlineable(graph, name) {
+				continue
+			}
+			size, _ := cost(bcc.body(name)...)
+			// each site replaces a RUN with the body, then the body and its
+			// return are removed
+			grow := sites*(size-2) - (size + 1)
+			if 1 < sites && (size > cfg.MaxSize || growth+grow > cfg.Budget || runs[name] < cfg.MinRuns) {
+				continue
+			}
+			if "" == best || grow < bestCost {
+				best, bestCost = name, grow
+			}
+		}
+		if "" == best {
+			break
+		}
+		if 1 < len(graph.sites[best]) {
+			growth += bestCost
+		}
+
+		rws, err := bcc.inline(best, graph.sites[best])
+		if nil != err {
+			return rewrites, errors.Wrap(err, "could not inline '%s'", best)
+		}
+		rewrites = append(rewrites, rws...)
+	}
+
+	bcc.index()
+	bcc.rewrites = append(bcc.rewrites, rewrites...)
+	return rewrites, nil
+}
+
+// inline replaces each RUN site of a subroutine with its body and removes the
+// subroutine. A single site receives the original instructions, several
+// sites receive copies. Tail calls in the body become calls again since the
+// body no longer ends in a return.
+func (bcc *bcc) inline(name string, sites []int) ([]Rewrite, error) {
+	rewrites := []Rewrite{}
+	body := bcc.body(name)
+	start, end := bcc.subRange(name)
+	copies := 1 < len(sites)
+
+	isSite := map[int]bool{}
+	for _, idx := range sites {
+		isSite[idx] = true
+	}
+
+	list := []*instruction{}
+	for idx, inst := range bcc.instructions {
+		if idx >= start && idx <= end {
+			// constant definitions outlive the subroutine
+			if TOK_CONST == inst.tokens[0].typ && !copies {
+				continue
+			}
+			if TOK_CONST == inst.tokens[0].typ {
+				inst.sub = ""
+				list = append(list, inst)
+			}
+			continue
+		}
+		if !isSite[idx] {
+			list = append(list, inst)
+			continue
+		}
+
+		// the call site's label now marks the start of the body
+		site := bcc.instructions[idx]
+		if TOK_LABEL == site.tokens[0].typ {
+			label, err := newInst(site.ln, site.tokens[0].tkn)
+			if nil != err {
+				return nil, errors.Wrap(err, "could not copy label on line %d", site.ln)
+			}
+			label.sub = site.sub
+			list = append(list, label)
+		}
+
+		repl := []*instruction{}
+		for _, orig := range body {
+			if TOK_CONST == orig.tokens[0].typ && copies {
+				continue
+			}
+			inst := orig
+			if copies || orig.tail {
+				line := " " + orig.code()
+				if orig.tail {
+					line = " RUN " + orig.op.param.tkn
+				}
+				clone, err := newInst(orig.ln, line)
+				if nil != err {
+					return nil, errors.Wrap(err, "could not copy line %d", orig.ln)
+				}
+				inst = clone
+			}
+			inst.sub = site.sub
+			repl = append(repl, inst)
+		}
+		list = append(list, repl...)
+
+		// the body still runs, the call and return do not
+		rw := newRewrite(site.ln, "inline", []*instruction{site}, repl)
+		rw.Cycles = site.cycles()
+		if ret := bcc.instructions[end]; ret.isReturn() {
+			rw.Cycles += ret.cycles()
+		}
+		rewrites = append(rewrites, *rw)
+	}
+
+	rewrites = append(rewrites, *bcc.removal("inline", start, end))
+
+	bcc.instructions = list
+	return rewrites, nil
+}
+
+// removeSub removes a subroutine that is never called.
+func (bcc *bcc) removeSub(name string) *Rewrite {
+	start, end := bcc.subRange(name)
+	rw := bcc.removal("dead-subroutine", start, end)
+
+	list := append([]*instruction{}, bcc.instructions[:start]...)
+	for _, inst := range bcc.instructions[start : end+1] {
+		if TOK_CONST == inst.tokens[0].typ {
+			inst.sub = ""
+			list = append(list, inst)
+		}
+	}
+	bcc.instructions = append(list, bcc.instructions[end+1:]...)
+	return rw
+}
+
+// removal records the removal of a subroutine.
+func (bcc *bcc) removal(rule string, start, end int) *Rewrite {
+	rw := newRewrite(bcc.instructions[start].ln, rule, bcc.instructions[start:end+1], nil)
+	rw.Before = []string{bcc.instructions[start].code()}
+	rw.Cycles = 0
+	return rw
+}
@@ -0,0 +1,33 @@
+package bcc_test
+
+import (
+	"testing"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+)
+
+func TestInline(t *testing.T) {
+	inc := "inc {\n    ADDV 1\n}\n"
+	runRewriteTests(t, []rewriteTest{
+		{"single call", inc + "    LDAV 0\n    RUN inc\n    OUTA\n    HLT\n", "inline inline", "    LDAV 0\n    ADDV 1\n    OUTA\n    HLT\n"},
+		{"labeled call", inc + "    LDAV 0\nloop RUN inc\n    OUTA\n    JMP loop\n", "inline inline", "    LDAV 0\nloop\n    ADDV 1\n    OUTA\n    JMP loop\n"},
+		{"dead subroutine", inc + "    LDAV 1\n    HLT\n", "dead-subroutine", "    LDAV 1\n    HLT\n"},
+		{"several calls", inc + "    RUN inc\n    RUN inc\n    OUTA\n", "", inc + "    RUN inc\n    RUN inc\n    OUTA\n"},
+		{"recursive", "f {\n    RUN f\n    OUTA\n}\n    RUN f\n", "", ""},
+	}, bcc.WithOptimization(bcc.OPT_INLINE))
+
+	runRewriteTests(t, []rewriteTest{
+		{"several calls within budget", inc + "    RUN inc\n    RUN inc\n    OUTA\n", "inline inline inline", "    ADDV 1\n    ADDV 1\n    OUTA\n"},
+		{"body over size", "f {\n    ADDV 1\n    ADDV 2\n}\n    RUN f\n    RUN f\n", "", ""},
+	}, bcc.WithOptimization(bcc.OPT_INLINE), bcc.WithInline(bcc.InlineConfig{MaxSize: 2}))
+
+	// call sites that run fewer than 3 times are left alone
+	twice := "f {\n    RUN inc\n    RUN inc\n    OUTA\n}\n"
+	runRewriteTests(t, []rewriteTest{
+		{"run twice", inc + "    RUN inc\n    RUN inc\n    HLT\n", "", inc + "    RUN inc\n    RUN inc\n    HLT\n"},
+		{"run three times", inc + "    RUN inc\n    RUN inc\n    RUN inc\n    HLT\n", "inline inline inline inline", "    ADDV 1\n    ADDV 1\n    ADDV 1\n    HLT\n"},
+		{"run in a loop", inc + "loop RUN inc\n    RUN inc\n    OUTA\n    JMP loop\n", "inline inline inline", "loop\n    ADDV 1\n    ADDV 1\n    OUTA\n    JMP loop\n"},
+		{"run by a subroutine run twice", inc + twice + "    RUN f\n    RUN f\n    HLT\n", "inline inline inline", "f {\n    ADDV 1\n    ADDV 1\n    OUTA\n}\n    RUN f\n    RUN f\n    HLT\n"},
+		{"run by a subroutine run once", inc + twice + "    RUN f\n    HLT\n", "inline inline", "inc {\n    ADDV 1\n}\n    RUN inc\n    RUN inc\n    OUTA\n    HLT\n"},
+	}, bcc.WithOptimization(bcc.OPT_INLINE), bcc.WithInline(bcc.InlineConfig{MaxSize: 2, Budget: 16, MinRuns: 3}))
+}
@@ -13,6 +13,9 @@ type instruction struct {
 	line   string
 	tokens []*tok
 	op     *oper
+	addr   int    // ROM address
+	sub    string // enclosing subroutine
+	tail   bool   // JMP to a subroutine generated by the tail-call rewrite
 }
 
 func (inst *instruction) Type() tokenType {
@@ -43,8 +46,60 @@ func (inst *instruction) Line() string {
 	return inst.line
 }
 
-func (inst *instruction) compile() ([]byte, error) {
-	return inst.op.byts, nil
+// Addr returns the ROM address of the instruction.
+func (inst *instruction) Addr() int {
+	return inst.addr
+}
+
+// size returns the number of ROM bytes the instruction occupies.
+func (inst *instruction) size() int {
+	return inst.op.size()
+}
+
+// compile returns the opcode and operand bytes, resolving symbol references.
+// Undefined symbols are recorded as error diagnostics and encoded as 0.
+func (inst *instruction) compile(bcc *bcc) ([]byte, error) {
+	if nil == inst.op.code {
+		return []byte{}, nil
+	}
+
+	byts := []byte{inst.op.code.pcid}
+	if nil == inst.op.param {
+		return byts, nil
+	}
+
+	param := inst.op.param
+	switch param.typ {
+	case TOK_LIT:
+		byts = append(byts, param.dat)
+	case TOK_CREF:
+		byt, ok := bcc.constMap[param.tkn]
+		if !ok {
+			bcc.diagnose(inst.ln, "undefined", SEV_ERROR, "undefined constant '%s'", param.tkn)
+		}
+		byts = append(byts, byt)
+	case TOK_LREF:
+		if "RUN" == inst.op.code.name || inst.tail {
+			addr, ok := bcc.addrOf(bcc.subMap, param.tkn)
+			if !ok {
+				bcc.diagnose(inst.ln, "undefined", SEV_ERROR, "undefined subroutine '%s'", param.tkn)
+			}
+			byts = append(byts, byte(addr))
+			break
+		}
+		if addr, ok := bcc.addrOf(bcc.subMap, param.tkn); ok {
+			bcc.diagnose(inst.ln, "jmp-subroutine", SEV_ERROR, "subroutine '%s' is not a valid %s target, use RUN", param.tkn, inst.op.code.name)
+			byts = append(byts, byte(addr))
+			break
+		}
+		addr, ok := bcc.addrOf(bcc.jmpMap, param.tkn)
+		if !ok {
+			bcc.diagnose(inst.ln, "undefined", SEV_ERROR, "undefined label '%s'", param.tkn)
+		}
+		byts = append(byts, byte(addr))
+	}
+
+	return byts, nil
 }
 
 func (inst *instruction) tokenize() error {
@@ -0,0 +1,58 @@
+package bcc
+
+import (
+	"github.com/bdlm/errors/v2"
+)
+
+const (
+	// Addressable is the number of ROM bytes the 8 bit program counter can
+	// reach.
+	Addressable = 256
+)
+
+// layout assigns a ROM address to each instruction. Top level code is placed
+// first, starting at address 0, followed by the subroutine bodies in source
+// order so subroutines only run when called.
+func (bcc *bcc) layout() error {
+	addr := 0
+	var over *instruction // first instruction past the addressable space
+	for _, top := range []bool{true, false} {
+		for _, inst := range bcc.instructions {
+			if top != ("" == inst.sub) {
+				continue
+			}
+			inst.addr = addr
+			addr += inst.size()
+			if addr > Addressable && nil == over {
+				over = inst
+			}
+		}
+	}
+
+	if nil != over {
+		bcc.diagnose(over.ln, "program-size", SEV_ERROR, "program is %d bytes, only %d are addressable", addr, Addressable)
+		return errors.Errorf("program is %d bytes, only %d are addressable", addr, Addressable)
+	}
+
+	return nil
+}
+
+// size returns the number of bytes in the program, excluding padding.
+func (bcc *bcc) size() int {
+	size := 0
+	for _, inst := range bcc.instructions {
+		if end := inst.addr + inst.size(); end > size {
+			size = end
+		}
+	}
+	return size
+}
+
+// addrOf returns the ROM address of a label or subroutine.
+func (bcc *bcc) addrOf(idxMap map[string]int, name string) (int, bool) {
+	idx, ok := idxMap[name]
+	if !ok {
+		return 0, false
+	}
+	return bcc.instructions[idx].addr, true
+}
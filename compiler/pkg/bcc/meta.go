@@ -0,0 +1,207 @@
+package bcc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/ucode"
+
+	"github.com/bdlm/errors/v2"
+)
+
+const (
+	// MetaAddr is where the metadata block is embedded in a program image,
+	// just past the addresses the program counter can reach.
+	MetaAddr = Addressable
+
+	// MetaSize is the size of the embedded metadata block.
+	MetaSize = 32
+
+	// MetaExt is appended to an image file name to name its metadata
+	// sidecar.
+	MetaExt = ".meta"
+)
+
+// Where the metadata of a built image is kept.
+const (
+	// embedded in the image at MetaAddr
+	META_EMBED = "embed"
+	// in a JSON sidecar, image.meta
+	META_SIDECAR = "sidecar"
+	// not kept
+	META_NONE = "none"
+)
+
+// metaMagic starts an embedded metadata block.
+var metaMagic = []byte("BCCM")
+
+// Metadata identifies the ISA an image was built for and lets tools detect
+// corrupt or mismatched images. Embedded in a program image it is encoded
+// as:
+//
+//	0x00  "BCCM"
+//	0x04  version
+//	0x06  length, little endian
+//	0x08  ISA hash
+//	0x10  build ID
+//	0x18  CRC-32 of the first length bytes
+//	0x1C  CRC-32 of the block up to here
+type Metadata struct {
+	Version int `json:"version"`
+	// ISAHash of the instruction set the image was built for
+	ISA string `json:"isa"`
+	// reproducible: the same source and ISA give the same ID
+	BuildID string `json:"build_id"`
+	// bytes covered by the CRC
+	Length int    `json:"length"`
+	CRC    uint32 `json:"crc"`
+}
+
+// MetaVersion is the metadata format version.
+const MetaVersion = 1
+
+// ISAHash fingerprints the instruction set of a target: the opcode of every
+// operation it implements and the micro-steps it executes. Images and
+// decoder ROMs built from different opcode tables, op tables or microcode
+// have different hashes.
+func ISAHash(target Target) string {
+	ops := map[string]bool{}
+	for _, op := range target.Ops {
+		ops[op] = true
+	}
+	h := sha256.New()
+	for _, name := range OpNames() {
+		if nil != target.Ops && !ops[name] {
+			continue
+		}
+		opcode, _ := Opcode(name)
+		steps, _ := ucode.Lookup(name)
+		fmt.Fprintf(h, "%02X %s", opcode, name)
+		for _, sig := range steps {
+			binary.Write(h, binary.LittleEndian, uint64(sig))
+		}
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// NewMetadata describes the first length bytes of an image built for a
+// target.
+func NewMetadata(target Target, img []byte, length int) Metadata {
+	isa := ISAHash(target)
+	h := sha256.New()
+	h.Write([]byte(isa))
+	h.Write(img[:length])
+	return Metadata{
+		Version: MetaVersion,
+		ISA:     isa,
+		BuildID: hex.EncodeToString(h.Sum(nil)[:8]),
+		Length:  length,
+		CRC:     crc32.ChecksumIEEE(img[:length]),
+	}
+}
+
+// Encode returns the embedded form of the metadata.
+func (meta Metadata) Encode() []byte {
+	block := make([]byte, MetaSize)
+	copy(block, metaMagic)
+	block[4] = byte(meta.Version)
+	binary.LittleEndian.PutUint16(block[6:], uint16(meta.Length))
+	isa, _ := hex.DecodeString(meta.ISA)
+	copy(block[8:16], isa)
+	id, _ := hex.DecodeString(meta.BuildID)
+	copy(block[16:24], id)
+	binary.LittleEndian.PutUint32(block[24:], meta.CRC)
+	binary.LittleEndian.PutUint32(block[28:], crc32.ChecksumIEEE(block[:28]))
+	return block
+}
+
+// Embed writes the metadata block into a program image.
+func (meta Metadata) Embed(img []byte) error {
+	if len(img) < MetaAddr+MetaSize {
+		return errors.Errorf("%d byte image has no room for metadata at 0x%04X", len(img), MetaAddr)
+	}
+	copy(img[MetaAddr:], meta.Encode())
+	return nil
+}
+
+// ReadMetadata decodes the metadata block embedded in a program image. It
+// returns false if there is none.
+func ReadMetadata(img []byte) (Metadata, bool, error) {
+	if len(img) < MetaAddr+MetaSize || !bytes.Equal(metaMagic, img[MetaAddr:MetaAddr+4]) {
+		return Metadata{}, false, nil
+	}
+	block := img[MetaAddr : MetaAddr+MetaSize]
+	if crc32.ChecksumIEEE(block[:28]) != binary.LittleEndian.Uint32(block[28:]) {
+		return Metadata{}, true, errors.Errorf("corrupt metadata block at 0x%04X", MetaAddr)
+	}
+	meta := Metadata{
+		Version: int(block[4]),
+		Length:  int(binary.LittleEndian.Uint16(block[6:])),
+		ISA:     hex.EncodeToString(block[8:16]),
+		BuildID: hex.EncodeToString(block[16:24]),
+		CRC:     binary.LittleEndian.Uint32(block[24:]),
+	}
+	if MetaVersion != meta.Version {
+		return Metadata{}, true, errors.Errorf("unsupported metadata version %d, expected %d", meta.Version, MetaVersion)
+	}
+	return meta, true, nil
+}
+
+// LoadMetadata returns the metadata of an image file: the embedded block, or
+// the file's sidecar. It returns false if there is neither.
+func LoadMetadata(imgFile string, img []byte) (Metadata, bool, error) {
+	meta, ok, err := ReadMetadata(img)
+	if ok || nil != err {
+		return meta, ok, err
+	}
+	byts, err := ioutil.ReadFile(imgFile + MetaExt)
+	if os.IsNotExist(err) {
+		return Metadata{}, false, nil
+	}
+	if nil == err {
+		err = json.Unmarshal(byts, &meta)
+	}
+	if nil != err {
+		return Metadata{}, true, errors.Wrap(err, "could not read metadata sidecar: %s", err)
+	}
+	if MetaVersion != meta.Version {
+		return Metadata{}, true, errors.Errorf("unsupported metadata version %d, expected %d", meta.Version, MetaVersion)
+	}
+	return meta, true, nil
+}
+
+// WriteSidecar writes the metadata next to an image file.
+func (meta Metadata) WriteSidecar(imgFile string) error {
+	byts, err := json.MarshalIndent(meta, "", "  ")
+	if nil != err {
+		return errors.Wrap(err, "could not encode metadata")
+	}
+	return ioutil.WriteFile(imgFile+MetaExt, append(byts, '\n'), 0644)
+}
+
+// Verify checks an image against its length and CRC.
+func (meta Metadata) Verify(img []byte) error {
+	if meta.Length > len(img) {
+		return errors.Errorf("image is %d bytes, metadata expects at least %d", len(img), meta.Length)
+	}
+	if crc := crc32.ChecksumIEEE(img[:meta.Length]); crc != meta.CRC {
+		return errors.Errorf("image CRC is %08X, metadata expects %08X", crc, meta.CRC)
+	}
+	return nil
+}
+
+// CheckISA checks that the image was built for the target's ISA.
+func (meta Metadata) CheckISA(target Target) error {
+	if isa := ISAHash(target); isa != meta.ISA {
+		return errors.Errorf("image was built for ISA %s, target '%s' is ISA %s", meta.ISA, target.Name, isa)
+	}
+	return nil
+}
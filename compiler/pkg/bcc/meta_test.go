@@ -0,0 +1,133 @@
+package bcc_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcctest"
+)
+
+const metaSrc = "    LDAV 255\n    OUTA\n    HLT\n"
+
+func TestMetadataRoundTrip(t *testing.T) {
+	prog := assemble(t, metaSrc, bcc.WithMetadata(true))
+	if len(prog.Meta.Encode()) != bcc.MetaSize {
+		t.Errorf("encoded size: got %d, want %d", len(prog.Meta.Encode()), bcc.MetaSize)
+	}
+
+	meta, ok, err := bcc.ReadMetadata(prog.Image)
+	if nil != err || !ok {
+		t.Fatalf("read metadata: %v %v", ok, err)
+	}
+	if meta != prog.Meta {
+		t.Errorf("decoded metadata:\n got  %+v\n want %+v", meta, prog.Meta)
+	}
+	if err := meta.Verify(prog.Image); nil != err {
+		t.Errorf("verify: %s", err)
+	}
+	if err := meta.CheckISA(bcc.DefaultTarget()); nil != err {
+		t.Errorf("check ISA: %s", err)
+	}
+	if meta.Length != prog.Size {
+		t.Errorf("length: got %d, want %d", meta.Length, prog.Size)
+	}
+
+	// the block sits past the code and doesn't change what runs
+	trace := bcctest.Run(t, prog.Image, bcctest.Options{MustHalt: true})
+	bcctest.ExpectOut(t, trace, 255)
+}
+
+func TestMetadataBuildID(t *testing.T) {
+	a := assemble(t, metaSrc).Meta
+	b := assemble(t, metaSrc).Meta
+	c := assemble(t, "    LDAV 254\n    OUTA\n    HLT\n").Meta
+	if a.BuildID != b.BuildID {
+		t.Errorf("build ID is not reproducible: %s, %s", a.BuildID, b.BuildID)
+	}
+	if a.BuildID == c.BuildID {
+		t.Errorf("different programs share build ID %s", a.BuildID)
+	}
+}
+
+func TestMetadataCorrupt(t *testing.T) {
+	prog := assemble(t, metaSrc, bcc.WithMetadata(true))
+
+	// a program byte
+	img := append([]byte{}, prog.Image...)
+	img[1] = 0
+	meta, _, err := bcc.ReadMetadata(img)
+	if nil != err {
+		t.Fatalf("read metadata: %s", err)
+	}
+	if nil == meta.Verify(img) {
+		t.Errorf("verify passed a corrupt program")
+	}
+
+	// the block itself
+	img = append([]byte{}, prog.Image...)
+	img[bcc.MetaAddr+8] ^= 0xFF
+	if _, ok, err := bcc.ReadMetadata(img); !ok || nil == err {
+		t.Errorf("read a corrupt block: %v %v", ok, err)
+	}
+
+	// another ISA
+	meta = prog.Meta
+	meta.ISA = "0000000000000000"
+	if nil == meta.CheckISA(bcc.DefaultTarget()) {
+		t.Errorf("check ISA passed a foreign ISA")
+	}
+
+	// no block
+	if _, ok, err := bcc.ReadMetadata(assemble(t, metaSrc).Image); ok || nil != err {
+		t.Errorf("read metadata from a bare image: %v %v", ok, err)
+	}
+}
+
+// TestMetadataTarget checks the ISA hash covers the target's op table.
+func TestMetadataTarget(t *testing.T) {
+	small := bcc.Target{Name: "small", StackDepth: bcc.StackDepth}
+	for _, name := range bcc.OpNames() {
+		if "PSHA" != name {
+			small.Ops = append(small.Ops, name)
+		}
+	}
+	if bcc.ISAHash(bcc.DefaultTarget()) == bcc.ISAHash(small) {
+		t.Errorf("targets with different op tables share ISA %s", bcc.ISAHash(small))
+	}
+	all := bcc.Target{Name: "all", StackDepth: bcc.StackDepth, Ops: bcc.OpNames()}
+	if bcc.ISAHash(bcc.DefaultTarget()) != bcc.ISAHash(all) {
+		t.Errorf("listing every operation changed the ISA: %s, %s", bcc.ISAHash(bcc.DefaultTarget()), bcc.ISAHash(all))
+	}
+
+	meta := assemble(t, metaSrc, bcc.WithTarget(small)).Meta
+	if err := meta.CheckISA(small); nil != err {
+		t.Errorf("check ISA: %s", err)
+	}
+	if nil == meta.CheckISA(bcc.DefaultTarget()) {
+		t.Errorf("check ISA passed an image built for another target")
+	}
+}
+
+func TestMetadataSidecar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bcc")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	prog := assemble(t, metaSrc)
+	imgFile := filepath.Join(dir, "prog.img")
+	if err := prog.Meta.WriteSidecar(imgFile); nil != err {
+		t.Fatalf("write sidecar: %s", err)
+	}
+	meta, ok, err := bcc.LoadMetadata(imgFile, prog.Image)
+	if nil != err || !ok {
+		t.Fatalf("load metadata: %v %v", ok, err)
+	}
+	if meta != prog.Meta {
+		t.Errorf("sidecar metadata:\n got  %+v\n want %+v", meta, prog.Meta)
+	}
+}
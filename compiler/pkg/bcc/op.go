@@ -13,6 +13,60 @@ func init() {
 	}
 }
 
+// OpName returns the name of the operation encoded by an opcode. Internal
+// token operations are not valid opcodes.
+func OpName(pcid byte) (string, bool) {
+	if int(pcid) >= len(opTable) || pcid <= opMap[string(TOK_SUBEND)].pcid {
+		return "", false
+	}
+	return opTable[pcid].name, true
+}
+
+// Opcode returns the opcode of a named operation.
+func Opcode(name string) (byte, bool) {
+	op, ok := opMap[name]
+	if !ok || op.pcid <= opMap[string(TOK_SUBEND)].pcid {
+		return 0, false
+	}
+	return op.pcid, true
+}
+
+// OpNames returns the names of the operations in opcode order.
+func OpNames() []string {
+	names := []string{}
+	for _, op := range opTable {
+		if _, ok := Opcode(op.name); ok {
+			names = append(names, op.name)
+		}
+	}
+	return names
+}
+
+// OpDoc returns the description of a named operation and the kind of operand
+// it takes, "" for none.
+func OpDoc(name string) (string, string, bool) {
+	if _, ok := Opcode(name); !ok {
+		return "", "", false
+	}
+	op := opMap[name]
+	operand := ""
+	switch true {
+	case "RUN" == name:
+		operand = "subroutine"
+	case "JMP" == name:
+		operand = "label"
+	case op.hasParam:
+		operand = "$const or literal"
+	}
+	return op.doc, operand, true
+}
+
+// OpHasParam returns whether a named operation takes an operand byte.
+func OpHasParam(name string) bool {
+	op, ok := opMap[name]
+	return ok && op.hasParam
+}
+
 func newOp(tokens []*tok) (*oper, error) {
 	var err error
 
@@ -39,52 +93,63 @@ func (op *oper) tokenize() error {
 			log.WithField("token", tkn).Debug("GOT HERE")
 			return errors.Errorf("invalid token postion '%d'", tkn.pos)
 		case 0:
-			// switch tkn.typ {
-			// case TOK_CONST:
-			// case TOK_LABEL:
-			// case TOK_SUB:
-			// case TOK_SUBEND:
-			// }
-			op.byts = append(op.byts, byte(tkn.ln))
+			// Constants, labels and subroutine names only define symbols. The
+			// subroutine end returns to the caller.
+			if TOK_SUBEND == tkn.typ {
+				op.code = opMap["POPP"]
+			}
 		case 1:
-			switch tkn.typ {
-			case TOK_LIT:
-				op.byts = append(op.byts, tkn.dat)
-			case TOK_OP:
+			if TOK_OP == tkn.typ {
 				ref, ok := opMap[tkn.tkn]
 				if !ok {
 					return errors.Errorf("unknown operation '%s'", tkn.tkn)
 				}
-				op.byts = append(op.byts, ref.pcid)
+				op.code = ref
 			}
 		case 2:
-			switch tkn.typ {
-			case TOK_LIT:
-				op.byts = append(op.byts, tkn.dat)
-			case TOK_CREF:
-				byt, ok := constMap[tkn.tkn]
-				if !ok {
-					return errors.Errorf("unknown reference '%s'", tkn.tkn)
-				}
-				op.byts = append(op.byts, byt)
-			case TOK_LREF:
-				op.byts = append(op.byts, byte(tkn.ln))
-			}
+			op.param = tkn
 		}
 	}
 
+	switch true {
+	case nil == op.code && nil != op.param:
+		return errors.Errorf("unexpected operand '%s'", op.param.tkn)
+	case nil == op.code:
+	case op.code.hasParam && nil == op.param:
+		return errors.Errorf("operation '%s' requires an operand", op.code.name)
+	case !op.code.hasParam && nil != op.param:
+		return errors.Errorf("operation '%s' does not accept an operand", op.code.name)
+	}
+
 	return nil
 }
 
+// size returns the number of ROM bytes the operation occupies.
+func (op *oper) size() int {
+	switch true {
+	case nil == op.code:
+		return 0
+	case op.code.hasParam:
+		return 2
+	}
+	return 1
+}
+
 type oper struct {
-	byts   []byte
 	tokens []*tok
+	// Operation definition from `opTable`, nil for lines that only define
+	// symbols.
+	code *oper
+	// Operand token, if any.
+	param *tok
 	// Operation name as defined in `opTable`.
 	name string
 	// Whether this operation accepts param data.
 	hasParam bool
 	// Program counter Id.
 	pcid byte
+	// Description shown by editors.
+	doc string
 }
 
 var opMap map[string]*oper = map[string]*oper{}
@@ -103,58 +168,58 @@ var opTable []*oper = []*oper{
 	&oper{name: string(TOK_SUBEND), hasParam: false},
 
 	// system
-	&oper{name: "HLT", hasParam: false},  // Halt system clock signal
-	&oper{name: "RST", hasParam: false},  // Reset all system registers
-	&oper{name: "NOP", hasParam: false},  // No-op, use 1 instruction cycle
-	&oper{name: "SLOP", hasParam: false}, // Slow no-op, use 16 instruction cycles
+	&oper{name: "HLT", hasParam: false, doc: "Halt system clock signal"},
+	&oper{name: "RST", hasParam: false, doc: "Reset all system registers"},
+	&oper{name: "NOP", hasParam: false, doc: "No-op, use 1 instruction cycle"},
+	&oper{name: "SLOP", hasParam: false, doc: "Slow no-op, use 16 instruction cycles"},
 
 	// math
-	&oper{name: "ADDV", hasParam: true},  // Add a $const or literal to register A
-	&oper{name: "ADDX", hasParam: false}, // Add register X to register A
-	&oper{name: "ADDY", hasParam: false}, // Add register Y to register A
+	&oper{name: "ADDV", hasParam: true, doc: "Add a $const or literal to register A"},
+	&oper{name: "ADDX", hasParam: false, doc: "Add register X to register A"},
+	&oper{name: "ADDY", hasParam: false, doc: "Add register Y to register A"},
 
-	&oper{name: "SUBV", hasParam: true},  // Subtract a $const or literal from register A
-	&oper{name: "SUBX", hasParam: false}, // Subtract register X from register A
-	&oper{name: "SUBY", hasParam: false}, // Subtract register Y from register A
+	&oper{name: "SUBV", hasParam: true, doc: "Subtract a $const or literal from register A"},
+	&oper{name: "SUBX", hasParam: false, doc: "Subtract register X from register A"},
+	&oper{name: "SUBY", hasParam: false, doc: "Subtract register Y from register A"},
 
 	// branching logic
-	&oper{name: "RUN", hasParam: true}, // Execute a subroutine. Is encoded as a JMPV operation
+	&oper{name: "RUN", hasParam: true, doc: "Execute a subroutine: push the return address and jump to it. `}` is encoded as a POPP operation"},
 
-	&oper{name: "JMP", hasParam: true},   // `JMP [label]`  - Jump to [label]:       Load a label index into the program counter
-	&oper{name: "JMPV", hasParam: true},  // `JMPV [value]` - Jump to [value]:       Load a $const or literal value into the program counter
-	&oper{name: "JMPA", hasParam: false}, // `JMPA`         - Jump to register A:    Load register A into the program counter
-	&oper{name: "JMPX", hasParam: false}, // `JMPX`         - Jump to register X:    Load register X into the program counter
-	&oper{name: "JMPY", hasParam: false}, // `JMPY`         - Jump to register Y:    Load register Y into the program counter
-	&oper{name: "JMPS", hasParam: false}, // `JMPS`         - Jump to stack pointer: Load the last stack value into the program counter
+	&oper{name: "JMP", hasParam: true, doc: "Jump to a label: load the label address into the program counter"},
+	&oper{name: "JMPV", hasParam: true, doc: "Jump to a value: load a $const or literal into the program counter"},
+	&oper{name: "JMPA", hasParam: false, doc: "Jump to register A: load register A into the program counter"},
+	&oper{name: "JMPX", hasParam: false, doc: "Jump to register X: load register X into the program counter"},
+	&oper{name: "JMPY", hasParam: false, doc: "Jump to register Y: load register Y into the program counter"},
+	&oper{name: "JMPS", hasParam: false, doc: "Jump to the stack: load the last stack value into the program counter"},
 
 	// data
-	&oper{name: "LDAV", hasParam: true},  // Load a $const or literal value into register A
-	&oper{name: "LDAX", hasParam: false}, // Load register X into register A
-	&oper{name: "LDAY", hasParam: false}, // Load register Y into register A
+	&oper{name: "LDAV", hasParam: true, doc: "Load a $const or literal value into register A"},
+	&oper{name: "LDAX", hasParam: false, doc: "Load register X into register A"},
+	&oper{name: "LDAY", hasParam: false, doc: "Load register Y into register A"},
 
-	&oper{name: "LDXV", hasParam: true},  // Load a $const or literal value into register X
-	&oper{name: "LDXA", hasParam: false}, // Load register A into register X
-	&oper{name: "LDXY", hasParam: false}, // Load register Y into register X
+	&oper{name: "LDXV", hasParam: true, doc: "Load a $const or literal value into register X"},
+	&oper{name: "LDXA", hasParam: false, doc: "Load register A into register X"},
+	&oper{name: "LDXY", hasParam: false, doc: "Load register Y into register X"},
 
-	&oper{name: "LDYV", hasParam: true},  // Load a $const or literal value into register Y
-	&oper{name: "LDYA", hasParam: false}, // Load register A into register Y
-	&oper{name: "LDYX", hasParam: false}, // Load register X into register Y
+	&oper{name: "LDYV", hasParam: true, doc: "Load a $const or literal value into register Y"},
+	&oper{name: "LDYA", hasParam: false, doc: "Load register A into register Y"},
+	&oper{name: "LDYX", hasParam: false, doc: "Load register X into register Y"},
 
 	// stack
-	&oper{name: "PSHV", hasParam: true},  // Push a $const or literal value onto the stack
-	&oper{name: "PSHA", hasParam: false}, // Push register A onto the stack
-	&oper{name: "PSHX", hasParam: false}, // Push register X onto the stack
-	&oper{name: "PSHY", hasParam: false}, // Push register Y onto the stack
-	&oper{name: "PSHP", hasParam: false}, // Push the current program counter onto the stack
+	&oper{name: "PSHV", hasParam: true, doc: "Push a $const or literal value onto the stack"},
+	&oper{name: "PSHA", hasParam: false, doc: "Push register A onto the stack"},
+	&oper{name: "PSHX", hasParam: false, doc: "Push register X onto the stack"},
+	&oper{name: "PSHY", hasParam: false, doc: "Push register Y onto the stack"},
+	&oper{name: "PSHP", hasParam: false, doc: "Push the current program counter onto the stack"},
 
-	&oper{name: "POPA", hasParam: false}, // Pop a stack value into register A
-	&oper{name: "POPX", hasParam: false}, // Pop a stack value into register X
-	&oper{name: "POPY", hasParam: false}, // Pop a stack value into register Y
-	&oper{name: "POPP", hasParam: false}, // Pop the last value from the stack into the program counter
+	&oper{name: "POPA", hasParam: false, doc: "Pop a stack value into register A"},
+	&oper{name: "POPX", hasParam: false, doc: "Pop a stack value into register X"},
+	&oper{name: "POPY", hasParam: false, doc: "Pop a stack value into register Y"},
+	&oper{name: "POPP", hasParam: false, doc: "Pop the last value from the stack into the program counter"},
 
 	// output
-	&oper{name: "OUTV", hasParam: true},  // Send a value to the output register
-	&oper{name: "OUTA", hasParam: false}, // Send the A register to the output register
-	&oper{name: "OUTX", hasParam: false}, // Send the X register to the output register
-	&oper{name: "OUTY", hasParam: false}, // Send the Y register to the output register
+	&oper{name: "OUTV", hasParam: true, doc: "Send a value to the output register"},
+	&oper{name: "OUTA", hasParam: false, doc: "Send the A register to the output register"},
+	&oper{name: "OUTX", hasParam: false, doc: "Send the X register to the output register"},
+	&oper{name: "OUTY", hasParam: false, doc: "Send the Y register to the output register"},
 }
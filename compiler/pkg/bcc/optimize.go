@@ -0,0 +1,278 @@
+package bcc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bdlm/errors/v2"
+)
+
+// Rewrite is a change made by the peephole optimizer.
+type Rewrite struct {
+	Line   int      `json:"line"`
+	Rule   string   `json:"rule"`
+	Before []string `json:"before"`
+	After  []string `json:"after"`
+	Bytes  int      `json:"bytes"`  // program bytes saved
+	Cycles int      `json:"cycles"` // cycles saved each time the code runs
+}
+
+// String implements Stringer.
+func (rw Rewrite) String() string {
+	after := strings.Join(rw.After, "; ")
+	if "" == after {
+		after = "(removed)"
+	}
+	return fmt.Sprintf("line %d: %s => %s (%s, %d bytes, %d cycles saved)", rw.Line, strings.Join(rw.Before, "; "), after, rw.Rule, rw.Bytes, rw.Cycles)
+}
+
+// cost returns the bytes and cycles a run of instructions takes, excluding
+// called subroutines.
+func cost(insts ...*instruction) (int, int) {
+	byts, cycles := 0, 0
+	for _, inst := range insts {
+		byts += inst.size()
+		cycles += inst.cycles()
+	}
+	return byts, cycles
+}
+
+// newRewrite records the replacement of instructions.
+func newRewrite(ln int, rule string, before, after []*instruction) *Rewrite {
+	rw := &Rewrite{Line: ln, Rule: rule, Before: []string{}, After: []string{}}
+	for _, inst := range before {
+		rw.Before = append(rw.Before, inst.code())
+	}
+	for _, inst := range after {
+		rw.After = append(rw.After, inst.code())
+	}
+	beforeBytes, beforeCycles := cost(before...)
+	afterBytes, afterCycles := cost(after...)
+	rw.Bytes, rw.Cycles = beforeBytes-afterBytes, beforeCycles-afterCycles
+	return rw
+}
+
+// peephole is a rewrite of two adjacent instructions. match returns the
+// replacement source for the pair.
+type peephole struct {
+	rule  string
+	match func(a, b *instruction) ([]string, bool)
+}
+
+// moveOp returns the destination and source registers of a register to
+// register load.
+func moveOp(inst *instruction) (string, string, bool) {
+	name := inst.opName()
+	if 4 != len(name) || "LD" != name[:2] || !strings.ContainsAny(name[2:3], "AXY") || !strings.ContainsAny(name[3:], "AXY") {
+		return "", "", false
+	}
+	return name[2:3], name[3:], true
+}
+
+// peepholes is the table of rewrites. None of them change the registers, the
+// flags or the stack seen by the following instruction.
+var peepholes = []peephole{
+	// LDXA; LDAX => LDXA, LDXA; LDXA => LDXA
+	{"redundant-move", func(a, b *instruction) ([]string, bool) {
+		aDst, aSrc, ok := moveOp(a)
+		if !ok {
+			return nil, false
+		}
+		bDst, bSrc, ok := moveOp(b)
+		if !ok {
+			return nil, false
+		}
+		if (aDst == bSrc && aSrc == bDst) || (aDst == bDst && aSrc == bSrc) {
+			return []string{a.opName()}, true
+		}
+		return nil, false
+	}},
+	// LDAV 1; LDAX => LDAX
+	{"overwritten-load", func(a, b *instruction) ([]string, bool) {
+		name := a.opName()
+		if "LDAV" != name && "LDXV" != name && "LDYV" != name {
+			if _, _, ok := moveOp(a); !ok {
+				return nil, false
+			}
+		}
+		use := regUse[b.opName()]
+		if "LD" != b.opName()[:2] || use[1] != regUse[name][1] || 0 != use[0]&use[1] {
+			return nil, false
+		}
+		return []string{b.code()}, true
+	}},
+	// PSHA; POPA => nothing, PSHA; POPX => LDXA
+	{"push-pop", func(a, b *instruction) ([]string, bool) {
+		if !strings.HasPrefix(a.opName(), "PSH") || !strings.HasPrefix(b.opName(), "POP") {
+			return nil, false
+		}
+		src, dst := a.opName()[3:], b.opName()[3:]
+		if !strings.Contains("AXY", src) || !strings.Contains("AXY", dst) {
+			return nil, false
+		}
+		if src == dst {
+			return []string{}, true
+		}
+		return []string{"LD" + dst + src}, true
+	}},
+	// RUN x; } => JMP x, x returns to our caller
+	{"tail-call", func(a, b *instruction) ([]string, bool) {
+		if "RUN" != a.opName() || !b.isReturn() || TOK_LREF != a.op.param.typ {
+			return nil, false
+		}
+		return []string{"JMP " + a.op.param.tkn}, true
+	}},
+}
+
+// code returns the instruction source without labels or comments.
+func (inst *instruction) code() string {
+	s := []string{}
+	for _, tkn := range inst.tokens {
+		s = append(s, tkn.tkn)
+	}
+	return strings.Join(s, " ")
+}
+
+// fixedAddress returns the first instruction that jumps to a literal or
+// computed address or pushes the program counter, nil if there is none.
+func (bcc *bcc) fixedAddress() *instruction {
+	for _, inst := range bcc.instructions {
+		switch inst.opName() {
+		case "JMPA", "JMPX", "JMPY", "JMPS", "PSHP":
+			return inst
+		case "JMP", "JMPV", "RUN":
+			if TOK_LREF != inst.op.param.typ {
+				return inst
+			}
+		}
+	}
+	return nil
+}
+
+// movable reports whether rewrites may move code. Code that uses a fixed
+// address can't be moved, the instruction is kept to warn about it on
+// assembly.
+func (bcc *bcc) movable() bool {
+	bcc.fixed = bcc.fixedAddress()
+	return nil == bcc.fixed
+}
+
+// Optimize applies the peephole rewrites to the parsed program until none
+// match and returns the rewrites made. Replacements keep the source line of
+// the instruction they replace. Rewrites move code, so programs that jump to
+// literal or computed addresses are left alone.
+func (bcc *bcc) Optimize() ([]Rewrite, error) {
+	rewrites := []Rewrite{}
+	if !bcc.movable() {
+		return rewrites, nil
+	}
+	for {
+		rw, err := bcc.rewrite()
+		if nil != err {
+			return rewrites, err
+		}
+		if nil == rw {
+			break
+		}
+		rewrites = append(rewrites, *rw)
+	}
+	bcc.index()
+	bcc.rewrites = append(bcc.rewrites, rewrites...)
+	return rewrites, nil
+}
+
+// rewrite applies the first matching rewrite.
+func (bcc *bcc) rewrite() (*Rewrite, error) {
+	for k, a := range bcc.instructions {
+		if 0 == a.size() {
+			continue
+		}
+
+		// a labeled instruction is a jump target and starts a new block
+		labeled := TOK_LABEL == a.tokens[0].typ
+
+		// JMP to the following instruction
+		if "JMP" == a.opName() && TOK_LREF == a.op.param.typ && !a.tail && !labeled {
+			for _, next := range bcc.instructions[k+1:] {
+				if TOK_LABEL == next.tokens[0].typ && a.op.param.tkn == next.tokens[0].tkn {
+					bcc.replace(k, -1, nil)
+					return newRewrite(a.ln, "jump-next", []*instruction{a}, nil), nil
+				}
+				if TOK_LABEL != next.tokens[0].typ && TOK_CONST != next.tokens[0].typ {
+					break
+				}
+			}
+		}
+
+		// next instruction in the same block, skipping constant definitions
+		j := k + 1
+		for j < len(bcc.instructions) && TOK_CONST == bcc.instructions[j].tokens[0].typ {
+			j++
+		}
+		if j == len(bcc.instructions) {
+			break
+		}
+		b := bcc.instructions[j]
+		if 0 == b.size() || a.sub != b.sub || labeled || TOK_LABEL == b.tokens[0].typ {
+			continue
+		}
+
+		for _, ph := range peepholes {
+			src, ok := ph.match(a, b)
+			if !ok {
+				continue
+			}
+			repl := []*instruction{}
+			for _, line := range src {
+				// instructions the rewrite keeps retain their source line
+				if line == a.code() || line == b.code() {
+					keep := a
+					if line == b.code() {
+						keep = b
+					}
+					repl = append(repl, keep)
+					continue
+				}
+				inst, err := newInst(a.ln, " "+line)
+				if nil != err {
+					return nil, errors.Wrap(err, "invalid %s rewrite on line %d", ph.rule, a.ln)
+				}
+				inst.sub = a.sub
+				inst.tail = "tail-call" == ph.rule
+				repl = append(repl, inst)
+			}
+			bcc.replace(k, j, repl)
+			return newRewrite(a.ln, ph.rule, []*instruction{a, b}, repl), nil
+		}
+	}
+	return nil, nil
+}
+
+// replace replaces the instructions at index a and b (if not negative),
+// keeping any between them.
+func (bcc *bcc) replace(a, b int, repl []*instruction) {
+	list := append([]*instruction{}, bcc.instructions[:a]...)
+	list = append(list, repl...)
+	if b < 0 {
+		list = append(list, bcc.instructions[a+1:]...)
+	} else {
+		list = append(list, bcc.instructions[a+1:b]...)
+		list = append(list, bcc.instructions[b+1:]...)
+	}
+	bcc.instructions = list
+}
+
+// index rebuilds the label and subroutine maps after the instruction list
+// changes.
+func (bcc *bcc) index() {
+	bcc.jmpMap = map[string]int{}
+	bcc.subMap = map[string]int{}
+	for idx, inst := range bcc.instructions {
+		switch inst.tokens[0].typ {
+		case TOK_LABEL:
+			bcc.jmpMap[inst.tokens[0].tkn] = idx
+		case TOK_SUB:
+			bcc.subMap[strings.TrimSuffix(inst.tokens[0].tkn, "{")] = idx
+		}
+	}
+}
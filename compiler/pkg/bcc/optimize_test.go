@@ -0,0 +1,140 @@
+package bcc_test
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcctest"
+)
+
+// assemble assembles source with options and fails the test if it does not
+// assemble.
+func assemble(t *testing.T, src string, opts ...bcc.Option) *bcc.Program {
+	t.Helper()
+	prog, err := bcc.NewAssembler(opts...).Assemble(context.Background(), strings.NewReader(src))
+	if nil != err {
+		t.Fatalf("assemble: %s", err)
+	}
+	return prog
+}
+
+// rules lists the rules of the rewrites made.
+func rules(prog *bcc.Program) string {
+	s := []string{}
+	for _, rw := range prog.Rewrites {
+		s = append(s, rw.Rule)
+	}
+	return strings.Join(s, " ")
+}
+
+// rewriteTest is an optimization case: the rewrites made and the source the
+// optimized program must assemble the same as, "" to skip the comparison.
+type rewriteTest struct {
+	name  string
+	src   string
+	rules string
+	want  string
+}
+
+// runRewriteTests assembles each case with options and compares the result.
+func runRewriteTests(t *testing.T, tests []rewriteTest, opts ...bcc.Option) {
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prog := assemble(t, tt.src, opts...)
+			if got := rules(prog); got != tt.rules {
+				t.Errorf("rewrites: got '%s', want '%s'", got, tt.rules)
+			}
+			if "" == tt.want {
+				return
+			}
+			got := prog.Image[:prog.Size]
+			if want := bcctest.Code(t, tt.want); string(got) != string(want) {
+				t.Errorf("optimized bytes:\n got  % X\n want % X", got, want)
+			}
+		})
+	}
+}
+
+func TestPeephole(t *testing.T) {
+	runRewriteTests(t, []rewriteTest{
+		{"redundant move", "    LDXA\n    LDAX\n    OUTA\n", "redundant-move", "    LDXA\n    OUTA\n"},
+		{"repeated move", "    LDXA\n    LDXA\n    OUTX\n", "redundant-move", "    LDXA\n    OUTX\n"},
+		{"overwritten load", "    LDAV 1\n    LDAX\n    OUTA\n", "overwritten-load", "    LDAX\n    OUTA\n"},
+		{"push pop", "    PSHA\n    POPA\n    OUTA\n", "push-pop", "    OUTA\n"},
+		{"push pop move", "    PSHA\n    POPX\n    OUTX\n", "push-pop", "    LDXA\n    OUTX\n"},
+		{"jump next", "    LDAV 1\n    JMP next\nnext\n    OUTA\n", "jump-next", "    LDAV 1\nnext\n    OUTA\n"},
+		{"jump to labeled next", "    LDAV 1\n    JMP next\nnext OUTA\n", "jump-next", "    LDAV 1\nnext OUTA\n"},
+		{"tail call", "f {\n    OUTA\n}\ng {\n    RUN f\n}\n    RUN g\n    HLT\n", "tail-call", ""},
+		{"unrelated loads", "    LDAV 1\n    LDXV 2\n    OUTA\n", "", "    LDAV 1\n    LDXV 2\n    OUTA\n"},
+
+		// a labeled instruction is a jump target and is never merged
+		{"labeled second move", "    LDXA\nloop LDAX\n    OUTA\n    JMP loop\n", "", "    LDXA\nloop LDAX\n    OUTA\n    JMP loop\n"},
+		{"labeled push", "loop PSHA\n    POPA\n    OUTA\n    JMP loop\n", "", "loop PSHA\n    POPA\n    OUTA\n    JMP loop\n"},
+		{"labeled load", "start LDAV 1\n    LDAX\n    OUTA\n    JMP start\n", "", "start LDAV 1\n    LDAX\n    OUTA\n    JMP start\n"},
+		{"labeled jump next", "loop JMP next\nnext\n    OUTA\n    JMP loop\n", "", "loop JMP next\nnext\n    OUTA\n    JMP loop\n"},
+		{"label line between", "    PSHA\nloop\n    POPA\n    JMP loop\n", "", "    PSHA\nloop\n    POPA\n    JMP loop\n"},
+	}, bcc.WithOptimization(bcc.OPT_PEEPHOLE))
+}
+
+// TestFixedAddress checks that programs using literal or computed addresses
+// are not optimized.
+func TestFixedAddress(t *testing.T) {
+	// a subroutine called once and a redundant move, both rewritten otherwise
+	body := "f {\n    OUTA\n}\n    RUN f\n    LDXA\n    LDAX\n"
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"literal jump", body + "    JMP 0\n"},
+		{"literal value jump", body + "    JMPV 0\n"},
+		{"constant value jump", "$start 0\n" + body + "    JMPV $start\n"},
+		{"register jump", body + "    LDAV 0\n    JMPA\n"},
+		{"X jump", body + "    LDXV 0\n    JMPX\n"},
+		{"Y jump", body + "    LDYV 0\n    JMPY\n"},
+		{"stack jump", body + "    PSHV 0\n    JMPS\n"},
+		{"pushed counter", "    PSHP\n" + body + "    POPA\n    HLT\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prog := assemble(t, tt.src, bcc.WithOptimization(bcc.OPT_INLINE))
+			if got := rules(prog); "" != got {
+				t.Errorf("rewrites: got '%s', want none", got)
+			}
+			got := prog.Image[:prog.Size]
+			if want := bcctest.Code(t, tt.src); string(got) != string(want) {
+				t.Errorf("optimized bytes:\n got  % X\n want % X", got, want)
+			}
+			warned := 0
+			for _, diag := range prog.Diagnostics {
+				if "fixed-address" == diag.Rule {
+					warned++
+				}
+			}
+			if 1 != warned {
+				t.Errorf("diagnostics: got %v, want one fixed-address warning", prog.Diagnostics)
+			}
+		})
+	}
+
+	// a label operand is moved with the code it names
+	prog := assemble(t, body+"end\n    JMPV end\n", bcc.WithOptimization(bcc.OPT_INLINE))
+	if "" == rules(prog) {
+		t.Errorf("a label operand stopped the optimizer")
+	}
+}
+
+// TestOptimizedFib checks that optimizing the example program keeps its
+// output.
+func TestOptimizedFib(t *testing.T) {
+	src, err := ioutil.ReadFile("../../fib.asm")
+	if nil != err {
+		t.Fatalf("read fib.asm: %s", err)
+	}
+	want := bcctest.RunSource(t, string(src), bcctest.Options{Outputs: 12})
+	prog := assemble(t, string(src), bcc.WithOptimization(bcc.OPT_INLINE))
+	got := bcctest.Run(t, prog.Image, bcctest.Options{Outputs: 12})
+	bcctest.ExpectOut(t, got, want.Out...)
+}
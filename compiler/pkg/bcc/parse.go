@@ -8,24 +8,33 @@ import (
 )
 
 // parseLiteral parses a binary, decimal, or hexidecimal string into a byte.
+// Values from -128 to 255 are accepted, negative values are stored in two's
+// complement. Binary and hex literals are unsigned.
 func parseLiteral(dataStr string) (byte, error) {
 	var err error
 	var data int64
+	var udata uint64
 
+	// only decimal literals take a sign
 	switch true {
 	// binary
 	case strings.HasPrefix(dataStr, "0b"):
-		data, err = strconv.ParseInt(string(dataStr[2:]), 2, 8)
+		udata, err = strconv.ParseUint(string(dataStr[2:]), 2, 16)
+		data = int64(udata)
 	// hex
 	case strings.HasPrefix(dataStr, "0x"):
-		data, err = strconv.ParseInt(string(dataStr[2:]), 16, 8)
+		udata, err = strconv.ParseUint(string(dataStr[2:]), 16, 16)
+		data = int64(udata)
 	// decimal
 	default:
-		data, err = strconv.ParseInt(dataStr, 10, 8)
+		data, err = strconv.ParseInt(dataStr, 10, 16)
 	}
 	if nil != err {
 		return 0, errors.Wrap(err, "failure parsing data '%s'", dataStr)
 	}
+	if data < -128 || data > 255 {
+		return 0, errors.Errorf("data '%s' does not fit in a byte", dataStr)
+	}
 
 	return byte(data), nil
 }
@@ -0,0 +1,49 @@
+package bcc_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcctest"
+)
+
+func TestLiterals(t *testing.T) {
+	ldav, _ := bcc.Opcode("LDAV")
+	tests := []struct {
+		lit  string
+		want byte
+		ok   bool
+	}{
+		{"28", 28, true},
+		{"0x1C", 0x1C, true},
+		{"0b11100", 28, true},
+		{"255", 255, true},
+		{"0xFF", 255, true},
+		{"-1", 0xFF, true},
+		{"-128", 0x80, true},
+		{"256", 0, false},
+		{"-129", 0, false},
+		{"0x100", 0, false},
+		{"0x-1", 0, false},
+		{"0b-1", 0, false},
+		{"0x+1", 0, false},
+		{"0b+1", 0, false},
+		{"0x", 0, false},
+		{"0x1G", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lit, func(t *testing.T) {
+			src := "    LDAV " + tt.lit + "\n"
+			if tt.ok {
+				bcctest.ExpectBytes(t, src, ldav, tt.want)
+				return
+			}
+			_, err := bcc.NewAssembler().Assemble(context.Background(), strings.NewReader(src))
+			if nil == err {
+				t.Errorf("assembled literal '%s'", tt.lit)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package bcc
+
+import (
+	"fmt"
+
+	"github.com/bdlm/errors/v2"
+)
+
+const (
+	// StackDepth is the hardware stack capacity of the reference build.
+	StackDepth = 16
+)
+
+// stackEffect returns the number of values an instruction pushes (positive)
+// or pops (negative), excluding the return address pushed by RUN.
+func (inst *instruction) stackEffect() int {
+	switch inst.opName() {
+	case "PSHV", "PSHA", "PSHX", "PSHY", "PSHP":
+		return 1
+	case "POPA", "POPX", "POPY", "POPP":
+		return -1
+	}
+	return 0
+}
+
+// stackAnalysis is the result of the static stack depth analysis.
+type stackAnalysis struct {
+	// maximum depth reached by the whole program
+	max int
+	// instruction at which the maximum is reached
+	peak *instruction
+	// maximum depth reached by one call to each subroutine, relative to the
+	// depth at the call and including its return address
+	subs map[string]int
+}
+
+// SetStackSize sets the hardware stack capacity the program must fit in.
+func (bcc *bcc) SetStackSize(size int) {
+	bcc.stackSize = size
+}
+
+// analyzeStack walks the control flow graph computing stack depths. It
+// reports unbalanced paths, pops from an empty stack and recursion as
+// warnings and stack overflow as an error.
+func (bcc *bcc) analyzeStack(graph *cfg) *stackAnalysis {
+	sa := &stackAnalysis{subs: map[string]int{}}
+	visiting := map[string]bool{}
+
+	var walk func(entry *block) (int, *instruction)
+	var subDepth func(name string, call *instruction) int
+
+	// subDepth returns the maximum depth a call adds, including the return
+	// address.
+	subDepth = func(name string, call *instruction) int {
+		if visiting[name] {
+			bcc.diagnose(call.ln, "stack-recursion", SEV_WARNING, "recursive call to '%s', stack depth is unbounded", name)
+			return 1
+		}
+		if depth, ok := sa.subs[name]; ok {
+			return depth
+		}
+		entry, ok := graph.subs[name]
+		if !ok {
+			return 1
+		}
+		visiting[name] = true
+		depth, _ := walk(entry)
+		delete(visiting, name)
+		sa.subs[name] = depth + 1
+		return depth + 1
+	}
+
+	// walk returns the maximum depth reached from a block, relative to the
+	// depth on entry, and the instruction that reaches it.
+	walk = func(entry *block) (int, *instruction) {
+		sub := entry.insts[0].sub
+		depthAt := map[*block]int{entry: 0}
+		reported := map[*block]bool{}
+		max, peak := 0, (*instruction)(nil)
+		work := []*block{entry}
+
+		for 0 < len(work) {
+			blk := work[len(work)-1]
+			work = work[:len(work)-1]
+			depth := depthAt[blk]
+			ended := false
+
+			for _, inst := range blk.insts {
+				if inst.isReturn() {
+					if 0 != depth {
+						bcc.diagnose(inst.ln, "stack-unbalanced", SEV_WARNING, "'%s' returns with %d value(s) left on the stack", sub, depth)
+					}
+					ended = true
+					break
+				}
+				if inst.tail {
+					// the callee returns to our caller with our return address
+					if callee, ok := bcc.callee(inst); ok {
+						if d := depth + subDepth(callee, inst) - 1; d > max {
+							max, peak = d, inst
+						}
+					}
+					if 0 != depth {
+						bcc.diagnose(inst.ln, "stack-unbalanced", SEV_WARNING, "'%s' returns with %d value(s) left on the stack", sub, depth)
+					}
+					ended = true
+					break
+				}
+				if "RUN" == inst.opName() {
+					if callee, ok := bcc.callee(inst); ok {
+						if d := depth + subDepth(callee, inst); d > max {
+							max, peak = d, inst
+						}
+					}
+					continue
+				}
+
+				effect := inst.stackEffect()
+				if depth+effect < 0 {
+					if "" == sub {
+						bcc.diagnose(inst.ln, "stack-empty", SEV_WARNING, "%s pops from an empty stack", inst.opName())
+					} else {
+						bcc.diagnose(inst.ln, "stack-empty", SEV_WARNING, "%s pops the return address of '%s'", inst.opName(), sub)
+					}
+					effect = -depth
+				}
+				depth += effect
+				if depth > max {
+					max, peak = depth, inst
+				}
+			}
+			if ended {
+				continue
+			}
+
+			for _, e := range blk.succs {
+				if nil == e.to || sub != e.to.insts[0].sub {
+					continue
+				}
+				prev, seen := depthAt[e.to]
+				switch true {
+				case !seen:
+					depthAt[e.to] = depth
+					work = append(work, e.to)
+				case prev != depth && !reported[e.to]:
+					reported[e.to] = true
+					bcc.diagnose(e.to.insts[0].ln, "stack-unbalanced", SEV_WARNING, "paths reach this point with stack depths %d and %d", prev, depth)
+				}
+			}
+		}
+
+		return max, peak
+	}
+
+	for _, name := range graph.subNames() {
+		subDepth(name, graph.subs[name].insts[0])
+	}
+	if entry, ok := graph.byAddr[0]; ok {
+		sa.max, sa.peak = walk(entry)
+	}
+
+	if sa.max > bcc.stackSize && nil != sa.peak {
+		bcc.diagnose(sa.peak.ln, "stack-overflow", SEV_ERROR, "stack depth reaches %d, the stack holds %d", sa.max, bcc.stackSize)
+	}
+
+	return sa
+}
+
+// stackReport summarizes the stack analysis.
+func (bcc *bcc) stackReport(sa *stackAnalysis, graph *cfg) string {
+	s := "STACK\n"
+	for _, name := range graph.subNames() {
+		s = s + fmt.Sprintf("  %-12s  %3d deep per call\n", name, sa.subs[name])
+	}
+	s = s + fmt.Sprintf("  %-12s  %3d of %d\n", "program", sa.max, bcc.stackSize)
+	return s
+}
+
+// checkDiagnostics returns an error if any error diagnostics were recorded.
+func (bcc *bcc) checkDiagnostics() error {
+	for _, diag := range bcc.Diagnostics() {
+		if SEV_ERROR == diag.Severity {
+			return errors.Errorf("%s", diag)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package bcc_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcctest"
+)
+
+func TestAnalyzeStack(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		size  int
+		max   int
+		subs  map[string]int
+		rules string
+	}{
+		{"balanced", "    PSHA\n    PSHX\n    POPX\n    POPA\n    HLT\n", 16, 2, map[string]int{}, ""},
+		{"call", "f {\n    PSHA\n    POPA\n}\n    PSHX\n    RUN f\n    POPX\n    HLT\n", 16, 3, map[string]int{"f": 2}, ""},
+		{"nested calls", "g {\n    PSHA\n    POPA\n}\nf {\n    RUN g\n    OUTA\n}\n    RUN f\n    HLT\n", 16, 3, map[string]int{"f": 3, "g": 2}, ""},
+		{"overflow", "    PSHA\n    PSHA\n    PSHA\n    HLT\n", 2, 3, map[string]int{}, "stack-overflow"},
+		{"empty", "    POPA\n    HLT\n", 16, 0, map[string]int{}, "stack-empty"},
+		{"return address", "f {\n    POPA\n}\n    RUN f\n    HLT\n", 16, 1, map[string]int{"f": 1}, "stack-empty"},
+		{"unbalanced", "f {\n    PSHA\n}\n    RUN f\n    HLT\n", 16, 2, map[string]int{"f": 2}, "stack-unbalanced"},
+		{"recursion", "f {\n    PSHA\n    RUN f\n    POPA\n}\n    RUN f\n    HLT\n", 16, 3, map[string]int{"f": 3}, "stack-recursion"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			max, subs, diags, err := bcc.StackDepths(tt.src, tt.size)
+			if nil != err {
+				t.Fatalf("assemble: %s", err)
+			}
+			if max != tt.max {
+				t.Errorf("max depth: got %d, want %d", max, tt.max)
+			}
+			if fmt.Sprint(subs) != fmt.Sprint(tt.subs) {
+				t.Errorf("subroutine depths: got %v, want %v", subs, tt.subs)
+			}
+			got := []string{}
+			for _, diag := range diags {
+				got = append(got, diag.Rule)
+			}
+			if strings.Join(got, " ") != tt.rules {
+				t.Errorf("diagnostics: got %v, want '%s'", diags, tt.rules)
+			}
+		})
+	}
+}
+
+// TestStackRun checks the analyzed depth against the emulated stack.
+func TestStackRun(t *testing.T) {
+	src := "f {\n    PSHA\n    PSHX\n    POPX\n    POPA\n}\n    LDAV 7\n    PSHA\n    RUN f\n    POPX\n    OUTX\n    HLT\n"
+	max, _, _, err := bcc.StackDepths(src, bcc.StackDepth)
+	if nil != err {
+		t.Fatalf("assemble: %s", err)
+	}
+	if 4 != max {
+		t.Errorf("max depth: got %d, want 4", max)
+	}
+	trace := bcctest.RunSource(t, src, bcctest.Options{MustHalt: true, StackDepth: max})
+	bcctest.ExpectOut(t, trace, 7)
+}
@@ -0,0 +1,264 @@
+package bcc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/ucode"
+
+	"github.com/bdlm/errors/v2"
+)
+
+// opName returns the name of the encoded operation, or "" for lines that
+// only define symbols.
+func (inst *instruction) opName() string {
+	if nil == inst.op.code {
+		return ""
+	}
+	return inst.op.code.name
+}
+
+// cycles returns the number of clock cycles (T-states) the instruction
+// takes, as defined by its microcode.
+func (inst *instruction) cycles() int {
+	cyc, _ := ucode.Cycles(inst.opName())
+	return cyc
+}
+
+// target resolves the operand of a RUN, JMP or JMPV instruction to a ROM
+// address.
+func (inst *instruction) target(bcc *bcc) (int, bool) {
+	param := inst.op.param
+	if nil == param {
+		return 0, false
+	}
+	switch inst.opName() {
+	case "RUN":
+		if TOK_LREF == param.typ {
+			return bcc.addrOf(bcc.subMap, param.tkn)
+		}
+	case "JMP", "JMPV":
+		if TOK_LREF == param.typ && inst.tail {
+			return bcc.addrOf(bcc.subMap, param.tkn)
+		}
+		if TOK_LREF == param.typ {
+			return bcc.addrOf(bcc.jmpMap, param.tkn)
+		}
+	default:
+		return 0, false
+	}
+	switch param.typ {
+	case TOK_LIT:
+		return int(param.dat), true
+	case TOK_CREF:
+		byt, ok := bcc.constMap[param.tkn]
+		return int(byt), ok
+	}
+	return 0, false
+}
+
+// byAddr returns the code instructions in ROM address order.
+func (bcc *bcc) byAddr() []*instruction {
+	list := []*instruction{}
+	for _, inst := range bcc.instructions {
+		if inst.size() > 0 {
+			list = append(list, inst)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].addr < list[j].addr
+	})
+	return list
+}
+
+// callee returns the name of the subroutine a RUN instruction or tail call
+// executes.
+func (bcc *bcc) callee(inst *instruction) (string, bool) {
+	if "RUN" != inst.opName() && !inst.tail {
+		return "", false
+	}
+	addr, ok := inst.target(bcc)
+	if !ok {
+		return "", false
+	}
+	for name := range bcc.subMap {
+		if subAddr, _ := bcc.addrOf(bcc.subMap, name); subAddr == addr {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// subCycles returns the cycles a single call to a subroutine takes,
+// including nested calls and the return. Recursive subroutines have no
+// bound and return false.
+func (bcc *bcc) subCycles(name string, visiting map[string]bool) (int, bool) {
+	if visiting[name] {
+		return 0, false
+	}
+	visiting[name] = true
+	defer delete(visiting, name)
+
+	total := 0
+	for _, inst := range bcc.instructions {
+		if name != inst.sub {
+			continue
+		}
+		cyc, ok := bcc.instCycles(inst, visiting)
+		if !ok {
+			return 0, false
+		}
+		total += cyc
+	}
+	return total, true
+}
+
+// instCycles returns the cycles an instruction takes, including the called
+// subroutine for RUN.
+func (bcc *bcc) instCycles(inst *instruction, visiting map[string]bool) (int, bool) {
+	cyc := inst.cycles()
+	if callee, ok := bcc.callee(inst); ok {
+		sub, ok := bcc.subCycles(callee, visiting)
+		if !ok {
+			return 0, false
+		}
+		cyc += sub
+	}
+	return cyc, true
+}
+
+// loop is a backward JMP and the instructions it repeats.
+type loop struct {
+	label  string
+	jmp    *instruction
+	body   []*instruction
+	cycles int
+	ok     bool
+}
+
+// loops returns every backward jump in address order.
+func (bcc *bcc) loops() []*loop {
+	code := bcc.byAddr()
+	loops := []*loop{}
+	for _, inst := range code {
+		if ("JMP" != inst.opName() && "JMPV" != inst.opName()) || inst.tail {
+			continue
+		}
+		addr, ok := inst.target(bcc)
+		if !ok || addr > inst.addr {
+			continue
+		}
+
+		lp := &loop{jmp: inst, ok: true}
+		if TOK_LREF == inst.op.param.typ {
+			lp.label = inst.op.param.tkn
+		}
+		for _, body := range code {
+			if body.addr < addr || body.addr > inst.addr {
+				continue
+			}
+			lp.body = append(lp.body, body)
+			cyc, ok := bcc.instCycles(body, map[string]bool{})
+			lp.cycles += cyc
+			lp.ok = lp.ok && ok
+		}
+		loops = append(loops, lp)
+	}
+	return loops
+}
+
+// duration returns the wall-clock time a number of cycles takes at a clock
+// frequency.
+func duration(cycles int, hz float64) time.Duration {
+	return time.Duration(float64(cycles) / hz * float64(time.Second))
+}
+
+// Listing returns the source listing annotated with ROM addresses, encoded
+// bytes and cycle counts, followed by the timing report.
+func (bcc *bcc) Listing(hz float64) (string, error) {
+	err := bcc.assemble()
+	if nil != err {
+		return "", errors.Wrap(err, "could not assemble program")
+	}
+
+	byLine := map[int]*instruction{}
+	for _, inst := range bcc.instructions {
+		byLine[inst.ln] = inst
+	}
+
+	s := "ADDR  BYTES  CYC  LINE  SOURCE\n"
+	for idx, line := range bcc.lines {
+		inst, ok := byLine[idx+1]
+		_, ln := bcc.position(idx + 1)
+		if !ok || 0 == inst.size() {
+			s = s + fmt.Sprintf("%-4s  %-5s  %3s  %4d  %s\n", "", "", "", ln, line)
+			continue
+		}
+		byts := []string{}
+		for k := 0; k < inst.size(); k++ {
+			byts = append(byts, fmt.Sprintf("%02X", bcc.prg[inst.addr+k]))
+		}
+		s = s + fmt.Sprintf("0x%02X  %-5s  %3d  %4d  %s\n", inst.addr, strings.Join(byts, " "), inst.cycles(), ln, line)
+	}
+
+	s = strings.TrimRight(s, "\n") + "\n\n" + bcc.timingReport(hz) + bcc.stackReport(bcc.stack, bcc.cfg)
+	if 0 < len(bcc.rewrites) {
+		s = s + "OPTIMIZATIONS\n"
+		saved := 0
+		for _, rw := range bcc.rewrites {
+			s = s + "  " + rw.String() + "\n"
+			saved += rw.Bytes
+		}
+		s = s + fmt.Sprintf("  %d bytes saved, program is %d bytes\n", saved, bcc.size())
+	}
+	if diags := bcc.Diagnostics(); 0 < len(diags) {
+		s = s + "DIAGNOSTICS\n"
+		for _, diag := range diags {
+			s = s + "  " + diag.String() + "\n"
+		}
+	}
+
+	return s, nil
+}
+
+// timingReport summarizes subroutine and loop costs.
+func (bcc *bcc) timingReport(hz float64) string {
+	at := func(cycles int) string {
+		if hz <= 0 {
+			return ""
+		}
+		return fmt.Sprintf("  %v at %g Hz", duration(cycles, hz), hz)
+	}
+
+	s := "SUBROUTINES\n"
+	names := []string{}
+	for name := range bcc.subMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cyc, ok := bcc.subCycles(name, map[string]bool{})
+		if !ok {
+			s = s + fmt.Sprintf("  %-12s  recursive, unbounded\n", name)
+			continue
+		}
+		s = s + fmt.Sprintf("  %-12s  %5d cycles%s\n", name, cyc, at(cyc))
+	}
+
+	s = s + "LOOPS\n"
+	for _, lp := range bcc.loops() {
+		label := lp.label
+		if "" == label {
+			label = fmt.Sprintf("0x%02X", lp.body[0].addr)
+		}
+		if !lp.ok {
+			s = s + fmt.Sprintf("  %-12s  line %d, recursive, unbounded\n", label, lp.jmp.ln)
+			continue
+		}
+		s = s + fmt.Sprintf("  %-12s  line %d, %5d cycles per iteration%s\n", label, lp.jmp.ln, lp.cycles, at(lp.cycles))
+	}
+
+	return s
+}
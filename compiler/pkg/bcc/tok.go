@@ -47,7 +47,7 @@ func (tkn *tok) tokenize() error {
 		} else {
 			// check for literals
 			if tkn.dat, err = parseLiteral(tkn.tkn); nil != err {
-				return errors.Errorf("unknown data literal '%s' at line %d", tkn.tkn, tkn.ln)
+				return errors.Errorf("unknown data literal '%s'", tkn.tkn)
 			}
 			tkn.typ = TOK_LIT
 		}
@@ -0,0 +1,326 @@
+package bcc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bdlm/errors/v2"
+)
+
+// VetRules describes every rule reported by Vet, including the stack
+// analysis rules every build runs.
+var VetRules = map[string]string{
+	"unreachable":      "code that can never execute",
+	"unused-symbol":    "labels, subroutines and $consts that are never referenced",
+	"uninitialized":    "registers read before any load",
+	"dead-store":       "values loaded into a register and overwritten before use",
+	"jmp-subroutine":   "JMP to a subroutine label",
+	"undefined":        "references to labels, subroutines and $consts that are not defined",
+	"fall-off":         "execution that runs past the end of the program",
+	"stack-unbalanced": "paths that reach a point or return with different stack depths",
+	"stack-empty":      "pops from an empty stack or of a return address",
+	"stack-recursion":  "recursive subroutine calls",
+	"stack-overflow":   "stack depth beyond the hardware capacity",
+	"unsupported":      "operations the target hardware does not implement",
+}
+
+// VetConfig selects the rules Vet reports.
+type VetConfig struct {
+	// rule => disabled
+	Disabled map[string]bool
+}
+
+// ignoreDirective suppresses diagnostics on a line, optionally limited to a
+// comma separated list of rules: `# vet:ignore` or `# vet:ignore dead-store`.
+const ignoreDirective = "vet:ignore"
+
+// Vet assembles the program and reports semantic mistakes. Diagnostics for
+// disabled rules and lines carrying an ignore directive are dropped.
+func (bcc *bcc) Vet(cfg VetConfig) ([]Diagnostic, error) {
+	for rule := range cfg.Disabled {
+		if _, ok := VetRules[rule]; !ok {
+			return nil, errors.Errorf("unknown vet rule '%s'", rule)
+		}
+	}
+
+	err := bcc.assemble()
+	if nil != err {
+		return nil, errors.Wrap(err, "could not assemble program")
+	}
+
+	bcc.vetReachability(bcc.cfg)
+	bcc.vetSymbols()
+	bcc.vetRegisters(bcc.cfg)
+	bcc.vetDeadStores(bcc.cfg)
+
+	diags := []Diagnostic{}
+	for _, diag := range bcc.Diagnostics() {
+		if cfg.Disabled[diag.Rule] || bcc.ignored(diag) {
+			continue
+		}
+		diags = append(diags, diag)
+	}
+
+	return diags, nil
+}
+
+// ignored returns whether the source line of a diagnostic suppresses it.
+func (bcc *bcc) ignored(diag Diagnostic) bool {
+	if diag.ln < 1 || diag.ln > len(bcc.lines) {
+		return false
+	}
+	p := strings.SplitN(bcc.lines[diag.ln-1], "#", 2)
+	if 2 != len(p) {
+		return false
+	}
+	idx := strings.Index(p[1], ignoreDirective)
+	if idx < 0 {
+		return false
+	}
+	rules := strings.Fields(p[1][idx+len(ignoreDirective):])
+	if 0 == len(rules) {
+		return true
+	}
+	for _, rule := range strings.Split(rules[0], ",") {
+		if rule == diag.Rule {
+			return true
+		}
+	}
+	return false
+}
+
+// vetReachability reports unreachable code and execution that runs past the
+// end of the top level program.
+func (bcc *bcc) vetReachability(graph *cfg) {
+	reachable := graph.reachable()
+	for _, blk := range graph.blocks {
+		first := blk.insts[0]
+		if !reachable[blk] {
+			// Subroutines that are never called are reported as unused.
+			if entry, ok := graph.subs[first.sub]; ok && !reachable[entry] {
+				continue
+			}
+			bcc.diagnose(first.ln, "unreachable", SEV_WARNING, "unreachable code")
+			continue
+		}
+
+		for _, e := range blk.succs {
+			if EDGE_FALL != e.typ {
+				continue
+			}
+			switch true {
+			case nil == e.to:
+				bcc.diagnose(e.from.ln, "fall-off", SEV_WARNING, "execution runs past the end of the program into erased ROM at 0x%02X", e.addr)
+			case "" == first.sub && "" != e.to.insts[0].sub:
+				bcc.diagnose(e.from.ln, "fall-off", SEV_WARNING, "execution runs past the end of the program into subroutine '%s'", e.to.insts[0].sub)
+			}
+		}
+	}
+}
+
+// vetSymbols reports symbols that are defined but never referenced.
+func (bcc *bcc) vetSymbols() {
+	used := map[string]bool{}
+	for _, inst := range bcc.instructions {
+		if nil != inst.op.param {
+			used[inst.op.param.tkn] = true
+		}
+	}
+
+	report := func(kind string, idxMap map[string]int) {
+		names := []string{}
+		for name := range idxMap {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if !used[name] {
+				bcc.diagnose(bcc.instructions[idxMap[name]].ln, "unused-symbol", SEV_WARNING, "%s '%s' is never used", kind, name)
+			}
+		}
+	}
+	report("label", bcc.jmpMap)
+	report("subroutine", bcc.subMap)
+
+	consts := map[string]int{}
+	for idx, inst := range bcc.instructions {
+		if TOK_CONST == inst.tokens[0].typ {
+			consts[inst.tokens[0].tkn] = idx
+		}
+	}
+	report("constant", consts)
+}
+
+// regSet is a set of data registers.
+type regSet uint8
+
+const (
+	REG_A regSet = 1 << iota
+	REG_X
+	REG_Y
+
+	REG_ALL = REG_A | REG_X | REG_Y
+)
+
+// String implements Stringer.
+func (regs regSet) String() string {
+	s := ""
+	for k, name := range []string{"A", "X", "Y"} {
+		if 0 != regs&(1<<uint(k)) {
+			s = s + name
+		}
+	}
+	return s
+}
+
+// regUse maps operations to the registers they read and write.
+var regUse = map[string][2]regSet{
+	"RST":  {0, REG_ALL},
+	"ADDV": {REG_A, REG_A},
+	"ADDX": {REG_A | REG_X, REG_A},
+	"ADDY": {REG_A | REG_Y, REG_A},
+	"SUBV": {REG_A, REG_A},
+	"SUBX": {REG_A | REG_X, REG_A},
+	"SUBY": {REG_A | REG_Y, REG_A},
+	"JMPA": {REG_A, 0},
+	"JMPX": {REG_X, 0},
+	"JMPY": {REG_Y, 0},
+	"LDAV": {0, REG_A},
+	"LDAX": {REG_X, REG_A},
+	"LDAY": {REG_Y, REG_A},
+	"LDXV": {0, REG_X},
+	"LDXA": {REG_A, REG_X},
+	"LDXY": {REG_Y, REG_X},
+	"LDYV": {0, REG_Y},
+	"LDYA": {REG_A, REG_Y},
+	"LDYX": {REG_X, REG_Y},
+	"PSHA": {REG_A, 0},
+	"PSHX": {REG_X, 0},
+	"PSHY": {REG_Y, 0},
+	"POPA": {0, REG_A},
+	"POPX": {0, REG_X},
+	"POPY": {0, REG_Y},
+	"OUTA": {REG_A, 0},
+	"OUTX": {REG_X, 0},
+	"OUTY": {REG_Y, 0},
+}
+
+// vetRegisters reports registers read before any load on some path from the
+// program entry. Calls are followed into the subroutine with the caller's
+// register state.
+func (bcc *bcc) vetRegisters(graph *cfg) {
+	entry, ok := graph.byAddr[0]
+	if !ok {
+		return
+	}
+
+	reported := map[string]bool{}
+	memo := map[string]regSet{}
+	visiting := map[string]bool{}
+
+	// run returns the registers loaded on every path out of a subroutine,
+	// given those loaded on entry.
+	var run func(entry *block, in regSet) regSet
+	run = func(entry *block, in regSet) regSet {
+		sub := entry.insts[0].sub
+		states := map[*block]regSet{entry: in}
+		work := []*block{entry}
+		out, returned := REG_ALL, false
+
+		for 0 < len(work) {
+			blk := work[len(work)-1]
+			work = work[:len(work)-1]
+			state := states[blk]
+			ended := false
+
+			for _, inst := range blk.insts {
+				if inst.isReturn() {
+					out, returned, ended = out&state, true, true
+					break
+				}
+
+				if callee, ok := bcc.callee(inst); ok {
+					key := fmt.Sprintf("%s:%d", callee, state)
+					if result, ok := memo[key]; ok {
+						state = result
+					} else if calleeEntry, ok := graph.subs[callee]; ok && !visiting[callee] {
+						visiting[callee] = true
+						state = run(calleeEntry, state)
+						delete(visiting, callee)
+						memo[key] = state
+					}
+					if inst.tail {
+						out, returned, ended = out&state, true, true
+						break
+					}
+					continue
+				}
+
+				use := regUse[inst.opName()]
+				if missing := use[0] &^ state; 0 != missing {
+					key := fmt.Sprintf("%d:%s", inst.ln, missing)
+					if !reported[key] {
+						reported[key] = true
+						bcc.diagnose(inst.ln, "uninitialized", SEV_WARNING, "%s reads register %s before it is loaded", inst.opName(), missing)
+					}
+				}
+				state |= use[0] | use[1]
+			}
+			if ended {
+				continue
+			}
+
+			for _, e := range blk.succs {
+				if nil == e.to || sub != e.to.insts[0].sub {
+					continue
+				}
+				prev, seen := states[e.to]
+				if !seen || prev&state != prev {
+					states[e.to] = prev & state
+					if !seen {
+						states[e.to] = state
+					}
+					work = append(work, e.to)
+				}
+			}
+		}
+
+		if !returned {
+			return REG_ALL
+		}
+		return out
+	}
+
+	run(entry, 0)
+}
+
+// vetDeadStores reports register loads that are overwritten, within the same
+// basic block, before the value is used.
+func (bcc *bcc) vetDeadStores(graph *cfg) {
+	for _, blk := range graph.blocks {
+		pending := map[regSet]*instruction{}
+		for _, inst := range blk.insts {
+			if "RUN" == inst.opName() {
+				pending = map[regSet]*instruction{}
+				continue
+			}
+
+			use := regUse[inst.opName()]
+			for _, reg := range []regSet{REG_A, REG_X, REG_Y} {
+				if 0 != use[0]&reg {
+					delete(pending, reg)
+				}
+			}
+			for _, reg := range []regSet{REG_A, REG_X, REG_Y} {
+				if 0 == use[1]&reg {
+					continue
+				}
+				if prev, ok := pending[reg]; ok && "RST" != prev.opName() {
+					bcc.diagnose(prev.ln, "dead-store", SEV_WARNING, "value loaded into %s by %s is overwritten on line %d before it is used", reg, prev.opName(), inst.ln)
+				}
+				pending[reg] = inst
+			}
+		}
+	}
+}
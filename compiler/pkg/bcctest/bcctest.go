@@ -0,0 +1,198 @@
+// Package bcctest helps Go tests assemble and run programs:
+//
+//	func TestFib(t *testing.T) {
+//		img := bcctest.Assemble(t, fibSrc)
+//		trace := bcctest.Run(t, img, bcctest.Options{Outputs: 5})
+//		bcctest.ExpectOut(t, trace, 1, 1, 2, 3, 5)
+//	}
+//
+// Helpers fail the test with t.Fatalf when a program doesn't assemble or
+// emulation fails, and matchers report mismatches with t.Errorf.
+package bcctest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/emu"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/ucode"
+)
+
+const (
+	// DefaultCycles is the clock pulse budget when Options doesn't set one.
+	DefaultCycles = 10000
+)
+
+// Assemble assembles source and returns the padded ROM image.
+func Assemble(t testing.TB, src string) []byte {
+	t.Helper()
+	img, err := bcc.Build([]byte(src), bcc.StackDepth)
+	if nil != err {
+		t.Fatalf("assemble: %s", err)
+	}
+	return img
+}
+
+// Code assembles source and returns the program bytes without the erased
+// bytes padding them.
+func Code(t testing.TB, src string) []byte {
+	t.Helper()
+	prog, err := bcc.NewAssembler().Assemble(context.Background(), strings.NewReader(src))
+	if nil != err {
+		t.Fatalf("assemble: %s", err)
+	}
+	return prog.Image[:prog.Size]
+}
+
+// ExpectBytes assembles source and checks the program bytes, ignoring the
+// padding.
+func ExpectBytes(t testing.TB, src string, want ...byte) {
+	t.Helper()
+	got := Code(t, src)
+	if string(got) != string(want) {
+		t.Errorf("assembled bytes:\n got  % X\n want % X", got, want)
+	}
+}
+
+// Options control a run.
+type Options struct {
+	// clock pulse budget, DefaultCycles if 0
+	Cycles uint64
+	// stop once this many values were latched into OUT, 0 for no limit
+	Outputs int
+	// hardware stack depth, the reference build's if 0
+	StackDepth int
+	// sets the initial registers, may be nil
+	Init func(*emu.State)
+	// fail the test if the budget runs out before the machine halts
+	MustHalt bool
+}
+
+// Trace is the outcome of a run.
+type Trace struct {
+	// values latched into the OUT register, in order
+	Out []byte
+	// final machine state
+	State emu.State
+	// executed instruction addresses, in order
+	Addrs []byte
+}
+
+// Run executes a ROM image until it halts, produces Options.Outputs values
+// or the cycle budget runs out. Emulation errors fail the test.
+func Run(t testing.TB, img []byte, opts Options) *Trace {
+	t.Helper()
+	cfg := emu.DefaultConfig()
+	if 0 < opts.StackDepth {
+		cfg.StackDepth = opts.StackDepth
+	}
+	if 0 == opts.Cycles {
+		opts.Cycles = DefaultCycles
+	}
+
+	cpu, err := emu.New(img, cfg)
+	if nil != err {
+		t.Fatalf("emulator: %s", err)
+	}
+	if nil != opts.Init {
+		state := cpu.State()
+		opts.Init(&state)
+		cpu.SetState(state)
+	}
+
+	trace := &Trace{Out: []byte{}, Addrs: []byte{}}
+	for {
+		state := cpu.State()
+		if state.Halted || state.Cycle >= opts.Cycles || (0 < opts.Outputs && len(trace.Out) >= opts.Outputs) {
+			break
+		}
+		err = cpu.Tick()
+		if nil != err {
+			t.Fatalf("emulation failed after %d cycles: %s", state.Cycle, err)
+		}
+		state = cpu.State()
+		if 0 != state.Signals&ucode.OUT {
+			trace.Out = append(trace.Out, state.Out)
+		}
+		if 0 == state.Step || state.Halted {
+			trace.Addrs = append(trace.Addrs, state.Addr)
+		}
+	}
+	trace.State = cpu.State()
+
+	if opts.MustHalt && !trace.State.Halted {
+		t.Fatalf("program did not halt within %d cycles", opts.Cycles)
+	}
+	return trace
+}
+
+// RunSource assembles and runs source.
+func RunSource(t testing.TB, src string, opts Options) *Trace {
+	t.Helper()
+	return Run(t, Assemble(t, src), opts)
+}
+
+// ExpectOut checks the complete output sequence.
+func ExpectOut(t testing.TB, trace *Trace, want ...byte) {
+	t.Helper()
+	if string(trace.Out) != string(want) {
+		t.Errorf("output:\n got  %s\n want %s", values(trace.Out), values(want))
+	}
+}
+
+// ExpectOutPrefix checks the first values of the output sequence.
+func ExpectOutPrefix(t testing.TB, trace *Trace, want ...byte) {
+	t.Helper()
+	got := trace.Out
+	if len(got) > len(want) {
+		got = got[:len(want)]
+	}
+	if string(got) != string(want) {
+		t.Errorf("output:\n got  %s\n want %s ...", values(trace.Out), values(want))
+	}
+}
+
+// ExpectState checks final registers. Only the fields that differ between
+// the expected and actual state are reported, so fn usually copies the actual
+// state and sets the fields that matter:
+//
+//	bcctest.ExpectState(t, trace, func(s *emu.State) { s.A = 8 })
+func ExpectState(t testing.TB, trace *Trace, fn func(*emu.State)) {
+	t.Helper()
+	want := trace.State
+	want.Stack = append([]byte{}, trace.State.Stack...)
+	fn(&want)
+
+	got := trace.State
+	diffs := []string{}
+	diff := func(name string, got, want interface{}) {
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			diffs = append(diffs, fmt.Sprintf("%s: got %v, want %v", name, got, want))
+		}
+	}
+	diff("A", got.A, want.A)
+	diff("X", got.X, want.X)
+	diff("Y", got.Y, want.Y)
+	diff("OUT", got.Out, want.Out)
+	diff("PC", got.PC, want.PC)
+	diff("Carry", got.Carry, want.Carry)
+	diff("Zero", got.Zero, want.Zero)
+	diff("Halted", got.Halted, want.Halted)
+	diff("RAM", got.RAM, want.RAM)
+	diff("Stack", got.Stack, want.Stack)
+	if 0 < len(diffs) {
+		t.Errorf("final state:\n %s", strings.Join(diffs, "\n "))
+	}
+}
+
+// values prints bytes as space separated decimal values.
+func values(byts []byte) string {
+	s := []string{}
+	for _, byt := range byts {
+		s = append(s, fmt.Sprintf("%d", byt))
+	}
+	return "[" + strings.Join(s, " ") + "]"
+}
@@ -0,0 +1,184 @@
+package bcctest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/emu"
+)
+
+const fibSrc = `
+    LDAV 1
+    LDXV 1
+loop
+    OUTA
+    ADDX
+    PSHA
+    LDAX
+    POPX
+    JMP  loop
+`
+
+// recorder is a testing.TB that records failures instead of reporting them.
+type recorder struct {
+	testing.TB
+	errors []string
+	fatal  bool
+}
+
+func (rec *recorder) Helper() {}
+
+func (rec *recorder) Errorf(format string, args ...interface{}) {
+	rec.errors = append(rec.errors, fmt.Sprintf(format, args...))
+}
+
+func (rec *recorder) Fatalf(format string, args ...interface{}) {
+	rec.Errorf(format, args...)
+	rec.fatal = true
+	runtime.Goexit()
+}
+
+// record runs fn against a recorder, as its own goroutine so Fatalf can stop
+// it.
+func record(t *testing.T, fn func(tb testing.TB)) *recorder {
+	rec := &recorder{TB: t}
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		fn(rec)
+	}()
+	<-done
+	return rec
+}
+
+// expectFailure checks that fn failed with a message containing want.
+func expectFailure(t *testing.T, rec *recorder, fatal bool, want string) {
+	t.Helper()
+	if rec.fatal != fatal || 1 != len(rec.errors) || !strings.Contains(rec.errors[0], want) {
+		t.Errorf("failure: got %q (fatal %v), want one containing %q (fatal %v)", rec.errors, rec.fatal, want, fatal)
+	}
+}
+
+func TestAssemble(t *testing.T) {
+	img := Assemble(t, fibSrc)
+	if bcc.Kbit32 != len(img) {
+		t.Errorf("image is %d bytes, want %d", len(img), bcc.Kbit32)
+	}
+	code := Code(t, fibSrc)
+	if 11 != len(code) || string(img[:len(code)]) != string(code) {
+		t.Errorf("code: got % X, image starts % X", code, img[:11])
+	}
+
+	rec := record(t, func(tb testing.TB) { Assemble(tb, "    JMP nowhere\n") })
+	expectFailure(t, rec, true, "assemble")
+	rec = record(t, func(tb testing.TB) { Code(tb, "    LDAV 256\n") })
+	expectFailure(t, rec, true, "assemble")
+}
+
+func TestExpectBytes(t *testing.T) {
+	ldav, _ := bcc.Opcode("LDAV")
+	hlt, _ := bcc.Opcode("HLT")
+
+	// operands and data that happen to be erased bytes are kept
+	ExpectBytes(t, "    LDAV 255\n", ldav, 0xFF)
+	ExpectBytes(t, "    LDAV 0xFF\n    HLT\n", ldav, 0xFF, hlt)
+
+	rec := record(t, func(tb testing.TB) { ExpectBytes(tb, "    LDAV 1\n", ldav, 2) })
+	expectFailure(t, rec, false, fmt.Sprintf("got  %02X 01", ldav))
+}
+
+func TestRun(t *testing.T) {
+	trace := RunSource(t, fibSrc, Options{Outputs: 6})
+	ExpectOut(t, trace, 1, 1, 2, 3, 5, 8)
+	ExpectOutPrefix(t, trace, 1, 1, 2)
+	if 0 == len(trace.Addrs) || 0 != trace.Addrs[0] {
+		t.Errorf("executed addresses: got %v, want the first at 0", trace.Addrs)
+	}
+	if trace.State.Halted {
+		t.Errorf("fib halted")
+	}
+
+	// the cycle budget stops a program that never halts
+	trace = RunSource(t, fibSrc, Options{Cycles: 100})
+	if 100 != trace.State.Cycle {
+		t.Errorf("stopped after %d cycles, want 100", trace.State.Cycle)
+	}
+	rec := record(t, func(tb testing.TB) { RunSource(tb, fibSrc, Options{Cycles: 100, MustHalt: true}) })
+	expectFailure(t, rec, true, "did not halt within 100 cycles")
+}
+
+func TestRunOptions(t *testing.T) {
+	src := "    LDAX\n    ADDY\n    OUTA\n    HLT\n"
+	trace := RunSource(t, src, Options{MustHalt: true, Init: func(s *emu.State) {
+		s.X, s.Y = 7, 3
+	}})
+	ExpectOut(t, trace, 10)
+	ExpectState(t, trace, func(s *emu.State) {
+		s.A, s.Halted = 10, true
+	})
+
+	push := "    PSHV 1\n    PSHV 2\n    PSHV 3\n    HLT\n"
+	RunSource(t, push, Options{MustHalt: true})
+	rec := record(t, func(tb testing.TB) { RunSource(tb, push, Options{MustHalt: true, StackDepth: 2}) })
+	expectFailure(t, rec, true, "emulation failed")
+}
+
+func TestMatchers(t *testing.T) {
+	trace := RunSource(t, "    LDAV 3\n    OUTA\n    OUTA\n    HLT\n", Options{MustHalt: true})
+
+	rec := record(t, func(tb testing.TB) { ExpectOut(tb, trace, 3) })
+	expectFailure(t, rec, false, "got  [3 3]\n want [3]")
+	rec = record(t, func(tb testing.TB) { ExpectOutPrefix(tb, trace, 4) })
+	expectFailure(t, rec, false, "want [4] ...")
+	rec = record(t, func(tb testing.TB) { ExpectOutPrefix(tb, trace, 3, 3) })
+	if 0 != len(rec.errors) {
+		t.Errorf("prefix: %v", rec.errors)
+	}
+
+	// only the differing fields are reported
+	rec = record(t, func(tb testing.TB) {
+		ExpectState(tb, trace, func(s *emu.State) { s.A, s.Out = 4, 3 })
+	})
+	expectFailure(t, rec, false, "A: got 3, want 4")
+	if strings.Contains(rec.errors[0], "OUT") {
+		t.Errorf("reported a matching field: %s", rec.errors[0])
+	}
+}
+
+func TestGolden(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bcctest")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(dir string) { GoldenDir = dir }(GoldenDir)
+	GoldenDir = dir
+
+	img := Assemble(t, fibSrc)
+	rec := record(t, func(tb testing.TB) { GoldenImage(tb, "fib.img", img) })
+	expectFailure(t, rec, true, "run with -update")
+
+	*update = true
+	GoldenImage(t, "fib.img", img)
+	GoldenListing(t, "fib.lst", fibSrc, 10)
+	*update = false
+
+	GoldenImage(t, "fib.img", img)
+	GoldenListing(t, "fib.lst", fibSrc, 10)
+
+	changed := Assemble(t, strings.Replace(fibSrc, "LDXV 1", "LDXV 2", 1))
+	rec = record(t, func(tb testing.TB) { GoldenImage(tb, "fib.img", changed) })
+	expectFailure(t, rec, false, "first difference at 0x0003: got 0x02, want 0x01")
+	rec = record(t, func(tb testing.TB) { GoldenImage(tb, "fib.img", img[:100]) })
+	expectFailure(t, rec, false, "image is 100 bytes")
+
+	rec = record(t, func(tb testing.TB) {
+		GoldenListing(tb, "fib.lst", strings.Replace(fibSrc, "LDXV 1", "LDXV 2", 1), 10)
+	})
+	expectFailure(t, rec, false, "line 4 differs")
+}
@@ -0,0 +1,100 @@
+package bcctest
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+)
+
+// update is set by `go test -update` to rewrite golden files instead of
+// comparing against them.
+var update = flag.Bool("update", false, "rewrite bcctest golden files")
+
+// GoldenDir is the directory golden files are kept in, relative to the
+// package under test.
+var GoldenDir = "testdata"
+
+// golden compares data with a golden file, or writes it with -update. It
+// returns the golden data and whether it matched.
+func golden(t testing.TB, name string, got []byte) ([]byte, bool) {
+	t.Helper()
+	path := filepath.Join(GoldenDir, name)
+	if *update {
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if nil == err {
+			err = ioutil.WriteFile(path, got, 0644)
+		}
+		if nil != err {
+			t.Fatalf("update golden file: %s", err)
+		}
+		return got, true
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if nil != err {
+		t.Fatalf("read golden file, run with -update to create it: %s", err)
+	}
+	return want, string(got) == string(want)
+}
+
+// GoldenImage compares a ROM image with testdata/name and reports the
+// first differing address.
+func GoldenImage(t testing.TB, name string, img []byte) {
+	t.Helper()
+	want, ok := golden(t, name, img)
+	if ok {
+		return
+	}
+	if len(want) != len(img) {
+		t.Errorf("%s: image is %d bytes, golden file is %d bytes", name, len(img), len(want))
+		return
+	}
+	for addr := range img {
+		if img[addr] != want[addr] {
+			t.Errorf("%s: first difference at 0x%04X: got 0x%02X, want 0x%02X", name, addr, img[addr], want[addr])
+			return
+		}
+	}
+}
+
+// GoldenListing assembles source and compares its listing at a clock rate
+// with testdata/name, reporting the first differing line.
+func GoldenListing(t testing.TB, name, src string, hz float64) {
+	t.Helper()
+	prg, err := bcc.NewSource([]byte(src))
+	if nil == err {
+		err = prg.Parse()
+	}
+	var listing string
+	if nil == err {
+		listing, err = prg.Listing(hz)
+	}
+	if nil != err {
+		t.Fatalf("listing: %s", err)
+	}
+
+	want, ok := golden(t, name, []byte(listing))
+	if ok {
+		return
+	}
+	gotLines := strings.Split(listing, "\n")
+	wantLines := strings.Split(string(want), "\n")
+	for k := 0; k < len(gotLines) || k < len(wantLines); k++ {
+		got, exp := "<eof>", "<eof>"
+		if k < len(gotLines) {
+			got = gotLines[k]
+		}
+		if k < len(wantLines) {
+			exp = wantLines[k]
+		}
+		if got != exp {
+			t.Errorf("%s: line %d differs:\n got  %s\n want %s", name, k+1, got, exp)
+			return
+		}
+	}
+}
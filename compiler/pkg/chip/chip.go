@@ -0,0 +1,253 @@
+// Package chip simulates the computer at the component level: 74LS-series
+// logic and EEPROMs wired together by a netlist, clocked edge by edge. Where
+// package emu executes the microcode directly, this package only knows how
+// each part behaves, so a wiring mistake on the breadboard shows up here as
+// a floating bus line, two outputs fighting over a net, or a program that
+// computes the wrong result.
+//
+// Nets settle with zero delay. On every clock edge the nets settle, every
+// clocked part samples its inputs and then they all update at once, so hold
+// times are always met; parts clocked from another part's outputs, such as
+// cascaded counters, update in a later round. Level-triggered RAM writes
+// store the value the nets settle to in each half of the clock cycle.
+package chip
+
+// Level is the logic level of a net or pin.
+type Level byte
+
+const (
+	LOW Level = iota
+	HIGH
+	// nothing drives the net
+	FLOAT
+	// drivers disagree
+	CONFLICT
+)
+
+// String implements Stringer.
+func (level Level) String() string {
+	return [...]string{"0", "1", "Z", "X"}[level]
+}
+
+// levelOf returns the level of a logic value.
+func levelOf(v bool) Level {
+	if v {
+		return HIGH
+	}
+	return LOW
+}
+
+// pinRef is a pin of a part.
+type pinRef struct {
+	part *part
+	pin  int
+}
+
+// String implements Stringer.
+func (ref pinRef) String() string {
+	return ref.part.name + "." + ref.part.spec.pins[ref.pin].name
+}
+
+// net is a set of connected pins.
+type net struct {
+	name string
+	// level read while nothing drives the net, FLOAT without a pull resistor
+	pull Level
+	// level of a supply or simulator driven net, FLOAT for ordinary nets
+	source Level
+	pins   []pinRef
+	// parts reading the net
+	readers []*part
+
+	level Level
+	// the undriven net a value derives from, "" if every driver is driven
+	origin  string
+	drivers int
+}
+
+// resolve computes the level of the net from its drivers and reports whether
+// it changed.
+func (n *net) resolve() bool {
+	level, origin, drivers := n.source, "", 0
+	if FLOAT != n.source {
+		drivers = 1
+	}
+	for _, ref := range n.pins {
+		drive := ref.part.drive[ref.pin]
+		if FLOAT == drive {
+			continue
+		}
+		drivers++
+		switch true {
+		case 1 == drivers:
+			level, origin = drive, ref.part.taint[ref.pin]
+		case level != drive:
+			level = CONFLICT
+		}
+		if "" == origin {
+			origin = ref.part.taint[ref.pin]
+		}
+	}
+	if 0 == drivers {
+		origin = n.name
+	}
+	changed := level != n.level || origin != n.origin
+	n.level, n.origin, n.drivers = level, origin, drivers
+	return changed
+}
+
+// part is a placed chip.
+type part struct {
+	name  string
+	spec  *Spec
+	model model
+	sim   *Sim
+	// net of each pin, nil if unconnected
+	nets []*net
+	// level each pin drives, FLOAT for inputs and disabled outputs
+	drive []Level
+	// the undriven net each driven level derives from
+	taint []string
+	// drive and taint before the last evaluation
+	was      []Level
+	wasTaint []string
+
+	// the undriven net read since begin, "" if none
+	origin string
+	dirty  bool
+}
+
+// model is the behaviour of a part type.
+type model interface {
+	// eval drives the outputs from the inputs and the stored state,
+	// including asynchronous clears and loads
+	eval(p *part)
+}
+
+// clocked is implemented by parts that change state on a clock edge.
+type clocked interface {
+	// edge is called whenever the nets settle. On a clock edge it samples
+	// the inputs and returns true, and commit stores what was sampled once
+	// every part has sampled.
+	edge(p *part) bool
+	commit()
+}
+
+// writer is implemented by parts with level-triggered writes.
+type writer interface {
+	// write stores the inputs while the write enable is active and returns
+	// whether anything changed
+	write(p *part) bool
+}
+
+// register is implemented by parts that hold a 4-bit value.
+type register interface {
+	value() int
+	setValue(int)
+}
+
+// memory is implemented by parts with storage cells.
+type memory interface {
+	cells() []byte
+}
+
+// begin starts reading the inputs for an independent set of outputs, such as
+// one gate of a package.
+func (p *part) begin() {
+	p.origin = ""
+}
+
+// in returns the level of an input as TTL sees it: a floating input reads
+// high unless the net is pulled.
+func (p *part) in(pin int) bool {
+	n := p.nets[pin]
+	if nil == n {
+		if "" == p.origin {
+			p.origin = pinRef{p, pin}.String()
+		}
+		return true
+	}
+	if "" == p.origin {
+		p.origin = n.origin
+	}
+	switch n.level {
+	case HIGH:
+		return true
+	case FLOAT:
+		return LOW != n.pull
+	}
+	return false
+}
+
+// bits returns the inputs as a number, the first pin the least significant
+// bit.
+func (p *part) bits(pins ...int) int {
+	v := 0
+	for k, pin := range pins {
+		if p.in(pin) {
+			v |= 1 << uint(k)
+		}
+	}
+	return v
+}
+
+// data returns an input sampled into storage, reporting it if the value comes
+// from a floating net.
+func (p *part) data(pin int) bool {
+	origin := p.origin
+	p.origin = ""
+	v := p.in(pin)
+	if "" != p.origin {
+		p.sim.floating(p.origin, pinRef{p, pin})
+	}
+	p.origin = origin
+	return v
+}
+
+// dataBits returns inputs sampled into storage as a number.
+func (p *part) dataBits(pins ...int) int {
+	v := 0
+	for k, pin := range pins {
+		if p.data(pin) {
+			v |= 1 << uint(k)
+		}
+	}
+	return v
+}
+
+// out drives an output.
+func (p *part) out(pin int, v bool) {
+	p.drive[pin] = levelOf(v)
+	p.taint[pin] = p.origin
+}
+
+// outBits drives outputs from a number, the first pin the least significant
+// bit.
+func (p *part) outBits(v int, pins ...int) {
+	for k, pin := range pins {
+		p.out(pin, 0 != v&(1<<uint(k)))
+	}
+}
+
+// float disables outputs.
+func (p *part) float(pins ...int) {
+	for _, pin := range pins {
+		p.drive[pin] = FLOAT
+		p.taint[pin] = ""
+	}
+}
+
+// evaluate runs the part's model and appends the nets whose drivers changed
+// to changed.
+func (p *part) evaluate(changed []*net) []*net {
+	p.was = append(p.was[:0], p.drive...)
+	p.wasTaint = append(p.wasTaint[:0], p.taint...)
+	p.begin()
+	p.model.eval(p)
+	for pin, n := range p.nets {
+		if nil != n && (p.was[pin] != p.drive[pin] || p.wasTaint[pin] != p.taint[pin]) {
+			changed = append(changed, n)
+		}
+	}
+	return changed
+}
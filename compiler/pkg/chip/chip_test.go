@@ -0,0 +1,168 @@
+package chip_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcctest"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/chip"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/emu"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/ucode"
+)
+
+// simulate parses a netlist and wires it without program or decoder ROMs.
+func simulate(t *testing.T, netlist string) *chip.Sim {
+	t.Helper()
+	nl, err := chip.ParseNetlist(strings.NewReader(netlist))
+	if nil != err {
+		t.Fatalf("netlist: %s", err)
+	}
+	sim, err := chip.New(nl, nil, nil)
+	if nil != err {
+		t.Fatalf("simulation: %s", err)
+	}
+	return sim
+}
+
+// tick runs clock cycles.
+func tick(t *testing.T, sim *chip.Sim, n int) {
+	t.Helper()
+	for k := 0; k < n; k++ {
+		if err := sim.Tick(); nil != err {
+			t.Fatalf("cycle %d: %s", k, err)
+		}
+	}
+}
+
+// counter is an 8 bit counter of two 74LS161s, the low nibble's carry
+// enabling the high nibble, cleared by the reset button.
+const counter = `
+part INV 74LS04
+part LO 74LS161
+part HI 74LS161
+net RESET   INV.A0
+net RESET_N INV.Y0 LO.CLR HI.CLR
+net CLOCK   LO.CLK HI.CLK
+net VCC     LO.ENP LO.ENT LO.LOAD HI.ENP HI.LOAD
+net GND     LO.D[0:3] HI.D[0:3]
+net CARRY   LO.RCO HI.ENT
+net Q[0:3]  LO.Q[0:3]
+net Q[4:7]  HI.Q[0:3]
+probe PC    LO HI
+`
+
+func TestCounter(t *testing.T) {
+	sim := simulate(t, counter)
+	tick(t, sim, 300)
+	if state := sim.State(); 300%256 != int(state.PC) || 300 != state.Cycle {
+		t.Errorf("after 300 cycles: PC %d, cycle %d, want %d", state.PC, state.Cycle, 300%256)
+	}
+	if 0 != len(sim.Issues()) {
+		t.Errorf("issues: %v", sim.Issues())
+	}
+
+	sim.Reset()
+	if pc := sim.State().PC; 0 != pc {
+		t.Errorf("after reset: PC %d, want 0", pc)
+	}
+	tick(t, sim, 17)
+	if pc := sim.State().PC; 17 != pc {
+		t.Errorf("after 17 cycles: PC %d, want 17", pc)
+	}
+}
+
+func TestContention(t *testing.T) {
+	sim := simulate(t, `
+part HI_BUF 74LS245
+part LO_BUF 74LS245
+net VCC HI_BUF.DIR HI_BUF.A0 LO_BUF.DIR
+net GND HI_BUF.OE LO_BUF.OE LO_BUF.A0
+net X   HI_BUF.B0 LO_BUF.B0
+`)
+	tick(t, sim, 3)
+	issues := sim.Issues()
+	if 1 != len(issues) {
+		t.Fatalf("issues: got %v, want contention on X", issues)
+	}
+	issue := issues[0]
+	if chip.ISSUE_CONTENTION != issue.Kind || "X" != issue.Net || 3 != issue.Count || "HI_BUF.B0 LO_BUF.B0" != strings.Join(issue.Pins, " ") {
+		t.Errorf("issue: got %s %s %v %d times, want contention on X by both buffers 3 times", issue.Kind, issue.Net, issue.Pins, issue.Count)
+	}
+}
+
+func TestFloating(t *testing.T) {
+	sim := simulate(t, `
+part REG 74LS173
+net CLOCK REG.CLK
+net GND   REG.M REG.N REG.G1 REG.G2 REG.CLR
+net D     REG.D[0:3]
+net Q[0:3] REG.Q[0:3]
+`)
+	tick(t, sim, 1)
+	issues := sim.Issues()
+	if 1 != len(issues) || chip.ISSUE_FLOATING != issues[0].Kind || "D" != issues[0].Net {
+		t.Fatalf("issues: got %v, want D floating", issues)
+	}
+	if pins := strings.Join(issues[0].Pins, " "); "REG.D0 REG.D1 REG.D2 REG.D3" != pins {
+		t.Errorf("pins: got %s, want every data input", pins)
+	}
+}
+
+// TestReference runs fib on the reference build in step with the emulator.
+func TestReference(t *testing.T) {
+	ops := []string{}
+	for _, name := range bcc.OpNames() {
+		opcode, _ := bcc.Opcode(name)
+		for len(ops) <= int(opcode) {
+			ops = append(ops, "")
+		}
+		ops[opcode] = name
+	}
+	roms, err := ucode.ROMs(ops)
+	if nil != err {
+		t.Fatalf("microcode: %s", err)
+	}
+
+	img := bcctest.Assemble(t, `
+    LDAV 1
+    LDXV 0
+loop
+    OUTA
+    PSHA
+    ADDX
+    POPX
+    JMP  loop
+`)
+	sim, err := chip.New(chip.ReferenceNetlist(), img, roms)
+	if nil != err {
+		t.Fatalf("simulation: %s", err)
+	}
+	ref, err := emu.New(img, emu.DefaultConfig())
+	if nil != err {
+		t.Fatalf("emulator: %s", err)
+	}
+
+	out := []byte{}
+	for k := 0; k < 40; k++ {
+		if err = sim.Step(); nil != err {
+			t.Fatalf("step %d: %s", k, err)
+		}
+		if err = ref.Step(); nil != err {
+			t.Fatalf("emulator step %d: %s", k, err)
+		}
+		have, want := sim.State(), ref.State()
+		if have.A != want.A || have.X != want.X || have.Out != want.Out || have.PC != want.PC || have.Cycle != want.Cycle || string(have.Stack) != string(want.Stack) {
+			t.Fatalf("step %d:\n sim %s\n emu %s", k, emu.Trace(img, have, nil), emu.Trace(img, want, nil))
+		}
+		if name, _ := bcc.OpName(have.IR); "OUTA" == name {
+			out = append(out, have.Out)
+		}
+	}
+	if want := []byte{1, 1, 2, 3, 5, 8, 13, 21}; string(out) != string(want) {
+		t.Errorf("output: got %v, want %v", out, want)
+	}
+	if 0 != len(sim.Issues()) {
+		t.Errorf("issues: %v", sim.Issues())
+	}
+}
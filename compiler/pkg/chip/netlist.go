@@ -0,0 +1,299 @@
+package chip
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/bdlm/errors/v2"
+)
+
+// Nets driven by the simulator rather than by parts.
+const (
+	// supply rails
+	NET_VCC = "VCC"
+	NET_GND = "GND"
+	// clock module output, before the HLT gate
+	NET_CLOCK = "CLOCK"
+	// reset button, high while pressed
+	NET_RESET = "RESET"
+)
+
+// ROM roles.
+const (
+	ROM_PROGRAM = "program"
+	ROM_DECODER = "decoder"
+)
+
+// Probes lists the machine state each probe reads, see Netlist.Probes.
+var Probes = map[string]string{
+	"A":     "register A, 74LS173 parts",
+	"X":     "register X, 74LS173 parts",
+	"Y":     "register Y, 74LS173 parts",
+	"OUT":   "output register, 74LS173 parts",
+	"PC":    "program counter, 74LS161 parts",
+	"MAR":   "ROM address register, 74LS173 parts",
+	"RAR":   "RAM address register, 74LS173 parts",
+	"IR":    "instruction register, 74LS173 parts",
+	"STEP":  "step counter, a 74LS161",
+	"FLAGS": "flags register, a 74LS173 holding carry on Q0 and zero on Q1",
+	"SP":    "stack pointer, the number of bytes on the stack, 74LS193 parts",
+	"RAM":   "RAM, 74LS189 parts",
+	"STACK": "stack memory, 74LS189 parts",
+}
+
+// PartDecl places a part.
+type PartDecl struct {
+	Name string
+	Type string
+	Line int
+}
+
+// NetDecl connects pins, as PART.PIN.
+type NetDecl struct {
+	Name string
+	Pins []string
+	Line int
+}
+
+// ROMDecl loads an image into an EEPROM part.
+type ROMDecl struct {
+	Part string
+	Role string
+	// decoder ROM number
+	Index int
+	Line  int
+}
+
+// Netlist describes how the parts of the computer are wired. The text form
+// has one statement per line, '#' starting a comment:
+//
+//	part NAME TYPE            place a part, TYPE one of Parts
+//	net NAME PIN...           connect pins, PART.PIN by name or number
+//	pull up|down NET...       a pull resistor, read while nothing drives the net
+//	bus NET...                the bus lines, least significant first
+//	probe NAME PART...        the parts holding a register, low nibble first
+//	rom PART program          the EEPROM the program image is loaded into
+//	rom PART decoder N        the EEPROM decoder ROM image N is loaded into
+//
+// Names and pins may end in a range, BUS[0:7] for BUS0 through BUS7. A net
+// with a range connects one pin of each ranged pin per net, a single net all
+// of them. Nets named after control signals carry them, and the VCC, GND,
+// CLOCK and RESET nets are driven by the simulator.
+type Netlist struct {
+	Parts  []PartDecl
+	Nets   []NetDecl
+	Pulls  map[string]Level
+	Bus    []string
+	Probes map[string][]string
+	ROMs   []ROMDecl
+}
+
+// ParseNetlist reads a netlist.
+func ParseNetlist(r io.Reader) (*Netlist, error) {
+	nl := &Netlist{
+		Pulls:  map[string]Level{},
+		Probes: map[string][]string{},
+	}
+	parts := map[string]string{}
+	pinNets := map[string]string{}
+	nets := map[string]int{}
+
+	scanner := bufio.NewScanner(r)
+	ln := 0
+	for scanner.Scan() {
+		ln++
+		line := scanner.Text()
+		if k := strings.Index(line, "#"); k >= 0 {
+			line = line[:k]
+		}
+		fields := strings.Fields(line)
+		if 0 == len(fields) {
+			continue
+		}
+		fail := func(format string, args ...interface{}) error {
+			return errors.Errorf("line %d: "+format, append([]interface{}{ln}, args...)...)
+		}
+		args := fields[1:]
+
+		switch fields[0] {
+		case "part":
+			if 2 != len(args) {
+				return nil, fail("expected part NAME TYPE")
+			}
+			name, typ := args[0], strings.ToUpper(args[1])
+			if _, ok := Parts[typ]; !ok {
+				return nil, fail("unknown part type '%s'", args[1])
+			}
+			if strings.ContainsAny(name, ".[]") {
+				return nil, fail("invalid part name '%s'", name)
+			}
+			if _, ok := parts[name]; ok {
+				return nil, fail("part '%s' is already placed", name)
+			}
+			parts[name] = typ
+			nl.Parts = append(nl.Parts, PartDecl{name, typ, ln})
+
+		case "net":
+			if len(args) < 2 {
+				return nil, fail("expected net NAME PIN...")
+			}
+			names, err := expand(args[0])
+			if nil != err {
+				return nil, fail("%s", err)
+			}
+			conns := make([][]string, len(names))
+			for _, arg := range args[1:] {
+				refs, err := expand(arg)
+				if nil != err {
+					return nil, fail("%s", err)
+				}
+				if 1 != len(names) && len(refs) != len(names) {
+					return nil, fail("%s has %d pins for %d nets", arg, len(refs), len(names))
+				}
+				for k, ref := range refs {
+					name, err := resolvePin(parts, ref)
+					if nil != err {
+						return nil, fail("%s", err)
+					}
+					net := names[0]
+					if 1 != len(names) {
+						net = names[k]
+					}
+					if was, ok := pinNets[name]; ok {
+						if was != net {
+							return nil, fail("%s is already on net %s", name, was)
+						}
+						continue
+					}
+					pinNets[name] = net
+					conns[k%len(names)] = append(conns[k%len(names)], name)
+				}
+			}
+			for k, name := range names {
+				if idx, ok := nets[name]; ok {
+					nl.Nets[idx].Pins = append(nl.Nets[idx].Pins, conns[k]...)
+					continue
+				}
+				nets[name] = len(nl.Nets)
+				nl.Nets = append(nl.Nets, NetDecl{name, conns[k], ln})
+			}
+
+		case "pull":
+			if len(args) < 2 || ("up" != args[0] && "down" != args[0]) {
+				return nil, fail("expected pull up|down NET...")
+			}
+			for _, arg := range args[1:] {
+				names, err := expand(arg)
+				if nil != err {
+					return nil, fail("%s", err)
+				}
+				for _, name := range names {
+					nl.Pulls[name] = levelOf("up" == args[0])
+				}
+			}
+
+		case "bus":
+			for _, arg := range args {
+				names, err := expand(arg)
+				if nil != err {
+					return nil, fail("%s", err)
+				}
+				nl.Bus = append(nl.Bus, names...)
+			}
+
+		case "probe":
+			if len(args) < 2 {
+				return nil, fail("expected probe NAME PART...")
+			}
+			if _, ok := Probes[args[0]]; !ok {
+				return nil, fail("unknown probe '%s'", args[0])
+			}
+			for _, name := range args[1:] {
+				if _, ok := parts[name]; !ok {
+					return nil, fail("unknown part '%s'", name)
+				}
+			}
+			nl.Probes[args[0]] = args[1:]
+
+		case "rom":
+			decl := ROMDecl{Line: ln}
+			switch true {
+			case 2 == len(args) && ROM_PROGRAM == args[1]:
+			case 3 == len(args) && ROM_DECODER == args[1]:
+				idx, err := strconv.Atoi(args[2])
+				if nil != err || idx < 0 {
+					return nil, fail("invalid decoder ROM number '%s'", args[2])
+				}
+				decl.Index = idx
+			default:
+				return nil, fail("expected rom PART program or rom PART decoder N")
+			}
+			typ, ok := parts[args[0]]
+			if !ok {
+				return nil, fail("unknown part '%s'", args[0])
+			}
+			if !strings.HasPrefix(typ, "28C") {
+				return nil, fail("%s is a %s, not an EEPROM", args[0], typ)
+			}
+			decl.Part, decl.Role = args[0], args[1]
+			nl.ROMs = append(nl.ROMs, decl)
+
+		default:
+			return nil, fail("unknown statement '%s'", fields[0])
+		}
+	}
+	if err := scanner.Err(); nil != err {
+		return nil, errors.Wrap(err, "could not read netlist")
+	}
+	return nl, nil
+}
+
+// resolvePin checks a PART.PIN reference and returns it with the pin by name.
+func resolvePin(parts map[string]string, ref string) (string, error) {
+	dot := strings.Index(ref, ".")
+	if dot < 0 {
+		return "", errors.Errorf("expected PART.PIN, found '%s'", ref)
+	}
+	typ, ok := parts[ref[:dot]]
+	if !ok {
+		return "", errors.Errorf("unknown part '%s'", ref[:dot])
+	}
+	spec := Parts[typ]
+	pin, ok := spec.pin(ref[dot+1:])
+	if !ok {
+		return "", errors.Errorf("%s has no pin '%s'", typ, ref[dot+1:])
+	}
+	return ref[:dot] + "." + spec.pins[pin].name, nil
+}
+
+// expand expands a trailing range, NAME[a:b], into the names it covers in
+// order. Other names are returned as they are.
+func expand(s string) ([]string, error) {
+	open := strings.Index(s, "[")
+	if open < 0 {
+		return []string{s}, nil
+	}
+	bounds := strings.Split(strings.TrimSuffix(s[open+1:], "]"), ":")
+	if !strings.HasSuffix(s, "]") || 2 != len(bounds) {
+		return nil, errors.Errorf("invalid range '%s'", s)
+	}
+	from, err1 := strconv.Atoi(bounds[0])
+	to, err2 := strconv.Atoi(bounds[1])
+	if nil != err1 || nil != err2 || from < 0 || to < 0 {
+		return nil, errors.Errorf("invalid range '%s'", s)
+	}
+	step := 1
+	if to < from {
+		step = -1
+	}
+	names := []string{}
+	for k := from; ; k += step {
+		names = append(names, s[:open]+strconv.Itoa(k))
+		if k == to {
+			break
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,424 @@
+package chip
+
+import (
+	"sort"
+	"strconv"
+)
+
+// pinSpec is a pin of a part type.
+type pinSpec struct {
+	name   string
+	number int
+}
+
+// Spec describes a part type. Pins are named as on the datasheet, except
+// that numbered groups count from 0 and lettered ones are numbered, so the
+// 74LS161's A-D and QA-QD are D0-D3 and Q0-Q3 and a bus connects as
+// BUS[0:3] PART.D[0:3]. Supply pins are not modelled.
+type Spec struct {
+	Name string
+	Doc  string
+	pins []pinSpec
+	new  func() model
+}
+
+// Pins returns the part's pins in pin number order, as NUMBER:NAME.
+func (spec *Spec) Pins() []string {
+	pins := append([]pinSpec{}, spec.pins...)
+	sort.Slice(pins, func(i, j int) bool { return pins[i].number < pins[j].number })
+	names := []string{}
+	for _, pin := range pins {
+		names = append(names, strconv.Itoa(pin.number)+":"+pin.name)
+	}
+	return names
+}
+
+// pin returns the index of a pin by name or number.
+func (spec *Spec) pin(name string) (int, bool) {
+	for k, pin := range spec.pins {
+		if pin.name == name || strconv.Itoa(pin.number) == name {
+			return k, true
+		}
+	}
+	return 0, false
+}
+
+// Parts lists the supported part types by name.
+var Parts = map[string]*Spec{}
+
+// define adds a part type.
+func define(name, doc string, new func() model, pins ...pinSpec) {
+	Parts[name] = &Spec{Name: name, Doc: doc, pins: pins, new: new}
+}
+
+func init() {
+	define("74LS173", "4-bit D register, tri-state outputs", func() model { return &ls173{} },
+		pinSpec{"M", 1}, pinSpec{"N", 2}, pinSpec{"CLK", 7}, pinSpec{"G1", 9}, pinSpec{"G2", 10}, pinSpec{"CLR", 15},
+		pinSpec{"D0", 14}, pinSpec{"D1", 13}, pinSpec{"D2", 12}, pinSpec{"D3", 11},
+		pinSpec{"Q0", 3}, pinSpec{"Q1", 4}, pinSpec{"Q2", 5}, pinSpec{"Q3", 6},
+	)
+	define("74LS161", "4-bit synchronous binary counter, asynchronous clear", func() model { return &ls161{} },
+		pinSpec{"CLR", 1}, pinSpec{"CLK", 2}, pinSpec{"ENP", 7}, pinSpec{"LOAD", 9}, pinSpec{"ENT", 10}, pinSpec{"RCO", 15},
+		pinSpec{"D0", 3}, pinSpec{"D1", 4}, pinSpec{"D2", 5}, pinSpec{"D3", 6},
+		pinSpec{"Q0", 14}, pinSpec{"Q1", 13}, pinSpec{"Q2", 12}, pinSpec{"Q3", 11},
+	)
+	define("74LS193", "4-bit up/down binary counter, asynchronous clear and load", func() model { return &ls193{} },
+		pinSpec{"DOWN", 4}, pinSpec{"UP", 5}, pinSpec{"LOAD", 11}, pinSpec{"CO", 12}, pinSpec{"BO", 13}, pinSpec{"CLR", 14},
+		pinSpec{"D0", 15}, pinSpec{"D1", 1}, pinSpec{"D2", 10}, pinSpec{"D3", 9},
+		pinSpec{"Q0", 3}, pinSpec{"Q1", 2}, pinSpec{"Q2", 6}, pinSpec{"Q3", 7},
+	)
+	define("74LS245", "octal bus transceiver, tri-state", func() model { return &ls245{} },
+		pinSpec{"DIR", 1}, pinSpec{"OE", 19},
+		pinSpec{"A0", 2}, pinSpec{"A1", 3}, pinSpec{"A2", 4}, pinSpec{"A3", 5},
+		pinSpec{"A4", 6}, pinSpec{"A5", 7}, pinSpec{"A6", 8}, pinSpec{"A7", 9},
+		pinSpec{"B0", 18}, pinSpec{"B1", 17}, pinSpec{"B2", 16}, pinSpec{"B3", 15},
+		pinSpec{"B4", 14}, pinSpec{"B5", 13}, pinSpec{"B6", 12}, pinSpec{"B7", 11},
+	)
+	define("74LS283", "4-bit binary full adder", func() model { return &ls283{} },
+		pinSpec{"C0", 7}, pinSpec{"C4", 9},
+		pinSpec{"A0", 5}, pinSpec{"A1", 3}, pinSpec{"A2", 14}, pinSpec{"A3", 12},
+		pinSpec{"B0", 6}, pinSpec{"B1", 2}, pinSpec{"B2", 15}, pinSpec{"B3", 11},
+		pinSpec{"S0", 4}, pinSpec{"S1", 1}, pinSpec{"S2", 13}, pinSpec{"S3", 10},
+	)
+	define("74LS189", "16x4 RAM, inverted tri-state outputs", func() model { return &ls189{} },
+		pinSpec{"CS", 2}, pinSpec{"WE", 3},
+		pinSpec{"A0", 1}, pinSpec{"A1", 15}, pinSpec{"A2", 14}, pinSpec{"A3", 13},
+		pinSpec{"D0", 4}, pinSpec{"D1", 6}, pinSpec{"D2", 10}, pinSpec{"D3", 12},
+		pinSpec{"Q0", 5}, pinSpec{"Q1", 7}, pinSpec{"Q2", 9}, pinSpec{"Q3", 11},
+	)
+	define("28C16", "2K x 8 EEPROM, read only", func() model { return newEEPROM(11) },
+		pinSpec{"CE", 18}, pinSpec{"OE", 20}, pinSpec{"WE", 21},
+		pinSpec{"D0", 9}, pinSpec{"D1", 10}, pinSpec{"D2", 11}, pinSpec{"D3", 13},
+		pinSpec{"D4", 14}, pinSpec{"D5", 15}, pinSpec{"D6", 16}, pinSpec{"D7", 17},
+		pinSpec{"A0", 8}, pinSpec{"A1", 7}, pinSpec{"A2", 6}, pinSpec{"A3", 5},
+		pinSpec{"A4", 4}, pinSpec{"A5", 3}, pinSpec{"A6", 2}, pinSpec{"A7", 1},
+		pinSpec{"A8", 23}, pinSpec{"A9", 22}, pinSpec{"A10", 19},
+	)
+	define("28C256", "32K x 8 EEPROM, read only", func() model { return newEEPROM(15) },
+		pinSpec{"CE", 20}, pinSpec{"OE", 22}, pinSpec{"WE", 27},
+		pinSpec{"D0", 11}, pinSpec{"D1", 12}, pinSpec{"D2", 13}, pinSpec{"D3", 15},
+		pinSpec{"D4", 16}, pinSpec{"D5", 17}, pinSpec{"D6", 18}, pinSpec{"D7", 19},
+		pinSpec{"A0", 10}, pinSpec{"A1", 9}, pinSpec{"A2", 8}, pinSpec{"A3", 7},
+		pinSpec{"A4", 6}, pinSpec{"A5", 5}, pinSpec{"A6", 4}, pinSpec{"A7", 3},
+		pinSpec{"A8", 25}, pinSpec{"A9", 24}, pinSpec{"A10", 21}, pinSpec{"A11", 23},
+		pinSpec{"A12", 2}, pinSpec{"A13", 26}, pinSpec{"A14", 1},
+	)
+	define("74LS04", "hex inverter", func() model { return &gates{1, func(in []bool) bool { return !in[0] }} },
+		pinSpec{"A0", 1}, pinSpec{"Y0", 2}, pinSpec{"A1", 3}, pinSpec{"Y1", 4}, pinSpec{"A2", 5}, pinSpec{"Y2", 6},
+		pinSpec{"A3", 9}, pinSpec{"Y3", 8}, pinSpec{"A4", 11}, pinSpec{"Y4", 10}, pinSpec{"A5", 13}, pinSpec{"Y5", 12},
+	)
+	quad := func(name, doc string, fn func(a, b bool) bool) {
+		define(name, doc, func() model { return &gates{2, func(in []bool) bool { return fn(in[0], in[1]) }} },
+			pinSpec{"A0", 1}, pinSpec{"B0", 2}, pinSpec{"Y0", 3}, pinSpec{"A1", 4}, pinSpec{"B1", 5}, pinSpec{"Y1", 6},
+			pinSpec{"A2", 9}, pinSpec{"B2", 10}, pinSpec{"Y2", 8}, pinSpec{"A3", 12}, pinSpec{"B3", 13}, pinSpec{"Y3", 11},
+		)
+	}
+	quad("74LS00", "quad 2-input NAND", func(a, b bool) bool { return !(a && b) })
+	quad("74LS08", "quad 2-input AND", func(a, b bool) bool { return a && b })
+	quad("74LS32", "quad 2-input OR", func(a, b bool) bool { return a || b })
+	quad("74LS86", "quad 2-input XOR", func(a, b bool) bool { return a != b })
+}
+
+// pins lists pin indexes from the first of a group of n consecutive pins.
+func pins(first, n int) []int {
+	list := make([]int, n)
+	for k := range list {
+		list[k] = first + k
+	}
+	return list
+}
+
+// rising tracks a clock input and reports its low to high transitions.
+type rising bool
+
+// edge records the clock level and reports whether it rose.
+func (last *rising) edge(clk bool) bool {
+	rose := clk && !bool(*last)
+	*last = rising(clk)
+	return rose
+}
+
+// 74LS173 pin indexes
+const (
+	ls173M = iota
+	ls173N
+	ls173CLK
+	ls173G1
+	ls173G2
+	ls173CLR
+	ls173D
+	ls173Q = ls173D + 4
+)
+
+// ls173 is a 4-bit register. It loads on the rising clock edge while both
+// data enables are low, clears while CLR is high and drives its outputs
+// while both output enables are low.
+type ls173 struct {
+	q, next int
+	clk     rising
+}
+
+func (m *ls173) eval(p *part) {
+	if p.in(ls173CLR) {
+		m.q = 0
+	}
+	if p.in(ls173M) || p.in(ls173N) {
+		p.float(pins(ls173Q, 4)...)
+		return
+	}
+	p.outBits(m.q, pins(ls173Q, 4)...)
+}
+
+func (m *ls173) edge(p *part) bool {
+	if !m.clk.edge(p.in(ls173CLK)) || p.in(ls173CLR) || p.in(ls173G1) || p.in(ls173G2) {
+		return false
+	}
+	m.next = p.dataBits(pins(ls173D, 4)...)
+	return true
+}
+
+func (m *ls173) commit()        { m.q = m.next }
+func (m *ls173) value() int     { return m.q }
+func (m *ls173) setValue(v int) { m.q = v & 0xF }
+
+// 74LS161 pin indexes
+const (
+	ls161CLR = iota
+	ls161CLK
+	ls161ENP
+	ls161LOAD
+	ls161ENT
+	ls161RCO
+	ls161D
+	ls161Q = ls161D + 4
+)
+
+// ls161 is a 4-bit counter. On the rising clock edge it loads while LOAD is
+// low, else counts while ENP and ENT are high. CLR low clears it at once.
+// RCO is high at 15 while ENT is high, to enable the next counter.
+type ls161 struct {
+	q, next int
+	clk     rising
+}
+
+func (m *ls161) eval(p *part) {
+	if !p.in(ls161CLR) {
+		m.q = 0
+	}
+	p.outBits(m.q, pins(ls161Q, 4)...)
+	p.out(ls161RCO, 0xF == m.q && p.in(ls161ENT))
+}
+
+func (m *ls161) edge(p *part) bool {
+	if !m.clk.edge(p.in(ls161CLK)) || !p.in(ls161CLR) {
+		return false
+	}
+	switch true {
+	case !p.in(ls161LOAD):
+		m.next = p.dataBits(pins(ls161D, 4)...)
+	case p.in(ls161ENP) && p.in(ls161ENT):
+		m.next = (m.q + 1) & 0xF
+	default:
+		return false
+	}
+	return true
+}
+
+func (m *ls161) commit()        { m.q = m.next }
+func (m *ls161) value() int     { return m.q }
+func (m *ls161) setValue(v int) { m.q = v & 0xF }
+
+// 74LS193 pin indexes
+const (
+	ls193DOWN = iota
+	ls193UP
+	ls193LOAD
+	ls193CO
+	ls193BO
+	ls193CLR
+	ls193D
+	ls193Q = ls193D + 4
+)
+
+// ls193 is a 4-bit up/down counter. It counts up when UP rises while DOWN is
+// high and down when DOWN rises while UP is high. CLR high clears it and LOAD
+// low loads it at once. CO goes low at 15 while UP is low and BO at 0 while
+// DOWN is low, so their rising edges clock the next counter.
+type ls193 struct {
+	q, next  int
+	up, down rising
+}
+
+func (m *ls193) eval(p *part) {
+	switch true {
+	case p.in(ls193CLR):
+		m.q = 0
+	case !p.in(ls193LOAD):
+		m.q = p.bits(pins(ls193D, 4)...)
+	}
+	p.outBits(m.q, pins(ls193Q, 4)...)
+	p.out(ls193CO, !(0xF == m.q && !p.in(ls193UP)))
+	p.out(ls193BO, !(0 == m.q && !p.in(ls193DOWN)))
+}
+
+func (m *ls193) edge(p *part) bool {
+	up := m.up.edge(p.in(ls193UP))
+	down := m.down.edge(p.in(ls193DOWN))
+	if p.in(ls193CLR) || !p.in(ls193LOAD) {
+		return false
+	}
+	switch true {
+	case up && p.in(ls193DOWN):
+		m.next = (m.q + 1) & 0xF
+	case down && p.in(ls193UP):
+		m.next = (m.q - 1) & 0xF
+	default:
+		return false
+	}
+	return true
+}
+
+func (m *ls193) commit()        { m.q = m.next }
+func (m *ls193) value() int     { return m.q }
+func (m *ls193) setValue(v int) { m.q = v & 0xF }
+
+// 74LS245 pin indexes
+const (
+	ls245DIR = iota
+	ls245OE
+	ls245A
+	ls245B = ls245A + 8
+)
+
+// ls245 is a bus transceiver. While OE is low it drives B from A if DIR is
+// high and A from B if DIR is low.
+type ls245 struct{}
+
+func (m *ls245) eval(p *part) {
+	if p.in(ls245OE) {
+		p.float(pins(ls245A, 16)...)
+		return
+	}
+	from, to := ls245A, ls245B
+	if !p.in(ls245DIR) {
+		from, to = ls245B, ls245A
+	}
+	p.float(pins(from, 8)...)
+	for k := 0; k < 8; k++ {
+		p.begin()
+		p.out(to+k, p.in(from+k))
+	}
+}
+
+// 74LS283 pin indexes
+const (
+	ls283C0 = iota
+	ls283C4
+	ls283A
+	ls283B = ls283A + 4
+	ls283S = ls283B + 4
+)
+
+// ls283 is a 4-bit adder, S = A + B + C0 with carry out C4.
+type ls283 struct{}
+
+func (m *ls283) eval(p *part) {
+	sum := p.bits(pins(ls283A, 4)...) + p.bits(pins(ls283B, 4)...)
+	if p.in(ls283C0) {
+		sum++
+	}
+	p.outBits(sum, pins(ls283S, 4)...)
+	p.out(ls283C4, sum > 0xF)
+}
+
+// 74LS189 pin indexes
+const (
+	ls189CS = iota
+	ls189WE
+	ls189A
+	ls189D = ls189A + 4
+	ls189Q = ls189D + 4
+)
+
+// ls189 is a 16x4 RAM. While CS is low it writes D while WE is low, and
+// otherwise drives the complement of the addressed cell on Q.
+type ls189 struct {
+	mem [16]byte
+}
+
+func (m *ls189) eval(p *part) {
+	if p.in(ls189CS) || !p.in(ls189WE) {
+		p.float(pins(ls189Q, 4)...)
+		return
+	}
+	p.outBits(int(^m.mem[p.bits(pins(ls189A, 4)...)]), pins(ls189Q, 4)...)
+}
+
+func (m *ls189) write(p *part) bool {
+	if p.in(ls189CS) || p.in(ls189WE) {
+		return false
+	}
+	addr := p.dataBits(pins(ls189A, 4)...)
+	v := byte(p.dataBits(pins(ls189D, 4)...))
+	if m.mem[addr] == v {
+		return false
+	}
+	m.mem[addr] = v
+	return true
+}
+
+func (m *ls189) cells() []byte { return m.mem[:] }
+
+// EEPROM pin indexes
+const (
+	eepromCE = iota
+	eepromOE
+	eepromWE
+	eepromD
+	eepromA = eepromD + 8
+)
+
+// eeprom is a parallel EEPROM. It drives the addressed byte while CE and OE
+// are low and WE is high. Writes are not modelled, images are loaded before
+// the simulation starts as they are burned with bcc flash.
+type eeprom struct {
+	width int
+	mem   []byte
+}
+
+// newEEPROM returns an erased EEPROM with width address lines.
+func newEEPROM(width int) *eeprom {
+	m := &eeprom{width: width, mem: make([]byte, 1<<uint(width))}
+	for k := range m.mem {
+		m.mem[k] = 0xFF
+	}
+	return m
+}
+
+func (m *eeprom) eval(p *part) {
+	if p.in(eepromCE) || p.in(eepromOE) || !p.in(eepromWE) {
+		p.float(pins(eepromD, 8)...)
+		return
+	}
+	p.outBits(int(m.mem[p.bits(pins(eepromA, m.width)...)]), pins(eepromD, 8)...)
+}
+
+func (m *eeprom) cells() []byte { return m.mem }
+
+// gates is a package of identical gates whose pins are listed gate by gate,
+// inputs then output.
+type gates struct {
+	inputs int
+	fn     func(in []bool) bool
+}
+
+func (m *gates) eval(p *part) {
+	in := make([]bool, m.inputs)
+	for first := 0; first < len(p.nets); first += m.inputs + 1 {
+		p.begin()
+		for k := range in {
+			in[k] = p.in(first + k)
+		}
+		p.out(first+m.inputs, m.fn(in))
+	}
+}
@@ -0,0 +1,384 @@
+package chip
+
+import (
+	"strings"
+)
+
+// Reference is the netlist of the reference build, see Netlist for the
+// format. bcc sim -netlist prints it as a starting point for wiring changes.
+const Reference = `# Reference build of the 8-bit computer.
+#
+# Control nets are named after the signals the decoder ROMs drive and NAME_N
+# nets carry their active low complement. Registers load on the rising edge
+# of CLK; the step counter advances on the falling edge, so the control
+# signals hold still while CLK is high and RAM writes then.
+
+# clock module: CLK is CLOCK gated by HLT
+part INV1 74LS04
+part AND1 74LS08
+net CLOCK   AND1.A0
+net HLT_N   INV1.Y0 AND1.B0
+net CLK     AND1.Y0 INV1.A1
+net CLK_N   INV1.Y1
+
+# reset: the button or RST while CLK is high clears the registers, RST also
+# sets IE so the step counter restarts on its own
+part OR1 74LS32
+part OR2 74LS32
+net RSTCLK  AND1.Y1 OR1.B0
+net CLK     AND1.A1
+net RESET   OR1.A0 INV1.A2 OR2.A3
+net RESET_N INV1.Y2
+net CLEAR   OR1.Y0 OR1.A1 OR1.A2 OR1.A3 OR2.A0 OR2.A1 OR2.A2
+net PCCLR   OR1.Y1 INV1.A3
+net PCCLR_N INV1.Y3
+net MARCLR  OR1.Y2
+net ACLR    OR1.Y3
+net XCLR    OR2.Y0
+net YCLR    OR2.Y1
+net RARCLR  OR2.Y2
+net IRCLR   OR2.Y3
+net IE_N    INV1.Y4
+net JMP_N   INV1.Y5
+
+# instruction decoder: the step counter drives A0-A3 and the instruction
+# register A4-A10 of five 28C16s, 8 control signals each
+part STEP 74LS161
+part UC0 28C16
+part UC1 28C16
+part UC2 28C16
+part UC3 28C16
+part UC4 28C16
+net CLK_N   STEP.CLK
+net RESET_N STEP.CLR
+net VCC     STEP.ENP STEP.ENT
+net GND     STEP.D[0:3]
+net IE_N    STEP.LOAD
+net T[0:3]  STEP.Q[0:3] UC0.A[0:3] UC1.A[0:3] UC2.A[0:3] UC3.A[0:3] UC4.A[0:3]
+net OP[0:6] UC0.A[4:10] UC1.A[4:10] UC2.A[4:10] UC3.A[4:10] UC4.A[4:10]
+net GND     UC0.CE UC0.OE UC1.CE UC1.OE UC2.CE UC2.OE UC3.CE UC3.OE UC4.CE UC4.OE
+net VCC     UC0.WE UC1.WE UC2.WE UC3.WE UC4.WE
+net HLT     UC0.D0 INV1.A0
+net RST     UC0.D1 AND1.B1
+net PCE     UC0.D2
+net PCR     UC0.D3 OR1.B1
+net JMP     UC0.D4 INV1.A5
+net PCO     UC0.D5
+net RORR    UC0.D6 OR1.B2
+net RORI    UC0.D7
+net RORO    UC1.D0
+net ROMI0   UC1.D1
+net ROMI1   UC1.D2
+net ROMO    UC1.D3
+net IR      UC1.D4 OR2.B3
+net IE      UC1.D5 INV1.A4
+net II      UC1.D6
+net AE      UC1.D7
+net SUB     UC2.D0
+net ARR     UC2.D1 OR1.B3
+net ARI     UC2.D2
+net ARO     UC2.D3
+net XRR     UC2.D4 OR2.B0
+net XRI     UC2.D5
+net XRO     UC2.D6
+net YRR     UC2.D7 OR2.B1
+net YRI     UC3.D0
+net YRO     UC3.D1
+net RARR    UC3.D2 OR2.B2
+net RARI    UC3.D3
+net RARO    UC3.D4
+net RAMI    UC3.D5
+net RAMO    UC3.D6
+net OUT     UC3.D7
+net STI     UC4.D0
+net STO     UC4.D1
+net STD     UC4.D2
+
+# active low enables
+part INV2 74LS04
+part INV3 74LS04
+part INV4 74LS04
+net PCO     INV2.A0
+net PCO_N   INV2.Y0
+net RORO    INV2.A1
+net RORO_N  INV2.Y1
+net ROMO    INV2.A2
+net ROMO_N  INV2.Y2
+net ARO     INV2.A3
+net ARO_N   INV2.Y3
+net XRO     INV2.A4
+net XRO_N   INV2.Y4
+net YRO     INV2.A5
+net YRO_N   INV2.Y5
+net RARO    INV3.A0
+net RARO_N  INV3.Y0
+net RAMO    INV3.A1
+net RAMO_N  INV3.Y1
+net STO     INV3.A2
+net STO_N   INV3.Y2
+net RORI    INV3.A3
+net RORI_N  INV3.Y3
+net II      INV3.A4
+net II_N    INV3.Y4
+net XRI     INV4.A0
+net XRI_N   INV4.Y0
+net YRI     INV4.A1
+net YRI_N   INV4.Y1
+net RARI    INV4.A2
+net RARI_N  INV4.Y2
+net OUT     INV4.A3
+net OUT_N   INV4.Y3
+net AE      INV4.A4
+net AE_N    INV4.Y4
+
+# bus, pulled low
+bus BUS[0:7]
+pull down BUS[0:7]
+
+# program counter
+part PC_LO 74LS161
+part PC_HI 74LS161
+part PC_BUF 74LS245
+net CLK     PC_LO.CLK PC_HI.CLK
+net PCCLR_N PC_LO.CLR PC_HI.CLR
+net JMP_N   PC_LO.LOAD PC_HI.LOAD
+net PCE     PC_LO.ENP PC_LO.ENT PC_HI.ENP
+net PC_RCO  PC_LO.RCO PC_HI.ENT
+net BUS[0:3] PC_LO.D[0:3]
+net BUS[4:7] PC_HI.D[0:3]
+net PC[0:3] PC_LO.Q[0:3] PC_BUF.A[0:3]
+net PC[4:7] PC_HI.Q[0:3] PC_BUF.A[4:7]
+net BUS[0:7] PC_BUF.B[0:7]
+net VCC     PC_BUF.DIR
+net PCO_N   PC_BUF.OE
+
+# ROM address register and program ROM
+part MAR_LO 74LS173
+part MAR_HI 74LS173
+part MAR_BUF 74LS245
+part PROG 28C256
+net CLK     MAR_LO.CLK MAR_HI.CLK
+net MARCLR  MAR_LO.CLR MAR_HI.CLR
+net GND     MAR_LO.M MAR_LO.N MAR_HI.M MAR_HI.N MAR_LO.G2 MAR_HI.G2
+net RORI_N  MAR_LO.G1 MAR_HI.G1
+net BUS[0:3] MAR_LO.D[0:3]
+net BUS[4:7] MAR_HI.D[0:3]
+net MA[0:3] MAR_LO.Q[0:3] MAR_BUF.A[0:3] PROG.A[0:3]
+net MA[4:7] MAR_HI.Q[0:3] MAR_BUF.A[4:7] PROG.A[4:7]
+net BUS[0:7] MAR_BUF.B[0:7]
+net VCC     MAR_BUF.DIR
+net RORO_N  MAR_BUF.OE
+net GND     PROG.A[8:14] PROG.CE
+net ROMO_N  PROG.OE
+net VCC     PROG.WE
+net BUS[0:7] PROG.D[0:7]
+
+# instruction register, the opcode drives the decoder
+part IR_LO 74LS173
+part IR_HI 74LS173
+net CLK     IR_LO.CLK IR_HI.CLK
+net IRCLR   IR_LO.CLR IR_HI.CLR
+net GND     IR_LO.M IR_LO.N IR_HI.M IR_HI.N IR_LO.G2 IR_HI.G2
+net II_N    IR_LO.G1 IR_HI.G1
+net BUS[0:3] IR_LO.D[0:3]
+net BUS[4:7] IR_HI.D[0:3]
+net OP[0:3] IR_LO.Q[0:3]
+net OP[4:6] IR_HI.Q[0:2]
+
+# register A and the ALU: A loads A + BUS on AE, and BUS on ARI, where the
+# A side of the adder is held at 0
+part A_LO 74LS173
+part A_HI 74LS173
+part A_BUF 74LS245
+part AGATE_LO 74LS08
+part AGATE_HI 74LS08
+part BXOR_LO 74LS86
+part BXOR_HI 74LS86
+part ALU_LO 74LS283
+part ALU_HI 74LS283
+part OR3 74LS32
+net ARI     OR3.A0
+net AE      OR3.B0
+net ALOAD   OR3.Y0 INV3.A5
+net ALOAD_N INV3.Y5
+net CLK     A_LO.CLK A_HI.CLK
+net ACLR    A_LO.CLR A_HI.CLR
+net GND     A_LO.M A_LO.N A_HI.M A_HI.N A_LO.G2 A_HI.G2
+net ALOAD_N A_LO.G1 A_HI.G1
+net SUM[0:3] A_LO.D[0:3]
+net SUM[4:7] A_HI.D[0:3]
+net A[0:3]  A_LO.Q[0:3] A_BUF.A[0:3] AGATE_LO.A[0:3]
+net A[4:7]  A_HI.Q[0:3] A_BUF.A[4:7] AGATE_HI.A[0:3]
+net BUS[0:7] A_BUF.B[0:7]
+net VCC     A_BUF.DIR
+net ARO_N   A_BUF.OE
+net AE      AGATE_LO.B[0:3] AGATE_HI.B[0:3]
+net AA[0:3] AGATE_LO.Y[0:3] ALU_LO.A[0:3]
+net AA[4:7] AGATE_HI.Y[0:3] ALU_HI.A[0:3]
+net BUS[0:3] BXOR_LO.A[0:3]
+net BUS[4:7] BXOR_HI.A[0:3]
+net SUB     BXOR_LO.B[0:3] BXOR_HI.B[0:3] ALU_LO.C0
+net BB[0:3] BXOR_LO.Y[0:3] ALU_LO.B[0:3]
+net BB[4:7] BXOR_HI.Y[0:3] ALU_HI.B[0:3]
+net SUM[0:3] ALU_LO.S[0:3]
+net SUM[4:7] ALU_HI.S[0:3]
+net CARRY4  ALU_LO.C4 ALU_HI.C0
+net CARRY   ALU_HI.C4
+
+# flags, loaded on AE
+part FLAGS 74LS173
+part ZOR1 74LS32
+part ZOR2 74LS32
+net SUM0    ZOR1.A0
+net SUM1    ZOR1.B0
+net SUM2    ZOR1.A1
+net SUM3    ZOR1.B1
+net SUM4    ZOR1.A2
+net SUM5    ZOR1.B2
+net SUM6    ZOR1.A3
+net SUM7    ZOR1.B3
+net Z01     ZOR1.Y0 ZOR2.A0
+net Z23     ZOR1.Y1 ZOR2.B0
+net Z45     ZOR1.Y2 ZOR2.A1
+net Z67     ZOR1.Y3 ZOR2.B1
+net Z03     ZOR2.Y0 ZOR2.A2
+net Z47     ZOR2.Y1 ZOR2.B2
+net NZ      ZOR2.Y2 INV4.A5
+net ZERO    INV4.Y5
+net CLK     FLAGS.CLK
+net CLEAR   FLAGS.CLR
+net GND     FLAGS.M FLAGS.N FLAGS.G2 FLAGS.D2 FLAGS.D3
+net AE_N    FLAGS.G1
+net CARRY   FLAGS.D0
+net ZERO    FLAGS.D1
+
+# registers X and Y drive the bus from their own tri-state outputs
+part X_LO 74LS173
+part X_HI 74LS173
+part Y_LO 74LS173
+part Y_HI 74LS173
+net CLK     X_LO.CLK X_HI.CLK Y_LO.CLK Y_HI.CLK
+net XCLR    X_LO.CLR X_HI.CLR
+net YCLR    Y_LO.CLR Y_HI.CLR
+net GND     X_LO.N X_HI.N X_LO.G2 X_HI.G2 Y_LO.N Y_HI.N Y_LO.G2 Y_HI.G2
+net XRO_N   X_LO.M X_HI.M
+net YRO_N   Y_LO.M Y_HI.M
+net XRI_N   X_LO.G1 X_HI.G1
+net YRI_N   Y_LO.G1 Y_HI.G1
+net BUS[0:3] X_LO.D[0:3] X_LO.Q[0:3] Y_LO.D[0:3] Y_LO.Q[0:3]
+net BUS[4:7] X_HI.D[0:3] X_HI.Q[0:3] Y_HI.D[0:3] Y_HI.Q[0:3]
+
+# output register
+part OUT_LO 74LS173
+part OUT_HI 74LS173
+net CLK     OUT_LO.CLK OUT_HI.CLK
+net CLEAR   OUT_LO.CLR OUT_HI.CLR
+net GND     OUT_LO.M OUT_LO.N OUT_HI.M OUT_HI.N OUT_LO.G2 OUT_HI.G2
+net OUT_N   OUT_LO.G1 OUT_HI.G1
+net BUS[0:3] OUT_LO.D[0:3]
+net BUS[4:7] OUT_HI.D[0:3]
+net DISPLAY[0:3] OUT_LO.Q[0:3]
+net DISPLAY[4:7] OUT_HI.Q[0:3]
+
+# RAM: a 4-bit address register and two 74LS189s written while CLK is high,
+# their inverted outputs inverted back onto the bus
+part RAR 74LS173
+part RAR_BUF 74LS245
+part RAM_LO 74LS189
+part RAM_HI 74LS189
+part RAM_INV_LO 74LS04
+part RAM_INV_HI 74LS04
+part RAM_BUF 74LS245
+part NAND1 74LS00
+net CLK     RAR.CLK
+net RARCLR  RAR.CLR
+net GND     RAR.M RAR.N RAR.G2
+net RARI_N  RAR.G1
+net BUS[0:3] RAR.D[0:3]
+net RA[0:3] RAR.Q[0:3] RAR_BUF.A[0:3] RAM_LO.A[0:3] RAM_HI.A[0:3]
+net GND     RAR_BUF.A[4:7]
+net BUS[0:7] RAR_BUF.B[0:7]
+net VCC     RAR_BUF.DIR
+net RARO_N  RAR_BUF.OE
+net RAMI    NAND1.A0
+net CLK     NAND1.B0
+net RAM_WE  NAND1.Y0 RAM_LO.WE RAM_HI.WE
+net GND     RAM_LO.CS RAM_HI.CS
+net BUS[0:3] RAM_LO.D[0:3]
+net BUS[4:7] RAM_HI.D[0:3]
+net RQ[0:3] RAM_LO.Q[0:3] RAM_INV_LO.A[0:3]
+net RQ[4:7] RAM_HI.Q[0:3] RAM_INV_HI.A[0:3]
+net RD[0:3] RAM_INV_LO.Y[0:3] RAM_BUF.A[0:3]
+net RD[4:7] RAM_INV_HI.Y[0:3] RAM_BUF.A[4:7]
+net BUS[0:7] RAM_BUF.B[0:7]
+net VCC     RAM_BUF.DIR
+net RAMO_N  RAM_BUF.OE
+
+# stack: the stack pointer counts the bytes on the stack, on the falling
+# edge of CLK. A push writes at the stack pointer while CLK is high; any
+# other step addresses the top, one below, by adding 15.
+part SP_LO 74LS193
+part SP_HI 74LS193
+part STK_ADDR 74LS283
+part STK_LO 74LS189
+part STK_HI 74LS189
+part STK_INV_LO 74LS04
+part STK_INV_HI 74LS04
+part STK_BUF 74LS245
+part INV5 74LS04
+net STI     NAND1.A1 INV5.A0
+net CLK     NAND1.B1 NAND1.B2
+net STD     NAND1.A2
+net STI_N   INV5.Y0 STK_ADDR.B[0:3]
+net STK_UP  NAND1.Y1 SP_LO.UP STK_LO.WE STK_HI.WE
+net STK_DOWN NAND1.Y2 SP_LO.DOWN
+net SP_CO   SP_LO.CO SP_HI.UP
+net SP_BO   SP_LO.BO SP_HI.DOWN
+net CLEAR   SP_LO.CLR SP_HI.CLR
+net VCC     SP_LO.LOAD SP_HI.LOAD
+net GND     SP_LO.D[0:3] SP_HI.D[0:3]
+net SP[0:3] SP_LO.Q[0:3] STK_ADDR.A[0:3]
+net SP[4:7] SP_HI.Q[0:3]
+net GND     STK_ADDR.C0
+net SA[0:3] STK_ADDR.S[0:3] STK_LO.A[0:3] STK_HI.A[0:3]
+net GND     STK_LO.CS STK_HI.CS
+net BUS[0:3] STK_LO.D[0:3]
+net BUS[4:7] STK_HI.D[0:3]
+net SQ[0:3] STK_LO.Q[0:3] STK_INV_LO.A[0:3]
+net SQ[4:7] STK_HI.Q[0:3] STK_INV_HI.A[0:3]
+net SD[0:3] STK_INV_LO.Y[0:3] STK_BUF.A[0:3]
+net SD[4:7] STK_INV_HI.Y[0:3] STK_BUF.A[4:7]
+net BUS[0:7] STK_BUF.B[0:7]
+net VCC     STK_BUF.DIR
+net STO_N   STK_BUF.OE
+
+probe A     A_LO A_HI
+probe X     X_LO X_HI
+probe Y     Y_LO Y_HI
+probe OUT   OUT_LO OUT_HI
+probe PC    PC_LO PC_HI
+probe MAR   MAR_LO MAR_HI
+probe RAR   RAR
+probe IR    IR_LO IR_HI
+probe STEP  STEP
+probe FLAGS FLAGS
+probe SP    SP_LO SP_HI
+probe RAM   RAM_LO RAM_HI
+probe STACK STK_LO STK_HI
+
+rom PROG program
+rom UC0 decoder 0
+rom UC1 decoder 1
+rom UC2 decoder 2
+rom UC3 decoder 3
+rom UC4 decoder 4
+`
+
+// ReferenceNetlist returns the parsed reference netlist.
+func ReferenceNetlist() *Netlist {
+	nl, err := ParseNetlist(strings.NewReader(Reference))
+	if nil != err {
+		panic(err)
+	}
+	return nl
+}
@@ -0,0 +1,574 @@
+package chip
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/emu"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/ucode"
+
+	"github.com/bdlm/errors/v2"
+)
+
+const (
+	// SettleLimit is the number of times parts may be re-evaluated while the
+	// nets settle before they are taken to oscillate.
+	SettleLimit = 1000
+
+	// EdgeLimit is the number of rounds of clocked parts a clock edge may
+	// cause, as when one counter clocks the next.
+	EdgeLimit = 64
+)
+
+// Issue kinds.
+const (
+	ISSUE_FLOATING   = "floating"
+	ISSUE_CONTENTION = "contention"
+)
+
+// Checks describes each kind of issue the simulation reports.
+var Checks = map[string]string{
+	ISSUE_FLOATING:   "a part stored a value read from a net nothing drives",
+	ISSUE_CONTENTION: "more than one output drove a net once it settled",
+}
+
+// Issue is a wiring fault found while the simulation ran.
+type Issue struct {
+	Kind string
+	// the floating net, or the net driven more than once
+	Net string
+	// the pins that stored the floating value, or the pins driving the net
+	Pins []string
+	// where it first happened
+	Cycle uint64
+	Addr  byte
+	Step  byte
+	// number of cycles it happened in
+	Count int
+
+	last uint64
+}
+
+// String implements Stringer.
+func (issue *Issue) String() string {
+	what := fmt.Sprintf("%s floating, stored by %s", issue.Net, strings.Join(issue.Pins, ", "))
+	switch true {
+	case ISSUE_CONTENTION == issue.Kind:
+		what = fmt.Sprintf("contention on %s, driven by %s", issue.Net, strings.Join(issue.Pins, ", "))
+	case strings.Contains(issue.Net, "."):
+		// an input with nothing connected to it
+		what = fmt.Sprintf("%s unconnected, stored by %s", issue.Net, strings.Join(issue.Pins, ", "))
+	}
+	times := ""
+	if issue.Count > 1 {
+		times = fmt.Sprintf(", %d cycles", issue.Count)
+	}
+	return fmt.Sprintf("cycle %d, 0x%02X step %d: %s (%s%s)", issue.Cycle, issue.Addr, issue.Step, what, issue.Kind, times)
+}
+
+// control is a net carrying a control signal.
+type control struct {
+	sig ucode.Signal
+	net *net
+}
+
+// Sim simulates a netlist. It implements emu.CPU, so the clock module model,
+// the front panel and tracing drive it as they do the emulator; one Tick is a
+// full clock cycle, the rising edge and then the falling edge.
+type Sim struct {
+	parts []*part
+	nets  map[string]*net
+	// nets in the order they were declared
+	order   []*net
+	clocked []*part
+	writers []*part
+	dirty   []*part
+
+	clock, reset *net
+	bus          []*net
+	control      []control
+	probes       map[string][]*part
+
+	// the fields the machine does not hold in registers
+	state emu.State
+	// step counter at the start of the current cycle
+	step   byte
+	err    error
+	issues []*Issue
+	seen   map[string]*Issue
+}
+
+// New wires the parts of a netlist and loads the program image and decoder
+// ROM images into the EEPROMs the netlist names for them, then resets the
+// machine.
+func New(nl *Netlist, program []byte, decoder [][]byte) (*Sim, error) {
+	sim := &Sim{
+		nets:   map[string]*net{},
+		probes: map[string][]*part{},
+		seen:   map[string]*Issue{},
+	}
+
+	parts := map[string]*part{}
+	for _, decl := range nl.Parts {
+		spec := Parts[decl.Type]
+		p := &part{
+			name:  decl.Name,
+			spec:  spec,
+			model: spec.new(),
+			sim:   sim,
+			nets:  make([]*net, len(spec.pins)),
+			drive: make([]Level, len(spec.pins)),
+			taint: make([]string, len(spec.pins)),
+		}
+		for pin := range p.drive {
+			p.drive[pin] = FLOAT
+		}
+		parts[decl.Name] = p
+		sim.parts = append(sim.parts, p)
+		if _, ok := p.model.(clocked); ok {
+			sim.clocked = append(sim.clocked, p)
+		}
+		if _, ok := p.model.(writer); ok {
+			sim.writers = append(sim.writers, p)
+		}
+	}
+
+	sources := []string{NET_VCC, NET_GND, NET_CLOCK, NET_RESET}
+	for _, name := range sources {
+		sim.nets[name] = &net{name: name, pull: FLOAT, source: levelOf(NET_VCC == name)}
+		sim.order = append(sim.order, sim.nets[name])
+	}
+	for _, decl := range nl.Nets {
+		n, ok := sim.nets[decl.Name]
+		if !ok {
+			n = &net{name: decl.Name, pull: FLOAT, source: FLOAT}
+			sim.nets[decl.Name] = n
+			sim.order = append(sim.order, n)
+		}
+		for _, ref := range decl.Pins {
+			dot := strings.Index(ref, ".")
+			p := parts[ref[:dot]]
+			pin, _ := p.spec.pin(ref[dot+1:])
+			p.nets[pin] = n
+			n.pins = append(n.pins, pinRef{p, pin})
+			if 0 == len(n.readers) || p != n.readers[len(n.readers)-1] {
+				n.readers = append(n.readers, p)
+			}
+		}
+	}
+	for name, level := range nl.Pulls {
+		n, ok := sim.nets[name]
+		if !ok {
+			return nil, errors.Errorf("pull resistor on unknown net '%s'", name)
+		}
+		n.pull = level
+	}
+	for _, name := range nl.Bus {
+		n, ok := sim.nets[name]
+		if !ok {
+			return nil, errors.Errorf("unknown bus net '%s'", name)
+		}
+		sim.bus = append(sim.bus, n)
+	}
+	for _, sig := range ucode.Signals {
+		if n, ok := sim.nets[sig.Name()]; ok {
+			sim.control = append(sim.control, control{sig, n})
+		}
+	}
+	sim.clock, sim.reset = sim.nets[NET_CLOCK], sim.nets[NET_RESET]
+
+	for name, names := range nl.Probes {
+		for _, partName := range names {
+			p := parts[partName]
+			_, isMem := p.model.(*ls189)
+			_, isReg := p.model.(register)
+			switch true {
+			case ("RAM" == name || "STACK" == name) && !isMem:
+				return nil, errors.Errorf("probe %s: %s is a %s, expected a 74LS189", name, partName, p.spec.Name)
+			case "RAM" != name && "STACK" != name && !isReg:
+				return nil, errors.Errorf("probe %s: %s is a %s, which holds no register", name, partName, p.spec.Name)
+			}
+			sim.probes[name] = append(sim.probes[name], p)
+		}
+	}
+
+	for _, rom := range nl.ROMs {
+		cells := parts[rom.Part].model.(memory).cells()
+		img := program
+		if ROM_DECODER == rom.Role {
+			if rom.Index >= len(decoder) {
+				return nil, errors.Errorf("%s is decoder ROM %d, %d decoder images given", rom.Part, rom.Index, len(decoder))
+			}
+			img = decoder[rom.Index]
+		}
+		if len(bytes.TrimRight(img, "\xff")) > len(cells) {
+			return nil, errors.Errorf("%s ROM image does not fit in %s, a %s", rom.Role, rom.Part, parts[rom.Part].spec.Name)
+		}
+		copy(cells, img)
+	}
+
+	// Drive every output before the nets resolve, so no net starts out
+	// floating only because its driver has not been evaluated yet. A floating
+	// level that reached a loop such as the decoder and the instruction
+	// register would otherwise circle it forever.
+	for _, name := range sources {
+		sim.nets[name].resolve()
+	}
+	for _, p := range sim.parts {
+		p.evaluate(nil)
+		sim.touch(p)
+	}
+	for _, n := range sim.order {
+		n.resolve()
+	}
+	err := sim.settle()
+	if nil != err {
+		return nil, err
+	}
+	for _, p := range sim.clocked {
+		p.model.(clocked).edge(p)
+	}
+	sim.Reset()
+	if nil != sim.err {
+		return nil, sim.err
+	}
+	return sim, nil
+}
+
+// touch schedules a part for evaluation.
+func (sim *Sim) touch(p *part) {
+	if !p.dirty {
+		p.dirty = true
+		sim.dirty = append(sim.dirty, p)
+	}
+}
+
+// settle evaluates parts until no net changes.
+func (sim *Sim) settle() error {
+	changed := []*net{}
+	for round := 0; 0 < len(sim.dirty); round++ {
+		if round > SettleLimit {
+			return errors.Errorf("nets do not settle, %s oscillates", changed[0].name)
+		}
+		parts := sim.dirty
+		sim.dirty = nil
+		changed = changed[:0]
+		for _, p := range parts {
+			p.dirty = false
+			changed = p.evaluate(changed)
+		}
+		for _, n := range changed {
+			if n.resolve() {
+				for _, p := range n.readers {
+					sim.touch(p)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// propagate settles the nets, clocks the parts whose clock inputs changed and
+// repeats until nothing changes, then stores the writes the settled nets
+// hold.
+func (sim *Sim) propagate() error {
+	for round := 0; ; round++ {
+		if round > EdgeLimit {
+			return errors.Errorf("clocked parts keep changing after %d rounds", EdgeLimit)
+		}
+		err := sim.settle()
+		if nil != err {
+			return err
+		}
+		fired := []*part{}
+		for _, p := range sim.clocked {
+			if p.model.(clocked).edge(p) {
+				fired = append(fired, p)
+			}
+		}
+		for _, p := range fired {
+			p.model.(clocked).commit()
+			sim.touch(p)
+		}
+		if 0 < len(fired) {
+			continue
+		}
+		wrote := false
+		for _, p := range sim.writers {
+			if p.model.(writer).write(p) {
+				wrote = true
+				sim.touch(p)
+			}
+		}
+		if !wrote {
+			return nil
+		}
+	}
+}
+
+// drive sets the level of a simulator driven net and propagates it.
+func (sim *Sim) drive(n *net, level Level) error {
+	n.source = level
+	if n.resolve() {
+		for _, p := range n.readers {
+			sim.touch(p)
+		}
+	}
+	return sim.propagate()
+}
+
+// signals returns the control signals the decoder drives.
+func (sim *Sim) signals() ucode.Signal {
+	sig := ucode.Signal(0)
+	for _, c := range sim.control {
+		if HIGH == c.net.level {
+			sig |= c.sig
+		}
+	}
+	return sig
+}
+
+// busValue returns the value on the bus, reading undriven lines as their pull
+// resistors hold them.
+func (sim *Sim) busValue() byte {
+	v := byte(0)
+	for bit, n := range sim.bus {
+		level := n.level
+		if FLOAT == level {
+			level = n.pull
+		}
+		if HIGH == level {
+			v |= 1 << uint(bit)
+		}
+	}
+	return v
+}
+
+// Tick runs one clock cycle. As in the emulator, a cycle whose control
+// signals include HLT halts the machine instead.
+func (sim *Sim) Tick() error {
+	if nil != sim.err {
+		return sim.err
+	}
+	if sim.state.Halted {
+		return nil
+	}
+	sig := sim.signals()
+	sim.state.Signals = sig
+	sim.state.Bus = sim.busValue()
+	if 0 != sig&ucode.HLT {
+		sim.state.Halted = true
+		return nil
+	}
+	if 0 != sig&ucode.II {
+		sim.state.Addr = byte(sim.probe("MAR"))
+	}
+	sim.state.Cycle++
+	sim.step = byte(sim.probe("STEP"))
+
+	for _, level := range []Level{HIGH, LOW} {
+		err := sim.drive(sim.clock, level)
+		if nil != err {
+			sim.err = errors.Wrap(err, "cycle %d: %s", sim.state.Cycle, err)
+			return sim.err
+		}
+		sim.contention()
+	}
+	return nil
+}
+
+// Step runs clock cycles until the current instruction completes or the
+// machine halts.
+func (sim *Sim) Step() error {
+	for {
+		err := sim.Tick()
+		if nil != err {
+			return err
+		}
+		if 0 == sim.probe("STEP") || sim.state.Halted {
+			return nil
+		}
+	}
+}
+
+// Reset presses the reset button. Unlike the emulator's reset it leaves the
+// RAM as it is, as the hardware does.
+func (sim *Sim) Reset() {
+	sim.state = emu.State{Stack: []byte{}}
+	for _, level := range []Level{HIGH, LOW} {
+		if err := sim.drive(sim.reset, level); nil != err {
+			sim.err = errors.Wrap(err, "reset: %s", err)
+			return
+		}
+	}
+}
+
+// State returns a snapshot of the machine read from the probed parts.
+// Registers without a probe read as 0.
+func (sim *Sim) State() emu.State {
+	state := sim.state
+	state.A = byte(sim.probe("A"))
+	state.X = byte(sim.probe("X"))
+	state.Y = byte(sim.probe("Y"))
+	state.Out = byte(sim.probe("OUT"))
+	state.PC = byte(sim.probe("PC"))
+	state.MAR = byte(sim.probe("MAR"))
+	state.RAR = byte(sim.probe("RAR"))
+	state.IR = byte(sim.probe("IR"))
+	state.Step = byte(sim.probe("STEP"))
+	flags := sim.probe("FLAGS")
+	state.Carry = 0 != flags&1
+	state.Zero = 0 != flags&2
+	copy(state.RAM[:], sim.cells("RAM"))
+	stack := sim.cells("STACK")
+	depth := sim.probe("SP")
+	if depth > len(stack) {
+		depth = len(stack)
+	}
+	state.Stack = append([]byte{}, stack[:depth]...)
+	return state
+}
+
+// SetState loads the probed parts from a snapshot, as if set from the front
+// panel.
+func (sim *Sim) SetState(state emu.State) {
+	sim.state.Cycle = state.Cycle
+	sim.state.Signals = state.Signals
+	sim.state.Bus = state.Bus
+	sim.state.Halted = state.Halted
+	sim.state.Addr = state.Addr
+	sim.setProbe("A", int(state.A))
+	sim.setProbe("X", int(state.X))
+	sim.setProbe("Y", int(state.Y))
+	sim.setProbe("OUT", int(state.Out))
+	sim.setProbe("PC", int(state.PC))
+	sim.setProbe("MAR", int(state.MAR))
+	sim.setProbe("RAR", int(state.RAR))
+	sim.setProbe("IR", int(state.IR))
+	sim.setProbe("STEP", int(state.Step))
+	flags := 0
+	if state.Carry {
+		flags |= 1
+	}
+	if state.Zero {
+		flags |= 2
+	}
+	sim.setProbe("FLAGS", flags)
+	sim.setCells("RAM", state.RAM[:])
+	sim.setCells("STACK", state.Stack)
+	sim.setProbe("SP", len(state.Stack))
+
+	for _, p := range sim.parts {
+		sim.touch(p)
+	}
+	if err := sim.settle(); nil != err {
+		sim.err = err
+		return
+	}
+	for _, p := range sim.clocked {
+		p.model.(clocked).edge(p)
+	}
+}
+
+// Issues returns the wiring faults found so far, in the order they were
+// first seen.
+func (sim *Sim) Issues() []*Issue {
+	return sim.issues
+}
+
+// probe returns the value of a register, the parts holding a nibble each.
+func (sim *Sim) probe(name string) int {
+	v := 0
+	for k, p := range sim.probes[name] {
+		v |= p.model.(register).value() << uint(4*k)
+	}
+	return v
+}
+
+// setProbe loads a register.
+func (sim *Sim) setProbe(name string, v int) {
+	for k, p := range sim.probes[name] {
+		p.model.(register).setValue(v >> uint(4*k))
+	}
+}
+
+// cells returns the contents of a memory, the parts holding a nibble of each
+// byte.
+func (sim *Sim) cells(name string) []byte {
+	mem := []byte{}
+	for k, p := range sim.probes[name] {
+		cells := p.model.(memory).cells()
+		if 0 == k {
+			mem = make([]byte, len(cells))
+		}
+		for addr := range mem {
+			mem[addr] |= (cells[addr] & 0xF) << uint(4*k)
+		}
+	}
+	return mem
+}
+
+// setCells loads a memory from the first address, leaving the rest as it is.
+func (sim *Sim) setCells(name string, mem []byte) {
+	for k, p := range sim.probes[name] {
+		cells := p.model.(memory).cells()
+		for addr := 0; addr < len(mem) && addr < len(cells); addr++ {
+			cells[addr] = (mem[addr] >> uint(4*k)) & 0xF
+		}
+	}
+}
+
+// report records an issue, once per cycle.
+func (sim *Sim) report(kind, netName string, pins []string) {
+	key := kind + " " + netName
+	issue, ok := sim.seen[key]
+	if !ok {
+		issue = &Issue{
+			Kind:  kind,
+			Net:   netName,
+			Cycle: sim.state.Cycle,
+			Addr:  sim.state.Addr,
+			Step:  sim.step,
+		}
+		sim.seen[key] = issue
+		sim.issues = append(sim.issues, issue)
+	}
+	for _, pin := range pins {
+		found := false
+		for _, have := range issue.Pins {
+			found = found || have == pin
+		}
+		if !found {
+			issue.Pins = append(issue.Pins, pin)
+		}
+	}
+	if !ok || issue.last != sim.state.Cycle {
+		issue.Count++
+		issue.last = sim.state.Cycle
+	}
+}
+
+// floating reports a pin storing a value that derives from an undriven net.
+func (sim *Sim) floating(origin string, ref pinRef) {
+	sim.report(ISSUE_FLOATING, origin, []string{ref.String()})
+}
+
+// contention reports every settled net with more than one driver.
+func (sim *Sim) contention() {
+	for _, n := range sim.order {
+		if n.drivers < 2 {
+			continue
+		}
+		pins := []string{}
+		if FLOAT != n.source {
+			pins = append(pins, n.name)
+		}
+		for _, ref := range n.pins {
+			if FLOAT != ref.part.drive[ref.pin] {
+				pins = append(pins, ref.String())
+			}
+		}
+		sim.report(ISSUE_CONTENTION, n.name, pins)
+	}
+}
@@ -0,0 +1,65 @@
+// Package eeprom describes the parallel EEPROM parts the computer's ROMs are
+// burned to.
+package eeprom
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/bdlm/errors/v2"
+)
+
+// Part is an EEPROM part.
+type Part struct {
+	Name string
+	// capacity in bytes
+	Size int
+	// bytes written per page write cycle, 1 for byte writes only
+	PageSize int
+}
+
+// Parts lists the supported parts by name.
+var Parts = map[string]Part{
+	"28C16":  {Name: "28C16", Size: 2048, PageSize: 1},
+	"28C64":  {Name: "28C64", Size: 8192, PageSize: 64},
+	"28C256": {Name: "28C256", Size: 32768, PageSize: 64},
+}
+
+// Default is the part the program ROM is built for.
+const Default = "28C256"
+
+// Lookup returns a part by name. The manufacturer prefix (AT, CAT, X) is
+// optional.
+func Lookup(name string) (Part, error) {
+	key := strings.ToUpper(name)
+	for _, prefix := range []string{"AT", "CAT", "X"} {
+		if _, ok := Parts[strings.TrimPrefix(key, prefix)]; ok {
+			key = strings.TrimPrefix(key, prefix)
+			break
+		}
+	}
+	part, ok := Parts[key]
+	if !ok {
+		names := []string{}
+		for name := range Parts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return Part{}, errors.Errorf("unknown EEPROM part '%s', expected one of %s", name, strings.Join(names, ", "))
+	}
+	return part, nil
+}
+
+// Fit pads or truncates an image to the size of a part. Padding reads as
+// erased cells. It fails if program bytes would be cut off.
+func (part Part) Fit(img []byte, size int) ([]byte, error) {
+	if size > part.Size {
+		return nil, errors.Errorf("%d byte program does not fit in a %s (%d bytes)", size, part.Name, part.Size)
+	}
+	out := make([]byte, part.Size)
+	for k := range out {
+		out[k] = 0xFF
+	}
+	copy(out, img)
+	return out, nil
+}
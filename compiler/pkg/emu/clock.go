@@ -0,0 +1,228 @@
+package emu
+
+import (
+	"context"
+	"time"
+
+	"github.com/bdlm/errors/v2"
+)
+
+// ClockMode is the position of the clock module's mode select switch.
+type ClockMode string
+
+const (
+	// free running 555 astable circuit
+	CLOCK_ASTABLE ClockMode = "astable"
+	// debounced push button, one pulse per press
+	CLOCK_MANUAL ClockMode = "manual"
+)
+
+const (
+	// MaxLag is how far the emulator may fall behind real time before the
+	// pacing epoch is reset instead of catching up.
+	MaxLag = 250 * time.Millisecond
+
+	// unthrottledBatch is the number of pulses executed per Advance call
+	// when the clock is unthrottled.
+	unthrottledBatch = 4096
+)
+
+// Clock is implemented by clock module models.
+type Clock interface {
+	Mode() ClockMode
+	SetMode(ClockMode)
+	Frequency() float64
+	SetFrequency(float64) error
+	Pulse() error
+	Advance(time.Time) (int, error)
+	Run(context.Context, func(State) bool) error
+	Pulses() uint64
+}
+
+// NewClock returns a clock module driving a CPU. A frequency of 0 runs the
+// astable clock unthrottled.
+func NewClock(cpu CPU, hz float64) (*clock, error) {
+	clk := &clock{
+		cpu:  cpu,
+		mode: CLOCK_ASTABLE,
+	}
+
+	err := clk.SetFrequency(hz)
+	if nil != err {
+		return nil, errors.Wrap(err, "invalid clock configuration")
+	}
+
+	return clk, nil
+}
+
+// clock models the clock module: an adjustable astable 555, a debounced
+// manual pulse button, a mode select switch and the HLT gate.
+//
+// The HLT control signal gates the clock output after the mode select, so a
+// halted machine ignores both astable and manual pulses until it is reset.
+type clock struct {
+	cpu  CPU
+	mode ClockMode
+	hz   float64
+
+	// pacing epoch and pulses generated since
+	epoch  time.Time
+	paced  uint64
+	pulses uint64
+}
+
+// Interface implementation
+func (clk *clock) Mode() ClockMode {
+	return clk.mode
+}
+
+// Interface implementation
+func (clk *clock) SetMode(mode ClockMode) {
+	clk.mode = mode
+	clk.epoch = time.Time{}
+}
+
+// Interface implementation
+func (clk *clock) Frequency() float64 {
+	return clk.hz
+}
+
+// Interface implementation
+func (clk *clock) SetFrequency(hz float64) error {
+	if hz < 0 {
+		return errors.Errorf("invalid clock frequency %g Hz", hz)
+	}
+	clk.hz = hz
+	clk.epoch = time.Time{}
+	return nil
+}
+
+// Pulses returns the number of clock pulses delivered to the CPU.
+func (clk *clock) Pulses() uint64 {
+	return clk.pulses
+}
+
+// gated returns whether HLT is holding the clock low.
+func (clk *clock) gated() bool {
+	return clk.cpu.State().Halted
+}
+
+// tick delivers one pulse to the CPU.
+func (clk *clock) tick() error {
+	err := clk.cpu.Tick()
+	if nil != err {
+		return err
+	}
+	clk.pulses++
+	return nil
+}
+
+// Pulse delivers a single debounced manual pulse. Presses are ignored while
+// the mode switch selects the astable clock or HLT gates the clock.
+func (clk *clock) Pulse() error {
+	if CLOCK_MANUAL != clk.mode || clk.gated() {
+		return nil
+	}
+	return clk.tick()
+}
+
+// Advance delivers the astable pulses due at `now` and returns how many were
+// delivered. Calling Advance periodically paces the CPU in real time.
+func (clk *clock) Advance(now time.Time) (int, error) {
+	if CLOCK_ASTABLE != clk.mode {
+		return 0, nil
+	}
+
+	due := uint64(unthrottledBatch)
+	if 0 != clk.hz {
+		if clk.epoch.IsZero() || now.Sub(clk.epoch) < 0 {
+			clk.epoch = now
+			clk.paced = 0
+		}
+		target := uint64(now.Sub(clk.epoch).Seconds() * clk.hz)
+		if float64(target-clk.paced) > clk.hz*MaxLag.Seconds()+1 {
+			// too far behind, drop the backlog
+			clk.epoch = now
+			clk.paced = 0
+			target = 0
+		}
+		due = 0
+		if target > clk.paced {
+			due = target - clk.paced
+		}
+	}
+
+	n := 0
+	for ; uint64(n) < due; n++ {
+		if clk.gated() {
+			break
+		}
+		err := clk.tick()
+		if nil != err {
+			return n, err
+		}
+		clk.paced++
+	}
+
+	return n, nil
+}
+
+// Run drives the astable clock in real time until the context is done, the
+// CPU halts or fails, or fn returns false. fn is called after every pulse
+// and may be nil.
+func (clk *clock) Run(ctx context.Context, fn func(State) bool) error {
+	if CLOCK_ASTABLE != clk.mode {
+		return errors.Errorf("clock mode is '%s', astable required", clk.mode)
+	}
+
+	for !clk.gated() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if 0 == clk.hz {
+			for n := 0; n < unthrottledBatch && !clk.gated(); n++ {
+				if err := clk.tick(); nil != err {
+					return err
+				}
+				if nil != fn && !fn(clk.cpu.State()) {
+					return nil
+				}
+			}
+			continue
+		}
+
+		// Sleep until the next pulse is due. Pulses that are late are delivered
+		// back to back to catch up.
+		if clk.epoch.IsZero() {
+			clk.epoch = time.Now()
+			clk.paced = 0
+		}
+		due := clk.epoch.Add(time.Duration(float64(clk.paced) / clk.hz * float64(time.Second)))
+		wait := time.Until(due)
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		} else if -wait > MaxLag {
+			clk.epoch = time.Now()
+			clk.paced = 0
+		}
+
+		if err := clk.tick(); nil != err {
+			return err
+		}
+		clk.paced++
+		if nil != fn && !fn(clk.cpu.State()) {
+			return nil
+		}
+	}
+
+	return nil
+}
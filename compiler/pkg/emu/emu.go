@@ -0,0 +1,322 @@
+// Package emu emulates the computer at the register level, one micro-step
+// per clock pulse, using the microcode defined in package ucode.
+package emu
+
+import (
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/ucode"
+
+	"github.com/bdlm/errors/v2"
+)
+
+const (
+	// RAMSize is the number of addressable RAM bytes.
+	RAMSize = 16
+)
+
+// Config describes the emulated hardware.
+type Config struct {
+	// Hardware stack capacity in bytes.
+	StackDepth int
+}
+
+// DefaultConfig returns the configuration of the reference build.
+func DefaultConfig() Config {
+	return Config{
+		StackDepth: 16,
+	}
+}
+
+// CPU is implemented by machine emulators.
+type CPU interface {
+	Tick() error
+	Step() error
+	Reset()
+	State() State
+	SetState(State)
+}
+
+// State is a snapshot of every register and bus in the machine.
+type State struct {
+	// clock pulses since reset
+	Cycle uint64
+	// control signals active during the last pulse
+	Signals ucode.Signal
+	// bus value during the last pulse
+	Bus byte
+	// clock gated by the HLT signal
+	Halted bool
+
+	A   byte
+	X   byte
+	Y   byte
+	Out byte
+
+	PC   byte
+	MAR  byte // ROM address register
+	RAR  byte // RAM address register
+	IR   byte
+	Step byte // step counter
+	Addr byte // address of the current instruction
+
+	Carry bool
+	Zero  bool
+
+	RAM   [RAMSize]byte
+	Stack []byte
+}
+
+// New returns an emulator that executes a program image.
+func New(rom []byte, cfg Config) (*cpu, error) {
+	if 0 == len(rom) {
+		return nil, errors.Errorf("empty program image")
+	}
+	if cfg.StackDepth < 1 {
+		return nil, errors.Errorf("invalid stack depth %d", cfg.StackDepth)
+	}
+
+	cpu := &cpu{
+		rom: rom,
+		cfg: cfg,
+	}
+	cpu.Reset()
+
+	return cpu, nil
+}
+
+// cpu is a register level emulator.
+type cpu struct {
+	rom []byte
+	cfg Config
+
+	state State
+}
+
+// control returns the control signals for the current step.
+func (cpu *cpu) control() (ucode.Signal, error) {
+	if int(cpu.state.Step) < len(ucode.Fetch) {
+		return ucode.Fetch[cpu.state.Step], nil
+	}
+
+	name, ok := bcc.OpName(cpu.state.IR)
+	if !ok {
+		return 0, errors.Errorf("illegal opcode 0x%02X at 0x%02X", cpu.state.IR, cpu.state.Addr)
+	}
+	steps, _ := ucode.Lookup(name)
+	if int(cpu.state.Step) < len(steps) {
+		return steps[cpu.state.Step], nil
+	}
+
+	return 0, nil
+}
+
+// read returns the byte at a ROM address. Addresses beyond the image read as
+// erased EEPROM cells.
+func (cpu *cpu) read(addr byte) byte {
+	if int(addr) >= len(cpu.rom) {
+		return 0xFF
+	}
+	return cpu.rom[addr]
+}
+
+// bus returns the value driven onto the bus.
+func (cpu *cpu) bus(sig ucode.Signal) (byte, error) {
+	state := &cpu.state
+
+	drivers := (sig & ucode.Drivers).List()
+	if len(drivers) > 1 {
+		return 0, errors.Errorf("bus contention at 0x%02X step %d: %s", state.Addr, state.Step, sig&ucode.Drivers)
+	}
+	if 0 == len(drivers) {
+		return 0, nil // pulled low
+	}
+
+	switch drivers[0] {
+	case ucode.PCO:
+		return state.PC, nil
+	case ucode.RORO:
+		return state.MAR, nil
+	case ucode.ROMO:
+		return cpu.read(state.MAR), nil
+	case ucode.ARO:
+		return state.A, nil
+	case ucode.XRO:
+		return state.X, nil
+	case ucode.YRO:
+		return state.Y, nil
+	case ucode.RARO:
+		return state.RAR, nil
+	case ucode.RAMO:
+		return state.RAM[state.RAR], nil
+	case ucode.STO:
+		if 0 == len(state.Stack) {
+			return 0, errors.Errorf("stack underflow at 0x%02X", state.Addr)
+		}
+		return state.Stack[len(state.Stack)-1], nil
+	}
+
+	return 0, nil
+}
+
+// Tick executes one clock pulse: the control signals for the current step
+// drive the bus, registers latch, and the step counter advances.
+func (cpu *cpu) Tick() error {
+	state := &cpu.state
+	if state.Halted {
+		return nil
+	}
+
+	sig, err := cpu.control()
+	if nil != err {
+		return err
+	}
+	bus, err := cpu.bus(sig)
+	if nil != err {
+		return err
+	}
+	state.Signals = sig
+	state.Bus = bus
+
+	// HLT gates the clock before the rising edge, so nothing latches and the
+	// step counter holds until reset.
+	if 0 != sig&ucode.HLT {
+		state.Halted = true
+		return nil
+	}
+	state.Cycle++
+
+	if 0 != sig&ucode.RST {
+		cycle := state.Cycle
+		cpu.Reset()
+		state.Cycle = cycle
+		return nil
+	}
+
+	// resets
+	if 0 != sig&ucode.PCR {
+		state.PC = 0
+	}
+	if 0 != sig&ucode.RORR {
+		state.MAR = 0
+	}
+	if 0 != sig&ucode.RARR {
+		state.RAR = 0
+	}
+	if 0 != sig&ucode.IR {
+		state.IR = 0
+	}
+	if 0 != sig&ucode.ARR {
+		state.A = 0
+	}
+	if 0 != sig&ucode.XRR {
+		state.X = 0
+	}
+	if 0 != sig&ucode.YRR {
+		state.Y = 0
+	}
+
+	// latches
+	if 0 != sig&ucode.RORI {
+		state.MAR = bus
+	}
+	if 0 != sig&ucode.RARI {
+		state.RAR = bus % RAMSize
+	}
+	if 0 != sig&ucode.RAMI {
+		state.RAM[state.RAR] = bus
+	}
+	if 0 != sig&ucode.II {
+		state.IR = bus
+		state.Addr = state.MAR
+	}
+	if 0 != sig&ucode.AE {
+		sum := int(state.A) + int(bus)
+		if 0 != sig&ucode.SUB {
+			sum = int(state.A) + int(^bus) + 1
+		}
+		state.A = byte(sum)
+		state.Carry = sum > 0xFF
+		state.Zero = 0 == state.A
+	}
+	if 0 != sig&ucode.ARI {
+		state.A = bus
+	}
+	if 0 != sig&ucode.XRI {
+		state.X = bus
+	}
+	if 0 != sig&ucode.YRI {
+		state.Y = bus
+	}
+	if 0 != sig&ucode.OUT {
+		state.Out = bus
+	}
+
+	// stack
+	if 0 != sig&ucode.STD {
+		if 0 == len(state.Stack) {
+			return errors.Errorf("stack underflow at 0x%02X", state.Addr)
+		}
+		state.Stack = state.Stack[:len(state.Stack)-1]
+	}
+	if 0 != sig&ucode.STI {
+		if len(state.Stack) >= cpu.cfg.StackDepth {
+			return errors.Errorf("stack overflow at 0x%02X, depth %d", state.Addr, cpu.cfg.StackDepth)
+		}
+		state.Stack = append(state.Stack, bus)
+	}
+
+	// counters
+	if 0 != sig&ucode.PCE {
+		state.PC++
+	}
+	if 0 != sig&ucode.JMP {
+		state.PC = bus
+	}
+	if 0 != sig&ucode.IE {
+		state.Step = 0
+	} else {
+		state.Step = (state.Step + 1) % ucode.Steps
+	}
+
+	return nil
+}
+
+// Step executes clock pulses until the current instruction completes or the
+// machine halts.
+func (cpu *cpu) Step() error {
+	for {
+		err := cpu.Tick()
+		if nil != err {
+			return err
+		}
+		if 0 == cpu.state.Step || cpu.state.Halted {
+			return nil
+		}
+	}
+}
+
+// Reset clears every register, as the reset button does. The program image
+// is retained.
+func (cpu *cpu) Reset() {
+	cpu.state = State{
+		Stack: []byte{},
+	}
+}
+
+// State returns a snapshot of the machine.
+func (cpu *cpu) State() State {
+	state := cpu.state
+	state.Stack = append([]byte{}, cpu.state.Stack...)
+	return state
+}
+
+// SetState loads every register from a snapshot, as if set from the front
+// panel. The stack is truncated to the configured depth.
+func (cpu *cpu) SetState(state State) {
+	stack := append([]byte{}, state.Stack...)
+	if len(stack) > cpu.cfg.StackDepth {
+		stack = stack[len(stack)-cpu.cfg.StackDepth:]
+	}
+	state.Stack = stack
+	cpu.state = state
+}
@@ -0,0 +1,82 @@
+package emu_test
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcctest"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/emu"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/ucode"
+)
+
+// cycles returns the cycles a run of operations takes.
+func cycles(t *testing.T, names ...string) uint64 {
+	total := 0
+	for _, name := range names {
+		cyc, ok := ucode.Cycles(name)
+		if !ok {
+			t.Fatalf("no microcode for %s", name)
+		}
+		total += cyc
+	}
+	return uint64(total)
+}
+
+// TestFib runs the example program one instruction at a time.
+func TestFib(t *testing.T) {
+	src, err := ioutil.ReadFile("../../fib.asm")
+	if nil != err {
+		t.Fatalf("read fib.asm: %s", err)
+	}
+	cpu, err := emu.New(bcctest.Assemble(t, string(src)), emu.DefaultConfig())
+	if nil != err {
+		t.Fatalf("emulator: %s", err)
+	}
+
+	for _, name := range []string{"LDAV", "LDXV", "LDYV"} {
+		if err = cpu.Step(); nil != err {
+			t.Fatalf("%s: %s", name, err)
+		}
+	}
+	start := cycles(t, "LDAV", "LDXV", "LDYV")
+	if got := cpu.State().Cycle; start != got {
+		t.Errorf("initialized after %d cycles, want %d", got, start)
+	}
+
+	// the sum wraps at 8 bits: 144 + 233 = 377 = 0x179
+	want := []byte{1, 1, 2, 3, 5, 8, 13, 21, 34, 55, 89, 144, 233, 0x79}
+	loop := cycles(t, "OUTA", "LDYA", "ADDX", "LDXY", "JMP")
+	got := []byte{}
+	for k := range want {
+		for n := 0; n < 5; n++ {
+			if err = cpu.Step(); nil != err {
+				t.Fatalf("iteration %d: %s", k, err)
+			}
+			if 0 == n {
+				got = append(got, cpu.State().Out)
+			}
+		}
+		state := cpu.State()
+		// JMP loop, back to the first instruction after the 3 loads
+		if cyc := start + uint64(k+1)*loop; cyc != state.Cycle || 0x06 != state.PC || state.Halted {
+			t.Fatalf("iteration %d: PC 0x%02X after %d cycles, want 0x06 after %d", k, state.PC, state.Cycle, cyc)
+		}
+	}
+	if string(got) != string(want) {
+		t.Errorf("output:\n got  %v\n want %v", got, want)
+	}
+}
+
+// TestTraceOperand checks that the operand of an instruction at the top of
+// the address space is read from the following byte, not from address 0.
+func TestTraceOperand(t *testing.T) {
+	ldav, _ := bcc.Opcode("LDAV")
+	rom := make([]byte, 0x200)
+	rom[0x100] = 0x2A
+	s := emu.Trace(rom, emu.State{IR: ldav, Addr: 0xFF}, nil)
+	if !strings.HasPrefix(s, "0xFF  LDAV 0x2A") {
+		t.Errorf("trace: got %q, want the operand 0x2A", s)
+	}
+}
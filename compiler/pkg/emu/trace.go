@@ -0,0 +1,34 @@
+package emu
+
+import (
+	"fmt"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+)
+
+// Trace describes the instruction the machine last executed and the
+// registers it left behind. With debug info the source location and the
+// label at the address are appended; dbg may be nil.
+func Trace(rom []byte, state State, dbg *bcc.DebugInfo) string {
+	name, ok := bcc.OpName(state.IR)
+	if !ok {
+		name = fmt.Sprintf("0x%02X", state.IR)
+	}
+	if bcc.OpHasParam(name) && int(state.Addr)+1 < len(rom) {
+		name = fmt.Sprintf("%-4s 0x%02X", name, rom[int(state.Addr)+1])
+	}
+	s := fmt.Sprintf(
+		"0x%02X  %-9s  A=0x%02X X=0x%02X Y=0x%02X OUT=0x%02X SP=%d",
+		state.Addr, name, state.A, state.X, state.Y, state.Out, len(state.Stack),
+	)
+	if nil == dbg {
+		return s
+	}
+	if loc, ok := dbg.At(int(state.Addr)); ok {
+		s = s + fmt.Sprintf("  %s:%d", dbg.File(loc), loc.Line)
+	}
+	if label, ok := dbg.Label(int(state.Addr)); ok {
+		s = s + " " + label
+	}
+	return s
+}
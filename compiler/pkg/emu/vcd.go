@@ -0,0 +1,344 @@
+package emu
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/ucode"
+
+	"github.com/bdlm/errors/v2"
+)
+
+// VCD_PERIOD is the clock period in nanoseconds recorded for an unthrottled
+// clock.
+const VCD_PERIOD = 1000
+
+// VCDConfig selects what a recording holds.
+type VCDConfig struct {
+	// Signal name patterns, as in path.Match, matched without regard to
+	// case against NAME and SCOPE.NAME, see VCDSignals. Empty records every
+	// signal; the clock is always recorded.
+	Signals []string
+	// Clock pulses to record, counted from 1 when recording starts. To is 0
+	// to record until the end.
+	From, To uint64
+	// Clock rate the timestamps are computed from, 0 for VCD_PERIOD.
+	Hz float64
+}
+
+// vcdVar is a recorded signal.
+type vcdVar struct {
+	scope string
+	name  string
+	width int
+	// rising is true for the values that change on the rising edge, the
+	// registers; the rest change on the falling edge with the step counter
+	rising bool
+	value  func(state State, step byte) uint64
+
+	id   string
+	last uint64
+}
+
+// vcdVars returns every signal a recording can hold: the clock, the bus, the
+// registers and flags in scope cpu, and every control signal in scope
+// control.
+func vcdVars() []*vcdVar {
+	byteVar := func(name string, rising bool, v func(State) byte) *vcdVar {
+		return &vcdVar{scope: "cpu", name: name, width: 8, rising: rising, value: func(state State, step byte) uint64 {
+			return uint64(v(state))
+		}}
+	}
+	flagVar := func(name string, v func(State) bool) *vcdVar {
+		return &vcdVar{scope: "cpu", name: name, width: 1, rising: true, value: func(state State, step byte) uint64 {
+			if v(state) {
+				return 1
+			}
+			return 0
+		}}
+	}
+	vars := []*vcdVar{
+		{scope: "cpu", name: "clk", width: 1},
+		byteVar("bus", false, func(s State) byte { return s.Bus }),
+		{scope: "cpu", name: "step", width: 4, value: func(state State, step byte) uint64 { return uint64(step) }},
+		byteVar("pc", true, func(s State) byte { return s.PC }),
+		byteVar("mar", true, func(s State) byte { return s.MAR }),
+		byteVar("ir", true, func(s State) byte { return s.IR }),
+		byteVar("a", true, func(s State) byte { return s.A }),
+		byteVar("x", true, func(s State) byte { return s.X }),
+		byteVar("y", true, func(s State) byte { return s.Y }),
+		byteVar("out", true, func(s State) byte { return s.Out }),
+		byteVar("rar", true, func(s State) byte { return s.RAR }),
+		byteVar("sp", true, func(s State) byte { return byte(len(s.Stack)) }),
+		flagVar("carry", func(s State) bool { return s.Carry }),
+		flagVar("zero", func(s State) bool { return s.Zero }),
+	}
+	for _, sig := range ucode.Signals {
+		sig := sig
+		vars = append(vars, &vcdVar{scope: "control", name: sig.Name(), width: 1, value: func(state State, step byte) uint64 {
+			if 0 != state.Signals&sig {
+				return 1
+			}
+			return 0
+		}})
+	}
+	return vars
+}
+
+// VCDSignals returns the names of the signals a recording can hold, as
+// SCOPE.NAME.
+func VCDSignals() []string {
+	names := []string{}
+	for _, v := range vcdVars() {
+		names = append(names, v.scope+"."+v.name)
+	}
+	return names
+}
+
+// Recorder wraps a CPU and writes a Value Change Dump of every clock pulse
+// it executes, for GTKWave or a logic analyzer's compare view. It implements
+// CPU, so the clock module, the front panel and the debugger drive it as
+// they drive the machine.
+//
+// Each pulse is two edges. The step counter advances on the falling edge,
+// so the control signals, the bus and the step change there; the clock then
+// rises half a period later and the registers latch. A halting step has no
+// rising edge, HLT gates the clock.
+type Recorder struct {
+	cpu  CPU
+	cfg  VCDConfig
+	w    *bufio.Writer
+	vars []*vcdVar
+	clk  *vcdVar
+	// half the clock period, in ns
+	half uint64
+
+	// the state before the current pulse
+	prev State
+	// pulses since recording started
+	pulses  uint64
+	dumped  bool
+	stopped bool
+	err     error
+}
+
+// NewRecorder returns a CPU that records cpu to w. Close it to complete the
+// dump.
+func NewRecorder(cpu CPU, w io.Writer, cfg VCDConfig) (*Recorder, error) {
+	vars := []*vcdVar{}
+	all := vcdVars()
+	for _, pattern := range cfg.Signals {
+		if _, err := path.Match(strings.ToLower(pattern), ""); nil != err {
+			return nil, errors.Errorf("invalid signal pattern '%s'", pattern)
+		}
+		found := false
+		for _, v := range all {
+			found = found || v.match(pattern)
+		}
+		if !found {
+			return nil, errors.Errorf("no signal matches '%s'", pattern)
+		}
+	}
+	for _, v := range all {
+		if "clk" == v.name || 0 == len(cfg.Signals) {
+			vars = append(vars, v)
+			continue
+		}
+		for _, pattern := range cfg.Signals {
+			if v.match(pattern) {
+				vars = append(vars, v)
+				break
+			}
+		}
+	}
+
+	half := uint64(VCD_PERIOD / 2)
+	if 0 < cfg.Hz {
+		half = uint64(1e9 / cfg.Hz / 2)
+	}
+	if 0 == half {
+		half = 1
+	}
+	rec := &Recorder{
+		cpu:  cpu,
+		cfg:  cfg,
+		w:    bufio.NewWriter(w),
+		vars: vars,
+		clk:  vars[0],
+		half: half,
+		prev: cpu.State(),
+	}
+	rec.header()
+	return rec, rec.err
+}
+
+// match returns whether a signal pattern selects the variable.
+func (v *vcdVar) match(pattern string) bool {
+	pattern = strings.ToLower(pattern)
+	full := strings.ToLower(v.scope + "." + v.name)
+	ok1, _ := path.Match(pattern, strings.ToLower(v.name))
+	ok2, _ := path.Match(pattern, full)
+	return ok1 || ok2
+}
+
+// header writes the declarations.
+func (rec *Recorder) header() {
+	rec.printf("$version bcc $end\n$timescale 1ns $end\n")
+	scope := ""
+	for k, v := range rec.vars {
+		v.id = vcdID(k)
+		if scope != v.scope {
+			if "" != scope {
+				rec.printf("$upscope $end\n")
+			}
+			scope = v.scope
+			rec.printf("$scope module %s $end\n", scope)
+		}
+		if 1 == v.width {
+			rec.printf("$var wire 1 %s %s $end\n", v.id, v.name)
+			continue
+		}
+		rec.printf("$var wire %d %s %s [%d:0] $end\n", v.width, v.id, v.name, v.width-1)
+	}
+	rec.printf("$upscope $end\n$enddefinitions $end\n")
+}
+
+// vcdID returns the identifier code of the k-th variable.
+func vcdID(k int) string {
+	id := ""
+	for {
+		id += string(rune('!' + k%94))
+		k /= 94
+		if 0 == k {
+			return id
+		}
+	}
+}
+
+// printf writes to the dump, keeping the first error.
+func (rec *Recorder) printf(format string, args ...interface{}) {
+	if nil == rec.err {
+		_, rec.err = fmt.Fprintf(rec.w, format, args...)
+	}
+}
+
+// set writes a value change, or every value when all is true.
+func (rec *Recorder) set(v *vcdVar, value uint64, all bool) {
+	if !all && value == v.last {
+		return
+	}
+	v.last = value
+	if 1 == v.width {
+		rec.printf("%d%s\n", value, v.id)
+		return
+	}
+	rec.printf("b%s %s\n", strconv.FormatUint(value, 2), v.id)
+}
+
+// record writes the edges of the pulse that led from rec.prev to state.
+func (rec *Recorder) record(state State) {
+	if rec.stopped || (state.Halted && rec.prev.Halted) {
+		rec.prev = state
+		return
+	}
+	rec.pulses++
+	n := rec.pulses
+	if n < rec.cfg.From || (0 != rec.cfg.To && n > rec.cfg.To) {
+		rec.stopped = 0 != rec.cfg.To && n > rec.cfg.To
+		rec.prev = state
+		return
+	}
+
+	// falling edge: the step's control signals and bus
+	rec.printf("#%d\n", (n-1)*2*rec.half)
+	all := !rec.dumped
+	if all {
+		rec.printf("$dumpvars\n")
+	}
+	for _, v := range rec.vars {
+		switch true {
+		case v == rec.clk:
+			rec.set(v, 0, all)
+		case v.rising:
+			rec.set(v, v.value(rec.prev, rec.prev.Step), all)
+		default:
+			rec.set(v, v.value(state, rec.prev.Step), all)
+		}
+	}
+	if all {
+		rec.printf("$end\n")
+		rec.dumped = true
+	}
+
+	// rising edge: the registers latch
+	if !state.Halted {
+		rec.printf("#%d\n", (n-1)*2*rec.half+rec.half)
+		rec.set(rec.clk, 1, false)
+		for _, v := range rec.vars {
+			if v.rising {
+				rec.set(v, v.value(state, state.Step), false)
+			}
+		}
+	}
+	rec.prev = state
+}
+
+// Close ends the dump at the next falling edge and flushes it.
+func (rec *Recorder) Close() error {
+	if rec.dumped {
+		end := rec.pulses
+		if 0 != rec.cfg.To && end > rec.cfg.To {
+			end = rec.cfg.To
+		}
+		rec.printf("#%d\n", end*2*rec.half)
+	}
+	if nil == rec.err {
+		rec.err = rec.w.Flush()
+	}
+	return rec.err
+}
+
+// Tick implements CPU.
+func (rec *Recorder) Tick() error {
+	err := rec.cpu.Tick()
+	if nil != err {
+		return err
+	}
+	rec.record(rec.cpu.State())
+	return rec.err
+}
+
+// Step implements CPU.
+func (rec *Recorder) Step() error {
+	for {
+		err := rec.Tick()
+		if nil != err {
+			return err
+		}
+		state := rec.cpu.State()
+		if 0 == state.Step || state.Halted {
+			return nil
+		}
+	}
+}
+
+// Reset implements CPU.
+func (rec *Recorder) Reset() {
+	rec.cpu.Reset()
+	rec.prev = rec.cpu.State()
+}
+
+// State implements CPU.
+func (rec *Recorder) State() State {
+	return rec.cpu.State()
+}
+
+// SetState implements CPU.
+func (rec *Recorder) SetState(state State) {
+	rec.cpu.SetState(state)
+	rec.prev = rec.cpu.State()
+}
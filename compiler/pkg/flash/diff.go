@@ -0,0 +1,27 @@
+package flash
+
+// Range is a span of addresses, [Start, End).
+type Range struct {
+	Start, End int
+}
+
+// Ranges returns the spans where two images differ. Bytes past the end of the
+// shorter image differ.
+func Ranges(a, b []byte) []Range {
+	n := len(a)
+	if len(b) > n {
+		n = len(b)
+	}
+	ranges := []Range{}
+	for addr := 0; addr < n; addr++ {
+		if addr < len(a) && addr < len(b) && a[addr] == b[addr] {
+			continue
+		}
+		if k := len(ranges) - 1; k >= 0 && ranges[k].End == addr {
+			ranges[k].End++
+			continue
+		}
+		ranges = append(ranges, Range{addr, addr + 1})
+	}
+	return ranges
+}
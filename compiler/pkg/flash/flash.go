@@ -0,0 +1,262 @@
+// Package flash burns ROM images with a serial EEPROM programmer: an Arduino
+// driving the EEPROM's address, data and control pins through shift
+// registers, as on the breadboard computer's programmer.
+//
+// The protocol is line oriented ASCII. The host sends a command and the
+// programmer answers one line, "OK" followed by the result or "ERR" followed
+// by a message. Numbers are hex, data is a hex string.
+//
+//	I               OK part size pagesize   identify the EEPROM
+//	R addr n        OK data                 read n bytes, at most 64
+//	W addr data     OK                      write at most 64 bytes
+//	V addr data     OK                      compare with the EEPROM
+//	E               OK                      erase every cell to 0xFF
+//
+// Writes never cross a 64 byte block, the page size of the 28C64 and 28C256;
+// the programmer writes a 28C16 a byte at a time. V answers "ERR mismatch at
+// addr" for the first differing byte.
+//
+// The Arduino sketch in compiler/programmer implements the programmer side.
+// Serial ports and the simulator's pseudo-terminal are only supported on
+// Linux.
+package flash
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/eeprom"
+
+	"github.com/bdlm/errors/v2"
+)
+
+const (
+	// BLOCK is the most bytes a command carries.
+	BLOCK = 64
+
+	// BAUD is the programmer's default line rate.
+	BAUD = 115200
+
+	// TIMEOUT is how long to wait for a reply by default.
+	TIMEOUT = 2 * time.Second
+
+	// writeCycle is the EEPROM's page write time, which erasing takes per
+	// page.
+	writeCycle = 10 * time.Millisecond
+)
+
+// deadliner is a connection whose reads can time out, such as a serial port.
+type deadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// Programmer is a connected EEPROM programmer.
+type Programmer struct {
+	// the EEPROM in the programmer's socket
+	Part eeprom.Part
+	// how long to wait for a reply, if the connection supports deadlines
+	Timeout time.Duration
+
+	conn io.ReadWriter
+	in   *bufio.Reader
+}
+
+// Connect identifies the programmer on a connection. An Arduino resets when
+// its port is opened and ignores the host while it boots, so the identify
+// command is repeated until boot has passed.
+func Connect(conn io.ReadWriter, timeout, boot time.Duration) (*Programmer, error) {
+	prog := &Programmer{Timeout: timeout, conn: conn, in: bufio.NewReader(conn)}
+	start := time.Now()
+	for {
+		err := prog.identify()
+		if nil == err || time.Since(start) >= boot {
+			return prog, err
+		}
+	}
+}
+
+// identify reads the part in the socket.
+func (prog *Programmer) identify() error {
+	reply, err := prog.cmd(prog.Timeout, "I")
+	if nil != err {
+		return err
+	}
+	fields := strings.Fields(reply)
+	if 3 != len(fields) {
+		return errors.Errorf("unexpected identify reply '%s'", reply)
+	}
+	size, err := strconv.ParseUint(fields[1], 16, 32)
+	if nil != err {
+		return errors.Errorf("unexpected identify reply '%s'", reply)
+	}
+	page, err := strconv.ParseUint(fields[2], 16, 32)
+	if nil != err || 0 == page {
+		return errors.Errorf("unexpected identify reply '%s'", reply)
+	}
+	prog.Part = eeprom.Part{Name: fields[0], Size: int(size), PageSize: int(page)}
+	return nil
+}
+
+// cmd sends a command and returns the result of an OK reply.
+func (prog *Programmer) cmd(timeout time.Duration, format string, args ...interface{}) (string, error) {
+	line := fmt.Sprintf(format, args...)
+	name := line
+	if fields := strings.Fields(line); len(fields) > 2 {
+		name = strings.Join(fields[:2], " ")
+	}
+
+	if conn, ok := prog.conn.(deadliner); ok && 0 < timeout {
+		err := conn.SetReadDeadline(time.Now().Add(timeout))
+		if nil != err {
+			return "", errors.Wrap(err, "could not set timeout: %s", err)
+		}
+	}
+	_, err := io.WriteString(prog.conn, line+"\n")
+	if nil != err {
+		return "", errors.Wrap(err, "could not send '%s': %s", name, err)
+	}
+	reply, err := prog.in.ReadString('\n')
+	if nil != err {
+		return "", errors.Wrap(err, "no reply to '%s': %s", name, err)
+	}
+
+	reply = strings.TrimSpace(reply)
+	switch true {
+	case "OK" == reply:
+		return "", nil
+	case strings.HasPrefix(reply, "OK "):
+		return reply[3:], nil
+	case strings.HasPrefix(reply, "ERR"):
+		return "", errors.Errorf("'%s' failed: %s", name, strings.TrimSpace(reply[3:]))
+	}
+	return "", errors.Errorf("unexpected reply to '%s': '%s'", name, reply)
+}
+
+// check fails if a range is outside the EEPROM or a command's data would
+// cross a block.
+func (prog *Programmer) check(addr, n int, block bool) error {
+	switch true {
+	case addr < 0 || addr+n > prog.Part.Size:
+		return errors.Errorf("0x%04X-0x%04X is outside the %s", addr, addr+n, prog.Part.Name)
+	case block && (n > BLOCK || addr/BLOCK != (addr+n-1)/BLOCK):
+		return errors.Errorf("%d bytes at 0x%04X cross a %d byte block", n, addr, BLOCK)
+	}
+	return nil
+}
+
+// Read reads n bytes starting at addr.
+func (prog *Programmer) Read(addr, n int) ([]byte, error) {
+	err := prog.check(addr, n, false)
+	if nil != err {
+		return nil, err
+	}
+	data := make([]byte, 0, n)
+	for len(data) < n {
+		size := BLOCK - (addr+len(data))%BLOCK
+		if size > n-len(data) {
+			size = n - len(data)
+		}
+		reply, err := prog.cmd(prog.Timeout, "R %04X %02X", addr+len(data), size)
+		if nil != err {
+			return nil, err
+		}
+		byts, err := hex.DecodeString(reply)
+		if nil != err || size != len(byts) {
+			return nil, errors.Errorf("bad read of %d bytes at 0x%04X: '%s'", size, addr+len(data), reply)
+		}
+		data = append(data, byts...)
+	}
+	return data, nil
+}
+
+// WriteBlock writes data at addr; it must not cross a block.
+func (prog *Programmer) WriteBlock(addr int, data []byte) error {
+	err := prog.check(addr, len(data), true)
+	if nil == err {
+		_, err = prog.cmd(prog.Timeout, "W %04X %X", addr, data)
+	}
+	return err
+}
+
+// VerifyBlock compares data with the EEPROM at addr; it must not cross a
+// block.
+func (prog *Programmer) VerifyBlock(addr int, data []byte) error {
+	err := prog.check(addr, len(data), true)
+	if nil == err {
+		_, err = prog.cmd(prog.Timeout, "V %04X %X", addr, data)
+	}
+	return err
+}
+
+// Erase sets every cell to 0xFF.
+func (prog *Programmer) Erase() error {
+	pages := time.Duration(prog.Part.Size / prog.Part.PageSize)
+	_, err := prog.cmd(prog.Timeout+pages*writeCycle, "E")
+	return err
+}
+
+// WriteOptions control Write and Apply.
+type WriteOptions struct {
+	// skip blocks that already hold their data, to finish an interrupted
+	// write
+	Resume bool
+	// verify each block after writing it
+	Verify bool
+	// called after each block with the number of blocks done
+	Progress func(done, total int)
+}
+
+// Stats counts the blocks handled by Write and Apply.
+type Stats struct {
+	Written, Skipped int
+}
+
+// Write burns an image to the start of the EEPROM block by block.
+func (prog *Programmer) Write(img []byte, opts WriteOptions) (Stats, error) {
+	if len(img) > prog.Part.Size {
+		return Stats{}, errors.Errorf("%d byte image does not fit in a %s (%d bytes)", len(img), prog.Part.Name, prog.Part.Size)
+	}
+	return prog.Apply(Blocks(img), opts)
+}
+
+// Apply burns a patch list.
+func (prog *Programmer) Apply(patches []Patch, opts WriteOptions) (Stats, error) {
+	stats := Stats{}
+	for k, patch := range patches {
+		err := prog.check(patch.Addr, len(patch.Data), true)
+		if nil != err {
+			return stats, err
+		}
+
+		written := false
+		if opts.Resume {
+			have, err := prog.Read(patch.Addr, len(patch.Data))
+			if nil != err {
+				return stats, err
+			}
+			written = bytes.Equal(have, patch.Data)
+		}
+		if written {
+			stats.Skipped++
+		} else {
+			err := prog.WriteBlock(patch.Addr, patch.Data)
+			if nil == err && opts.Verify {
+				err = prog.VerifyBlock(patch.Addr, patch.Data)
+			}
+			if nil != err {
+				return stats, err
+			}
+			stats.Written++
+		}
+		if nil != opts.Progress {
+			opts.Progress(k+1, len(patches))
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,179 @@
+package flash_test
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcctest"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/eeprom"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/flash"
+)
+
+const src = `
+    LDAV 1
+    LDXV 1
+loop
+    OUTA
+    ADDX
+    PSHA
+    LDAX
+    POPX
+    JMP  loop
+`
+
+// connect serves a simulator on one end of a pipe and connects a programmer
+// to the other. The returned func ends the connection and waits for the
+// simulator.
+func connect(t *testing.T, sim *flash.Simulator, timeout time.Duration) (*flash.Programmer, func()) {
+	t.Helper()
+	host, dev := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- sim.Serve(dev)
+	}()
+	closer := func() {
+		host.Close()
+		if err := <-done; nil != err {
+			t.Errorf("simulator: %s", err)
+		}
+		dev.Close()
+	}
+	prog, err := flash.Connect(host, timeout, 0)
+	if nil != err {
+		closer()
+		t.Fatalf("connect: %s", err)
+	}
+	return prog, closer
+}
+
+func TestIdentify(t *testing.T) {
+	for name, part := range eeprom.Parts {
+		t.Run(name, func(t *testing.T) {
+			prog, closer := connect(t, flash.NewSimulator(part), time.Second)
+			defer closer()
+			if prog.Part != part {
+				t.Errorf("part: got %+v, want %+v", prog.Part, part)
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	img := bcctest.Assemble(t, src)
+	sim := flash.NewSimulator(eeprom.Parts["28C256"])
+	prog, closer := connect(t, sim, time.Second)
+	defer closer()
+
+	progress := 0
+	stats, err := prog.Write(img, flash.WriteOptions{Verify: true, Progress: func(done, total int) {
+		progress = done
+	}})
+	if nil != err {
+		t.Fatalf("write: %s", err)
+	}
+	if blocks := len(img) / flash.BLOCK; blocks != stats.Written || 0 != stats.Skipped || blocks != progress {
+		t.Errorf("stats: got %+v after %d blocks, want %d written", stats, progress, blocks)
+	}
+	if !bytes.Equal(sim.Mem, img) {
+		t.Errorf("EEPROM does not hold the image")
+	}
+
+	// read it back, across block boundaries, and run it
+	back, err := prog.Read(0, len(img))
+	if nil != err {
+		t.Fatalf("read: %s", err)
+	}
+	if !bytes.Equal(back, img) {
+		t.Errorf("read back differs from the image")
+	}
+	part, err := prog.Read(60, 10)
+	if nil != err || !bytes.Equal(part, img[60:70]) {
+		t.Errorf("read 60-70: got % X, %v, want % X", part, err, img[60:70])
+	}
+	trace := bcctest.Run(t, back, bcctest.Options{Outputs: 6})
+	bcctest.ExpectOut(t, trace, 1, 1, 2, 3, 5, 8)
+}
+
+func TestVerifyMismatch(t *testing.T) {
+	img := bcctest.Code(t, src)
+	sim := flash.NewSimulator(eeprom.Parts["28C16"])
+	prog, closer := connect(t, sim, time.Second)
+	defer closer()
+
+	if err := prog.WriteBlock(0, img); nil != err {
+		t.Fatalf("write: %s", err)
+	}
+	if err := prog.VerifyBlock(0, img); nil != err {
+		t.Errorf("verify: %s", err)
+	}
+	sim.Mem[5] ^= 0xFF
+	err := prog.VerifyBlock(0, img)
+	if nil == err || !strings.Contains(err.Error(), "mismatch at 0005") {
+		t.Errorf("verify a changed byte: got %v, want a mismatch at 0005", err)
+	}
+}
+
+func TestResume(t *testing.T) {
+	// no block of the image reads back as erased
+	img := make([]byte, 8*flash.BLOCK)
+	for k := range img {
+		img[k] = byte(k)
+	}
+	sim := flash.NewSimulator(eeprom.Parts["28C64"])
+	sim.FailAfter = 3
+
+	prog, closer := connect(t, sim, 50*time.Millisecond)
+	stats, err := prog.Write(img, flash.WriteOptions{})
+	closer()
+	if nil == err || 3 != stats.Written {
+		t.Fatalf("unplugged write: got %+v, %v, want 3 blocks and an error", stats, err)
+	}
+
+	sim.FailAfter = 0
+	prog, closer = connect(t, sim, time.Second)
+	defer closer()
+	stats, err = prog.Write(img, flash.WriteOptions{Resume: true, Verify: true})
+	if nil != err {
+		t.Fatalf("resume: %s", err)
+	}
+	if 5 != stats.Written || 3 != stats.Skipped {
+		t.Errorf("stats: got %+v, want 5 written and 3 skipped", stats)
+	}
+	if !bytes.Equal(sim.Mem[:len(img)], img) {
+		t.Errorf("EEPROM does not hold the image")
+	}
+}
+
+func TestErase(t *testing.T) {
+	sim := flash.NewSimulator(eeprom.Parts["28C16"])
+	for k := range sim.Mem {
+		sim.Mem[k] = byte(k)
+	}
+	prog, closer := connect(t, sim, time.Second)
+	defer closer()
+
+	if err := prog.Erase(); nil != err {
+		t.Fatalf("erase: %s", err)
+	}
+	if !bytes.Equal(sim.Mem, bytes.Repeat([]byte{0xFF}, len(sim.Mem))) {
+		t.Errorf("EEPROM is not erased")
+	}
+}
+
+func TestRanges(t *testing.T) {
+	prog, closer := connect(t, flash.NewSimulator(eeprom.Parts["28C16"]), time.Second)
+	defer closer()
+
+	if err := prog.WriteBlock(60, make([]byte, 8)); nil == err {
+		t.Errorf("wrote across a block")
+	}
+	if _, err := prog.Read(2040, 16); nil == err {
+		t.Errorf("read past the end of the part")
+	}
+	if _, err := prog.Write(make([]byte, 4096), flash.WriteOptions{}); nil == err {
+		t.Errorf("wrote an image larger than the part")
+	}
+}
@@ -0,0 +1,109 @@
+package flash
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/bdlm/errors/v2"
+)
+
+// Patch is data to write at an address, within one block.
+type Patch struct {
+	Addr int
+	Data []byte
+}
+
+// Blocks splits an image into one patch per block.
+func Blocks(img []byte) []Patch {
+	patches := []Patch{}
+	for addr := 0; addr < len(img); addr += BLOCK {
+		end := addr + BLOCK
+		if end > len(img) {
+			end = len(img)
+		}
+		patches = append(patches, Patch{addr, img[addr:end]})
+	}
+	return patches
+}
+
+// Patches returns the fewest block writes that turn an EEPROM holding old
+// into one holding new: in each block, the span from the first to the last
+// changed byte. Bytes past the end of new are left alone.
+func Patches(old, new []byte) []Patch {
+	patches := []Patch{}
+	for _, r := range Ranges(old, new) {
+		if r.Start >= len(new) {
+			break
+		}
+		if r.End > len(new) {
+			r.End = len(new)
+		}
+		for addr := r.Start; addr < r.End; {
+			end := (addr/BLOCK + 1) * BLOCK
+			if end > r.End {
+				end = r.End
+			}
+			k := len(patches) - 1
+			if k >= 0 && patches[k].Addr/BLOCK == addr/BLOCK {
+				patches[k].Data = new[patches[k].Addr:end]
+			} else {
+				patches = append(patches, Patch{addr, new[addr:end]})
+			}
+			addr = end
+		}
+	}
+	return patches
+}
+
+// FormatPatches encodes a patch list as text, one patch per line: the hex
+// address and data. Lines starting with # are comments.
+//
+//	# fib.img: 2 blocks
+//	0006 1A02
+//	0100 4243434D01000C00
+func FormatPatches(patches []Patch, comment string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(comment, "\n") {
+		if "" != line {
+			fmt.Fprintf(&b, "# %s\n", line)
+		}
+	}
+	for _, patch := range patches {
+		fmt.Fprintf(&b, "%04X %X\n", patch.Addr, patch.Data)
+	}
+	return b.String()
+}
+
+// ParsePatches decodes a patch list written by FormatPatches.
+func ParsePatches(r io.Reader) ([]Patch, error) {
+	patches := []Patch{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for ln := 1; scanner.Scan(); ln++ {
+		line := strings.TrimSpace(scanner.Text())
+		if "" == line || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if 2 != len(fields) {
+			return nil, errors.Errorf("line %d: expected an address and data", ln)
+		}
+		addr, err := strconv.ParseUint(fields[0], 16, 16)
+		if nil != err {
+			return nil, errors.Errorf("line %d: invalid address '%s'", ln, fields[0])
+		}
+		data, err := hex.DecodeString(fields[1])
+		if nil != err || 0 == len(data) {
+			return nil, errors.Errorf("line %d: invalid data", ln)
+		}
+		if len(data) > BLOCK || int(addr)/BLOCK != (int(addr)+len(data)-1)/BLOCK {
+			return nil, errors.Errorf("line %d: %d bytes at 0x%04X cross a %d byte block", ln, len(data), addr, BLOCK)
+		}
+		patches = append(patches, Patch{int(addr), data})
+	}
+	return patches, scanner.Err()
+}
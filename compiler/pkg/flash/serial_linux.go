@@ -0,0 +1,123 @@
+package flash
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bdlm/errors/v2"
+	"golang.org/x/sys/unix"
+)
+
+// bauds maps line rates to termios speeds.
+var bauds = map[int]uint32{
+	9600:   unix.B9600,
+	19200:  unix.B19200,
+	38400:  unix.B38400,
+	57600:  unix.B57600,
+	115200: unix.B115200,
+	230400: unix.B230400,
+}
+
+// OpenPort opens a serial port for 8N1 raw I/O at the given line rate.
+// Reads honor the file's deadlines.
+func OpenPort(name string, baud int) (*os.File, error) {
+	speed, ok := bauds[baud]
+	if !ok {
+		return nil, errors.Errorf("unsupported baud rate %d", baud)
+	}
+	// non-blocking so the open does not wait for carrier detect
+	port, err := os.OpenFile(name, os.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK, 0)
+	if nil != err {
+		return nil, err
+	}
+	err = control(port, func(fd int) error {
+		tio, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+		if nil != err {
+			return err
+		}
+		makeRaw(tio)
+		tio.Cflag &^= unix.CBAUD | unix.CSTOPB
+		tio.Cflag |= speed | unix.CREAD | unix.CLOCAL
+		tio.Ispeed, tio.Ospeed = speed, speed
+		err = unix.IoctlSetTermios(fd, unix.TCSETS, tio)
+		if nil != err {
+			return err
+		}
+		return unix.IoctlSetInt(fd, unix.TCFLSH, unix.TCIFLUSH)
+	})
+	if nil != err {
+		port.Close()
+		return nil, errors.Wrap(err, "could not configure %s: %s", name, err)
+	}
+	return port, nil
+}
+
+// OpenPTY creates a pseudo-terminal for the simulator. The simulator serves
+// the master; the raw mode slave is held open so the master keeps reading
+// between clients, and its name is the port clients open.
+func OpenPTY() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if nil != err {
+		return nil, nil, err
+	}
+	var name string
+	err = control(master, func(fd int) error {
+		err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0)
+		if nil != err {
+			return err
+		}
+		n, err := unix.IoctlGetUint32(fd, unix.TIOCGPTN)
+		name = fmt.Sprintf("/dev/pts/%d", n)
+		return err
+	})
+	if nil == err {
+		slave, err = os.OpenFile(name, os.O_RDWR|unix.O_NOCTTY, 0)
+	}
+	if nil == err {
+		err = control(slave, func(fd int) error {
+			tio, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+			if nil != err {
+				return err
+			}
+			makeRaw(tio)
+			return unix.IoctlSetTermios(fd, unix.TCSETS, tio)
+		})
+	}
+	if nil != err {
+		master.Close()
+		if nil != slave {
+			slave.Close()
+		}
+		return nil, nil, errors.Wrap(err, "could not create pseudo-terminal: %s", err)
+	}
+	return master, slave, nil
+}
+
+// makeRaw turns off line editing, echo and character translation, as
+// cfmakeraw.
+func makeRaw(tio *unix.Termios) {
+	tio.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	tio.Oflag &^= unix.OPOST
+	tio.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	tio.Cflag &^= unix.CSIZE | unix.PARENB
+	tio.Cflag |= unix.CS8
+	tio.Cc[unix.VMIN] = 1
+	tio.Cc[unix.VTIME] = 0
+}
+
+// control runs fn on a file's descriptor without taking it out of the
+// runtime poller, as Fd would.
+func control(file *os.File, fn func(fd int) error) error {
+	conn, err := file.SyscallConn()
+	if nil != err {
+		return err
+	}
+	var fnErr error
+	err = conn.Control(func(fd uintptr) {
+		fnErr = fn(int(fd))
+	})
+	if nil != err {
+		return err
+	}
+	return fnErr
+}
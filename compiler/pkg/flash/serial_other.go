@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package flash
+
+import (
+	"os"
+
+	"github.com/bdlm/errors/v2"
+)
+
+// OpenPort opens a serial port; only Linux is supported.
+func OpenPort(name string, baud int) (*os.File, error) {
+	return nil, errors.Errorf("serial ports are only supported on Linux")
+}
+
+// OpenPTY creates a pseudo-terminal for the simulator; only Linux is
+// supported.
+func OpenPTY() (master, slave *os.File, err error) {
+	return nil, nil, errors.Errorf("the programmer simulator is only supported on Linux")
+}
@@ -0,0 +1,131 @@
+package flash
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/eeprom"
+)
+
+// Simulator is a programmer in software, with an EEPROM in memory, so the
+// flash flow can be exercised without hardware.
+type Simulator struct {
+	Part eeprom.Part
+	// EEPROM contents
+	Mem []byte
+	// go silent after this many writes, as if the programmer were unplugged
+	// mid-burn, 0 for never
+	FailAfter int
+	// called after each write or erase, to persist Mem
+	Changed func(mem []byte) error
+
+	writes int
+}
+
+// NewSimulator returns a simulator with an erased part in its socket.
+func NewSimulator(part eeprom.Part) *Simulator {
+	sim := &Simulator{Part: part, Mem: make([]byte, part.Size)}
+	for k := range sim.Mem {
+		sim.Mem[k] = 0xFF
+	}
+	return sim
+}
+
+// Serve answers commands until the connection is closed.
+func (sim *Simulator) Serve(conn io.ReadWriter) error {
+	in := bufio.NewReader(conn)
+	for {
+		line, err := in.ReadString('\n')
+		if io.EOF == err {
+			return nil
+		}
+		if nil != err {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		if "" == line || (0 < sim.FailAfter && sim.writes >= sim.FailAfter) {
+			continue
+		}
+		_, err = io.WriteString(conn, sim.exec(line)+"\n")
+		if nil != err {
+			return err
+		}
+	}
+}
+
+// exec runs one command and returns the reply.
+func (sim *Simulator) exec(line string) string {
+	fields := strings.Fields(line)
+	args := []int{}
+	var data []byte
+	for k, field := range fields[1:] {
+		if 1 == k && ("W" == fields[0] || "V" == fields[0]) {
+			byts, err := hex.DecodeString(field)
+			if nil != err || 0 == len(byts) {
+				return "ERR bad data"
+			}
+			data = byts
+			continue
+		}
+		n, err := strconv.ParseUint(field, 16, 16)
+		if nil != err {
+			return "ERR bad number " + field
+		}
+		args = append(args, int(n))
+	}
+
+	switch true {
+	case "I" == fields[0] && 0 == len(args):
+		return fmt.Sprintf("OK %s %X %X", sim.Part.Name, sim.Part.Size, sim.Part.PageSize)
+
+	case "R" == fields[0] && 2 == len(args):
+		addr, n := args[0], args[1]
+		if n > BLOCK || addr+n > len(sim.Mem) {
+			return "ERR bad range"
+		}
+		return fmt.Sprintf("OK %X", sim.Mem[addr:addr+n])
+
+	case "W" == fields[0] && 1 == len(args) && nil != data:
+		addr := args[0]
+		if len(data) > BLOCK || addr+len(data) > len(sim.Mem) || addr/BLOCK != (addr+len(data)-1)/BLOCK {
+			return "ERR bad range"
+		}
+		copy(sim.Mem[addr:], data)
+		sim.writes++
+		return sim.changed()
+
+	case "V" == fields[0] && 1 == len(args) && nil != data:
+		addr := args[0]
+		if len(data) > BLOCK || addr+len(data) > len(sim.Mem) {
+			return "ERR bad range"
+		}
+		for k, b := range data {
+			if b != sim.Mem[addr+k] {
+				return fmt.Sprintf("ERR mismatch at %04X", addr+k)
+			}
+		}
+		return "OK"
+
+	case "E" == fields[0] && 0 == len(args):
+		for k := range sim.Mem {
+			sim.Mem[k] = 0xFF
+		}
+		return sim.changed()
+	}
+	return "ERR unknown command " + line
+}
+
+// changed persists a write.
+func (sim *Simulator) changed() string {
+	if nil != sim.Changed {
+		err := sim.Changed(sim.Mem)
+		if nil != err {
+			return "ERR " + err.Error()
+		}
+	}
+	return "OK"
+}
@@ -6,4 +6,5 @@ require (
 	github.com/bdlm/errors/v2 v2.1.2
 	github.com/bdlm/log/v2 v2.0.3
 	golang.org/x/crypto v0.7.0 // indirect
+	golang.org/x/sys v0.6.0
 )
@@ -0,0 +1,573 @@
+// Package lsp implements a Language Server Protocol server for bcc assembly
+// source files. Documents are analyzed in memory on every change by the
+// assembler, without building files or starting processes.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/ucode"
+
+	"github.com/bdlm/errors/v2"
+)
+
+// Server is a language server connected to a client over a pair of streams.
+type Server interface {
+	Serve() error
+}
+
+// ErrNoShutdown is returned by Serve when the client sends `exit` without
+// asking the server to shut down first.
+var ErrNoShutdown = errors.Errorf("exit without shutdown")
+
+// server handles requests one at a time, in the order they arrive.
+type server struct {
+	in  *bufio.Reader
+	out io.Writer
+	mu  sync.Mutex // guards out
+
+	// uri => current analysis
+	docs map[string]*bcc.Analysis
+	// after shutdown only exit is handled
+	shutdown bool
+}
+
+// New returns a server reading requests from in and writing responses and
+// notifications to out.
+func New(in io.Reader, out io.Writer) *server {
+	return &server{
+		in:   bufio.NewReader(in),
+		out:  out,
+		docs: map[string]*bcc.Analysis{},
+	}
+}
+
+// Serve handles messages until the client sends `exit` or closes the input.
+// Exiting before a shutdown request returns ErrNoShutdown.
+func (srv *server) Serve() error {
+	for {
+		msg, err := srv.read()
+		if io.EOF == errors.Unwrap(err) || io.EOF == err {
+			return nil
+		}
+		if nil != err {
+			return errors.Wrap(err, "could not read message")
+		}
+		if "exit" == msg.Method {
+			if !srv.shutdown {
+				return ErrNoShutdown
+			}
+			return nil
+		}
+
+		var result interface{}
+		var rpcErr *responseError
+		if srv.shutdown {
+			rpcErr = &responseError{Code: ERR_INVALID_REQUEST, Message: "server is shut down"}
+		} else {
+			result, rpcErr = srv.handle(msg)
+		}
+		if nil == msg.ID {
+			continue
+		}
+		resp := &message{JSONRPC: "2.0", ID: msg.ID, Result: result, Error: rpcErr}
+		if nil == rpcErr && nil == result {
+			// null results must still be sent
+			raw := json.RawMessage("null")
+			resp.Result = &raw
+		}
+		err = srv.write(resp)
+		if nil != err {
+			return errors.Wrap(err, "could not write response")
+		}
+	}
+}
+
+// read reads one Content-Length framed message.
+func (srv *server) read() (*message, error) {
+	header, err := textproto.NewReader(srv.in).ReadMIMEHeader()
+	if nil != err {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if nil != err {
+		return nil, errors.Wrap(err, "invalid Content-Length header")
+	}
+	body := make([]byte, length)
+	_, err = io.ReadFull(srv.in, body)
+	if nil != err {
+		return nil, errors.Wrap(err, "short message body")
+	}
+	msg := &message{}
+	err = json.Unmarshal(body, msg)
+	if nil != err {
+		return nil, errors.Wrap(err, "invalid message")
+	}
+	return msg, nil
+}
+
+// write writes one Content-Length framed message.
+func (srv *server) write(msg *message) error {
+	msg.JSONRPC = "2.0"
+	body, err := json.Marshal(msg)
+	if nil != err {
+		return err
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	_, err = fmt.Fprintf(srv.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+// notify sends a notification to the client.
+func (srv *server) notify(method string, params interface{}) error {
+	raw, err := json.Marshal(params)
+	if nil != err {
+		return err
+	}
+	return srv.write(&message{Method: method, Params: raw})
+}
+
+// handle dispatches a request or notification.
+func (srv *server) handle(msg *message) (interface{}, *responseError) {
+	decode := func(v interface{}) *responseError {
+		if err := json.Unmarshal(msg.Params, v); nil != err {
+			return &responseError{Code: ERR_INVALID_PARAMS, Message: err.Error()}
+		}
+		return nil
+	}
+
+	switch msg.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":       1, // full
+				"hoverProvider":          true,
+				"definitionProvider":     true,
+				"referencesProvider":     true,
+				"renameProvider":         true,
+				"documentSymbolProvider": true,
+				"completionProvider": map[string]interface{}{
+					"triggerCharacters": []string{"$"},
+				},
+			},
+			"serverInfo": map[string]string{"name": "bcc"},
+		}, nil
+
+	case "initialized", "$/cancelRequest", "$/setTrace", "workspace/didChangeConfiguration", "textDocument/didSave":
+		return nil, nil
+
+	case "shutdown":
+		srv.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		params := didOpenParams{}
+		if err := decode(&params); nil != err {
+			return nil, err
+		}
+		srv.update(params.TextDocument.URI, params.TextDocument.Text)
+		return nil, nil
+
+	case "textDocument/didChange":
+		params := didChangeParams{}
+		if err := decode(&params); nil != err {
+			return nil, err
+		}
+		if n := len(params.ContentChanges); 0 < n {
+			srv.update(params.TextDocument.URI, params.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+
+	case "textDocument/didClose":
+		params := didChangeParams{}
+		if err := decode(&params); nil != err {
+			return nil, err
+		}
+		delete(srv.docs, params.TextDocument.URI)
+		srv.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []diagnostic{}})
+		return nil, nil
+
+	case "textDocument/hover":
+		params := textDocumentPositionParams{}
+		if err := decode(&params); nil != err {
+			return nil, err
+		}
+		return srv.hover(params)
+
+	case "textDocument/definition":
+		params := textDocumentPositionParams{}
+		if err := decode(&params); nil != err {
+			return nil, err
+		}
+		return srv.definition(params)
+
+	case "textDocument/references":
+		params := referenceParams{}
+		if err := decode(&params); nil != err {
+			return nil, err
+		}
+		return srv.references(params)
+
+	case "textDocument/completion":
+		params := textDocumentPositionParams{}
+		if err := decode(&params); nil != err {
+			return nil, err
+		}
+		return srv.completion(params)
+
+	case "textDocument/rename":
+		params := renameParams{}
+		if err := decode(&params); nil != err {
+			return nil, err
+		}
+		return srv.rename(params)
+
+	case "textDocument/documentSymbol":
+		params := textDocumentPositionParams{}
+		if err := decode(&params); nil != err {
+			return nil, err
+		}
+		return srv.documentSymbols(params)
+	}
+
+	return nil, &responseError{Code: ERR_METHOD_NOT_FOUND, Message: fmt.Sprintf("method '%s' not supported", msg.Method)}
+}
+
+// update analyzes a document and publishes its diagnostics.
+func (srv *server) update(uri, text string) {
+	includes := []string{}
+	if path, ok := uriPath(uri); ok {
+		includes = append(includes, filepath.Dir(path))
+	}
+	an := bcc.Analyze([]byte(text), includes...)
+	srv.docs[uri] = an
+
+	diags := []diagnostic{}
+	for _, diag := range an.Diagnostics {
+		if "" != diag.File {
+			continue // reported when the included file is open
+		}
+		sev := SEVERITY_WARNING
+		if bcc.SEV_ERROR == diag.Severity {
+			sev = SEVERITY_ERROR
+		}
+		line := diag.Line - 1
+		if line < 0 {
+			line = 0
+		}
+		end := 0
+		if line < len(an.Lines) {
+			end = utf16Len(strings.TrimRight(an.Lines[line], " \t\r"))
+		}
+		diags = append(diags, diagnostic{
+			Range:    rng{position{line, 0}, position{line, end}},
+			Severity: sev,
+			Code:     diag.Rule,
+			Source:   "bcc",
+			Message:  diag.Message,
+		})
+	}
+	srv.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: diags})
+}
+
+// uriPath returns the filesystem path of a file URI.
+func uriPath(uri string) (string, bool) {
+	u, err := url.Parse(uri)
+	if nil != err || "file" != u.Scheme {
+		return "", false
+	}
+	return u.Path, true
+}
+
+// utf16Len returns the length of a string in UTF-16 code units, the unit of
+// protocol positions.
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n++
+		if r > 0xFFFF {
+			n++ // surrogate pair
+		}
+	}
+	return n
+}
+
+// byteCol converts a protocol character offset in a line to a byte offset.
+// Offsets past the end of the line are clamped to it.
+func byteCol(line string, char int) int {
+	n := 0
+	for k, r := range line {
+		if n >= char {
+			return k
+		}
+		n += utf16Len(string(r))
+	}
+	return len(line)
+}
+
+// lineText returns a line of a document, or "" if it has no such line. Files
+// that are not open are read from disk.
+func (srv *server) lineText(uri string, line int) string {
+	lines := []string{}
+	if an, ok := srv.docs[uri]; ok {
+		lines = an.Lines
+	} else if path, ok := uriPath(uri); ok {
+		src, _ := ioutil.ReadFile(path)
+		lines = strings.Split(string(src), "\n")
+	}
+	if line < 0 || line >= len(lines) {
+		return ""
+	}
+	return lines[line]
+}
+
+// spanLocation returns the location of a span, in the document or a file it
+// includes.
+func (srv *server) spanLocation(uri string, span bcc.Span) location {
+	if "" != span.File {
+		path, _ := filepath.Abs(span.File)
+		uri = (&url.URL{Scheme: "file", Path: path}).String()
+	}
+	return location{uri, spanRange(srv.lineText(uri, span.Line-1), span)}
+}
+
+// spanRange converts an analysis span of a line to a protocol range.
+func spanRange(line string, span bcc.Span) rng {
+	start, end := span.Col, span.Col+span.Len
+	if end <= len(line) && utf8.ValidString(line[:end]) {
+		start, end = utf16Len(line[:start]), utf16Len(line[:end])
+	}
+	return rng{
+		Start: position{span.Line - 1, start},
+		End:   position{span.Line - 1, end},
+	}
+}
+
+// docPosition returns the analysis of a document and a protocol position as
+// a 1-based line and byte offset.
+func (srv *server) docPosition(params textDocumentPositionParams) (*bcc.Analysis, int, int, *responseError) {
+	an, ok := srv.docs[params.TextDocument.URI]
+	if !ok {
+		return nil, 0, 0, &responseError{Code: ERR_REQUEST_FAILED, Message: "document is not open"}
+	}
+	line := params.Position.Line
+	col := params.Position.Character
+	if 0 <= line && line < len(an.Lines) {
+		col = byteCol(an.Lines[line], col)
+	}
+	return an, line + 1, col, nil
+}
+
+// lookup returns the analysis of a document and the symbol at a position.
+func (srv *server) lookup(params textDocumentPositionParams) (*bcc.Analysis, *bcc.Symbol, *responseError) {
+	an, line, col, rpcErr := srv.docPosition(params)
+	if nil != rpcErr {
+		return nil, nil, rpcErr
+	}
+	sym, _ := an.SymbolAt(line, col)
+	return an, sym, nil
+}
+
+// symbolDetail describes a symbol.
+func symbolDetail(sym *bcc.Symbol) string {
+	switch true {
+	case bcc.SYM_CONST == sym.Kind:
+		return fmt.Sprintf("constant = 0x%02X (%d)", sym.Value, sym.Value)
+	case sym.Value < 0:
+		return string(sym.Kind)
+	}
+	return fmt.Sprintf("%s at 0x%02X", sym.Kind, sym.Value)
+}
+
+// hover describes the symbol or mnemonic at a position.
+func (srv *server) hover(params textDocumentPositionParams) (interface{}, *responseError) {
+	an, sym, rpcErr := srv.lookup(params)
+	if nil != rpcErr {
+		return nil, rpcErr
+	}
+	if nil != sym {
+		text := fmt.Sprintf("**%s** `%s`\n\n%s, defined on line %d, %d reference(s)", sym.Kind, sym.Name, symbolDetail(sym), sym.Def.Line, len(sym.Refs))
+		return hover{Contents: markupContent{"markdown", text}}, nil
+	}
+
+	_, line, col, _ := srv.docPosition(params)
+	field, _, ok := an.FieldAt(line, col)
+	if !ok {
+		return nil, nil
+	}
+	text, ok := opHover(field.Text)
+	if !ok {
+		return nil, nil
+	}
+	r := spanRange(an.Lines[line-1], field.Span)
+	return hover{Contents: markupContent{"markdown", text}, Range: &r}, nil
+}
+
+// opHover documents a mnemonic.
+func opHover(name string) (string, bool) {
+	doc, operand, ok := bcc.OpDoc(name)
+	if !ok {
+		return "", false
+	}
+	cycles, _ := ucode.Cycles(name)
+	code, _ := bcc.Opcode(name)
+	signature := name
+	size := 1
+	if "" != operand {
+		signature = signature + " <" + operand + ">"
+		size = 2
+	}
+	return fmt.Sprintf("**%s**\n\n%s\n\n%d cycles, %d byte(s), opcode 0x%02X", signature, doc, cycles, size, code), true
+}
+
+// definition returns where the symbol at a position is defined.
+func (srv *server) definition(params textDocumentPositionParams) (interface{}, *responseError) {
+	_, sym, rpcErr := srv.lookup(params)
+	if nil != rpcErr || nil == sym {
+		return nil, rpcErr
+	}
+	return srv.spanLocation(params.TextDocument.URI, sym.Def), nil
+}
+
+// references returns where the symbol at a position is used.
+func (srv *server) references(params referenceParams) (interface{}, *responseError) {
+	_, sym, rpcErr := srv.lookup(params.textDocumentPositionParams)
+	if nil != rpcErr || nil == sym {
+		return nil, rpcErr
+	}
+	locs := []location{}
+	if params.Context.IncludeDeclaration {
+		locs = append(locs, srv.spanLocation(params.TextDocument.URI, sym.Def))
+	}
+	for _, ref := range sym.Refs {
+		locs = append(locs, srv.spanLocation(params.TextDocument.URI, ref))
+	}
+	return locs, nil
+}
+
+// completion offers mnemonics at the start of an instruction and the
+// symbols its operand accepts after it.
+func (srv *server) completion(params textDocumentPositionParams) (interface{}, *responseError) {
+	an, line, col, rpcErr := srv.docPosition(params)
+	if nil != rpcErr {
+		return nil, rpcErr
+	}
+	items := []completionItem{}
+	if line < 1 || line > len(an.Lines) {
+		return items, nil
+	}
+	text := an.Lines[line-1][:col]
+	// labels, constants and subroutines are defined at column 0
+	if "" == text || (' ' != text[0] && '\t' != text[0]) || strings.Contains(text, "#") {
+		return items, nil
+	}
+
+	fields := bcc.LineFields(text)
+	if !strings.HasSuffix(text, " ") && !strings.HasSuffix(text, "\t") && 0 < len(fields) {
+		fields = fields[:len(fields)-1] // the field being typed
+	}
+
+	switch len(fields) {
+	case 0:
+		for _, name := range bcc.OpNames() {
+			_, operand, _ := bcc.OpDoc(name)
+			text, _ := opHover(name)
+			items = append(items, completionItem{Label: name, Kind: COMPLETION_KEYWORD, Detail: operand, Documentation: &markupContent{"markdown", text}})
+		}
+	case 1:
+		_, operand, ok := bcc.OpDoc(fields[0].Text)
+		if !ok || "" == operand {
+			break
+		}
+		for _, sym := range an.Symbols {
+			switch true {
+			case "subroutine" == operand && bcc.SYM_SUB == sym.Kind:
+				items = append(items, completionItem{Label: sym.Name, Kind: COMPLETION_FUNCTION, Detail: symbolDetail(sym)})
+			case "label" == operand && bcc.SYM_LABEL == sym.Kind:
+				items = append(items, completionItem{Label: sym.Name, Kind: COMPLETION_REFERENCE, Detail: symbolDetail(sym)})
+			case strings.HasPrefix(operand, "$const") && bcc.SYM_CONST == sym.Kind:
+				items = append(items, completionItem{Label: sym.Name, Kind: COMPLETION_CONSTANT, Detail: symbolDetail(sym)})
+			}
+		}
+	}
+	return items, nil
+}
+
+// rename renames the symbol at a position and every reference to it.
+func (srv *server) rename(params renameParams) (interface{}, *responseError) {
+	an, sym, rpcErr := srv.lookup(params.textDocumentPositionParams)
+	if nil != rpcErr {
+		return nil, rpcErr
+	}
+	if nil == sym {
+		return nil, &responseError{Code: ERR_REQUEST_FAILED, Message: "no symbol at this position"}
+	}
+
+	name := params.NewName
+	if bcc.SYM_CONST == sym.Kind && !strings.HasPrefix(name, "$") {
+		name = "$" + name
+	}
+	if "" == strings.TrimPrefix(name, "$") || strings.ContainsAny(name, " \t#{}") || (bcc.SYM_CONST != sym.Kind && strings.HasPrefix(name, "$")) {
+		return nil, &responseError{Code: ERR_REQUEST_FAILED, Message: fmt.Sprintf("'%s' is not a valid %s name", name, sym.Kind)}
+	}
+	if _, ok := bcc.Opcode(name); ok {
+		return nil, &responseError{Code: ERR_REQUEST_FAILED, Message: fmt.Sprintf("'%s' is an operation", name)}
+	}
+	for _, other := range an.Lookup(name) {
+		if other.Kind == sym.Kind && other != sym {
+			return nil, &responseError{Code: ERR_REQUEST_FAILED, Message: fmt.Sprintf("%s '%s' is already defined on line %d", other.Kind, name, other.Def.Line)}
+		}
+	}
+
+	changes := map[string][]textEdit{}
+	for _, span := range append([]bcc.Span{sym.Def}, sym.Refs...) {
+		loc := srv.spanLocation(params.TextDocument.URI, span)
+		changes[loc.URI] = append(changes[loc.URI], textEdit{loc.Range, name})
+	}
+	return workspaceEdit{Changes: changes}, nil
+}
+
+// documentSymbols lists the labels, subroutines and constants of a document.
+func (srv *server) documentSymbols(params textDocumentPositionParams) (interface{}, *responseError) {
+	an, ok := srv.docs[params.TextDocument.URI]
+	if !ok {
+		return nil, &responseError{Code: ERR_REQUEST_FAILED, Message: "document is not open"}
+	}
+	syms := []documentSymbol{}
+	for _, sym := range an.Symbols {
+		if "" != sym.Def.File {
+			continue
+		}
+		def := spanRange(an.Lines[sym.Def.Line-1], sym.Def)
+		ds := documentSymbol{
+			Name:           sym.Name,
+			Detail:         symbolDetail(sym),
+			Range:          def,
+			SelectionRange: def,
+		}
+		switch sym.Kind {
+		case bcc.SYM_SUB:
+			ds.Kind = SYMBOL_FUNCTION
+			ds.Range.End = position{sym.End - 1, utf16Len(an.Lines[sym.End-1])}
+		case bcc.SYM_CONST:
+			ds.Kind = SYMBOL_CONSTANT
+		default:
+			ds.Kind = SYMBOL_KEY
+		}
+		syms = append(syms, ds)
+	}
+	return syms, nil
+}
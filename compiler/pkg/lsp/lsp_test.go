@@ -0,0 +1,205 @@
+package lsp_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/lsp"
+)
+
+// the constant name is 11 bytes and 8 UTF-16 code units long
+const src = "$naïve😀 1\nloop\n    LDAV $naïve😀\n    OUTA\n    JMP  nowhere\n"
+
+const uri = "untitled:fib.asm"
+
+// client talks to a server running in the test.
+type client struct {
+	t    *testing.T
+	in   *io.PipeWriter
+	out  *bufio.Reader
+	id   int
+	done chan error
+}
+
+func newClient(t *testing.T) *client {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &client{t: t, in: inW, out: bufio.NewReader(outR), done: make(chan error, 1)}
+	go func() {
+		err := lsp.New(inR, outW).Serve()
+		outW.Close()
+		c.done <- err
+	}()
+	return c
+}
+
+// send writes a request, or a notification if id is 0.
+func (c *client) send(id int, method string, params interface{}) {
+	c.t.Helper()
+	msg := map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params}
+	if 0 != id {
+		msg["id"] = id
+	}
+	body, err := json.Marshal(msg)
+	if nil != err {
+		c.t.Fatal(err)
+	}
+	_, err = fmt.Fprintf(c.in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	if nil != err {
+		c.t.Fatalf("send %s: %s", method, err)
+	}
+}
+
+// message is a response or notification from the server.
+type message struct {
+	ID     int             `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code int `json:"code"`
+	} `json:"error"`
+}
+
+// read reads the next message from the server.
+func (c *client) read() *message {
+	c.t.Helper()
+	header, err := textproto.NewReader(c.out).ReadMIMEHeader()
+	if nil != err {
+		c.t.Fatalf("read header: %s", err)
+	}
+	length, _ := strconv.Atoi(header.Get("Content-Length"))
+	body := make([]byte, length)
+	if _, err = io.ReadFull(c.out, body); nil != err {
+		c.t.Fatalf("read body: %s", err)
+	}
+	msg := &message{}
+	if err = json.Unmarshal(body, msg); nil != err {
+		c.t.Fatalf("invalid message %s: %s", body, err)
+	}
+	return msg
+}
+
+// call sends a request and decodes its result into v.
+func (c *client) call(method string, params interface{}, v interface{}) {
+	c.t.Helper()
+	c.id++
+	c.send(c.id, method, params)
+	msg := c.read()
+	if c.id != msg.ID || nil != msg.Error {
+		c.t.Fatalf("%s: got response %d, error %v", method, msg.ID, msg.Error)
+	}
+	if err := json.Unmarshal(msg.Result, v); nil != err {
+		c.t.Fatalf("%s: invalid result %s: %s", method, msg.Result, err)
+	}
+}
+
+// exit sends exit and returns what Serve returned.
+func (c *client) exit() error {
+	c.send(0, "exit", nil)
+	return <-c.done
+}
+
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type rng struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+type textEdit struct {
+	Range   rng    `json:"range"`
+	NewText string `json:"newText"`
+}
+
+func at(line, char int) map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument": map[string]string{"uri": uri},
+		"position":     position{line, char},
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	c := newClient(t)
+
+	caps := struct {
+		Capabilities map[string]interface{} `json:"capabilities"`
+	}{}
+	c.call("initialize", map[string]interface{}{}, &caps)
+	if true != caps.Capabilities["definitionProvider"] || true != caps.Capabilities["renameProvider"] {
+		t.Errorf("capabilities: %v", caps.Capabilities)
+	}
+	c.send(0, "initialized", map[string]interface{}{})
+
+	c.send(0, "textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]string{"uri": uri, "text": src},
+	})
+	msg := c.read()
+	published := struct {
+		URI         string `json:"uri"`
+		Diagnostics []struct {
+			Range rng    `json:"range"`
+			Code  string `json:"code"`
+		} `json:"diagnostics"`
+	}{}
+	json.Unmarshal(msg.Params, &published)
+	if "textDocument/publishDiagnostics" != msg.Method || uri != published.URI || 2 != len(published.Diagnostics) {
+		t.Fatalf("didOpen: got %s %s", msg.Method, msg.Params)
+	}
+	if diag := published.Diagnostics[1]; "undefined" != diag.Code || (rng{position{4, 0}, position{4, 16}}) != diag.Range {
+		t.Errorf("diagnostic: got %+v, want undefined on line 4", diag)
+	}
+
+	// positions are UTF-16 code units, the reference is 9-17
+	def := struct {
+		URI   string `json:"uri"`
+		Range rng    `json:"range"`
+	}{}
+	c.call("textDocument/definition", at(2, 16), &def)
+	if uri != def.URI || (rng{position{0, 0}, position{0, 8}}) != def.Range {
+		t.Errorf("definition: got %+v, want 0:0-0:8", def)
+	}
+
+	edit := struct {
+		Changes map[string][]textEdit `json:"changes"`
+	}{}
+	params := at(2, 17)
+	params["newName"] = "count"
+	c.call("textDocument/rename", params, &edit)
+	want := []textEdit{
+		{rng{position{0, 0}, position{0, 8}}, "$count"},
+		{rng{position{2, 9}, position{2, 17}}, "$count"},
+	}
+	if !reflect.DeepEqual(edit.Changes[uri], want) {
+		t.Errorf("rename: got %+v, want %+v", edit.Changes, want)
+	}
+
+	var result interface{}
+	c.call("shutdown", nil, &result)
+	c.id++
+	c.send(c.id, "textDocument/definition", at(2, 16))
+	if msg := c.read(); nil == msg.Error || -32600 != msg.Error.Code {
+		t.Errorf("request after shutdown: got %+v, want an invalid request error", msg)
+	}
+	if err := c.exit(); nil != err {
+		t.Errorf("exit after shutdown: %v", err)
+	}
+}
+
+func TestExitWithoutShutdown(t *testing.T) {
+	c := newClient(t)
+	var result interface{}
+	c.call("initialize", map[string]interface{}{}, &result)
+	if err := c.exit(); lsp.ErrNoShutdown != err {
+		t.Errorf("exit: got %v, want %v", err, lsp.ErrNoShutdown)
+	}
+}
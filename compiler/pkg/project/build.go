@@ -0,0 +1,146 @@
+package project
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+
+	"github.com/bdlm/errors/v2"
+)
+
+// Result is the outcome of building one source for one target.
+type Result struct {
+	Target *Target
+	Source string
+	// nil if the source did not assemble
+	Program *bcc.Program
+	// files written
+	Files []string
+	Err   error
+}
+
+// Build assembles every source of the named targets, all targets if none are
+// named, and writes each image in every format of its target, with its debug
+// info, to OutDir(target):
+//
+//	build/stackless/fib.img
+//	build/stackless/fib.img.dbg
+//	build/stackless/fib.hex
+//
+// Sources that fail to assemble are reported in their Result and do not stop
+// the build; the error is for problems with the project itself.
+func (proj *Project) Build(ctx context.Context, names ...string) ([]*Result, error) {
+	targets := proj.Targets
+	if 0 < len(names) {
+		targets = []*Target{}
+		for _, name := range names {
+			target, ok := proj.Target(name)
+			if !ok {
+				return nil, errors.Errorf("unknown target '%s'", name)
+			}
+			targets = append(targets, target)
+		}
+	}
+
+	results := []*Result{}
+	for _, target := range targets {
+		hw := bcc.DefaultTarget()
+		hw.Name = target.Name
+		if "" != target.ISA {
+			var err error
+			hw, err = LoadISA(proj.path(target.ISA))
+			if nil != err {
+				return nil, errors.Wrap(err, "target %s: %s", target.Name, err)
+			}
+			hw.Name = target.Name
+		}
+
+		dir := proj.OutDir(target)
+		err := os.MkdirAll(dir, 0755)
+		if nil != err {
+			return nil, err
+		}
+
+		includes := []string{}
+		for _, path := range append(append([]string{}, proj.Include...), target.Include...) {
+			includes = append(includes, proj.path(path))
+		}
+		opts := []bcc.Option{
+			bcc.WithTarget(hw),
+			bcc.WithIncludePaths(includes...),
+			bcc.WithOptimization(target.Optimize),
+			bcc.WithMetadata(bcc.META_EMBED == target.Metadata),
+		}
+		for name, value := range target.Defines {
+			opts = append(opts, bcc.WithDefine(name, value))
+		}
+
+		for _, source := range target.Sources {
+			res := &Result{Target: target, Source: proj.path(source)}
+			res.Program, res.Files, res.Err = proj.buildSource(ctx, target, res.Source, dir, opts)
+			results = append(results, res)
+			if nil != ctx.Err() {
+				return results, ctx.Err()
+			}
+		}
+	}
+	return results, nil
+}
+
+// buildSource assembles one source and writes its outputs.
+func (proj *Project) buildSource(ctx context.Context, target *Target, source, dir string, opts []bcc.Option) (*bcc.Program, []string, error) {
+	f, err := os.Open(source)
+	if nil != err {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	prog, err := bcc.NewAssembler(append(opts, bcc.WithSourceName(source))...).Assemble(ctx, f)
+	if nil != err {
+		return prog, nil, err
+	}
+
+	base := filepath.Join(dir, strings.TrimSuffix(filepath.Base(source), filepath.Ext(source)))
+	files := []string{}
+	for _, format := range target.Formats {
+		file := base + ".img"
+		out := prog.Image
+		if bcc.FORMAT_IHEX == format {
+			file = base + ".hex"
+			out = bcc.IntelHex(prog.Image[:prog.Size])
+		} else {
+			out, err = target.EEPROM.Fit(prog.Image, prog.Size)
+			if nil != err {
+				return prog, files, err
+			}
+		}
+		err = ioutil.WriteFile(file, out, 0644)
+		if nil != err {
+			return prog, files, err
+		}
+		files = append(files, file)
+
+		if bcc.META_SIDECAR == target.Metadata {
+			err = prog.Meta.WriteSidecar(file)
+			if nil != err {
+				return prog, files, err
+			}
+			files = append(files, file+bcc.MetaExt)
+		}
+
+		dbg, err := os.Create(file + bcc.DebugExt)
+		if nil == err {
+			_, err = prog.DebugInfo(source).WriteTo(dbg)
+			dbg.Close()
+		}
+		if nil != err {
+			return prog, files, err
+		}
+		files = append(files, file+bcc.DebugExt)
+	}
+	return prog, files, nil
+}
@@ -0,0 +1,107 @@
+package project_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/project"
+)
+
+// TestExamples builds the example project into a temporary directory.
+func TestExamples(t *testing.T) {
+	dir, err := ioutil.TempDir("", "project")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	proj, err := project.Load("../../" + project.File)
+	if nil != err {
+		t.Fatalf("load: %s", err)
+	}
+	proj.Out = dir
+
+	results, err := proj.Build(context.Background(), "stackless")
+	if nil != err {
+		t.Fatalf("build: %s", err)
+	}
+	if 2 != len(results) {
+		t.Fatalf("results: got %d, want fib.asm and add.asm", len(results))
+	}
+	for _, res := range results {
+		if nil != res.Err {
+			t.Errorf("%s: %s", res.Source, res.Err)
+			continue
+		}
+		base := filepath.Join(dir, "stackless", strings.TrimSuffix(filepath.Base(res.Source), ".asm"))
+		if want := base + ".img " + base + ".img" + bcc.DebugExt; strings.Join(res.Files, " ") != want {
+			t.Errorf("%s: wrote %v, want %s", res.Source, res.Files, want)
+		}
+		img, err := ioutil.ReadFile(base + ".img")
+		if nil != err || 2048 != len(img) {
+			t.Errorf("%s: got a %d byte image, %v, want a 28C16 image", res.Source, len(img), err)
+		}
+	}
+
+	if _, err = proj.Build(context.Background(), "nope"); nil == err || !strings.Contains(err.Error(), "unknown target 'nope'") {
+		t.Errorf("unknown target: got %v", err)
+	}
+}
+
+// TestBuildErrors checks a source that doesn't assemble for its target is
+// reported without stopping the build.
+func TestBuildErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "project")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		project.File: `
+[target.small]
+isa = "small.toml"
+sources = ["push.asm", "out.asm"]
+formats = ["ihex"]
+metadata = "sidecar"
+`,
+		"small.toml": "exclude = [\"PSHA\"]\n",
+		"push.asm":   "    PSHA\n    HLT\n",
+		"out.asm":    "    OUTA\n    HLT\n",
+	}
+	for name, src := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); nil != err {
+			t.Fatal(err)
+		}
+	}
+	proj, err := project.Load(filepath.Join(dir, project.File))
+	if nil != err {
+		t.Fatalf("load: %s", err)
+	}
+
+	results, err := proj.Build(context.Background())
+	if nil != err {
+		t.Fatalf("build: %s", err)
+	}
+	if 2 != len(results) || nil == results[0].Err || nil != results[0].Files || nil != results[1].Err {
+		t.Fatalf("results: got %+v", results)
+	}
+	if diags := results[0].Program.Diagnostics; 1 != len(diags) || "unsupported" != diags[0].Rule {
+		t.Errorf("push.asm: got %v, want PSHA unsupported", diags)
+	}
+	hex := filepath.Join(dir, project.OutDir, "small", "out.hex")
+	if want := hex + " " + hex + bcc.MetaExt + " " + hex + bcc.DebugExt; strings.Join(results[1].Files, " ") != want {
+		t.Errorf("out.asm: wrote %v, want %s", results[1].Files, want)
+	}
+
+	// an ISA file that can't be read stops the build
+	proj.Targets[0].ISA = "missing.toml"
+	if _, err = proj.Build(context.Background()); nil == err || !strings.Contains(err.Error(), "target small") {
+		t.Errorf("missing ISA: got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package project
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+
+	"github.com/bdlm/errors/v2"
+)
+
+// LoadISA reads an ISA file, which describes the hardware of one variant of
+// the computer:
+//
+//	name = "stackless"
+//	stack = 0                           # hardware stack depth
+//	exclude = ["RUN", "PSHA", "POPA"]   # or ops = [...] to list them all
+//
+// Operations default to every operation the assembler knows.
+func LoadISA(file string) (bcc.Target, error) {
+	byts, err := ioutil.ReadFile(file)
+	if nil != err {
+		return bcc.Target{}, err
+	}
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	target, err := ParseISA(string(byts), name)
+	if nil != err {
+		return bcc.Target{}, errors.Wrap(err, "%s: %s", file, err)
+	}
+	return target, nil
+}
+
+// ParseISA decodes an ISA file. name is used if the file does not name the
+// target.
+func ParseISA(src, name string) (bcc.Target, error) {
+	target := bcc.DefaultTarget()
+	doc, err := parseTOML(src)
+	if nil == err {
+		err = doc.only("", "name", "description", "stack", "ops", "exclude")
+	}
+	if nil == err {
+		target.Name, err = doc.str("isa", "name", name)
+	}
+	if nil == err {
+		_, err = doc.str("isa", "description", "")
+	}
+	var depth int64
+	if nil == err {
+		depth, err = doc.int("isa", "stack", int64(target.StackDepth), 0, 255)
+		target.StackDepth = int(depth)
+	}
+	var ops, exclude []string
+	if nil == err {
+		ops, err = doc.strs("isa", "ops")
+	}
+	if nil == err {
+		exclude, err = doc.strs("isa", "exclude")
+	}
+	if nil != err {
+		return bcc.Target{}, err
+	}
+	if nil != ops && nil != exclude {
+		return bcc.Target{}, errors.Errorf("isa: set ops or exclude, not both")
+	}
+
+	if nil == ops && nil == exclude {
+		return target, nil
+	}
+	if nil == ops {
+		ops = bcc.OpNames()
+	}
+	skip := map[string]bool{}
+	for _, op := range exclude {
+		skip[strings.ToUpper(op)] = true
+	}
+	target.Ops = []string{}
+	for _, op := range ops {
+		op = strings.ToUpper(op)
+		if _, ok := bcc.Opcode(op); !ok {
+			return bcc.Target{}, errors.Errorf("isa: unknown operation '%s'", op)
+		}
+		if !skip[op] {
+			target.Ops = append(target.Ops, op)
+		}
+	}
+	for op := range skip {
+		if _, ok := bcc.Opcode(op); !ok {
+			return bcc.Target{}, errors.Errorf("isa: unknown operation '%s'", op)
+		}
+	}
+	return target, nil
+}
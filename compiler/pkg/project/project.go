@@ -0,0 +1,315 @@
+// Package project reads bcc.toml project manifests, which declare the build
+// targets of a program: one per variant of the computer.
+//
+//	[project]
+//	name = "demo"
+//	out = "build"
+//	include = ["lib"]
+//
+//	[target.stackless]
+//	isa = "isa/stackless.toml"
+//	sources = ["fib.asm"]
+//	defines = { delay = 20 }
+//	formats = ["bin", "ihex"]
+//	eeprom = "28C16"
+//	metadata = "embed"
+//
+// Paths are relative to the manifest's directory.
+package project
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/eeprom"
+
+	"github.com/bdlm/errors/v2"
+)
+
+const (
+	// File is the manifest file name bcc build looks for.
+	File = "bcc.toml"
+
+	// OutDir is the default output directory.
+	OutDir = "build"
+)
+
+// Project is a parsed manifest.
+type Project struct {
+	Name string
+	// directory the manifest is in, which relative paths start from
+	Dir string
+	// output directory; each target builds into a subdirectory
+	Out string
+	// include paths shared by every target
+	Include []string
+	// targets sorted by name
+	Targets []*Target
+}
+
+// Target is one build of the project's sources.
+type Target struct {
+	Name string
+	// ISA file describing the hardware, "" for the default target
+	ISA     string
+	Sources []string
+	// include paths searched after the project's
+	Include []string
+	Defines map[string]byte
+	Formats []bcc.OutputFormat
+	EEPROM  eeprom.Part
+	// optimization level, bcc.OPT_NONE by default
+	Optimize int
+	// where image metadata is kept, bcc.META_EMBED by default
+	Metadata string
+}
+
+// Load reads a manifest file.
+func Load(file string) (*Project, error) {
+	byts, err := ioutil.ReadFile(file)
+	if nil != err {
+		return nil, err
+	}
+	proj, err := Parse(string(byts), filepath.Dir(file))
+	if nil != err {
+		return nil, errors.Wrap(err, "%s: %s", file, err)
+	}
+	return proj, nil
+}
+
+// Parse decodes a manifest whose relative paths start in dir.
+func Parse(src, dir string) (*Project, error) {
+	doc, err := parseTOML(src)
+	if nil != err {
+		return nil, err
+	}
+	err = doc.only("", "project", "target")
+	if nil != err {
+		return nil, err
+	}
+
+	proj := &Project{Dir: dir, Out: OutDir}
+	meta, err := doc.table("project")
+	if nil != err {
+		return nil, err
+	}
+	err = meta.only("project", "name", "out", "include")
+	if nil == err {
+		proj.Name, err = meta.str("project", "name", filepath.Base(dir))
+	}
+	if nil == err {
+		proj.Out, err = meta.str("project", "out", OutDir)
+	}
+	if nil == err {
+		proj.Include, err = meta.strs("project", "include")
+	}
+	if nil != err {
+		return nil, err
+	}
+
+	targets, err := doc.table("target")
+	if nil != err {
+		return nil, err
+	}
+	names := []string{}
+	for name := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if 0 == len(names) {
+		return nil, errors.Errorf("no targets, add a [target.name] table")
+	}
+	for _, name := range names {
+		target, err := parseTarget(targets, name)
+		if nil != err {
+			return nil, err
+		}
+		proj.Targets = append(proj.Targets, target)
+	}
+	return proj, nil
+}
+
+// parseTarget decodes a [target.name] table.
+func parseTarget(targets table, name string) (*Target, error) {
+	path := "target." + name
+	tbl, err := targets.table(name)
+	if nil != err {
+		return nil, err
+	}
+	err = tbl.only(path, "isa", "sources", "include", "defines", "formats", "eeprom", "optimize", "metadata")
+	if nil != err {
+		return nil, err
+	}
+
+	target := &Target{Name: name, Defines: map[string]byte{}}
+	target.ISA, err = tbl.str(path, "isa", "")
+	if nil == err {
+		target.Sources, err = tbl.strs(path, "sources")
+	}
+	if nil == err && 0 == len(target.Sources) {
+		err = errors.Errorf("%s: no sources", path)
+	}
+	if nil == err {
+		target.Include, err = tbl.strs(path, "include")
+	}
+
+	var formats []string
+	if nil == err {
+		formats, err = tbl.strs(path, "formats")
+	}
+	if 0 == len(formats) {
+		formats = []string{string(bcc.FORMAT_BIN)}
+	}
+	for _, format := range formats {
+		switch bcc.OutputFormat(format) {
+		case bcc.FORMAT_BIN, bcc.FORMAT_IHEX:
+			target.Formats = append(target.Formats, bcc.OutputFormat(format))
+		default:
+			err = errors.Errorf("%s.formats: unknown format '%s'", path, format)
+		}
+	}
+
+	var part string
+	if nil == err {
+		part, err = tbl.str(path, "eeprom", eeprom.Default)
+	}
+	if nil == err {
+		target.EEPROM, err = eeprom.Lookup(part)
+	}
+
+	var level int64
+	if nil == err {
+		level, err = tbl.int(path, "optimize", bcc.OPT_NONE, bcc.OPT_NONE, bcc.OPT_INLINE)
+		target.Optimize = int(level)
+	}
+
+	if nil == err {
+		target.Metadata, err = tbl.str(path, "metadata", bcc.META_EMBED)
+	}
+	switch target.Metadata {
+	case bcc.META_EMBED, bcc.META_SIDECAR, bcc.META_NONE:
+	default:
+		if nil == err {
+			err = errors.Errorf("%s.metadata: expected embed, sidecar or none", path)
+		}
+	}
+
+	var defines table
+	if nil == err {
+		defines, err = tbl.table("defines")
+	}
+	for key := range defines {
+		var v int64
+		if nil == err {
+			v, err = defines.int(path+".defines", key, 0, -128, 255)
+		}
+		target.Defines[strings.TrimPrefix(key, "$")] = byte(v)
+	}
+	if nil != err {
+		return nil, err
+	}
+	return target, nil
+}
+
+// Target returns the named target.
+func (proj *Project) Target(name string) (*Target, bool) {
+	for _, target := range proj.Targets {
+		if name == target.Name {
+			return target, true
+		}
+	}
+	return nil, false
+}
+
+// path resolves a manifest path.
+func (proj *Project) path(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(proj.Dir, name)
+}
+
+// OutDir returns the directory a target builds into.
+func (proj *Project) OutDir(target *Target) string {
+	return filepath.Join(proj.path(proj.Out), target.Name)
+}
+
+// only fails if the table has keys other than those given.
+func (tbl table) only(path string, keys ...string) error {
+	allowed := map[string]bool{}
+	for _, key := range keys {
+		allowed[key] = true
+	}
+	for key := range tbl {
+		if !allowed[key] {
+			if "" != path {
+				key = path + "." + key
+			}
+			return errors.Errorf("unknown key '%s'", key)
+		}
+	}
+	return nil
+}
+
+// table returns a sub-table, empty if it is not set.
+func (tbl table) table(key string) (table, error) {
+	value, ok := tbl[key]
+	if !ok {
+		return table{}, nil
+	}
+	sub, ok := value.(table)
+	if !ok {
+		return nil, errors.Errorf("'%s' must be a table", key)
+	}
+	return sub, nil
+}
+
+// str returns a string value, or def if it is not set.
+func (tbl table) str(path, key, def string) (string, error) {
+	value, ok := tbl[key]
+	if !ok {
+		return def, nil
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", errors.Errorf("%s.%s must be a string", path, key)
+	}
+	return s, nil
+}
+
+// strs returns an array of strings, nil if it is not set.
+func (tbl table) strs(path, key string) ([]string, error) {
+	value, ok := tbl[key]
+	if !ok {
+		return nil, nil
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, errors.Errorf("%s.%s must be an array of strings", path, key)
+	}
+	strs := []string{}
+	for _, item := range list {
+		s, ok := item.(string)
+		if !ok {
+			return nil, errors.Errorf("%s.%s must be an array of strings", path, key)
+		}
+		strs = append(strs, s)
+	}
+	return strs, nil
+}
+
+// int returns an integer value within [min, max], or def if it is not set.
+func (tbl table) int(path, key string, def, min, max int64) (int64, error) {
+	value, ok := tbl[key]
+	if !ok {
+		return def, nil
+	}
+	n, ok := value.(int64)
+	if !ok || n < min || n > max {
+		return 0, errors.Errorf("%s.%s must be an integer from %d to %d", path, key, min, max)
+	}
+	return n, nil
+}
@@ -0,0 +1,152 @@
+package project_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/bcc"
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/project"
+)
+
+const manifest = `
+# every key a manifest may set
+[project]
+name = "demo"    # trailing comments are ignored
+out = "out"
+include = ["lib"]
+
+[target.b]
+sources = [
+    "fib.asm",
+    "add.asm",   # arrays may span lines
+]
+defines = { delay = 0x20, "$neg" = -1 }
+formats = ["bin", "ihex"]
+eeprom = "28C16"
+optimize = 2
+metadata = "sidecar"
+
+[target.a]
+isa = "isa/a.toml"
+sources = ["fib.asm"]
+include = ["a"]
+`
+
+func TestParse(t *testing.T) {
+	proj, err := project.Parse(manifest, "/src/demo")
+	if nil != err {
+		t.Fatalf("parse: %s", err)
+	}
+	if "demo" != proj.Name || "/src/demo" != proj.Dir || "out" != proj.Out || "[lib]" != fmt.Sprint(proj.Include) {
+		t.Errorf("project: got %+v", proj)
+	}
+	if 2 != len(proj.Targets) || "a" != proj.Targets[0].Name || "b" != proj.Targets[1].Name {
+		t.Fatalf("targets: got %+v, want a and b sorted by name", proj.Targets)
+	}
+
+	a, b := proj.Targets[0], proj.Targets[1]
+	got := fmt.Sprintf("%s %v %v %v %s %d %s", a.ISA, a.Sources, a.Include, a.Formats, a.EEPROM.Name, a.Optimize, a.Metadata)
+	if want := "isa/a.toml [fib.asm] [a] [bin] 28C256 0 embed"; got != want {
+		t.Errorf("target a:\n got  %s\n want %s", got, want)
+	}
+	got = fmt.Sprintf("%s %v %v %v %s %d %s", b.ISA, b.Sources, b.Defines, b.Formats, b.EEPROM.Name, b.Optimize, b.Metadata)
+	if want := " [fib.asm add.asm] map[delay:32 neg:255] [bin ihex] 28C16 2 sidecar"; got != want {
+		t.Errorf("target b:\n got  %s\n want %s", got, want)
+	}
+
+	if target, ok := proj.Target("b"); !ok || b != target {
+		t.Errorf("Target(b): got %v, %v", target, ok)
+	}
+	if _, ok := proj.Target("c"); ok {
+		t.Errorf("Target(c): found a target that doesn't exist")
+	}
+	if dir := proj.OutDir(a); filepath.Join("/src/demo", "out", "a") != dir {
+		t.Errorf("OutDir: got %s", dir)
+	}
+
+	// the project table is optional, the name defaults to the directory
+	proj, err = project.Parse("[target.x]\nsources = [\"x.asm\"]\n", "/src/demo")
+	if nil != err || "demo" != proj.Name || project.OutDir != proj.Out {
+		t.Errorf("defaults: got %+v, %v", proj, err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"", "no targets, add a [target.name] table"},
+		{"[build]", "unknown key 'build'"},
+		{"[project]\nversion = 1", "unknown key 'project.version'"},
+		{"[project]\nname = 1", "project.name must be a string"},
+		{"[project]\ninclude = [1]", "project.include must be an array of strings"},
+		{"[target.x]", "target.x: no sources"},
+		{"[target.x]\nsources = [\"x.asm\"]\nformats = [\"srec\"]", "target.x.formats: unknown format 'srec'"},
+		{"[target.x]\nsources = [\"x.asm\"]\neeprom = \"27C512\"", "27C512"},
+		{"[target.x]\nsources = [\"x.asm\"]\noptimize = 3", "target.x.optimize must be an integer from"},
+		{"[target.x]\nsources = [\"x.asm\"]\nmetadata = \"inline\"", "target.x.metadata: expected embed, sidecar or none"},
+		{"[target.x]\nsources = [\"x.asm\"]\ndefines = { n = 256 }", "target.x.defines.n must be an integer from -128 to 255"},
+		{"[target.x]\nsources = [\"x.asm\"]\nsources = []", "line 3: duplicate key 'sources'"},
+		{"[target.x", "line 1: invalid table header '[target.x'"},
+		{"[[target]]", "line 1: invalid table header '[[target]]'"},
+		{"[target]\nname", "line 2: expected key = value"},
+		{"[target]\na b = 1", "line 2: invalid key 'a b'"},
+		{"[target]\nx = \"open", "line 2: unterminated string"},
+		{"[target]\nx = [1 2]", "line 2: expected ',' or ']' in array"},
+		{"[target]\nx = 1 2", "line 2: unexpected '2' after value"},
+		{"[target]\nx = yes", "line 2: invalid value 'yes'"},
+		{"[target]\nx = 1\n[target.x]", "line 3: 'x' is not a table"},
+	}
+	for _, tt := range tests {
+		_, err := project.Parse(tt.src, "/src/demo")
+		if nil == err || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: got %v, want an error containing %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestParseISA(t *testing.T) {
+	target, err := project.ParseISA("stack = 0\nexclude = [\"run\", \"PSHA\"]\n", "small")
+	if nil != err {
+		t.Fatalf("parse: %s", err)
+	}
+	if "small" != target.Name || 0 != target.StackDepth || len(bcc.OpNames())-2 != len(target.Ops) {
+		t.Errorf("exclude: got %s, stack %d, %d ops", target.Name, target.StackDepth, len(target.Ops))
+	}
+	for _, op := range target.Ops {
+		if "RUN" == op || "PSHA" == op {
+			t.Errorf("exclude: %s is still in the op table", op)
+		}
+	}
+
+	target, err = project.ParseISA("name = \"tiny\"\ndescription = \"two ops\"\nops = [\"hlt\", \"OUTA\"]\n", "small")
+	if nil != err || "tiny" != target.Name || bcc.DefaultTarget().StackDepth != target.StackDepth || "[HLT OUTA]" != fmt.Sprint(target.Ops) {
+		t.Errorf("ops: got %+v, %v", target, err)
+	}
+
+	// without ops or exclude the target implements every operation
+	target, err = project.ParseISA("", "default")
+	if nil != err || nil != target.Ops {
+		t.Errorf("default: got %+v, %v", target, err)
+	}
+
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"ops = [\"HLT\"]\nexclude = [\"RUN\"]", "isa: set ops or exclude, not both"},
+		{"ops = [\"NOPE\"]", "isa: unknown operation 'NOPE'"},
+		{"exclude = [\"NOPE\"]", "isa: unknown operation 'NOPE'"},
+		{"stack = 256", "isa.stack must be an integer from 0 to 255"},
+		{"registers = 3", "unknown key 'registers'"},
+	}
+	for _, tt := range tests {
+		_, err := project.ParseISA(tt.src, "x")
+		if nil == err || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: got %v, want an error containing %q", tt.src, err, tt.want)
+		}
+	}
+}
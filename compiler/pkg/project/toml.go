@@ -0,0 +1,237 @@
+package project
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/bdlm/errors/v2"
+)
+
+// table is a decoded TOML table. Values are string, int64, bool, []interface{}
+// or table.
+type table map[string]interface{}
+
+// parseTOML decodes the subset of TOML project files use: [table] headers
+// with dotted names, key = value pairs, strings, integers, booleans, arrays
+// (which may span lines) and single line inline tables.
+func parseTOML(src string) (table, error) {
+	root := table{}
+	current := root
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	for idx := 0; idx < len(lines); idx++ {
+		ln := idx + 1
+		line := strings.TrimSpace(stripComment(lines[idx]))
+		if "" == line {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+				return nil, errors.Errorf("line %d: invalid table header '%s'", ln, line)
+			}
+			keys, err := splitKey(line[1 : len(line)-1])
+			if nil != err {
+				return nil, errors.Errorf("line %d: %s", ln, err)
+			}
+			current = root
+			for _, key := range keys {
+				next, ok := current[key]
+				if !ok {
+					next = table{}
+					current[key] = next
+				}
+				tbl, ok := next.(table)
+				if !ok {
+					return nil, errors.Errorf("line %d: '%s' is not a table", ln, key)
+				}
+				current = tbl
+			}
+			continue
+		}
+
+		eq := strings.Index(line, "=")
+		if eq < 0 {
+			return nil, errors.Errorf("line %d: expected key = value", ln)
+		}
+		keys, err := splitKey(line[:eq])
+		if nil != err || 1 != len(keys) {
+			return nil, errors.Errorf("line %d: invalid key '%s'", ln, strings.TrimSpace(line[:eq]))
+		}
+		text := strings.TrimSpace(line[eq+1:])
+		// arrays may continue on the following lines
+		for strings.HasPrefix(text, "[") && !balanced(text) && idx+1 < len(lines) {
+			idx++
+			text = text + " " + strings.TrimSpace(stripComment(lines[idx]))
+		}
+		value, rest, err := parseValue(text)
+		if nil == err && "" != strings.TrimSpace(rest) {
+			err = errors.Errorf("unexpected '%s' after value", strings.TrimSpace(rest))
+		}
+		if nil != err {
+			return nil, errors.Errorf("line %d: %s", ln, err)
+		}
+		if _, ok := current[keys[0]]; ok {
+			return nil, errors.Errorf("line %d: duplicate key '%s'", ln, keys[0])
+		}
+		current[keys[0]] = value
+	}
+	return root, nil
+}
+
+// stripComment removes a trailing # comment outside of strings.
+func stripComment(line string) string {
+	quoted := false
+	for k := 0; k < len(line); k++ {
+		switch line[k] {
+		case '\\':
+			if quoted {
+				k++
+			}
+		case '"':
+			quoted = !quoted
+		case '#':
+			if !quoted {
+				return line[:k]
+			}
+		}
+	}
+	return line
+}
+
+// balanced reports whether every bracket outside of strings is closed.
+func balanced(text string) bool {
+	depth, quoted := 0, false
+	for k := 0; k < len(text); k++ {
+		switch text[k] {
+		case '\\':
+			if quoted {
+				k++
+			}
+		case '"':
+			quoted = !quoted
+		case '[', '{':
+			if !quoted {
+				depth++
+			}
+		case ']', '}':
+			if !quoted {
+				depth--
+			}
+		}
+	}
+	return depth <= 0
+}
+
+// splitKey splits a dotted key of bare or quoted parts.
+func splitKey(text string) ([]string, error) {
+	keys := []string{}
+	for _, part := range strings.Split(text, ".") {
+		part = strings.TrimSpace(part)
+		if strings.HasPrefix(part, `"`) {
+			key, err := strconv.Unquote(part)
+			if nil != err {
+				return nil, errors.Errorf("invalid key '%s'", part)
+			}
+			keys = append(keys, key)
+			continue
+		}
+		if "" == part || strings.IndexFunc(part, func(r rune) bool {
+			return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || '_' == r || '-' == r)
+		}) >= 0 {
+			return nil, errors.Errorf("invalid key '%s'", part)
+		}
+		keys = append(keys, part)
+	}
+	return keys, nil
+}
+
+// parseValue decodes the value at the start of text and returns the text
+// that follows it.
+func parseValue(text string) (interface{}, string, error) {
+	text = strings.TrimSpace(text)
+	switch true {
+	case "" == text:
+		return nil, "", errors.Errorf("missing value")
+
+	case '"' == text[0]:
+		for k := 1; k < len(text); k++ {
+			if '\\' == text[k] {
+				k++
+				continue
+			}
+			if '"' == text[k] {
+				s, err := strconv.Unquote(text[:k+1])
+				if nil != err {
+					return nil, "", errors.Errorf("invalid string %s", text[:k+1])
+				}
+				return s, text[k+1:], nil
+			}
+		}
+		return nil, "", errors.Errorf("unterminated string")
+
+	case '[' == text[0]:
+		list := []interface{}{}
+		rest := strings.TrimSpace(text[1:])
+		for {
+			if strings.HasPrefix(rest, "]") {
+				return list, rest[1:], nil
+			}
+			value, next, err := parseValue(rest)
+			if nil != err {
+				return nil, "", err
+			}
+			list = append(list, value)
+			rest = strings.TrimSpace(next)
+			if strings.HasPrefix(rest, ",") {
+				rest = strings.TrimSpace(rest[1:])
+			} else if !strings.HasPrefix(rest, "]") {
+				return nil, "", errors.Errorf("expected ',' or ']' in array")
+			}
+		}
+
+	case '{' == text[0]:
+		tbl := table{}
+		rest := strings.TrimSpace(text[1:])
+		for {
+			if strings.HasPrefix(rest, "}") {
+				return tbl, rest[1:], nil
+			}
+			eq := strings.Index(rest, "=")
+			if eq < 0 {
+				return nil, "", errors.Errorf("expected key = value in inline table")
+			}
+			keys, err := splitKey(rest[:eq])
+			if nil != err || 1 != len(keys) {
+				return nil, "", errors.Errorf("invalid key '%s'", strings.TrimSpace(rest[:eq]))
+			}
+			value, next, err := parseValue(rest[eq+1:])
+			if nil != err {
+				return nil, "", err
+			}
+			tbl[keys[0]] = value
+			rest = strings.TrimSpace(next)
+			if strings.HasPrefix(rest, ",") {
+				rest = strings.TrimSpace(rest[1:])
+			} else if !strings.HasPrefix(rest, "}") {
+				return nil, "", errors.Errorf("expected ',' or '}' in inline table")
+			}
+		}
+	}
+
+	end := strings.IndexAny(text, ",]} \t")
+	if end < 0 {
+		end = len(text)
+	}
+	word, rest := text[:end], text[end:]
+	switch word {
+	case "true":
+		return true, rest, nil
+	case "false":
+		return false, rest, nil
+	}
+	n, err := strconv.ParseInt(strings.ReplaceAll(word, "_", ""), 0, 64)
+	if nil != err {
+		return nil, "", errors.Errorf("invalid value '%s'", word)
+	}
+	return n, rest, nil
+}
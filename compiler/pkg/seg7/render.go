@@ -0,0 +1,128 @@
+package seg7
+
+import (
+	"strings"
+
+	"github.com/bdlm/errors/v2"
+)
+
+// segments lists every segment name in display order.
+const segments = "abcdefgp"
+
+// glyphs maps display characters to their lit segments.
+var glyphs = map[byte]string{
+	' ': "",
+	'-': "g",
+	'0': "abcdef",
+	'1': "bc",
+	'2': "abdeg",
+	'3': "abcdg",
+	'4': "bcfg",
+	'5': "acdfg",
+	'6': "acdefg",
+	'7': "abc",
+	'8': "abcdefg",
+	'9': "abcdfg",
+	'A': "abcefg",
+	'B': "cdefg", // b
+	'C': "adef",
+	'D': "bcdeg", // d
+	'E': "adefg",
+	'F': "aefg",
+}
+
+// modeWidth is the number of digits each display mode needs.
+var modeWidth = map[Mode]int{
+	MODE_UNSIGNED: 3,
+	MODE_SIGNED:   4,
+	MODE_HEX:      2,
+}
+
+// addrBits returns the number of address lines needed to select one of n
+// items.
+func addrBits(n int) uint {
+	bits := uint(0)
+	for 1<<bits < n {
+		bits++
+	}
+	return bits
+}
+
+// glyph returns the character drawn by a set of lit segments, or '?'.
+func glyph(lit string) byte {
+	for chr, segs := range glyphs {
+		if segs == lit {
+			return chr
+		}
+	}
+	return '?'
+}
+
+// Render draws the displayed value as three rows of ASCII 7-segment art,
+// reading each digit back out of the ROM image.
+func (dec *decoder) Render(mode Mode, value byte) (string, error) {
+	m := dec.modeIndex(mode)
+	if m < 0 {
+		return "", errors.Errorf("display mode '%s' is not configured", mode)
+	}
+	if nil == dec.rom {
+		if err := dec.build(); nil != err {
+			return "", errors.Wrap(err, "could not build decoder ROM")
+		}
+	}
+
+	rows := [3]string{}
+	for digit := dec.cfg.Digits - 1; digit >= 0; digit-- {
+		lit := dec.decode(dec.rom[dec.addr(m, digit, value)])
+		on := func(seg byte, chr string) string {
+			if strings.IndexByte(lit, seg) >= 0 {
+				return chr
+			}
+			return " "
+		}
+		rows[0] = rows[0] + " " + on('a', "_") + "  "
+		rows[1] = rows[1] + on('f', "|") + on('g', "_") + on('b', "|") + " "
+		rows[2] = rows[2] + on('e', "|") + on('d', "_") + on('c', "|") + on('p', ".")
+	}
+
+	return strings.Join([]string{
+		strings.TrimRight(rows[0], " "),
+		strings.TrimRight(rows[1], " "),
+		strings.TrimRight(rows[2], " "),
+	}, "\n"), nil
+}
+
+// Verify decodes every ROM entry back into a character and checks it
+// against the expected display string.
+func (dec *decoder) Verify() error {
+	if nil == dec.rom {
+		if err := dec.build(); nil != err {
+			return errors.Wrap(err, "could not build decoder ROM")
+		}
+	}
+
+	for m, mode := range dec.cfg.Modes {
+		for v := 0; v < 256; v++ {
+			str := dec.format(mode, byte(v))
+			for digit := 0; digit < dec.cfg.Digits; digit++ {
+				want := str[len(str)-1-digit]
+				got := glyph(dec.decode(dec.rom[dec.addr(m, digit, byte(v))]))
+				if want != got {
+					return errors.Errorf("%s %d digit %d: expected '%c', found '%c'", mode, v, digit, want, got)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// modeIndex returns the address index of a configured mode, or -1.
+func (dec *decoder) modeIndex(mode Mode) int {
+	for m, cfgMode := range dec.cfg.Modes {
+		if mode == cfgMode {
+			return m
+		}
+	}
+	return -1
+}
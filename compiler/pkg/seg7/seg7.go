@@ -0,0 +1,229 @@
+// Package seg7 generates the output module decoder EEPROM that multiplexes
+// the OUT register onto a row of 7-segment displays.
+package seg7
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bdlm/errors/v2"
+)
+
+const (
+	// Kbit16 is the size of a 28C16 EEPROM in bytes.
+	Kbit16 = 2048
+)
+
+// Mode is a display mode selected by the high address lines of the decoder
+// ROM.
+type Mode string
+
+const (
+	// unsigned decimal, 0 to 255
+	MODE_UNSIGNED Mode = "unsigned"
+	// two's-complement signed decimal, -128 to 127
+	MODE_SIGNED Mode = "signed"
+	// hexadecimal, 00 to FF
+	MODE_HEX Mode = "hex"
+)
+
+// Config describes the display hardware the decoder ROM drives.
+type Config struct {
+	// Common-anode displays light a segment when its bit is low.
+	Anode bool
+	// Segment-to-bit wiring, most significant bit first. Segments are named
+	// 'a' through 'g', 'p' is the decimal point.
+	Wiring string
+	// Number of multiplexed digits.
+	Digits int
+	// Display modes, in address order.
+	Modes []Mode
+	// ROM image size in bytes.
+	Size int
+}
+
+// DefaultConfig matches the output module from the Ben Eater build: four
+// common-cathode digits wired dp,a-g from D7 to D0 with unsigned and signed
+// modes on a 28C16.
+func DefaultConfig() Config {
+	return Config{
+		Anode:  false,
+		Wiring: "pabcdefg",
+		Digits: 4,
+		Modes:  []Mode{MODE_UNSIGNED, MODE_SIGNED},
+		Size:   Kbit16,
+	}
+}
+
+// Decoder is implemented by decoder ROM generators.
+type Decoder interface {
+	Compile() error
+	Image() []byte
+	Render(Mode, byte) (string, error)
+	Verify() error
+}
+
+// New returns a decoder ROM generator that writes to destFile.
+func New(destFile string, cfg Config) (*decoder, error) {
+	dec := &decoder{
+		destFile: destFile,
+		cfg:      cfg,
+		bits:     map[byte]uint{},
+	}
+
+	err := dec.configure()
+	if nil != err {
+		return nil, errors.Wrap(err, "invalid decoder configuration")
+	}
+
+	return dec, nil
+}
+
+// decoder generates a 7-segment decoder ROM image.
+type decoder struct {
+	destFile string
+	cfg      Config
+
+	// segment => data bit
+	bits map[byte]uint
+	// address lines used for digit and mode selection
+	digitBits uint
+	modeBits  uint
+
+	rom []byte
+}
+
+// configure validates the configuration and computes the address layout.
+func (dec *decoder) configure() error {
+	if 8 != len(dec.cfg.Wiring) {
+		return errors.Errorf("wiring '%s' must name 8 segments", dec.cfg.Wiring)
+	}
+	for pos := 0; pos < 8; pos++ {
+		seg := dec.cfg.Wiring[pos]
+		if !strings.ContainsRune(segments, rune(seg)) {
+			return errors.Errorf("unknown segment '%c' in wiring '%s'", seg, dec.cfg.Wiring)
+		}
+		if _, ok := dec.bits[seg]; ok {
+			return errors.Errorf("segment '%c' wired more than once in '%s'", seg, dec.cfg.Wiring)
+		}
+		dec.bits[seg] = uint(7 - pos)
+	}
+
+	if dec.cfg.Digits < 1 {
+		return errors.Errorf("at least one digit is required")
+	}
+	if 0 == len(dec.cfg.Modes) {
+		return errors.Errorf("at least one display mode is required")
+	}
+	for _, mode := range dec.cfg.Modes {
+		if _, ok := modeWidth[mode]; !ok {
+			return errors.Errorf("unknown display mode '%s'", mode)
+		}
+		if modeWidth[mode] > dec.cfg.Digits {
+			return errors.Errorf("display mode '%s' requires %d digits, %d configured", mode, modeWidth[mode], dec.cfg.Digits)
+		}
+	}
+
+	dec.digitBits = addrBits(dec.cfg.Digits)
+	dec.modeBits = addrBits(len(dec.cfg.Modes))
+	if need := 1 << (8 + dec.digitBits + dec.modeBits); need > dec.cfg.Size {
+		return errors.Errorf("%d digits and %d modes require %d bytes, ROM size is %d", dec.cfg.Digits, len(dec.cfg.Modes), need, dec.cfg.Size)
+	}
+
+	return nil
+}
+
+// addr returns the ROM address for a mode index, digit and value. Digit 0 is
+// the rightmost display.
+func (dec *decoder) addr(mode, digit int, value byte) int {
+	return mode<<(8+dec.digitBits) | digit<<8 | int(value)
+}
+
+// build populates the ROM image.
+func (dec *decoder) build() error {
+	blank := dec.encode(' ')
+	dec.rom = make([]byte, dec.cfg.Size)
+	for a := range dec.rom {
+		dec.rom[a] = blank
+	}
+
+	for m, mode := range dec.cfg.Modes {
+		for v := 0; v < 256; v++ {
+			str := dec.format(mode, byte(v))
+			for digit := 0; digit < dec.cfg.Digits; digit++ {
+				chr := str[len(str)-1-digit]
+				if _, ok := glyphs[chr]; !ok {
+					return errors.Errorf("no glyph for '%c' (%s %d)", chr, mode, v)
+				}
+				dec.rom[dec.addr(m, digit, byte(v))] = dec.encode(chr)
+			}
+		}
+	}
+
+	return nil
+}
+
+// format returns the right-aligned display string for a value.
+func (dec *decoder) format(mode Mode, value byte) string {
+	switch mode {
+	case MODE_SIGNED:
+		return fmt.Sprintf("%*d", dec.cfg.Digits, int8(value))
+	case MODE_HEX:
+		return fmt.Sprintf("%*X", dec.cfg.Digits, value)
+	}
+	return fmt.Sprintf("%*d", dec.cfg.Digits, value)
+}
+
+// encode returns the data byte that lights a character's segments.
+func (dec *decoder) encode(chr byte) byte {
+	var byt byte
+	for _, seg := range []byte(glyphs[chr]) {
+		byt |= 1 << dec.bits[seg]
+	}
+	if dec.cfg.Anode {
+		byt = ^byt
+	}
+	return byt
+}
+
+// decode returns the lit segments for a data byte.
+func (dec *decoder) decode(byt byte) string {
+	if dec.cfg.Anode {
+		byt = ^byt
+	}
+	lit := ""
+	for _, seg := range []byte(segments) {
+		if 0 != byt&(1<<dec.bits[seg]) {
+			lit = lit + string(seg)
+		}
+	}
+	return lit
+}
+
+// Interface implementation
+func (dec *decoder) Compile() error {
+	err := dec.build()
+	if nil != err {
+		return errors.Wrap(err, "could not build decoder ROM")
+	}
+
+	outf, err := os.Create(dec.destFile)
+	if nil != err {
+		return errors.Wrap(err, "could not create data file '%s'", dec.destFile)
+	}
+	defer outf.Close()
+
+	err = binary.Write(outf, binary.BigEndian, dec.rom)
+	if nil != err {
+		return errors.Wrap(err, "could not write binary data to '%s'", dec.destFile)
+	}
+
+	return nil
+}
+
+// Interface implementation
+func (dec *decoder) Image() []byte {
+	return dec.rom
+}
@@ -0,0 +1,160 @@
+package seg7_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/seg7"
+
+	"github.com/bdlm/errors/v2"
+)
+
+// TestImage checks digits of the default decoder ROM. Segments are wired
+// dp,a-g from D7 to D0, so '2' (abdeg) is 0x6D.
+func TestImage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seg7")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "seg7.img")
+
+	dec, err := seg7.New(file, seg7.DefaultConfig())
+	if nil != err {
+		t.Fatalf("new: %s", err)
+	}
+	if err = dec.Compile(); nil != err {
+		t.Fatalf("compile: %s", err)
+	}
+	img, err := ioutil.ReadFile(file)
+	if nil != err {
+		t.Fatalf("read image: %s", err)
+	}
+	if seg7.Kbit16 != len(img) || string(img) != string(dec.Image()) {
+		t.Fatalf("image file is %d bytes, want the %d byte image", len(img), seg7.Kbit16)
+	}
+
+	// address: mode A10, digit A8-A9, value A0-A7
+	tests := []struct {
+		name string
+		addr int
+		want byte
+	}{
+		{"unsigned 42 ones", 0x02A, 0x6D},
+		{"unsigned 42 tens", 0x12A, 0x33},
+		{"unsigned 42 hundreds", 0x22A, 0x00},
+		{"signed -1 ones", 0x4FF, 0x30},
+		{"signed -1 sign", 0x5FF, 0x01},
+		{"signed -128 sign", 0x780, 0x01},
+	}
+	for _, tt := range tests {
+		if img[tt.addr] != tt.want {
+			t.Errorf("%s: 0x%03X is 0x%02X, want 0x%02X", tt.name, tt.addr, img[tt.addr], tt.want)
+		}
+	}
+	if err = dec.Verify(); nil != err {
+		t.Errorf("verify: %s", err)
+	}
+
+	// common anode displays light a segment when its bit is low
+	cfg := seg7.DefaultConfig()
+	cfg.Anode = true
+	anode, err := seg7.New(file, cfg)
+	if nil != err {
+		t.Fatalf("new: %s", err)
+	}
+	if err = anode.Compile(); nil != err {
+		t.Fatalf("compile: %s", err)
+	}
+	for k, byt := range anode.Image() {
+		if byt != ^img[k] {
+			t.Fatalf("anode 0x%03X is 0x%02X, want 0x%02X", k, byt, ^img[k])
+		}
+	}
+	if err = anode.Verify(); nil != err {
+		t.Errorf("verify anode: %s", err)
+	}
+}
+
+func TestRender(t *testing.T) {
+	cfg := seg7.DefaultConfig()
+	cfg.Modes = append(cfg.Modes, seg7.MODE_HEX)
+	cfg.Size = 2 * seg7.Kbit16
+	dec, err := seg7.New("", cfg)
+	if nil != err {
+		t.Fatalf("new: %s", err)
+	}
+
+	tests := []struct {
+		mode  seg7.Mode
+		value byte
+		want  []string
+	}{
+		{seg7.MODE_UNSIGNED, 209, []string{
+			"     _   _   _",
+			"     _| | | |_|",
+			"    |_  |_|  _|",
+		}},
+		{seg7.MODE_SIGNED, 0xF6, []string{
+			"             _",
+			"     _    | | |",
+			"          | |_|",
+		}},
+		{seg7.MODE_HEX, 0xB8, []string{
+			"             _",
+			"        |_  |_|",
+			"        |_| |_|",
+		}},
+	}
+	for _, tt := range tests {
+		got, err := dec.Render(tt.mode, tt.value)
+		if nil != err {
+			t.Errorf("%s %d: %s", tt.mode, tt.value, err)
+			continue
+		}
+		if want := strings.Join(tt.want, "\n"); got != want {
+			t.Errorf("%s %d:\n%s\nwant\n%s", tt.mode, tt.value, got, want)
+		}
+	}
+
+	dec, _ = seg7.New("", seg7.DefaultConfig())
+	if _, err = dec.Render(seg7.MODE_HEX, 1); nil == err {
+		t.Errorf("rendered a mode that is not configured")
+	}
+}
+
+func TestConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(cfg *seg7.Config)
+		want string
+	}{
+		{"short wiring", func(cfg *seg7.Config) { cfg.Wiring = "abcdefg" }, "must name 8 segments"},
+		{"unknown segment", func(cfg *seg7.Config) { cfg.Wiring = "xabcdefg" }, "unknown segment 'x'"},
+		{"segment twice", func(cfg *seg7.Config) { cfg.Wiring = "aabcdefg" }, "segment 'a' wired more than once"},
+		{"no digits", func(cfg *seg7.Config) { cfg.Digits = 0 }, "at least one digit"},
+		{"no modes", func(cfg *seg7.Config) { cfg.Modes = nil }, "at least one display mode"},
+		{"unknown mode", func(cfg *seg7.Config) { cfg.Modes = []seg7.Mode{"octal"} }, "unknown display mode 'octal'"},
+		{"too few digits", func(cfg *seg7.Config) { cfg.Digits = 3 }, "'signed' requires 4 digits"},
+		{"small ROM", func(cfg *seg7.Config) { cfg.Size = 1024 }, "require 2048 bytes, ROM size is 1024"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := seg7.DefaultConfig()
+			tt.edit(&cfg)
+			_, err := seg7.New("", cfg)
+			if nil == err {
+				t.Fatalf("got no error, want %q", tt.want)
+			}
+			for nil != errors.Unwrap(err) {
+				err = errors.Unwrap(err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
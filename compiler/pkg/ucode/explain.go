@@ -0,0 +1,77 @@
+package ucode
+
+import "strings"
+
+// units names what each bus signal connects to the bus.
+var units = map[Signal]string{
+	PCO:   "program counter",
+	RORO:  "ROM address register",
+	ROMO:  "ROM",
+	ARO:   "register A",
+	XRO:   "register X",
+	YRO:   "register Y",
+	RARO:  "RAM address register",
+	RAMO:  "RAM",
+	STO:   "stack top",
+	JMP:   "program counter",
+	RORI:  "ROM address register",
+	ROMI0: "ROM 0",
+	ROMI1: "ROM 1",
+	II:    "instruction register",
+	AE:    "register A (ALU sum)",
+	ARI:   "register A",
+	XRI:   "register X",
+	YRI:   "register Y",
+	RARI:  "RAM address register",
+	RAMI:  "RAM",
+	OUT:   "output register",
+	STI:   "stack",
+}
+
+// actions describes the signals that neither drive nor load the bus.
+var actions = map[Signal]string{
+	HLT:  "halt the clock",
+	RST:  "reset the system",
+	PCE:  "advance the program counter",
+	PCR:  "reset the program counter",
+	RORR: "reset the ROM address register",
+	IR:   "reset the instruction register",
+	IE:   "end the instruction",
+	SUB:  "ALU subtracts",
+	ARR:  "reset register A",
+	XRR:  "reset register X",
+	YRR:  "reset register Y",
+	RARR: "reset the RAM address register",
+	STD:  "drop the stack top",
+}
+
+// Describe explains a micro-step in words: what drives the bus, which
+// registers latch it and what else happens, such as
+// "ROM -> instruction register; advance the program counter".
+func Describe(sig Signal) string {
+	parts := []string{}
+	if 0 != sig&(Drivers|Latches) {
+		from := []string{}
+		for _, s := range (sig & Drivers).List() {
+			from = append(from, units[s])
+		}
+		if 0 == len(from) {
+			from = append(from, "nothing")
+		}
+		to := []string{}
+		for _, s := range (sig & Latches).List() {
+			to = append(to, units[s])
+		}
+		if 0 == len(to) {
+			to = append(to, "nothing")
+		}
+		parts = append(parts, strings.Join(from, ", ")+" -> "+strings.Join(to, ", "))
+	}
+	for _, s := range (sig &^ (Drivers | Latches)).List() {
+		parts = append(parts, actions[s])
+	}
+	if 0 == len(parts) {
+		return "idle"
+	}
+	return strings.Join(parts, "; ")
+}
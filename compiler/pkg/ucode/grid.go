@@ -0,0 +1,142 @@
+package ucode
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bdlm/errors/v2"
+)
+
+// ReadPrograms decodes decoder EEPROM dumps into the micro-steps of every
+// opcode, Steps per opcode. Dumps of larger parts are read up to ROMSize.
+func ReadPrograms(roms [][]byte) ([][]Signal, error) {
+	if len(roms) != ROMCount() {
+		return nil, errors.Errorf("%d decoder ROMs, expected %d", len(roms), ROMCount())
+	}
+	for k, rom := range roms {
+		if len(rom) < ROMSize {
+			return nil, errors.Errorf("decoder ROM %d is %d bytes, expected %d", k, len(rom), ROMSize)
+		}
+	}
+	progs := make([][]Signal, MaxOpcodes)
+	for opcode := range progs {
+		progs[opcode] = make([]Signal, Steps)
+		for step := range progs[opcode] {
+			progs[opcode][step] = Decode(roms, Address(byte(opcode), step))
+		}
+	}
+	return progs, nil
+}
+
+// StepDiff is a micro-step whose signals differ between two sets of
+// programs.
+type StepDiff struct {
+	Opcode     byte
+	Step       int
+	Have, Want Signal
+}
+
+// DiffPrograms compares burned programs with their definition, step by step.
+// Steps past the end of a program have no signals set.
+func DiffPrograms(have, want [][]Signal) []StepDiff {
+	diffs := []StepDiff{}
+	for opcode := 0; opcode < MaxOpcodes; opcode++ {
+		for step := 0; step < Steps; step++ {
+			h, w := stepOf(have, opcode, step), stepOf(want, opcode, step)
+			if h != w {
+				diffs = append(diffs, StepDiff{byte(opcode), step, h, w})
+			}
+		}
+	}
+	return diffs
+}
+
+// stepOf returns the signals of a step, none past the end of a program.
+func stepOf(progs [][]Signal, opcode, step int) Signal {
+	if opcode < len(progs) && step < len(progs[opcode]) {
+		return progs[opcode][step]
+	}
+	return 0
+}
+
+// Grid renders programs as a table with a row per micro-step and a column per
+// control signal, grouped by decoder ROM. A set signal is '#'. When want is
+// given, signals burned but not defined are '+' and defined but not burned
+// are '-', and differing rows end with the difference. Unused opcodes, those
+// without a name, are only shown if all is set or they differ.
+func Grid(w io.Writer, have, want [][]Signal, names []string, all bool) {
+	width := 0
+	for _, s := range Signals {
+		if len(s.Name()) > width {
+			width = len(s.Name())
+		}
+	}
+	label := strings.Repeat(" ", 14)
+	for row := 0; row < width; row++ {
+		line := label
+		for bit, s := range Signals {
+			if 0 < bit && 0 == bit%ROMWidth {
+				line += " "
+			}
+			name := s.Name()
+			if row < len(name) {
+				line += name[row : row+1]
+			} else {
+				line += " "
+			}
+		}
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+	}
+
+	for opcode := 0; opcode < MaxOpcodes; opcode++ {
+		name := ""
+		if opcode < len(names) {
+			name = names[opcode]
+		}
+		last := -1
+		differs := false
+		for step := 0; step < Steps; step++ {
+			h, wnt := stepOf(have, opcode, step), stepOf(want, opcode, step)
+			if 0 != h || 0 != wnt {
+				last = step
+			}
+			if nil != want && h != wnt {
+				differs = true
+			}
+		}
+		if "" == name && !all && !differs {
+			continue
+		}
+
+		for step := 0; step <= last; step++ {
+			h, wnt := stepOf(have, opcode, step), stepOf(want, opcode, step)
+			if nil == want {
+				wnt = h
+			}
+			line := fmt.Sprintf("0x%02X %-4s %2d  ", opcode, name, step)
+			for bit, s := range Signals {
+				if 0 < bit && 0 == bit%ROMWidth {
+					line += " "
+				}
+				switch true {
+				case 0 != h&s && 0 != wnt&s:
+					line += "#"
+				case 0 != h&s:
+					line += "+"
+				case 0 != wnt&s:
+					line += "-"
+				default:
+					line += "."
+				}
+			}
+			if 0 != h&^wnt {
+				line += "  +" + strings.Replace((h&^wnt).String(), "|", " +", -1)
+			}
+			if 0 != wnt&^h {
+				line += "  -" + strings.Replace((wnt&^h).String(), "|", " -", -1)
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+}
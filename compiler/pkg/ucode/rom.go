@@ -0,0 +1,101 @@
+package ucode
+
+import (
+	"github.com/bdlm/errors/v2"
+)
+
+const (
+	// ROMSize is the capacity of each instruction decoder EEPROM (28C16).
+	ROMSize = 2048
+
+	// ROMWidth is the number of control signals driven by each decoder
+	// EEPROM.
+	ROMWidth = 8
+
+	// MaxOpcodes is the number of opcodes the decoder address lines can
+	// select.
+	MaxOpcodes = ROMSize / Steps
+)
+
+// ROMCount returns the number of decoder EEPROMs needed to drive every
+// control signal.
+func ROMCount() int {
+	return (len(Signals) + ROMWidth - 1) / ROMWidth
+}
+
+// Address returns the decoder EEPROM address of an opcode and step. The
+// instruction register drives A4-A10 and the step counter A0-A3.
+func Address(opcode byte, step int) int {
+	return int(opcode)<<4 | step&(Steps-1)
+}
+
+// Programs returns the micro-steps of every opcode the decoder can select,
+// fetch cycle included, for an opcode assignment where ops[opcode] names the
+// operation and "" marks an unused opcode.
+//
+// Unused opcodes fetch and then halt, so a stray jump into data stops the
+// clock instead of running garbage.
+func Programs(ops []string) ([][]Signal, error) {
+	if len(ops) > MaxOpcodes {
+		return nil, errors.Errorf("%d opcodes do not fit in %d decoder addresses", len(ops), MaxOpcodes)
+	}
+	progs := make([][]Signal, MaxOpcodes)
+	for opcode := range progs {
+		name := ""
+		if opcode < len(ops) {
+			name = ops[opcode]
+		}
+		if "" == name {
+			progs[opcode] = append(append([]Signal{}, Fetch...), HLT|IE)
+			continue
+		}
+		steps, ok := Lookup(name)
+		if !ok {
+			return nil, errors.Errorf("opcode 0x%02X: unknown operation '%s'", opcode, name)
+		}
+		if len(steps) > Steps {
+			return nil, errors.Errorf("%s: %d steps exceed the %d step counter", name, len(steps), Steps)
+		}
+		progs[opcode] = steps
+	}
+	return progs, nil
+}
+
+// ROMs returns the decoder EEPROM images for an opcode assignment, ops as for
+// Programs. ROM k drives control signals 8k through 8k+7, in CUB order, on
+// D0-D7.
+func ROMs(ops []string) ([][]byte, error) {
+	progs, err := Programs(ops)
+	if nil != err {
+		return nil, err
+	}
+
+	roms := make([][]byte, ROMCount())
+	for k := range roms {
+		roms[k] = make([]byte, ROMSize)
+	}
+	for opcode, steps := range progs {
+		for step, sig := range steps {
+			addr := Address(byte(opcode), step)
+			for bit, s := range Signals {
+				if 0 != sig&s {
+					roms[bit/ROMWidth][addr] |= 1 << uint(bit%ROMWidth)
+				}
+			}
+		}
+	}
+	return roms, nil
+}
+
+// Decode returns the control signals stored at an address of a set of
+// decoder EEPROM images.
+func Decode(roms [][]byte, addr int) Signal {
+	sig := Signal(0)
+	for bit, s := range Signals {
+		k := bit / ROMWidth
+		if k < len(roms) && addr < len(roms[k]) && 0 != roms[k][addr]&(1<<uint(bit%ROMWidth)) {
+			sig |= s
+		}
+	}
+	return sig
+}
@@ -0,0 +1,57 @@
+package ucode_test
+
+import (
+	"testing"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/ucode"
+)
+
+// TestROMRoundTrip burns every opcode and reads each step back.
+func TestROMRoundTrip(t *testing.T) {
+	progs, err := ucode.Programs(ops())
+	if nil != err {
+		t.Fatalf("programs: %s", err)
+	}
+	roms, err := ucode.ROMs(ops())
+	if nil != err {
+		t.Fatalf("roms: %s", err)
+	}
+	if ucode.ROMCount() != len(roms) {
+		t.Fatalf("got %d ROMs, want %d", len(roms), ucode.ROMCount())
+	}
+
+	for opcode := 0; opcode < ucode.MaxOpcodes; opcode++ {
+		for step := 0; step < ucode.Steps; step++ {
+			want := ucode.Signal(0)
+			if step < len(progs[opcode]) {
+				want = progs[opcode][step]
+			}
+			if got := ucode.Decode(roms, ucode.Address(byte(opcode), step)); got != want {
+				t.Errorf("0x%02X step %d: got %s, want %s", opcode, step, got, want)
+			}
+		}
+	}
+
+	read, err := ucode.ReadPrograms(roms)
+	if nil != err {
+		t.Fatalf("read programs: %s", err)
+	}
+	if diffs := ucode.DiffPrograms(read, progs); 0 != len(diffs) {
+		t.Errorf("read back differs: %v", diffs)
+	}
+
+	// a flipped bit shows as a single differing step
+	roms[1][ucode.Address(3, 2)] ^= 0x04
+	read, err = ucode.ReadPrograms(roms)
+	if nil != err {
+		t.Fatalf("read programs: %s", err)
+	}
+	diffs := ucode.DiffPrograms(read, progs)
+	if 1 != len(diffs) || 3 != diffs[0].Opcode || 2 != diffs[0].Step || ucode.Signals[ucode.ROMWidth+2] != diffs[0].Have^diffs[0].Want {
+		t.Errorf("flipped bit: got %+v, want %s at 0x03 step 2", diffs, ucode.Signals[ucode.ROMWidth+2])
+	}
+
+	if _, err = ucode.ReadPrograms(roms[1:]); nil == err {
+		t.Errorf("read programs from too few ROMs")
+	}
+}
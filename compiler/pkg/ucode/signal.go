@@ -0,0 +1,142 @@
+// Package ucode defines the control signals driven by the instruction
+// decoder ROMs and the micro-steps each operation executes.
+package ucode
+
+import (
+	"strings"
+)
+
+// Signal is a set of control unit bus (CUB) lines. Bits are numbered in CUB
+// order, see docs/opcodes.md.
+type Signal uint64
+
+const (
+	// clock
+	HLT Signal = 1 << iota // halt
+	RST                    // system reset
+
+	// program counter
+	PCE // program counter enable
+	PCR // program counter reset
+	JMP // program counter in
+	PCO // program counter out
+
+	// ROM
+	RORR  // memory address register reset
+	RORI  // memory address register in
+	RORO  // memory address register out
+	ROMI0 // ROM_0 data in
+	ROMI1 // ROM_1 data in
+	ROMO  // memory data out
+
+	// instruction register
+	IR // reset
+	IE // end, reset the step counter
+	II // in
+
+	// ALU
+	AE  // enable, REG_A = BUS + REG_A
+	SUB // subtract flag
+
+	// A register
+	ARR // reset
+	ARI // in
+	ARO // out
+
+	// X register
+	XRR // reset
+	XRI // in
+	XRO // out
+
+	// Y register
+	YRR // reset
+	YRI // in
+	YRO // out
+
+	// RAM
+	RARR // RAM address register reset
+	RARI // RAM address register in
+	RARO // RAM address register out
+	RAMI // RAM data in
+	RAMO // RAM data out
+
+	// output
+	OUT // in
+
+	// stack
+	STI // push BUS onto the stack
+	STO // stack top out
+	STD // drop the stack top
+)
+
+// Signals lists every control signal in bit order.
+var Signals = []Signal{
+	HLT, RST,
+	PCE, PCR, JMP, PCO,
+	RORR, RORI, RORO, ROMI0, ROMI1, ROMO,
+	IR, IE, II,
+	AE, SUB,
+	ARR, ARI, ARO,
+	XRR, XRI, XRO,
+	YRR, YRI, YRO,
+	RARR, RARI, RARO, RAMI, RAMO,
+	OUT,
+	STI, STO, STD,
+}
+
+var signalNames = []string{
+	"HLT", "RST",
+	"PCE", "PCR", "JMP", "PCO",
+	"RORR", "RORI", "RORO", "ROMI0", "ROMI1", "ROMO",
+	"IR", "IE", "II",
+	"AE", "SUB",
+	"ARR", "ARI", "ARO",
+	"XRR", "XRI", "XRO",
+	"YRR", "YRI", "YRO",
+	"RARR", "RARI", "RARO", "RAMI", "RAMO",
+	"OUT",
+	"STI", "STO", "STD",
+}
+
+// Drivers are the signals that put a value on the bus.
+const Drivers = PCO | RORO | ROMO | ARO | XRO | YRO | RARO | RAMO | STO
+
+// Name returns the name of a single signal.
+func (sig Signal) Name() string {
+	for bit, s := range Signals {
+		if s == sig {
+			return signalNames[bit]
+		}
+	}
+	return "?"
+}
+
+// List returns the individual signals in the set, in bit order.
+func (sig Signal) List() []Signal {
+	list := []Signal{}
+	for _, s := range Signals {
+		if 0 != sig&s {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// String returns the signal names joined by '|'.
+func (sig Signal) String() string {
+	names := []string{}
+	for _, s := range sig.List() {
+		names = append(names, s.Name())
+	}
+	return strings.Join(names, "|")
+}
+
+// Parse returns the signal with the given name.
+func Parse(name string) (Signal, bool) {
+	for bit, n := range signalNames {
+		if n == strings.ToUpper(name) {
+			return Signals[bit], true
+		}
+	}
+	return 0, false
+}
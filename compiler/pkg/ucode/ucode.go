@@ -0,0 +1,93 @@
+package ucode
+
+const (
+	// Steps is the capacity of the 4 bit step counter. The counter wraps to
+	// 0 after the last step.
+	Steps = 16
+)
+
+// Fetch is the fetch cycle shared by every operation: load the program
+// counter into the ROM address register, then latch the opcode into the
+// instruction register and advance the program counter.
+var Fetch = []Signal{
+	PCO | RORI,
+	ROMO | II | PCE,
+}
+
+// operand loads the byte following the opcode into the ROM address register.
+var operand = PCO | RORI
+
+// Table maps operation names to the execute micro-steps that follow the
+// fetch cycle. Each operation ends with IE, except SLOP which runs until the
+// step counter wraps.
+var Table = map[string][]Signal{
+	// system
+	"HLT":  {HLT | IE},
+	"RST":  {RST | IE},
+	"NOP":  {IE},
+	"SLOP": make([]Signal, Steps-2),
+
+	// math
+	"ADDV": {operand, ROMO | AE | PCE | IE},
+	"ADDX": {XRO | AE | IE},
+	"ADDY": {YRO | AE | IE},
+	"SUBV": {operand, ROMO | AE | SUB | PCE | IE},
+	"SUBX": {XRO | AE | SUB | IE},
+	"SUBY": {YRO | AE | SUB | IE},
+
+	// branching logic
+	"RUN":  {operand, PCE, PCO | STI, ROMO | JMP | IE},
+	"JMP":  {operand, ROMO | JMP | IE},
+	"JMPV": {operand, ROMO | JMP | IE},
+	"JMPA": {ARO | JMP | IE},
+	"JMPX": {XRO | JMP | IE},
+	"JMPY": {YRO | JMP | IE},
+	"JMPS": {STO | JMP | IE},
+
+	// data
+	"LDAV": {operand, ROMO | ARI | PCE | IE},
+	"LDAX": {XRO | ARI | IE},
+	"LDAY": {YRO | ARI | IE},
+	"LDXV": {operand, ROMO | XRI | PCE | IE},
+	"LDXA": {ARO | XRI | IE},
+	"LDXY": {YRO | XRI | IE},
+	"LDYV": {operand, ROMO | YRI | PCE | IE},
+	"LDYA": {ARO | YRI | IE},
+	"LDYX": {XRO | YRI | IE},
+
+	// stack
+	"PSHV": {operand, ROMO | STI | PCE | IE},
+	"PSHA": {ARO | STI | IE},
+	"PSHX": {XRO | STI | IE},
+	"PSHY": {YRO | STI | IE},
+	"PSHP": {PCO | STI | IE},
+	"POPA": {STO | STD | ARI | IE},
+	"POPX": {STO | STD | XRI | IE},
+	"POPY": {STO | STD | YRI | IE},
+	"POPP": {STO | STD | JMP | IE},
+
+	// output
+	"OUTV": {operand, ROMO | OUT | PCE | IE},
+	"OUTA": {ARO | OUT | IE},
+	"OUTX": {XRO | OUT | IE},
+	"OUTY": {YRO | OUT | IE},
+}
+
+// Lookup returns every micro-step of an operation, including the fetch
+// cycle.
+func Lookup(name string) ([]Signal, bool) {
+	steps, ok := Table[name]
+	if !ok {
+		return nil, false
+	}
+	return append(append([]Signal{}, Fetch...), steps...), true
+}
+
+// Cycles returns the number of clock cycles (T-states) an operation takes.
+func Cycles(name string) (int, bool) {
+	steps, ok := Lookup(name)
+	if !ok {
+		return 0, false
+	}
+	return len(steps), true
+}
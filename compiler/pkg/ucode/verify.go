@@ -0,0 +1,144 @@
+package ucode
+
+import "fmt"
+
+// Latches are the signals that load a value from the bus.
+const Latches = JMP | RORI | ROMI0 | ROMI1 | II | AE | ARI | XRI | YRI | RARI | RAMI | OUT | STI
+
+// VerifyRules describes every rule reported by Check.
+var VerifyRules = map[string]string{
+	"bus":         "more than one signal driving the bus",
+	"floating":    "a latch loading the bus while nothing drives it",
+	"conflict":    "signals that must not be set together, such as a register's in and out",
+	"end":         "instructions that neither end with IE nor run until the step counter wraps",
+	"unreachable": "micro-steps after IE",
+	"fetch":       "opcodes that do not start with the fetch cycle",
+}
+
+// conflicts lists the pairs of signals that must not be set in the same
+// micro-step.
+var conflicts = []struct {
+	a, b Signal
+	why  string
+}{
+	{AE, ARI, "both load register A"},
+	{ARR, ARI, "reset and load register A"},
+	{XRR, XRI, "reset and load register X"},
+	{YRR, YRI, "reset and load register Y"},
+	{ARI, ARO, "register A in and out"},
+	{XRI, XRO, "register X in and out"},
+	{YRI, YRO, "register Y in and out"},
+	{RORI, RORO, "ROM address register in and out"},
+	{RARI, RARO, "RAM address register in and out"},
+	{RAMI, RAMO, "RAM in and out"},
+	{JMP, PCO, "program counter in and out"},
+	{JMP, PCE, "both change the program counter"},
+	{STI, STO, "stack in and out"},
+	{STI, STD, "push and drop the stack"},
+}
+
+// Violation is a micro-step that breaks a verify rule.
+type Violation struct {
+	Opcode byte
+	// operation name, "" for an unused opcode
+	Name    string
+	Step    int
+	Rule    string
+	Message string
+}
+
+// String implements Stringer.
+func (v Violation) String() string {
+	name := v.Name
+	if "" == name {
+		name = "unused"
+	}
+	return fmt.Sprintf("0x%02X %s step %d: %s (%s)", v.Opcode, name, v.Step, v.Message, v.Rule)
+}
+
+// Verify checks the micro-steps of an opcode assignment, ops as for Programs.
+func Verify(ops []string) ([]Violation, error) {
+	progs, err := Programs(ops)
+	if nil != err {
+		return nil, err
+	}
+	return Check(progs, ops), nil
+}
+
+// Check verifies the micro-steps of every opcode, progs[opcode] as returned
+// by Programs or decoded from ROM images, in opcode and step order. names
+// labels the opcodes and may be nil. The decoder has no flag inputs, so each
+// opcode has a single sequence to check.
+func Check(progs [][]Signal, names []string) []Violation {
+	violations := []Violation{}
+	for opcode, steps := range progs {
+		name := ""
+		if opcode < len(names) {
+			name = names[opcode]
+		}
+		report := func(step int, rule, format string, args ...interface{}) {
+			violations = append(violations, Violation{
+				Opcode:  byte(opcode),
+				Name:    name,
+				Step:    step,
+				Rule:    rule,
+				Message: fmt.Sprintf(format, args...),
+			})
+		}
+
+		for step, sig := range Fetch {
+			if step >= len(steps) || steps[step] != sig {
+				have := Signal(0)
+				if step < len(steps) {
+					have = steps[step]
+				}
+				report(step, "fetch", "%s, the fetch cycle is %s", signalString(have), signalString(sig))
+			}
+		}
+
+		end := -1
+		for step, sig := range steps {
+			if 0 != sig&IE {
+				end = step
+				break
+			}
+		}
+		switch true {
+		case end < 0 && len(steps) < Steps:
+			report(len(steps)-1, "end", "the last step does not set IE and the step counter does not wrap")
+		case end >= 0:
+			for step := end + 1; step < len(steps); step++ {
+				if 0 != steps[step] {
+					report(step, "unreachable", "%s after IE at step %d", steps[step], end)
+				}
+			}
+		}
+
+		for step, sig := range steps {
+			if end >= 0 && step > end {
+				break
+			}
+			drivers := sig & Drivers
+			if len(drivers.List()) > 1 {
+				report(step, "bus", "%s drive the bus at once", drivers)
+			}
+			if 0 == drivers && 0 != sig&Latches {
+				report(step, "floating", "%s loads the bus but nothing drives it", sig&Latches)
+			}
+			for _, c := range conflicts {
+				if 0 != sig&c.a && 0 != sig&c.b {
+					report(step, "conflict", "%s and %s %s", c.a.Name(), c.b.Name(), c.why)
+				}
+			}
+		}
+	}
+	return violations
+}
+
+// signalString returns a signal set's names, or "nothing" if it is empty.
+func signalString(sig Signal) string {
+	if 0 == sig {
+		return "nothing"
+	}
+	return sig.String()
+}
@@ -0,0 +1,81 @@
+package ucode_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/mkenney/8bit-cpu/cmp2/pkg/ucode"
+)
+
+// ops returns every operation in the table, in name order, each followed by
+// an unused opcode.
+func ops() []string {
+	names := []string{}
+	for name := range ucode.Table {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ops := []string{}
+	for _, name := range names {
+		ops = append(ops, name, "")
+	}
+	return ops
+}
+
+// program returns the fetch cycle followed by steps.
+func program(steps ...ucode.Signal) []ucode.Signal {
+	return append(append([]ucode.Signal{}, ucode.Fetch...), steps...)
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		rule string
+		prog []ucode.Signal
+		step int
+	}{
+		{"bus", program(ucode.ARO | ucode.XRO | ucode.OUT | ucode.IE), 2},
+		{"floating", program(ucode.OUT | ucode.IE), 2},
+		{"conflict", program(ucode.ARO | ucode.ARI | ucode.IE), 2},
+		{"end", program(ucode.ARO | ucode.OUT), 2},
+		{"unreachable", program(ucode.IE, ucode.ARO|ucode.OUT), 3},
+		{"fetch", []ucode.Signal{ucode.PCO | ucode.RORI, ucode.ROMO | ucode.II, ucode.IE}, 1},
+	}
+	tested := map[string]bool{}
+	for _, tt := range tests {
+		tested[tt.rule] = true
+		t.Run(tt.rule, func(t *testing.T) {
+			violations := ucode.Check([][]ucode.Signal{tt.prog}, []string{"TEST"})
+			if 1 != len(violations) {
+				t.Fatalf("violations: got %v, want one %s", violations, tt.rule)
+			}
+			v := violations[0]
+			if tt.rule != v.Rule || tt.step != v.Step || 0 != v.Opcode || "TEST" != v.Name {
+				t.Errorf("violation: got %+v, want %s at TEST step %d", v, tt.rule, tt.step)
+			}
+		})
+	}
+	for rule := range ucode.VerifyRules {
+		if !tested[rule] {
+			t.Errorf("no case for rule %s", rule)
+		}
+	}
+
+	// an operation that runs until the step counter wraps needs no IE
+	slop := program(make([]ucode.Signal, ucode.Steps-2)...)
+	if violations := ucode.Check([][]ucode.Signal{slop}, nil); 0 != len(violations) {
+		t.Errorf("wrapping operation: %v", violations)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	violations, err := ucode.Verify(ops())
+	if nil != err {
+		t.Fatalf("verify: %s", err)
+	}
+	for _, v := range violations {
+		t.Errorf("%s", v)
+	}
+	if _, err = ucode.Verify([]string{"NOPE"}); nil == err {
+		t.Errorf("verified an unknown operation")
+	}
+}
@@ -0,0 +1,331 @@
+// EEPROM programmer firmware for bcc flash.
+//
+// Speaks the line protocol documented in compiler/pkg/flash at 115200 baud:
+// I, R, W, V and E commands, each answered by one "OK ..." or "ERR ..."
+// line. Numbers are hex, data is a hex string.
+//
+// Wiring is the usual breadboard programmer on an Arduino Uno or Nano
+// (ATmega328P):
+//
+//   pin 2       74HC595 serial data (SER)
+//   pin 3       74HC595 shift clock (SRCLK)
+//   pin 4       74HC595 latch clock (RCLK)
+//   pins 5-12   EEPROM D0-D7
+//   pin 13      EEPROM ~WE
+//
+// Two chained 74HC595s drive A0-A14 and the top bit of the high register
+// drives ~OE; ~CE is tied low. The pins are driven through the port
+// registers rather than digitalWrite so a 64 byte page loads within the
+// EEPROM's byte load window.
+//
+// Set PART to the EEPROM in the socket. Parts shipped with software data
+// protection enabled must have it disabled before they accept writes.
+
+// the most bytes a command carries
+#define BLOCK 64
+
+// the EEPROM's write cycle time
+#define WRITE_CYCLE_MS 10
+
+struct part {
+  const char *name;
+  unsigned int size;
+  unsigned int page;
+};
+
+// the 28C16 is written a byte at a time
+const part PARTS[] = {
+  {"28C16", 0x0800, 1},
+  {"28C64", 0x2000, 64},
+  {"28C256", 0x8000, 64},
+};
+
+enum { P28C16, P28C64, P28C256 };
+
+// the EEPROM in the socket
+#define PART P28C256
+
+const part &eeprom = PARTS[PART];
+
+// a command line: "W addr data" is the longest
+char line[2 * BLOCK + 16];
+int lineLen = 0;
+bool overflow = false;
+
+byte data[BLOCK];
+
+void setup() {
+  // ~WE high before it becomes an output
+  PORTB |= _BV(5);
+  DDRB |= _BV(5);
+  DDRD |= _BV(2) | _BV(3) | _BV(4);
+  dataInput();
+  setAddress(0, false);
+  Serial.begin(115200);
+}
+
+void loop() {
+  while (Serial.available()) {
+    char c = Serial.read();
+    if ('\n' != c && '\r' != c) {
+      if (lineLen < (int)sizeof(line) - 1) {
+        line[lineLen++] = c;
+      } else {
+        overflow = true;
+      }
+      continue;
+    }
+    line[lineLen] = 0;
+    if (overflow) {
+      Serial.println("ERR line too long");
+    } else if (0 < lineLen) {
+      exec(line);
+    }
+    lineLen = 0;
+    overflow = false;
+  }
+}
+
+// exec runs one command and prints the reply.
+void exec(char *cmd) {
+  char *name = strtok(cmd, " ");
+  if (NULL == name) {
+    return;
+  }
+  char *args[3];
+  int nargs = 0;
+  for (char *arg = strtok(NULL, " "); NULL != arg; arg = strtok(NULL, " ")) {
+    if (nargs == 3) {
+      nargs++;
+      break;
+    }
+    args[nargs++] = arg;
+  }
+  char reply[24];
+  unsigned int addr, n;
+  int len;
+
+  // I: OK part size pagesize
+  if (0 == strcmp("I", name) && 0 == nargs) {
+    sprintf(reply, "OK %s %X %X", eeprom.name, eeprom.size, eeprom.page);
+    Serial.println(reply);
+    return;
+  }
+
+  // R addr n: OK data
+  if (0 == strcmp("R", name) && 2 == nargs) {
+    if (!parseNumber(args[0], &addr) || !parseNumber(args[1], &n)) {
+      Serial.println("ERR bad number");
+      return;
+    }
+    if (n > BLOCK || (unsigned long)addr + n > eeprom.size) {
+      Serial.println("ERR bad range");
+      return;
+    }
+    Serial.print("OK ");
+    for (unsigned int k = 0; k < n; k++) {
+      printHex(readByte(addr + k));
+    }
+    Serial.println();
+    return;
+  }
+
+  // W addr data: OK
+  if (0 == strcmp("W", name) && 2 == nargs) {
+    if (!parseNumber(args[0], &addr)) {
+      Serial.println("ERR bad number");
+      return;
+    }
+    len = parseData(args[1], data);
+    if (len <= 0) {
+      Serial.println("ERR bad data");
+      return;
+    }
+    if ((unsigned long)addr + len > eeprom.size || addr / BLOCK != (addr + len - 1) / BLOCK) {
+      Serial.println("ERR bad range");
+      return;
+    }
+    writeData(addr, data, len);
+    Serial.println("OK");
+    return;
+  }
+
+  // V addr data: OK, or ERR mismatch at addr
+  if (0 == strcmp("V", name) && 2 == nargs) {
+    if (!parseNumber(args[0], &addr)) {
+      Serial.println("ERR bad number");
+      return;
+    }
+    len = parseData(args[1], data);
+    if (len <= 0) {
+      Serial.println("ERR bad data");
+      return;
+    }
+    if ((unsigned long)addr + len > eeprom.size) {
+      Serial.println("ERR bad range");
+      return;
+    }
+    for (int k = 0; k < len; k++) {
+      if (data[k] != readByte(addr + k)) {
+        sprintf(reply, "ERR mismatch at %04X", addr + k);
+        Serial.println(reply);
+        return;
+      }
+    }
+    Serial.println("OK");
+    return;
+  }
+
+  // E: OK once every cell reads 0xFF
+  if (0 == strcmp("E", name) && 0 == nargs) {
+    memset(data, 0xFF, BLOCK);
+    for (unsigned long block = 0; block < eeprom.size; block += BLOCK) {
+      if (!erased(block)) {
+        writeData(block, data, BLOCK);
+      }
+    }
+    Serial.println("OK");
+    return;
+  }
+
+  Serial.print("ERR unknown command ");
+  Serial.println(name);
+}
+
+// parseNumber parses a hex number of at most 4 digits.
+bool parseNumber(const char *s, unsigned int *n) {
+  char *end;
+  if (0 == strlen(s) || 4 < strlen(s)) {
+    return false;
+  }
+  *n = strtoul(s, &end, 16);
+  return 0 == *end;
+}
+
+// parseData decodes a hex string into buf and returns its length, or -1.
+int parseData(const char *s, byte *buf) {
+  int len = strlen(s);
+  if (0 != len % 2 || len > 2 * BLOCK) {
+    return -1;
+  }
+  for (int k = 0; k < len; k += 2) {
+    int hi = hexDigit(s[k]);
+    int lo = hexDigit(s[k + 1]);
+    if (hi < 0 || lo < 0) {
+      return -1;
+    }
+    buf[k / 2] = hi << 4 | lo;
+  }
+  return len / 2;
+}
+
+int hexDigit(char c) {
+  if ('0' <= c && c <= '9') {
+    return c - '0';
+  }
+  if ('A' <= c && c <= 'F') {
+    return c - 'A' + 10;
+  }
+  if ('a' <= c && c <= 'f') {
+    return c - 'a' + 10;
+  }
+  return -1;
+}
+
+void printHex(byte b) {
+  const char digits[] = "0123456789ABCDEF";
+  Serial.write(digits[b >> 4]);
+  Serial.write(digits[b & 0x0F]);
+}
+
+// setAddress shifts an address into the 74HC595s, the high byte first, and
+// latches it. ~OE is the top bit.
+void setAddress(unsigned int addr, bool outputEnable) {
+  unsigned int word = addr & 0x7FFF;
+  if (!outputEnable) {
+    word |= 0x8000;
+  }
+  for (int bit = 15; bit >= 0; bit--) {
+    if (word & (1u << bit)) {
+      PORTD |= _BV(2);
+    } else {
+      PORTD &= ~_BV(2);
+    }
+    PORTD |= _BV(3);
+    PORTD &= ~_BV(3);
+  }
+  PORTD |= _BV(4);
+  PORTD &= ~_BV(4);
+}
+
+// D0-D2 are PD5-PD7, D3-D7 are PB0-PB4.
+void dataInput() {
+  DDRD &= ~0xE0;
+  DDRB &= ~0x1F;
+  PORTD &= ~0xE0;
+  PORTB &= ~0x1F;
+}
+
+void dataOutput() {
+  DDRD |= 0xE0;
+  DDRB |= 0x1F;
+}
+
+void putData(byte b) {
+  PORTD = (PORTD & 0x1F) | ((b << 5) & 0xE0);
+  PORTB = (PORTB & 0xE0) | (b >> 3);
+}
+
+byte getData() {
+  return ((PIND >> 5) & 0x07) | ((PINB & 0x1F) << 3);
+}
+
+byte readByte(unsigned int addr) {
+  dataInput();
+  setAddress(addr, true);
+  delayMicroseconds(1);
+  return getData();
+}
+
+// erased returns whether every cell of a block reads 0xFF.
+bool erased(unsigned int addr) {
+  for (int k = 0; k < BLOCK; k++) {
+    if (0xFF != readByte(addr + k)) {
+      return false;
+    }
+  }
+  return true;
+}
+
+// writeData writes bytes a page at a time.
+void writeData(unsigned int addr, const byte *buf, int n) {
+  while (0 < n) {
+    int size = eeprom.page - addr % eeprom.page;
+    if (size > n) {
+      size = n;
+    }
+    writePage(addr, buf, size);
+    addr += size;
+    buf += size;
+    n -= size;
+  }
+}
+
+// writePage loads bytes that share a page and waits out the write cycle.
+// Interrupts are held off so no byte misses the load window.
+void writePage(unsigned int addr, const byte *buf, int n) {
+  dataInput();
+  setAddress(addr, false);
+  dataOutput();
+  noInterrupts();
+  for (int k = 0; k < n; k++) {
+    setAddress(addr + k, false);
+    putData(buf[k]);
+    PORTB &= ~_BV(5);
+    delayMicroseconds(1);
+    PORTB |= _BV(5);
+  }
+  interrupts();
+  dataInput();
+  delay(WRITE_CYCLE_MS);
+}